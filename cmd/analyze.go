@@ -4,11 +4,19 @@ import (
 	"fmt"
 
 	"github.com/iyuangang/gpgenie/internal/app"
+	"github.com/iyuangang/gpgenie/internal/repository"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+var (
+	analyzeRunID  uint
+	analyzeAlgo   string
+	analyzeWindow string
+	analyzeRarest int
+)
+
 var AnalyzeCmd = &cobra.Command{
 	Use:   "analyze",
 	Short: "analyze key data",
@@ -20,7 +28,11 @@ var AnalyzeCmd = &cobra.Command{
 			return fmt.Errorf("failed to get app instance")
 		}
 
-		if err := appInstance.KeyService.AnalyzeData(); err != nil {
+		window, err := scoreWindowFilter(analyzeWindow)
+		if err != nil {
+			return err
+		}
+		if err := appInstance.KeyService.AnalyzeData(repository.KeyFilter{RunID: analyzeRunID, Algorithm: analyzeAlgo, ScoreWindow: window}, analyzeRarest); err != nil {
 			return fmt.Errorf("analyze key data: %w", err)
 		}
 
@@ -31,4 +43,9 @@ var AnalyzeCmd = &cobra.Command{
 
 func init() {
 	RootCmd.AddCommand(AnalyzeCmd)
+
+	AnalyzeCmd.Flags().UintVar(&analyzeRunID, "run", 0, "only analyze keys from this generation run")
+	AnalyzeCmd.Flags().StringVar(&analyzeAlgo, "algorithm", "", "only analyze keys of this algorithm, e.g. ed25519, rsa4096, or ecdsa")
+	AnalyzeCmd.Flags().IntVar(&analyzeRarest, "rarest", 10, "list this many keys ranked by rarity; 0 disables the list")
+	AnalyzeCmd.Flags().StringVar(&analyzeWindow, "window", "", "only analyze keys scored over this scoring window: short, long, full, or OFFSET:LENGTH")
 }
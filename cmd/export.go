@@ -39,7 +39,7 @@ var ExportCmd = &cobra.Command{
 func init() {
 	RootCmd.AddCommand(ExportCmd)
 
-	ExportCmd.Flags().StringVarP(&exportFingerprint, "fingerprint", "f", "", "the last 16 digits of the fingerprint (required)")
+	ExportCmd.Flags().StringVarP(&exportFingerprint, "fingerprint", "f", "", "the full v4 or v6 fingerprint, its last 16 digits, or the leading 16 of a v6 one (required)")
 	err := ExportCmd.MarkFlagRequired("fingerprint")
 	if err != nil {
 		log.Errorf("failed to set fingerprint flag: %v", err)
@@ -1,17 +1,39 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/iyuangang/gpgenie/internal/app"
+	"github.com/iyuangang/gpgenie/internal/key/service"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var (
-	totalKeys int
-	batchSize int
+	totalKeys        int
+	batchSize        int
+	resumeRunID      uint
+	generateStrategy string
+	generateWindow   string
+	generatePatterns []string
+	generateAlgo     string
+	generateRSABits  int
+	generateCurve    string
+	grindWindow      int
+	generateVersion  int
+	generateInterval time.Duration
+	generateMetrics  string
+	generateDuration time.Duration
+	generateUntil    string
+	generateMaxRate  float64
+	generateConflict string
+	generateKeepTop  int
+	generateAccept   string
+	generateShards   int
+	shardSocket      string
 )
 
 var GenerateCmd = &cobra.Command{
@@ -42,12 +64,99 @@ var GenerateCmd = &cobra.Command{
 		// update config
 		appInstance.Config.KeyGeneration.TotalKeys = totalKeys
 		appInstance.Config.KeyGeneration.BatchSize = batchSize
+		if cmd.Flags().Changed("strategy") {
+			appInstance.Config.Scoring.Strategy = generateStrategy
+		}
+		if cmd.Flags().Changed("window") {
+			appInstance.Config.Scoring.Window = generateWindow
+		}
+		if cmd.Flags().Changed("pattern") {
+			appInstance.Config.KeyGeneration.Patterns = generatePatterns
+		}
+		if cmd.Flags().Changed("algorithm") {
+			// size settings from the config belong to the configured algorithm
+			appInstance.Config.KeyGeneration.Algorithm = generateAlgo
+			appInstance.Config.KeyGeneration.RSABits = 0
+			appInstance.Config.KeyGeneration.Curve = ""
+		}
+		if cmd.Flags().Changed("rsa-bits") {
+			appInstance.Config.KeyGeneration.RSABits = generateRSABits
+		}
+		if cmd.Flags().Changed("curve") {
+			appInstance.Config.KeyGeneration.Curve = generateCurve
+		}
+		if cmd.Flags().Changed("key-version") {
+			appInstance.Config.KeyGeneration.KeyVersion = generateVersion
+		}
+		if cmd.Flags().Changed("grind-window") {
+			appInstance.Config.KeyGeneration.GrindWindow = grindWindow
+		}
+		if cmd.Flags().Changed("keep-top") {
+			appInstance.Config.KeyGeneration.KeepTop = generateKeepTop
+		}
+		if cmd.Flags().Changed("accept") {
+			appInstance.Config.KeyGeneration.Accept = generateAccept
+		}
+		if cmd.Flags().Changed("on-conflict") {
+			appInstance.Config.KeyGeneration.OnConflict = generateConflict
+		}
 
-		if err := appInstance.KeyService.GenerateKeys(cmd.Context()); err != nil {
+		deadline, err := generateDeadline(time.Now(), generateDuration, generateUntil)
+		if err != nil {
+			return err
+		}
+		if generateMaxRate < 0 {
+			return fmt.Errorf("--max-rate must not be negative")
+		}
+
+		registry, stopMetrics, err := startMetricsServer(generateMetrics, cmd.OutOrStdout())
+		if err != nil {
+			return err
+		}
+		defer stopMetrics()
+
+		abort, stopAbort := abortOnSecondSignal(cmd.Context())
+		defer stopAbort()
+
+		if generateShards < 0 {
+			return fmt.Errorf("--shards must not be negative")
+		}
+
+		display := newProgressDisplay(cmd.OutOrStdout())
+		options := service.GenerateOptions{
+			ResumeRunID:      resumeRunID,
+			Profile:          appInstance.Config.Profile,
+			Metrics:          registry,
+			Deadline:         deadline,
+			MaxRate:          generateMaxRate,
+			Abort:            abort,
+			ProgressInterval: generateInterval,
+			Progress: func(progress service.Progress) {
+				display.Update(formatGenerateProgress(progress), progress.Final)
+			},
+		}
+		var summary *service.GenerateSummary
+		if generateShards > 0 {
+			summary, err = generateSharded(cmd.Context(), appInstance.KeyService, options, appInstance.Config.Logging.LogLevel)
+		} else {
+			summary, err = appInstance.KeyService.GenerateKeys(cmd.Context(), options)
+		}
+		display.Close()
+		if err != nil {
+			if summary != nil {
+				log.Infof("run %d stopped: generated=%d accepted=%d saved=%d (flushed while stopping: %d); continue with --resume %d",
+					summary.RunID, summary.Generated, summary.Accepted, summary.Saved, summary.Drained, summary.RunID)
+			}
 			return fmt.Errorf("generate keys: %w", err)
 		}
 
-		log.Info("keys generated successfully.")
+		if summary.DeadlineReached {
+			log.Infof("run %d reached its time limit: generated=%d accepted=%d saved=%d (flushed while stopping: %d); continue with --resume %d",
+				summary.RunID, summary.Generated, summary.Accepted, summary.Saved, summary.Drained, summary.RunID)
+			return nil
+		}
+		log.Infof("keys generated successfully: run=%d generated=%d accepted=%d saved=%d (inserted=%d updated=%d skipped=%d evicted=%d)",
+			summary.RunID, summary.Generated, summary.Accepted, summary.Saved, summary.Inserted, summary.Updated, summary.Skipped, summary.Evicted)
 		return nil
 	},
 }
@@ -58,4 +167,51 @@ func init() {
 	// 设置默认值为0，这样可以判断是否使用配置文件的值
 	GenerateCmd.Flags().IntVarP(&totalKeys, "total", "t", 0, "the total number of keys to generate (default from config if not specified)")
 	GenerateCmd.Flags().IntVarP(&batchSize, "batch", "b", 0, "the number of keys to insert in batches (default from config if not specified)")
+	GenerateCmd.Flags().StringVar(&generateStrategy, "strategy", "", "scoring strategy (default from config if not specified)")
+	GenerateCmd.Flags().StringVar(&generateWindow, "window", "", "fingerprint digits to score: short (last 8), long (last 16), full, or OFFSET:LENGTH with a negative OFFSET counting from the end (default from config, else long)")
+	GenerateCmd.Flags().StringArrayVar(&generatePatterns, "pattern", nil, "accept fingerprints matching this target: ...C0FFEE, C0FFEE..., ????DEAD????BEEF, or re:<regexp> (repeatable; default from config)")
+	GenerateCmd.Flags().StringVar(&generateAlgo, "algorithm", "", "key algorithm: ed25519, ed448, rsa, or ecdsa (default from config if not specified)")
+	GenerateCmd.Flags().IntVar(&generateRSABits, "rsa-bits", 0, "RSA modulus size: 2048, 3072, or 4096 (default 3072)")
+	GenerateCmd.Flags().StringVar(&generateCurve, "curve", "", "ECDSA curve: p256, p384, p521, brainpoolp256, brainpoolp384, or brainpoolp512 (default p256)")
+	GenerateCmd.Flags().IntVar(&generateVersion, "key-version", 0, "OpenPGP key version: 4, or 6 for RFC 9580 Ed25519 keys with SHA-256 fingerprints (default from config, else 4)")
+	GenerateCmd.Flags().IntVar(&grindWindow, "grind-window", 0, "score this many creation timestamps per Ed25519 key instead of generating a key per candidate (default from config if not specified)")
+	GenerateCmd.Flags().DurationVar(&generateInterval, "progress-interval", 5*time.Second, "progress reporting interval")
+	GenerateCmd.Flags().StringVar(&generateMetrics, "metrics-addr", "", "serve Prometheus metrics at this address, e.g. :9090 (disabled if empty)")
+	GenerateCmd.Flags().StringVar(&generateAccept, "accept", "", "accept keys for which this expression holds, e.g. 'score >= 300 || (unique <= 4 && repeat > 0)'; replaces the min_score and max_letters_count rules; pattern hits are always accepted (default from config if not specified)")
+	GenerateCmd.Flags().IntVar(&generateKeepTop, "keep-top", 0, "keep only the N best-scoring keys in the database, evicting displaced ones; replaces min_score and max_letters_count (default from config if not specified)")
+	GenerateCmd.Flags().StringVar(&generateConflict, "on-conflict", "", "what to do with keys whose fingerprint is already stored: skip, update, or fail (default from config, else skip)")
+	GenerateCmd.Flags().DurationVar(&generateDuration, "duration", 0, "stop issuing candidates after this long, save what is in flight, and leave the run resumable")
+	GenerateCmd.Flags().StringVar(&generateUntil, "until", "", "stop like --duration at this time: RFC 3339 or a local HH:MM clock time")
+	GenerateCmd.Flags().Float64Var(&generateMaxRate, "max-rate", 0, "cap the candidates issued per second (0 means unlimited)")
+	GenerateCmd.Flags().IntVar(&generateShards, "shards", 0, "run the generation in this many worker processes coordinated over a local socket (0 runs in this process)")
+	GenerateCmd.Flags().StringVar(&shardSocket, "shard-socket", "", "with --shards, listen on this Unix socket so more workers can join with `gpgenie shard-worker --connect PATH` (default: a temporary socket)")
+	GenerateCmd.Flags().UintVar(&resumeRunID, "resume", 0, "continue an unfinished generation run toward its remaining target")
+}
+
+// generateSharded runs the generation as a coordinator of generateShards
+// worker processes started from this executable.
+func generateSharded(ctx context.Context, keyService service.KeyService, opts service.GenerateOptions, logLevel string) (*service.GenerateSummary, error) {
+	listener, socket, cleanup, err := shardListener(shardSocket)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	defer listener.Close()
+	// Workers log every slice; keep them quiet unless debugging.
+	workerLogLevel := "warn"
+	if logLevel == "debug" {
+		workerLogLevel = logLevel
+	}
+	processes, err := newShardProcesses(socket, workerLogLevel)
+	if err != nil {
+		return nil, err
+	}
+	defer processes.wait(shardExitTimeout)
+
+	log.Infof("coordinating %d shards on %s", generateShards, socket)
+	return keyService.GenerateSharded(ctx, opts, service.ShardOptions{
+		Listener: listener,
+		Shards:   generateShards,
+		Spawn:    processes.spawn,
+	})
 }
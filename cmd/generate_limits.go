@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+)
+
+// untilClockLayout is the short --until form: a wall-clock time today, or
+// tomorrow if that time has already passed.
+const untilClockLayout = "15:04"
+
+// generateDeadline combines --duration and --until into one deadline. When
+// both are set, the earlier one wins. A zero result means no deadline.
+func generateDeadline(now time.Time, duration time.Duration, until string) (time.Time, error) {
+	if duration < 0 {
+		return time.Time{}, fmt.Errorf("--duration must not be negative")
+	}
+	var deadline time.Time
+	if duration > 0 {
+		deadline = now.Add(duration)
+	}
+	if until == "" {
+		return deadline, nil
+	}
+	at, err := parseUntil(now, until)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if deadline.IsZero() || at.Before(deadline) {
+		deadline = at
+	}
+	return deadline, nil
+}
+
+// parseUntil accepts an RFC 3339 timestamp or a local HH:MM clock time.
+func parseUntil(now time.Time, value string) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		if !at.After(now) {
+			return time.Time{}, fmt.Errorf("--until %s is in the past", value)
+		}
+		return at, nil
+	}
+	clock, err := time.ParseInLocation(untilClockLayout, value, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --until %q: use RFC 3339 or HH:MM", value)
+	}
+	at := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !at.After(now) {
+		at = at.AddDate(0, 0, 1)
+	}
+	return at, nil
+}
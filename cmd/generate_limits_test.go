@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateDeadline(t *testing.T) {
+	now := time.Date(2024, 5, 1, 22, 30, 0, 0, time.UTC)
+
+	deadline, err := generateDeadline(now, 0, "")
+	require.NoError(t, err)
+	assert.True(t, deadline.IsZero())
+
+	deadline, err = generateDeadline(now, 90*time.Minute, "")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(90*time.Minute), deadline)
+
+	deadline, err = generateDeadline(now, 0, "23:00")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC), deadline)
+
+	deadline, err = generateDeadline(now, 0, "06:15")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 2, 6, 15, 0, 0, time.UTC), deadline, "a passed clock time means tomorrow")
+
+	deadline, err = generateDeadline(now, 10*time.Minute, "2024-05-02T00:00:00Z")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(10*time.Minute), deadline, "the earlier limit wins")
+
+	_, err = generateDeadline(now, 0, "2024-05-01T00:00:00Z")
+	assert.ErrorContains(t, err, "in the past")
+	_, err = generateDeadline(now, 0, "tonight")
+	assert.ErrorContains(t, err, "invalid --until")
+	_, err = generateDeadline(now, -time.Second, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/iyuangang/gpgenie/internal/key/service"
+)
+
+func formatGenerateProgress(progress service.Progress) string {
+	line := fmt.Sprintf(
+		"generate run=%d generated=%s/%s accepted=%s saved=%s rate=%s accept=%s save=%s queue=%d/%d,%d/%d time=%s",
+		progress.RunID,
+		formatMetric(progress.Generated),
+		formatMetric(uint64(max(progress.TargetKeys, 0))),
+		formatMetric(progress.Accepted),
+		formatMetric(progress.Saved),
+		formatRate(progress.GenerateRate),
+		formatRate(progress.AcceptRate),
+		formatRate(progress.SaveRate),
+		progress.EntityQueue, progress.EntityCapacity,
+		progress.KeyQueue, progress.KeyCapacity,
+		progress.Elapsed.Round(time.Second),
+	)
+	switch {
+	case progress.Final:
+	case progress.ETA > 0:
+		line += " eta~" + formatSeconds(progress.ETA.Seconds())
+	case progress.GenerateRate <= 0:
+		line += " eta=warming-up"
+	}
+	return line
+}
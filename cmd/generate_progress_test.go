@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iyuangang/gpgenie/internal/key/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatGenerateProgress(t *testing.T) {
+	line := formatGenerateProgress(service.Progress{
+		RunID:          7,
+		TargetKeys:     1_000_000,
+		Generated:      250_000,
+		Accepted:       1_200,
+		Saved:          1_000,
+		GenerateRate:   12_500,
+		AcceptRate:     60,
+		SaveRate:       50,
+		EntityQueue:    3,
+		EntityCapacity: 12,
+		KeyQueue:       1,
+		KeyCapacity:    4,
+		Elapsed:        20 * time.Second,
+		ETA:            time.Minute,
+	})
+
+	assert.Contains(t, line, "run=7")
+	assert.Contains(t, line, "generated=250.000K/1.000M")
+	assert.Contains(t, line, "accepted=1.200K saved=1.000K")
+	assert.Contains(t, line, "rate=12.500K/s accept=60/s save=50/s")
+	assert.Contains(t, line, "queue=3/12,1/4")
+	assert.Contains(t, line, "time=20s")
+	assert.Contains(t, line, "eta~1.0m")
+
+	warming := formatGenerateProgress(service.Progress{TargetKeys: 10})
+	assert.Contains(t, warming, "rate=warming-up")
+	assert.Contains(t, warming, "eta=warming-up")
+
+	final := formatGenerateProgress(service.Progress{TargetKeys: 10, Generated: 10, GenerateRate: 5, Final: true})
+	assert.NotContains(t, final, "eta")
+}
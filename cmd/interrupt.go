@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// abortOnSecondSignal returns a channel that is closed when SIGINT or SIGTERM
+// arrives after ctx has been canceled by the first one. The first signal lets
+// a command drain; the second aborts it. Call stop to release the handler.
+func abortOnSecondSignal(ctx context.Context) (abort <-chan struct{}, stop func()) {
+	aborted := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(signals)
+		log.Warnf("interrupted: saving keys in flight; press Ctrl-C again to abort")
+		select {
+		case <-signals:
+			close(aborted)
+		case <-done:
+		}
+	}()
+	return aborted, func() { close(done) }
+}
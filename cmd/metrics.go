@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/iyuangang/gpgenie/internal/metrics"
+)
+
+// startMetricsServer serves a new registry at addr/metrics. An empty addr
+// disables metrics and returns a nil registry, which instrumented code treats
+// as a no-op.
+func startMetricsServer(addr string, output io.Writer) (*metrics.Registry, func(), error) {
+	if addr == "" {
+		return nil, func() {}, nil
+	}
+	registry := metrics.NewRegistry()
+	server, err := metrics.Serve(addr, registry)
+	if err != nil {
+		return nil, nil, fmt.Errorf("start metrics server: %w", err)
+	}
+	fmt.Fprintf(output, "metrics available at http://%s/metrics\n", server.Addr())
+	return registry, func() {
+		if err := server.Close(); err != nil {
+			log.Warnf("stop metrics server: %v", err)
+		}
+	}, nil
+}
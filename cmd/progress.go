@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+type progressDisplay struct {
+	output io.Writer
+	inline bool
+	width  int
+	active bool
+}
+
+func newProgressDisplay(output io.Writer) *progressDisplay {
+	return &progressDisplay{
+		output: output,
+		inline: writerIsTerminal(output),
+	}
+}
+
+// Update redraws one terminal line. Redirected output keeps newline-delimited
+// snapshots so logs remain readable and do not contain carriage-return frames.
+func (d *progressDisplay) Update(line string, final bool) {
+	if !d.inline {
+		fmt.Fprintln(d.output, line)
+		return
+	}
+
+	padding := d.width - len(line)
+	if padding < 0 {
+		padding = 0
+	}
+	fmt.Fprintf(d.output, "\r%s%s", line, strings.Repeat(" ", padding))
+	d.width = len(line)
+	d.active = true
+	if final {
+		fmt.Fprintln(d.output)
+		d.width = 0
+		d.active = false
+	}
+}
+
+func (d *progressDisplay) Close() {
+	if d.inline && d.active {
+		fmt.Fprintln(d.output)
+		d.width = 0
+		d.active = false
+	}
+}
+
+func writerIsTerminal(output io.Writer) bool {
+	file, ok := output.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func formatMetric(value uint64) string {
+	switch {
+	case value >= 1_000_000_000_000_000_000:
+		return fmt.Sprintf("%.3fE", float64(value)/1_000_000_000_000_000_000)
+	case value >= 1_000_000_000_000_000:
+		return fmt.Sprintf("%.3fP", float64(value)/1_000_000_000_000_000)
+	case value >= 1_000_000_000_000:
+		return fmt.Sprintf("%.3fT", float64(value)/1_000_000_000_000)
+	case value >= 1_000_000_000:
+		return fmt.Sprintf("%.3fB", float64(value)/1_000_000_000)
+	case value >= 1_000_000:
+		return fmt.Sprintf("%.3fM", float64(value)/1_000_000)
+	case value >= 1_000:
+		return fmt.Sprintf("%.3fK", float64(value)/1_000)
+	default:
+		return fmt.Sprintf("%d", value)
+	}
+}
+
+func formatRate(rate float64) string {
+	if rate <= 0 {
+		return "warming-up"
+	}
+	return formatMetric(uint64(rate)) + "/s"
+}
+
+func formatSeconds(seconds float64) string {
+	const (
+		minute = 60
+		hour   = 60 * minute
+		day    = 24 * hour
+		year   = 365.25 * day
+	)
+	switch {
+	case math.IsNaN(seconds) || math.IsInf(seconds, 0) || seconds < 0:
+		return "unknown"
+	case seconds < minute:
+		return fmt.Sprintf("%.0fs", seconds)
+	case seconds < hour:
+		return fmt.Sprintf("%.1fm", seconds/minute)
+	case seconds < day:
+		return fmt.Sprintf("%.1fh", seconds/hour)
+	case seconds < year:
+		return fmt.Sprintf("%.1fd", seconds/day)
+	default:
+		return fmt.Sprintf("%.1fy", seconds/year)
+	}
+}
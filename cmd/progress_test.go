@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressDisplayRedrawsOneTerminalLine(t *testing.T) {
+	var output bytes.Buffer
+	display := &progressDisplay{output: &output, inline: true}
+	display.Update("progress: long", false)
+	display.Update("done", true)
+
+	assert.Equal(t, "\rprogress: long\rdone          \n", output.String())
+}
+
+func TestProgressDisplayUsesLinesWhenRedirected(t *testing.T) {
+	var output bytes.Buffer
+	display := &progressDisplay{output: &output}
+	display.Update("first", false)
+	display.Update("second", true)
+
+	assert.Equal(t, "first\nsecond\n", output.String())
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/iyuangang/gpgenie/internal/app"
+	"github.com/iyuangang/gpgenie/internal/repository"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	rescoreRunID     uint
+	rescoreBatchSize int
+	rescoreStrategy  string
+	rescoreWindow    string
+)
+
+var RescoreCmd = &cobra.Command{
+	Use:   "rescore",
+	Short: "recompute stored key scores",
+	Long: `Recompute the score columns of keys in the database with the configured
+scoring strategy, weights, and window. Use this after changing the scoring section so
+existing keys rank consistently with newly generated ones.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		appInterface := viper.Get("app")
+		appInstance, ok := appInterface.(*app.App)
+		if !ok {
+			return fmt.Errorf("failed to get app instance")
+		}
+
+		if cmd.Flags().Changed("strategy") {
+			appInstance.Config.Scoring.Strategy = rescoreStrategy
+		}
+		if cmd.Flags().Changed("window") {
+			appInstance.Config.Scoring.Window = rescoreWindow
+		}
+
+		updated, err := appInstance.KeyService.RescoreKeys(repository.KeyFilter{RunID: rescoreRunID}, rescoreBatchSize)
+		if err != nil {
+			return fmt.Errorf("rescore keys: %w", err)
+		}
+
+		log.Infof("rescored %d keys with strategy %s.", updated, appInstance.Config.Scoring.Strategy)
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(RescoreCmd)
+
+	RescoreCmd.Flags().UintVar(&rescoreRunID, "run", 0, "only rescore keys from this generation run")
+	RescoreCmd.Flags().IntVarP(&rescoreBatchSize, "batch", "b", 500, "the number of keys to update per transaction")
+	RescoreCmd.Flags().StringVar(&rescoreStrategy, "strategy", "", "scoring strategy (default from config if not specified)")
+	RescoreCmd.Flags().StringVar(&rescoreWindow, "window", "", "scoring window: short, long, full, or OFFSET:LENGTH (default from config if not specified)")
+}
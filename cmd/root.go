@@ -14,8 +14,10 @@ import (
 )
 
 var (
-	cfgFile string
-	log     *logger.Logger
+	cfgFile  string
+	sinkSpec string
+	profile  string
+	log      *logger.Logger
 )
 
 var RootCmd = &cobra.Command{
@@ -26,12 +28,15 @@ var RootCmd = &cobra.Command{
 	SilenceUsage:  true,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		// initialize app
-		appInstance, err := app.NewApp(cfgFile)
+		appInstance, err := app.NewAppWithOptions(app.Options{ConfigPath: cfgFile, Profile: profile, Sink: sinkSpec})
 		if err != nil {
 			return fmt.Errorf("initialize app: %w", err)
 		}
 
 		log.Debugf("using config file: %s", viper.ConfigFileUsed())
+		if appInstance.Config.Profile != "" {
+			log.Debugf("using config profile: %s", appInstance.Config.Profile)
+		}
 		viper.Set("app", appInstance)
 		return nil
 	},
@@ -59,6 +64,8 @@ func init() {
 	cobra.OnInitialize(initConfig)
 
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "config/config.json", "config file path")
+	RootCmd.PersistentFlags().StringVar(&profile, "profile", "", "merge this entry of the config profiles map over key_generation and vanity (default from the config profile key or GPGENIE_PROFILE)")
+	RootCmd.PersistentFlags().StringVar(&sinkSpec, "sink", "db", "key storage: db, jsonl:<file> (append-only, also readable by show, export, and analyze), or armor:<directory> (write-only)")
 
 	if err := viper.BindPFlag("config", RootCmd.PersistentFlags().Lookup("config")); err != nil {
 		fmt.Fprintf(os.Stderr, "failed to bind config flag: %v\n", err)
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/iyuangang/gpgenie/internal/config"
+	"github.com/iyuangang/gpgenie/internal/key/service"
+	"github.com/iyuangang/gpgenie/internal/logger"
+
+	"github.com/spf13/cobra"
+)
+
+// shardExitTimeout is how long generate waits for its shard processes to
+// exit after the run before killing them.
+const shardExitTimeout = 10 * time.Second
+
+var (
+	shardConnect  string
+	shardSpawned  bool
+	shardLogLevel string
+)
+
+// ShardWorkerCmd runs generation slices for a `generate --shards`
+// coordinator. It is started by the coordinator, or by hand with --connect to
+// add a worker to a coordinator listening on --shard-socket.
+var ShardWorkerCmd = &cobra.Command{
+	Use:    "shard-worker",
+	Short:  "run generation slices for a generate --shards coordinator",
+	Hidden: true,
+	// The coordinator sends the configuration and stores the keys, so the
+	// worker builds no app and opens no database.
+	PersistentPreRunE: func(*cobra.Command, []string) error { return nil },
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if shardConnect == "" {
+			return fmt.Errorf("--connect is required")
+		}
+		if shardSpawned {
+			// Ctrl-C reaches the whole process group; the coordinator
+			// decides how its shards stop.
+			signal.Ignore(syscall.SIGINT)
+		}
+		workerLog, err := logger.InitLogger(&config.LoggingConfig{LogLevel: shardLogLevel})
+		if err != nil {
+			return err
+		}
+		defer workerLog.SyncLogger()
+
+		conn, err := net.Dial("unix", shardConnect)
+		if err != nil {
+			return fmt.Errorf("connect to coordinator: %w", err)
+		}
+		err = service.ShardWorker{Logger: workerLog}.Serve(cmd.Context(), conn)
+		if errors.Is(err, context.Canceled) && cmd.Context().Err() != nil {
+			return nil
+		}
+		return err
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(ShardWorkerCmd)
+
+	ShardWorkerCmd.Flags().StringVar(&shardConnect, "connect", "", "coordinator socket path")
+	ShardWorkerCmd.Flags().BoolVar(&shardSpawned, "spawned", false, "the worker was started by the coordinator")
+	ShardWorkerCmd.Flags().StringVar(&shardLogLevel, "log-level", "info", "log level")
+}
+
+// shardListener listens on socket or, when it is empty, on a socket in a new
+// temporary directory. cleanup removes the temporary directory.
+func shardListener(socket string) (listener net.Listener, path string, cleanup func(), err error) {
+	cleanup = func() {}
+	if socket == "" {
+		dir, err := os.MkdirTemp("", "gpgenie-shards-")
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("create shard socket directory: %w", err)
+		}
+		cleanup = func() { _ = os.RemoveAll(dir) }
+		socket = filepath.Join(dir, "coordinator.sock")
+	}
+	listener, err = net.Listen("unix", socket)
+	if err != nil {
+		cleanup()
+		return nil, "", nil, fmt.Errorf("listen for shards: %w", err)
+	}
+	return listener, socket, cleanup, nil
+}
+
+// shardProcesses starts shard workers as child processes of this executable.
+type shardProcesses struct {
+	executable string
+	socket     string
+	logLevel   string
+	mu         sync.Mutex
+	running    map[int]*exec.Cmd
+	wg         sync.WaitGroup
+}
+
+func newShardProcesses(socket, logLevel string) (*shardProcesses, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("locate gpgenie executable: %w", err)
+	}
+	return &shardProcesses{
+		executable: executable,
+		socket:     socket,
+		logLevel:   logLevel,
+		running:    make(map[int]*exec.Cmd),
+	}, nil
+}
+
+// spawn is a service.ShardOptions.Spawn function.
+func (p *shardProcesses) spawn(shard int) error {
+	process := exec.Command(p.executable, "shard-worker", "--config", cfgFile, "--connect", p.socket, "--spawned", "--log-level", p.logLevel)
+	process.Stdout = os.Stdout
+	process.Stderr = os.Stderr
+	if err := process.Start(); err != nil {
+		return err
+	}
+	log.Debugf("started shard %d as pid %d", shard, process.Process.Pid)
+	p.mu.Lock()
+	p.running[shard] = process
+	p.mu.Unlock()
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		if err := process.Wait(); err != nil {
+			log.Warnf("shard %d (pid %d) exited: %v", shard, process.Process.Pid, err)
+		}
+		p.mu.Lock()
+		delete(p.running, shard)
+		p.mu.Unlock()
+	}()
+	return nil
+}
+
+// wait waits for every shard process to exit and kills those still running
+// after timeout.
+func (p *shardProcesses) wait(timeout time.Duration) {
+	exited := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+		return
+	case <-time.After(timeout):
+	}
+	p.mu.Lock()
+	for shard, process := range p.running {
+		log.Warnf("killing shard %d (pid %d), which did not exit", shard, process.Process.Pid)
+		_ = process.Process.Kill()
+	}
+	p.mu.Unlock()
+	<-exited
+}
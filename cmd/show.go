@@ -4,12 +4,20 @@ import (
 	"fmt"
 
 	"github.com/iyuangang/gpgenie/internal/app"
+	"github.com/iyuangang/gpgenie/internal/config"
+	"github.com/iyuangang/gpgenie/internal/repository"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-var displayCount int // the unified display count parameter
+var (
+	displayCount int  // the unified display count parameter
+	displayRunID uint // restricts listings to one generation run when non-zero
+	displayAlgo  string
+	// displayWindow restricts listings to keys scored over one scoring window.
+	displayWindow string
+)
 
 // ShowCmd the main command to display key information
 var ShowCmd = &cobra.Command{
@@ -30,8 +38,12 @@ var ShowTopCmd = &cobra.Command{
 			return fmt.Errorf("failed to get app instance")
 		}
 
+		window, err := scoreWindowFilter(displayWindow)
+		if err != nil {
+			return err
+		}
 		log.Debugf("display the highest %d keys", displayCount)
-		if err := appInstance.KeyService.ShowTopKeys(displayCount); err != nil {
+		if err := appInstance.KeyService.ShowTopKeys(displayCount, repository.KeyFilter{RunID: displayRunID, Algorithm: displayAlgo, ScoreWindow: window}); err != nil {
 			return fmt.Errorf("display high-scoring keys: %w", err)
 		}
 		return nil
@@ -50,14 +62,37 @@ var ShowMinimalKeysCmd = &cobra.Command{
 			return fmt.Errorf("failed to get app instance")
 		}
 
+		window, err := scoreWindowFilter(displayWindow)
+		if err != nil {
+			return err
+		}
 		log.Debugf("display the minimal %d keys", displayCount)
-		if err := appInstance.KeyService.ShowMinimalKeys(displayCount); err != nil {
+		if err := appInstance.KeyService.ShowMinimalKeys(displayCount, repository.KeyFilter{RunID: displayRunID, Algorithm: displayAlgo, ScoreWindow: window}); err != nil {
 			return fmt.Errorf("display minimal keys: %w", err)
 		}
 		return nil
 	},
 }
 
+// ShowRunsCmd the subcommand to display the generation run ledger
+var ShowRunsCmd = &cobra.Command{
+	Use:   "runs",
+	Short: "display generation runs",
+	Long:  `display the N most recent generate runs with their status and counters.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		appInterface := viper.Get("app")
+		appInstance, ok := appInterface.(*app.App)
+		if !ok {
+			return fmt.Errorf("failed to get app instance")
+		}
+
+		if err := appInstance.KeyService.ShowRuns(displayCount); err != nil {
+			return fmt.Errorf("display generation runs: %w", err)
+		}
+		return nil
+	},
+}
+
 func init() {
 	// add show command to root command
 	RootCmd.AddCommand(ShowCmd)
@@ -65,8 +100,31 @@ func init() {
 	// add subcommands to show command
 	ShowCmd.AddCommand(ShowTopCmd)
 	ShowCmd.AddCommand(ShowMinimalKeysCmd)
+	ShowCmd.AddCommand(ShowRunsCmd)
 
 	// add common -n flag to subcommands
 	ShowTopCmd.Flags().IntVarP(&displayCount, "count", "n", 10, "the number of keys to display")
 	ShowMinimalKeysCmd.Flags().IntVarP(&displayCount, "count", "n", 10, "the number of keys to display")
+	ShowRunsCmd.Flags().IntVarP(&displayCount, "count", "n", 10, "the number of runs to display")
+
+	ShowTopCmd.Flags().UintVar(&displayRunID, "run", 0, "only display keys from this generation run")
+	ShowMinimalKeysCmd.Flags().UintVar(&displayRunID, "run", 0, "only display keys from this generation run")
+
+	ShowTopCmd.Flags().StringVar(&displayAlgo, "algorithm", "", "only display keys of this algorithm, e.g. ed25519, rsa4096, or ecdsa")
+	ShowMinimalKeysCmd.Flags().StringVar(&displayAlgo, "algorithm", "", "only display keys of this algorithm, e.g. ed25519, rsa4096, or ecdsa")
+	ShowTopCmd.Flags().StringVar(&displayWindow, "window", "", "only display keys scored over this scoring window: short, long, full, or OFFSET:LENGTH")
+	ShowMinimalKeysCmd.Flags().StringVar(&displayWindow, "window", "", "only display keys scored over this scoring window: short, long, full, or OFFSET:LENGTH")
+}
+
+// scoreWindowFilter returns the canonical name of a --window filter, or ""
+// when the filter is not set.
+func scoreWindowFilter(spec string) (string, error) {
+	if spec == "" {
+		return "", nil
+	}
+	window, err := config.ParseScoringWindow(spec)
+	if err != nil {
+		return "", err
+	}
+	return window.String(), nil
 }
@@ -10,9 +10,10 @@ import (
 	"time"
 
 	"github.com/iyuangang/gpgenie/internal/app"
+	"github.com/iyuangang/gpgenie/internal/config"
+	"github.com/iyuangang/gpgenie/internal/key/domain"
 	"github.com/iyuangang/gpgenie/internal/key/service"
 	"github.com/iyuangang/gpgenie/internal/key/vanity"
-	"github.com/iyuangang/gpgenie/internal/repository"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -23,6 +24,11 @@ var (
 	vanityWorkers          int
 	vanityScope            string
 	vanityDigits           string
+	vanityPattern          string
+	vanityTargetsPath      string
+	vanityCollect          int
+	vanityKeyTarget        string
+	vanityAddSubkeys       string
 	vanityMaxAttempts      uint64
 	vanityTimestampWindow  time.Duration
 	vanityOutputDir        string
@@ -35,16 +41,18 @@ var (
 	vanityGPUKeyBatch      int
 	vanityGPUWorkItems     uint64
 	vanityListOpenCL       bool
+	vanityMetricsAddr      string
 )
 
 var VanityCmd = &cobra.Command{
 	Use:   "vanity",
 	Short: "mine a real OpenPGP vanity signing subkey",
 	Long: `Mine an Ed25519 OpenPGP signing subkey whose 16-digit long key ID
-contains a repeated hexadecimal run. The normal primary key is generated only
+contains a repeated hexadecimal run or matches --pattern. The normal primary key is generated only
 after a result is found and the private keyring is encrypted to the configured
-encryptor_public_key. The OpenCL backend uses every selected GPU concurrently
-and verifies every GPU winner again on the CPU.`,
+encryptor_public_key. With --target encryption-subkey a Curve25519 encryption
+subkey is mined instead, on the CPU backend. The OpenCL backend uses every
+selected GPU concurrently and verifies every GPU winner again on the CPU.`,
 	RunE: runVanity,
 }
 
@@ -67,6 +75,52 @@ func runVanity(cmd *cobra.Command, _ []string) error {
 		backendName = appInstance.Config.Vanity.Backend
 	}
 	backend := vanity.Backend(strings.ToLower(strings.TrimSpace(backendName)))
+	if vanityTargetsPath != "" {
+		for _, flag := range []string{"min-run", "scope", "digits", "pattern", "collect"} {
+			if cmd.Flags().Changed(flag) {
+				return fmt.Errorf("--targets cannot be combined with --%s", flag)
+			}
+		}
+		// Targets are matched on the CPU only.
+		if backend == vanity.BackendAuto {
+			backend = vanity.BackendCPU
+		}
+	}
+	keyringOptions := vanity.KeyringOptions{Kind: vanity.KeyKind(strings.ToLower(strings.TrimSpace(vanityKeyTarget)))}
+	if err := vanity.ParseAdditionalSubkeys(vanityAddSubkeys, &keyringOptions); err != nil {
+		return fmt.Errorf("invalid --add-subkeys: %w", err)
+	}
+	if err := keyringOptions.Validate(); err != nil {
+		return fmt.Errorf("invalid --target: %w", err)
+	}
+	// Encryption subkeys are mined on the CPU only.
+	if keyringOptions.Kind == vanity.KeyKindEncryptionSubkey && backend == vanity.BackendAuto {
+		backend = vanity.BackendCPU
+	}
+	if vanityCollect < 0 {
+		return fmt.Errorf("collect must not be negative")
+	}
+	// Collecting searches run on the CPU only.
+	if vanityCollect > 0 && backend == vanity.BackendAuto {
+		backend = vanity.BackendCPU
+	}
+	var pattern *vanity.Pattern
+	if vanityPattern != "" {
+		for _, flag := range []string{"min-run", "scope", "digits"} {
+			if cmd.Flags().Changed(flag) {
+				return fmt.Errorf("--pattern cannot be combined with --%s", flag)
+			}
+		}
+		parsed, err := vanity.ParsePattern(vanityPattern)
+		if err != nil {
+			return fmt.Errorf("invalid --pattern: %w", err)
+		}
+		pattern = parsed
+		// Patterns are matched on the CPU only.
+		if backend == vanity.BackendAuto {
+			backend = vanity.BackendCPU
+		}
+	}
 	deviceSelection := vanityOpenCLDevices
 	if !cmd.Flags().Changed("gpu-devices") && appInstance.Config.Vanity.OpenCLDevices != "" {
 		deviceSelection = appInstance.Config.Vanity.OpenCLDevices
@@ -110,6 +164,9 @@ func runVanity(cmd *cobra.Command, _ []string) error {
 	if !cmd.Flags().Changed("min-run") && appInstance.Config.Vanity.MinRun != 0 {
 		minRun = appInstance.Config.Vanity.MinRun
 	}
+	if pattern != nil {
+		minRun = pattern.Length()
+	}
 	if minRun < 1 || minRun > 16 {
 		return fmt.Errorf("min-run must be between 1 and 16")
 	}
@@ -126,6 +183,13 @@ func runVanity(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("invalid --digits: %w", err)
 	}
 	targetDigits := allowedDigits.String()
+	criteria := fmt.Sprintf("scope=%s digits=%s", scope, targetDigits)
+	if pattern != nil {
+		criteria = "pattern=" + pattern.String()
+	}
+	if keyringOptions.Kind != vanity.KeyKindSigningSubkey {
+		criteria += " target=" + string(keyringOptions.Kind)
+	}
 
 	now := time.Now().UTC().Truncate(time.Second)
 	start := now.Add(-vanityTimestampWindow)
@@ -138,6 +202,17 @@ func runVanity(cmd *cobra.Command, _ []string) error {
 	if checkpointPath == "" {
 		checkpointPath = filepath.Join(vanityOutputDir, "vanity-checkpoint.json")
 	}
+	if vanityTargetsPath != "" {
+		return runVanityWishlist(cmd, appInstance, vanity.SearchConfig{
+			Backend:          effectiveBackend,
+			Workers:          workers,
+			TimestampStart:   uint32(start.Unix()),
+			TimestampEnd:     uint32(now.Unix()),
+			MaxAttempts:      vanityMaxAttempts,
+			KeyKind:          keyringOptions.Kind,
+			ProgressInterval: vanityProgressInterval,
+		}, checkpointPath, primaryCreatedAt, keyringOptions, saveToDatabase)
+	}
 	checkpoint := &vanity.Checkpoint{}
 	if vanityResume {
 		loaded, err := vanity.LoadCheckpoint(checkpointPath)
@@ -157,18 +232,29 @@ func runVanity(cmd *cobra.Command, _ []string) error {
 		} else if parsed, parseErr := vanity.ParseDigits(checkpointDigits); parseErr == nil {
 			checkpointDigits = parsed.String()
 		}
-		if checkpointScope != scope || checkpointDigits != targetDigits {
+		checkpointCriteria := fmt.Sprintf("scope=%s digits=%s", checkpointScope, checkpointDigits)
+		if checkpoint.Pattern != "" {
+			checkpointCriteria = "pattern=" + checkpoint.Pattern
+		}
+		if checkpoint.KeyKind != "" && checkpoint.KeyKind != string(vanity.KeyKindSigningSubkey) {
+			checkpointCriteria += " target=" + checkpoint.KeyKind
+		}
+		if checkpointCriteria != criteria {
 			fmt.Fprintf(
 				cmd.OutOrStdout(),
-				"checkpoint criteria changed: scope=%s digits=%s -> scope=%s digits=%s; resetting counters and best (existing artifacts are preserved)\n",
-				checkpointScope, checkpointDigits, scope, targetDigits,
+				"checkpoint criteria changed: %s -> %s; resetting counters and best (existing artifacts are preserved)\n",
+				checkpointCriteria, criteria,
 			)
 			checkpoint = &vanity.Checkpoint{}
 		}
 	}
 	checkpoint.Scope = scope
 	checkpoint.TargetDigits = targetDigits
-	if checkpoint.BestRun >= minRun {
+	checkpoint.Pattern = pattern.String()
+	checkpoint.KeyKind = string(keyringOptions.Kind)
+	// A collecting search keeps mining past a checkpoint that already
+	// reached the target.
+	if checkpoint.BestRun >= minRun && vanityCollect == 0 {
 		if saveToDatabase && !checkpoint.SavedToDatabase {
 			artifacts, err := vanity.LoadArtifacts(
 				checkpoint.LatestPublicKeyPath,
@@ -178,14 +264,14 @@ func runVanity(cmd *cobra.Command, _ []string) error {
 			if err != nil {
 				return fmt.Errorf("reload checkpoint artifacts for database save: %w", err)
 			}
-			if err := saveVanityToDatabase(appInstance.Repository, artifacts); err != nil {
+			if err := saveVanityToDatabase(appInstance, artifacts); err != nil {
 				return err
 			}
 			checkpoint.SavedToDatabase = true
 			if err := vanity.SaveCheckpoint(checkpointPath, *checkpoint); err != nil {
 				return err
 			}
-			fmt.Fprintf(cmd.OutOrStdout(), "checkpoint vanity key saved to database: fingerprint=%s\n", artifacts.Metadata.SigningSubkeyFingerprint)
+			fmt.Fprintf(cmd.OutOrStdout(), "checkpoint vanity key saved to database: fingerprint=%s\n", artifacts.Metadata.MinedFingerprint())
 		}
 		fmt.Fprintf(cmd.OutOrStdout(), "checkpoint already contains run=%d key_id=%s\n", checkpoint.BestRun, checkpoint.BestKeyID)
 		return nil
@@ -197,20 +283,35 @@ func runVanity(cmd *cobra.Command, _ []string) error {
 	}
 	fmt.Fprintf(
 		cmd.OutOrStdout(),
-		"vanity search started: backend=%s cpu_workers=%d opencl_devices=%d scope=%s digits=%s target_run=%d save_db=%t timestamp_window=%s previous_attempts=%d\n",
+		"vanity search started: backend=%s cpu_workers=%d opencl_devices=%d %s target_run=%d save_db=%t timestamp_window=%s previous_attempts=%d\n",
 		effectiveBackend, cpuWorkers,
-		len(openCLDevices), scope, targetDigits, minRun, saveToDatabase, vanityTimestampWindow, checkpoint.Attempts,
+		len(openCLDevices), criteria, minRun, saveToDatabase, vanityTimestampWindow, checkpoint.Attempts,
 	)
 	for _, device := range openCLDevices {
 		fmt.Fprintf(cmd.OutOrStdout(), "OpenCL GPU [%d]: %s (%s), compute_units=%d memory=%.1fGiB driver=%s\n",
 			device.Index, device.Name, device.Platform, device.ComputeUnits,
 			float64(device.GlobalMemoryBytes)/(1024*1024*1024), device.DriverVersion)
 	}
-	fmt.Fprintf(
-		cmd.OutOrStdout(),
-		"key timestamps will span %s through %s; each additional repeated digit costs about 16x more work\n",
-		start.Format(time.RFC3339), now.Format(time.RFC3339),
-	)
+	expectedAttempts := expectedVanityAttempts(minRun, scope, allowedDigits, pattern)
+	if pattern != nil {
+		fmt.Fprintf(
+			cmd.OutOrStdout(),
+			"key timestamps will span %s through %s; the pattern matches one key ID in %.0f on average\n",
+			start.Format(time.RFC3339), now.Format(time.RFC3339), expectedAttempts,
+		)
+	} else {
+		fmt.Fprintf(
+			cmd.OutOrStdout(),
+			"key timestamps will span %s through %s; each additional repeated digit costs about 16x more work\n",
+			start.Format(time.RFC3339), now.Format(time.RFC3339),
+		)
+	}
+
+	registry, stopMetrics, err := startMetricsServer(vanityMetricsAddr, cmd.OutOrStdout())
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
 
 	searchConfig := vanity.SearchConfig{
 		Backend:          effectiveBackend,
@@ -221,20 +322,23 @@ func runVanity(cmd *cobra.Command, _ []string) error {
 		MinRun:           minRun,
 		Scope:            scope,
 		AllowedDigits:    allowedDigits,
+		Pattern:          pattern,
 		TimestampStart:   uint32(start.Unix()),
 		TimestampEnd:     uint32(now.Unix()),
 		MaxAttempts:      vanityMaxAttempts,
 		InitialAttempts:  checkpoint.Attempts,
 		InitialBestRun:   checkpoint.BestRun,
+		Collect:          vanityCollect,
+		KeyKind:          keyringOptions.Kind,
 		ProgressInterval: vanityProgressInterval,
+		Metrics:          registry,
 	}
-	progressDisplay := newVanityProgressDisplay(cmd.OutOrStdout())
-	expectedAttempts := expectedVanityAttempts(minRun, scope, allowedDigits)
-	progressDisplay.Update(formatVanityProgress(vanity.Progress{
+	display := newProgressDisplay(cmd.OutOrStdout())
+	display.Update(formatVanityProgress(vanity.Progress{
 		Attempts: checkpoint.Attempts,
 		BestRun:  checkpoint.BestRun,
 	}, minRun, checkpoint.BestKeyID, expectedAttempts), false)
-	defer progressDisplay.Close()
+	defer display.Close()
 
 	var checkpointErr error
 	result, searchErr := vanity.Search(cmd.Context(), searchConfig, func(progress vanity.Progress) {
@@ -249,7 +353,7 @@ func runVanity(cmd *cobra.Command, _ []string) error {
 		if bestKeyID == "" {
 			bestKeyID = checkpoint.BestKeyID
 		}
-		progressDisplay.Update(
+		display.Update(
 			formatVanityProgress(progress, minRun, bestKeyID, expectedAttempts),
 			progress.Final,
 		)
@@ -267,6 +371,12 @@ func runVanity(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("vanity search returned no result")
 	}
 
+	if vanityCollect > 0 {
+		return finishVanityCollect(
+			cmd, appInstance, result, searchErr, checkpoint, checkpointPath,
+			primaryCreatedAt, scope, targetDigits, pattern, keyringOptions, minRun, saveToDatabase,
+		)
+	}
 	if result.Candidate == nil {
 		fmt.Fprintf(
 			cmd.OutOrStdout(),
@@ -295,16 +405,18 @@ func runVanity(cmd *cobra.Command, _ []string) error {
 		result,
 		scope,
 		targetDigits,
+		pattern,
+		keyringOptions,
 		encryptor,
 	)
 	if err != nil {
-		return fmt.Errorf("finalize vanity signing key: %w", err)
+		return fmt.Errorf("finalize vanity key: %w", err)
 	}
 
 	checkpoint.Attempts = result.Attempts
 	checkpoint.BestRun = artifacts.Metadata.RunLength
-	checkpoint.BestKeyID = artifacts.Metadata.SigningKeyID
-	checkpoint.BestSigningFingerprint = artifacts.Metadata.SigningSubkeyFingerprint
+	checkpoint.BestKeyID = artifacts.Metadata.MinedKeyID()
+	checkpoint.BestSigningFingerprint = artifacts.Metadata.MinedFingerprint()
 	checkpoint.LatestPublicKeyPath = artifacts.PublicKeyPath
 	checkpoint.LatestEncryptedPrivatePath = artifacts.EncryptedPrivatePath
 	checkpoint.LatestMetadataPath = artifacts.MetadataPath
@@ -314,23 +426,32 @@ func runVanity(cmd *cobra.Command, _ []string) error {
 	}
 	targetReached := artifacts.Metadata.RunLength >= minRun
 	if saveToDatabase && targetReached {
-		if err := saveVanityToDatabase(appInstance.Repository, artifacts); err != nil {
+		if err := saveVanityToDatabase(appInstance, artifacts); err != nil {
 			return err
 		}
 		checkpoint.SavedToDatabase = true
 		if err := vanity.SaveCheckpoint(checkpointPath, *checkpoint); err != nil {
 			return err
 		}
-		fmt.Fprintf(cmd.OutOrStdout(), "database: saved encrypted vanity key fingerprint=%s\n", artifacts.Metadata.SigningSubkeyFingerprint)
+		fmt.Fprintf(cmd.OutOrStdout(), "database: saved encrypted vanity key fingerprint=%s\n", artifacts.Metadata.MinedFingerprint())
 	}
 
-	if targetReached {
-		fmt.Fprintf(cmd.OutOrStdout(), "vanity signing subkey ready: key_id=%s run=%d digit=%s\n", artifacts.Metadata.SigningKeyID, artifacts.Metadata.RunLength, artifacts.Metadata.RepeatedDigit)
+	keyDescription := "signing subkey"
+	switch keyringOptions.Kind {
+	case vanity.KeyKindPrimary:
+		keyDescription = "primary key"
+	case vanity.KeyKindEncryptionSubkey:
+		keyDescription = "encryption subkey"
+	}
+	if targetReached && pattern != nil {
+		fmt.Fprintf(cmd.OutOrStdout(), "vanity %s ready: key_id=%s pattern=%s\n", keyDescription, artifacts.Metadata.MinedKeyID(), artifacts.Metadata.Pattern)
+	} else if targetReached {
+		fmt.Fprintf(cmd.OutOrStdout(), "vanity %s ready: key_id=%s run=%d digit=%s\n", keyDescription, artifacts.Metadata.MinedKeyID(), artifacts.Metadata.RunLength, artifacts.Metadata.RepeatedDigit)
 	} else {
 		fmt.Fprintf(
 			cmd.OutOrStdout(),
 			"target not reached: preserved best candidate key_id=%s run=%d target=%d; database not updated\n",
-			artifacts.Metadata.SigningKeyID,
+			artifacts.Metadata.MinedKeyID(),
 			artifacts.Metadata.RunLength,
 			minRun,
 		)
@@ -350,12 +471,21 @@ func checkpointHasSearchState(checkpoint *vanity.Checkpoint) bool {
 	return checkpoint.Attempts > 0 || checkpoint.BestRun > 0 || checkpoint.BestKeyID != ""
 }
 
-func saveVanityToDatabase(repo repository.KeyRepository, artifacts *vanity.Artifacts) error {
-	record, err := artifacts.ToDatabaseKeyInfo()
+func saveVanityToDatabase(appInstance *app.App, artifacts *vanity.Artifacts) error {
+	scorer, err := domain.NewScorer(appInstance.Config.Scoring)
+	if err != nil {
+		return fmt.Errorf("initialize vanity key scorer: %w", err)
+	}
+	window, err := config.ParseScoringWindow(appInstance.Config.Scoring.Window)
+	if err != nil {
+		return err
+	}
+	rarity := domain.NewRarityEstimator(scorer, appInstance.Config.Scoring)
+	record, err := artifacts.ToDatabaseKeyInfo(scorer, window, rarity)
 	if err != nil {
 		return fmt.Errorf("prepare vanity database record: %w", err)
 	}
-	if err := repo.Upsert(record); err != nil {
+	if err := appInstance.Repository.Upsert(record); err != nil {
 		return fmt.Errorf("save vanity key to database: %w", err)
 	}
 	return nil
@@ -393,8 +523,13 @@ func init() {
 	VanityCmd.Flags().IntVarP(&vanityWorkers, "workers", "j", 0, "search workers (0 uses config or logical CPU count)")
 	VanityCmd.Flags().StringVar(&vanityScope, "scope", string(vanity.ScopeSuffix), "match scope: suffix or any")
 	VanityCmd.Flags().StringVar(&vanityDigits, "digits", vanity.AllDigits.String(), "hexadecimal digits allowed to form the repeated run (for example: 180 or 1,8,0)")
+	VanityCmd.Flags().StringVar(&vanityPattern, "pattern", "", "match the key ID against a pattern instead of a repeated run: ...C0FFEE, C0FFEE..., DEAD????BEEF????, or digit classes like [0-3]")
+	VanityCmd.Flags().StringVar(&vanityTargetsPath, "targets", "", "JSON targets file to mine every listed target in one search, each into <output-dir>/<name>")
+	VanityCmd.Flags().IntVar(&vanityCollect, "collect", 0, "keep mining after the target and finalize the N best distinct candidates and any tied with the Nth (0 stops at the first match)")
+	VanityCmd.Flags().StringVar(&vanityKeyTarget, "target", string(vanity.KeyKindSigningSubkey), "key that carries the vanity fingerprint: signing-subkey, primary, or encryption-subkey")
+	VanityCmd.Flags().StringVar(&vanityAddSubkeys, "add-subkeys", "", "fresh subkeys to add to a --target primary keyring: sign, encrypt, or sign,encrypt")
 	VanityCmd.Flags().Uint64Var(&vanityMaxAttempts, "max-attempts", 0, "maximum attempts in this run (0 searches until target or cancellation)")
-	VanityCmd.Flags().DurationVar(&vanityTimestampWindow, "timestamp-window", 30*24*time.Hour, "historical timestamp range scanned for each Ed25519 key")
+	VanityCmd.Flags().DurationVar(&vanityTimestampWindow, "timestamp-window", 30*24*time.Hour, "historical timestamp range scanned for each candidate key")
 	VanityCmd.Flags().StringVarP(&vanityOutputDir, "output-dir", "o", "./vanity_keys", "directory for generated key artifacts")
 	VanityCmd.Flags().StringVar(&vanityCheckpointPath, "checkpoint", "", "checkpoint file (default: <output-dir>/vanity-checkpoint.json)")
 	VanityCmd.Flags().BoolVar(&vanityResume, "resume", true, "resume attempt and best-run counters from the checkpoint")
@@ -405,4 +540,5 @@ func init() {
 	VanityCmd.Flags().IntVar(&vanityGPUKeyBatch, "gpu-key-batch", 0, "Ed25519 templates prepared per GPU batch (0 uses the tuned default)")
 	VanityCmd.Flags().Uint64Var(&vanityGPUWorkItems, "gpu-work-items", 0, "hashes per OpenCL dispatch (0 uses the tuned default)")
 	VanityCmd.Flags().BoolVar(&vanityListOpenCL, "list-opencl-devices", false, "list detected OpenCL GPUs and exit")
+	VanityCmd.Flags().StringVar(&vanityMetricsAddr, "metrics-addr", "", "serve Prometheus metrics at this address, e.g. :9090 (disabled if empty)")
 }
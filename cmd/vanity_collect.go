@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/iyuangang/gpgenie/internal/app"
+	"github.com/iyuangang/gpgenie/internal/key/service"
+	"github.com/iyuangang/gpgenie/internal/key/vanity"
+
+	"github.com/spf13/cobra"
+)
+
+// finishVanityCollect finalizes every candidate a --collect search retained
+// into its own artifacts, best first. The checkpoint best moves to the best
+// collected candidate only when it is at least as long as the previous best.
+func finishVanityCollect(
+	cmd *cobra.Command,
+	appInstance *app.App,
+	result *vanity.SearchResult,
+	searchErr error,
+	checkpoint *vanity.Checkpoint,
+	checkpointPath string,
+	primaryCreatedAt time.Time,
+	scope vanity.Scope,
+	targetDigits string,
+	pattern *vanity.Pattern,
+	keyringOptions vanity.KeyringOptions,
+	minRun int,
+	saveToDatabase bool,
+) error {
+	out := cmd.OutOrStdout()
+	checkpoint.Attempts = result.Attempts
+	if err := vanity.SaveCheckpoint(checkpointPath, *checkpoint); err != nil {
+		return err
+	}
+	if len(result.Collected) == 0 {
+		fmt.Fprintf(out, "no candidate reached run=%d after %d new attempts\n", minRun, result.RunAttempts)
+		if searchErr != nil && searchErr != context.Canceled {
+			return searchErr
+		}
+		return nil
+	}
+
+	encryptor, err := service.NewPGPEncryptor(appInstance.Config.KeyGeneration.EncryptorPublicKey)
+	if err != nil {
+		return fmt.Errorf("initialize vanity key encryptor: %w", err)
+	}
+	identity := vanity.Identity{
+		Name:    appInstance.Config.KeyGeneration.Name,
+		Comment: appInstance.Config.KeyGeneration.Comment,
+		Email:   appInstance.Config.KeyGeneration.Email,
+	}
+	for i, candidate := range result.Collected {
+		artifacts, err := vanity.FinalizeAndWrite(
+			vanityOutputDir,
+			identity,
+			candidate,
+			primaryCreatedAt,
+			result,
+			scope,
+			targetDigits,
+			pattern,
+			keyringOptions,
+			encryptor,
+		)
+		if err != nil {
+			return fmt.Errorf("finalize collected vanity key %s: %w", candidate.KeyIDHex(), err)
+		}
+		newBest := i == 0 && artifacts.Metadata.RunLength >= checkpoint.BestRun
+		if newBest {
+			checkpoint.BestRun = artifacts.Metadata.RunLength
+			checkpoint.BestKeyID = artifacts.Metadata.MinedKeyID()
+			checkpoint.BestSigningFingerprint = artifacts.Metadata.MinedFingerprint()
+			checkpoint.LatestPublicKeyPath = artifacts.PublicKeyPath
+			checkpoint.LatestEncryptedPrivatePath = artifacts.EncryptedPrivatePath
+			checkpoint.LatestMetadataPath = artifacts.MetadataPath
+			checkpoint.SavedToDatabase = false
+			if err := vanity.SaveCheckpoint(checkpointPath, *checkpoint); err != nil {
+				return err
+			}
+		}
+		if saveToDatabase {
+			if err := saveVanityToDatabase(appInstance, artifacts); err != nil {
+				return err
+			}
+			if newBest {
+				checkpoint.SavedToDatabase = true
+				if err := vanity.SaveCheckpoint(checkpointPath, *checkpoint); err != nil {
+					return err
+				}
+			}
+		}
+		fmt.Fprintf(
+			out,
+			"collected %d/%d: key_id=%s run=%d metadata=%s\n",
+			i+1, len(result.Collected), artifacts.Metadata.MinedKeyID(), artifacts.Metadata.RunLength, artifacts.MetadataPath,
+		)
+	}
+	if saveToDatabase {
+		fmt.Fprintf(out, "database: saved %d encrypted vanity keys\n", len(result.Collected))
+	}
+	fmt.Fprintln(out, "decrypt the private artifacts with GnuPG before importing; never commit them to source control")
+
+	if searchErr != nil && searchErr != context.Canceled {
+		return searchErr
+	}
+	return nil
+}
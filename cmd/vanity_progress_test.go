@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"bytes"
 	"strings"
 	"testing"
 	"time"
@@ -12,24 +11,6 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestVanityProgressDisplayRedrawsOneTerminalLine(t *testing.T) {
-	var output bytes.Buffer
-	display := &vanityProgressDisplay{output: &output, inline: true}
-	display.Update("progress: long", false)
-	display.Update("done", true)
-
-	assert.Equal(t, "\rprogress: long\rdone          \n", output.String())
-}
-
-func TestVanityProgressDisplayUsesLinesWhenRedirected(t *testing.T) {
-	var output bytes.Buffer
-	display := &vanityProgressDisplay{output: &output}
-	display.Update("first", false)
-	display.Update("second", true)
-
-	assert.Equal(t, "first\nsecond\n", output.String())
-}
-
 func TestFormatVanityProgress(t *testing.T) {
 	line := formatVanityProgress(vanity.Progress{
 		Attempts:    2_336_633_662_306,
@@ -48,9 +29,13 @@ func TestFormatVanityProgress(t *testing.T) {
 }
 
 func TestExpectedVanityAttempts(t *testing.T) {
-	assert.Equal(t, mathPow16(14), expectedVanityAttempts(15, vanity.ScopeSuffix, vanity.AllDigits))
-	assert.Equal(t, mathPow16(15)/3, expectedVanityAttempts(15, vanity.ScopeSuffix, mustDigits(t, "018")))
-	assert.Zero(t, expectedVanityAttempts(15, vanity.ScopeAny, vanity.AllDigits))
+	assert.Equal(t, mathPow16(14), expectedVanityAttempts(15, vanity.ScopeSuffix, vanity.AllDigits, nil))
+	assert.Equal(t, mathPow16(15)/3, expectedVanityAttempts(15, vanity.ScopeSuffix, mustDigits(t, "018"), nil))
+	assert.Zero(t, expectedVanityAttempts(15, vanity.ScopeAny, vanity.AllDigits, nil))
+
+	pattern, err := vanity.ParsePattern("DEAD????[0-3]...")
+	require.NoError(t, err)
+	assert.Equal(t, mathPow16(4)*4, expectedVanityAttempts(5, vanity.ScopeSuffix, vanity.AllDigits, pattern))
 }
 
 func mathPow16(exponent int) float64 {
@@ -84,3 +69,38 @@ func TestParseOpenCLDeviceSelection(t *testing.T) {
 		assert.Error(t, err)
 	}
 }
+
+func TestReconcileTargetCheckpoints(t *testing.T) {
+	coffee, err := vanity.ParsePattern("...C0FFEE")
+	require.NoError(t, err)
+	targets := []vanity.Target{
+		{Name: "coffee", MinRun: 6, Pattern: coffee},
+		{Name: "ops", MinRun: 10, Scope: vanity.ScopeSuffix, AllowedDigits: mustDigits(t, "180")},
+		{Name: "new", MinRun: 8, Scope: vanity.ScopeAny, AllowedDigits: vanity.AllDigits},
+	}
+	previous := []vanity.TargetCheckpoint{
+		{Name: "ops", Criteria: "scope=suffix digits=018 min_run=9", KeyID: "ABCDEF1234999999"},
+		{Name: "coffee", Criteria: "pattern=...C0FFEE", KeyID: "ABCDEF1234C0FFEE"},
+		{Name: "removed", Criteria: "pattern=...1"},
+	}
+	var out strings.Builder
+	got := reconcileTargetCheckpoints(&out, previous, targets)
+
+	require.Len(t, got, 3)
+	assert.Equal(t, previous[1], got[0])
+	assert.Equal(t, vanity.TargetCheckpoint{Name: "ops", Criteria: "scope=suffix digits=018 min_run=10"}, got[1])
+	assert.Equal(t, vanity.TargetCheckpoint{Name: "new", Criteria: "scope=any digits=0123456789ABCDEF min_run=8"}, got[2])
+	assert.Contains(t, out.String(), "target ops criteria changed")
+}
+
+func TestFormatVanityWishlistProgress(t *testing.T) {
+	line := formatVanityWishlistProgress(vanity.Progress{
+		Attempts:         2_000_000,
+		RunAttempts:      1_000_000,
+		Rate:             500_000,
+		Elapsed:          2 * time.Second,
+		TargetsSatisfied: 2,
+	}, 5)
+	assert.Contains(t, line, "total=2.000M")
+	assert.Contains(t, line, "targets=2/5")
+}
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/iyuangang/gpgenie/internal/app"
+	"github.com/iyuangang/gpgenie/internal/key/service"
+	"github.com/iyuangang/gpgenie/internal/key/vanity"
+
+	"github.com/spf13/cobra"
+)
+
+// runVanityWishlist mines every target of the --targets file in one search.
+// searchConfig carries the backend, worker, timestamp, and budget settings;
+// each hit is finalized into <output-dir>/<target name>.
+func runVanityWishlist(
+	cmd *cobra.Command,
+	appInstance *app.App,
+	searchConfig vanity.SearchConfig,
+	checkpointPath string,
+	primaryCreatedAt time.Time,
+	keyringOptions vanity.KeyringOptions,
+	saveToDatabase bool,
+) error {
+	out := cmd.OutOrStdout()
+	targets, err := vanity.LoadTargets(vanityTargetsPath, vanity.Identity{
+		Name:    appInstance.Config.KeyGeneration.Name,
+		Comment: appInstance.Config.KeyGeneration.Comment,
+		Email:   appInstance.Config.KeyGeneration.Email,
+	})
+	if err != nil {
+		return err
+	}
+
+	checkpoint := &vanity.Checkpoint{}
+	if vanityResume {
+		loaded, err := vanity.LoadCheckpoint(checkpointPath)
+		if err != nil {
+			return err
+		}
+		checkpoint = loaded
+	}
+	if checkpoint.Targets == nil && checkpointHasSearchState(checkpoint) {
+		fmt.Fprintln(out, "checkpoint holds a single-target search; resetting counters (existing artifacts are preserved)")
+		checkpoint = &vanity.Checkpoint{}
+	}
+	checkpoint.Targets = reconcileTargetCheckpoints(out, checkpoint.Targets, targets)
+
+	var outstanding []vanity.Target
+	var outstandingIndex []int
+	for i, target := range targets {
+		status := &checkpoint.Targets[i]
+		if !status.Satisfied() {
+			outstanding = append(outstanding, target)
+			outstandingIndex = append(outstandingIndex, i)
+			continue
+		}
+		if saveToDatabase && !status.SavedToDatabase {
+			artifacts, err := vanity.LoadArtifacts(status.PublicKeyPath, status.EncryptedPrivatePath, status.MetadataPath)
+			if err != nil {
+				return fmt.Errorf("reload artifacts of target %s for database save: %w", target.Name, err)
+			}
+			if err := saveVanityToDatabase(appInstance, artifacts); err != nil {
+				return err
+			}
+			status.SavedToDatabase = true
+			if err := vanity.SaveCheckpoint(checkpointPath, *checkpoint); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "checkpoint target %s saved to database: fingerprint=%s\n", target.Name, status.SigningFingerprint)
+		}
+	}
+	if len(outstanding) == 0 {
+		fmt.Fprintf(out, "checkpoint already satisfies all %d targets\n", len(targets))
+		return nil
+	}
+
+	fmt.Fprintf(
+		out,
+		"vanity wishlist search started: backend=%s cpu_workers=%d targets=%d outstanding=%d save_db=%t previous_attempts=%d\n",
+		searchConfig.Backend, searchConfig.Workers, len(targets), len(outstanding), saveToDatabase, checkpoint.Attempts,
+	)
+	for _, target := range outstanding {
+		fmt.Fprintf(out, "target %s: %s identity=%q <%s>\n", target.Name, target.Criteria(), target.Identity.Name, target.Identity.Email)
+	}
+
+	registry, stopMetrics, err := startMetricsServer(vanityMetricsAddr, out)
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+
+	searchConfig.Targets = outstanding
+	searchConfig.InitialAttempts = checkpoint.Attempts
+	searchConfig.Metrics = registry
+	display := newProgressDisplay(out)
+	display.Update(formatVanityWishlistProgress(vanity.Progress{Attempts: checkpoint.Attempts}, len(outstanding)), false)
+	defer display.Close()
+
+	var checkpointErr error
+	result, searchErr := vanity.Search(cmd.Context(), searchConfig, func(progress vanity.Progress) {
+		checkpoint.Attempts = progress.Attempts
+		if err := vanity.SaveCheckpoint(checkpointPath, *checkpoint); err != nil && checkpointErr == nil {
+			checkpointErr = err
+		}
+		display.Update(formatVanityWishlistProgress(progress, len(outstanding)), progress.Final)
+	})
+	if checkpointErr != nil && (result == nil || len(result.Hits) == 0) {
+		return checkpointErr
+	}
+	if checkpointErr != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "warning: progress checkpoint failed before finalization: %v\n", checkpointErr)
+	}
+	if result == nil {
+		if searchErr != nil {
+			return searchErr
+		}
+		return fmt.Errorf("vanity search returned no result")
+	}
+	checkpoint.Attempts = result.Attempts
+
+	var encryptor *service.PGPEncryptor
+	if len(result.Hits) > 0 {
+		encryptor, err = service.NewPGPEncryptor(appInstance.Config.KeyGeneration.EncryptorPublicKey)
+		if err != nil {
+			return fmt.Errorf("initialize vanity key encryptor: %w", err)
+		}
+	}
+	for _, hit := range result.Hits {
+		target := outstanding[hit.Target]
+		status := &checkpoint.Targets[outstandingIndex[hit.Target]]
+		artifacts, err := vanity.FinalizeAndWrite(
+			filepath.Join(vanityOutputDir, target.Name),
+			target.Identity,
+			hit,
+			primaryCreatedAt,
+			result,
+			target.Scope,
+			target.AllowedDigits.String(),
+			target.Pattern,
+			keyringOptions,
+			encryptor,
+		)
+		if err != nil {
+			return fmt.Errorf("finalize vanity key for target %s: %w", target.Name, err)
+		}
+		status.KeyID = artifacts.Metadata.MinedKeyID()
+		status.SigningFingerprint = artifacts.Metadata.MinedFingerprint()
+		status.PublicKeyPath = artifacts.PublicKeyPath
+		status.EncryptedPrivatePath = artifacts.EncryptedPrivatePath
+		status.MetadataPath = artifacts.MetadataPath
+		status.SavedToDatabase = false
+		if err := vanity.SaveCheckpoint(checkpointPath, *checkpoint); err != nil {
+			return err
+		}
+		if saveToDatabase {
+			if err := saveVanityToDatabase(appInstance, artifacts); err != nil {
+				return err
+			}
+			status.SavedToDatabase = true
+			if err := vanity.SaveCheckpoint(checkpointPath, *checkpoint); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(out, "target %s satisfied: key_id=%s metadata=%s\n", target.Name, artifacts.Metadata.MinedKeyID(), artifacts.MetadataPath)
+	}
+	if err := vanity.SaveCheckpoint(checkpointPath, *checkpoint); err != nil {
+		return err
+	}
+
+	satisfied := 0
+	for _, status := range checkpoint.Targets {
+		if status.Satisfied() {
+			satisfied++
+		}
+	}
+	fmt.Fprintf(out, "targets satisfied: %d/%d\n", satisfied, len(targets))
+	if satisfied > 0 {
+		fmt.Fprintln(out, "decrypt the private artifacts with GnuPG before importing; never commit them to source control")
+	}
+	if searchErr != nil && searchErr != context.Canceled {
+		return searchErr
+	}
+	return nil
+}
+
+// reconcileTargetCheckpoints returns the checkpoint state of each target in
+// order. State is kept for a target whose name and criteria are unchanged;
+// a target whose criteria changed starts over.
+func reconcileTargetCheckpoints(out io.Writer, previous []vanity.TargetCheckpoint, targets []vanity.Target) []vanity.TargetCheckpoint {
+	byName := make(map[string]vanity.TargetCheckpoint, len(previous))
+	for _, status := range previous {
+		byName[status.Name] = status
+	}
+	result := make([]vanity.TargetCheckpoint, len(targets))
+	for i, target := range targets {
+		criteria := target.Criteria()
+		status, ok := byName[target.Name]
+		if ok && status.Criteria != criteria {
+			fmt.Fprintf(out, "target %s criteria changed: %s -> %s; searching again (existing artifacts are preserved)\n", target.Name, status.Criteria, criteria)
+			ok = false
+		}
+		if !ok {
+			status = vanity.TargetCheckpoint{Name: target.Name, Criteria: criteria}
+		}
+		result[i] = status
+	}
+	return result
+}
@@ -13,15 +13,48 @@ import (
 type App struct {
 	Config     *config.Config
 	DB         *database.DB
+	Sink       repository.FileSink
 	Logger     *logger.Logger
 	KeyService service.KeyService
 	Repository repository.KeyRepository
+	Runs       repository.RunRepository
 }
 
 // NewApp 初始化应用程序，通过依赖注入传入 Encryptor
 func NewApp(configPath string) (*App, error) {
+	return NewAppWithSink(configPath, repository.SinkDatabase)
+}
+
+// NewAppWithSink initializes the application with keys stored in the sink
+// described by sinkSpec (see repository.ParseSink).
+func NewAppWithSink(configPath, sinkSpec string) (*App, error) {
+	return NewAppWithOptions(Options{ConfigPath: configPath, Sink: sinkSpec})
+}
+
+// Options selects the configuration file, configuration profile, and key
+// storage of an App.
+type Options struct {
+	ConfigPath string
+	// Profile names an entry of the profiles map; empty uses the profile
+	// selected by the configuration file, if any.
+	Profile string
+	// Sink is a repository.ParseSink spec; empty means the database.
+	Sink string
+}
+
+// NewAppWithOptions initializes the application. File sinks do not connect
+// to the database and keep the run ledger in memory.
+func NewAppWithOptions(opts Options) (*App, error) {
+	if opts.Sink == "" {
+		opts.Sink = repository.SinkDatabase
+	}
+	spec, err := repository.ParseSink(opts.Sink)
+	if err != nil {
+		return nil, err
+	}
+
 	// 加载配置
-	cfg, err := config.Load(configPath)
+	cfg, err := config.LoadProfile(opts.ConfigPath, opts.Profile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
@@ -32,40 +65,53 @@ func NewApp(configPath string) (*App, error) {
 		return nil, fmt.Errorf("failed to initialize logger: %w", err)
 	}
 
-	// 连接数据库
-	db, err := database.Connect(cfg.Database)
-	if err != nil {
-		log.Errorf("failed to connect to database: %v", err)
-		log.SyncLogger()
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
-	}
+	application := &App{Config: cfg, Logger: log}
+	if spec.IsDatabase() {
+		// 连接数据库
+		db, err := database.Connect(cfg.Database)
+		if err != nil {
+			log.Errorf("failed to connect to database: %v", err)
+			log.SyncLogger()
+			return nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
 
-	// 初始化仓储
-	repo := repository.NewKeyRepository(db.DB)
+		// 初始化仓储
+		application.DB = db
+		application.Repository = repository.NewKeyRepository(db.DB)
+		application.Runs = repository.NewRunRepository(db.DB)
+	} else {
+		sink, err := repository.OpenFileSink(spec)
+		if err != nil {
+			log.SyncLogger()
+			return nil, fmt.Errorf("failed to open %s sink: %w", spec.Kind, err)
+		}
+		application.Sink = sink
+		application.Repository = sink
+		application.Runs = repository.NewMemoryRunRepository(sink.NextRunID())
+	}
 
 	// 初始化 KeyService，并注入 Encryptor
-	keyService, err := service.InitializeKeyService(cfg, repo, log)
+	keyService, err := service.InitializeKeyService(cfg, application.Repository, application.Runs, log)
 	if err != nil {
-		_ = db.Close()
-		log.SyncLogger()
+		_ = application.Close()
 		return nil, fmt.Errorf("failed to initialize KeyService: %w", err)
 	}
-
-	return &App{
-		Config:     cfg,
-		DB:         db,
-		Logger:     log,
-		KeyService: keyService,
-		Repository: repo,
-	}, nil
+	application.KeyService = keyService
+	return application, nil
 }
 
 func (a *App) Close() error {
 	if a.Logger != nil {
 		a.Logger.SyncLogger()
 	}
+	var sinkErr error
+	if a.Sink != nil {
+		sinkErr = a.Sink.Close()
+	}
 	if a.DB != nil {
-		return a.DB.Close()
+		if err := a.DB.Close(); err != nil {
+			return err
+		}
 	}
-	return nil
+	return sinkErr
 }
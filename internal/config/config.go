@@ -2,6 +2,11 @@ package config
 
 import (
 	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/viper"
@@ -12,7 +17,11 @@ type Config struct {
 	Database      DatabaseConfig      `mapstructure:"database"`
 	KeyGeneration KeyGenerationConfig `mapstructure:"key_generation"`
 	Vanity        VanityConfig        `mapstructure:"vanity"`
+	Scoring       ScoringConfig       `mapstructure:"scoring"`
 	Logging       LoggingConfig       `mapstructure:"logging"`
+	// Profile names the entry of the profiles map merged over key_generation
+	// and vanity, or is empty when no profile is in effect.
+	Profile string `mapstructure:"profile"`
 }
 
 type VanityConfig struct {
@@ -45,6 +54,177 @@ func (c VanityConfig) Validate() error {
 	return nil
 }
 
+// ScoringConfig selects the fingerprint scoring strategy and tunes its
+// components. Weights multiply each component score; a zero weight disables
+// the component and a negative weight turns it into a penalty.
+type ScoringConfig struct {
+	Strategy          string  `mapstructure:"strategy"`
+	RepeatWeight      float64 `mapstructure:"repeat_weight"`
+	IncreasingWeight  float64 `mapstructure:"increasing_weight"`
+	DecreasingWeight  float64 `mapstructure:"decreasing_weight"`
+	MagicWeight       float64 `mapstructure:"magic_weight"`
+	PalindromeWeight  float64 `mapstructure:"palindrome_weight"`
+	BlockWeight       float64 `mapstructure:"block_weight"`
+	AlternatingWeight float64 `mapstructure:"alternating_weight"`
+	MinRepeatLength   int     `mapstructure:"min_repeat_length"`
+	MinSequenceLength int     `mapstructure:"min_sequence_length"`
+	// Window selects the fingerprint digits that are scored: short, long,
+	// full, or an OFFSET:LENGTH range. See ParseScoringWindow.
+	Window string `mapstructure:"window"`
+	// MagicSequences are hexadecimal sequences that add their weight to the
+	// magic score when found in the scored digits. Leaving the list empty
+	// keeps the classic -100 penalty for 49.
+	MagicSequences []MagicSequence `mapstructure:"magic_sequences"`
+	// HexWordWeight scores each built-in hex word (CAFE, BEEF, C0DE, ...)
+	// found in the scored digits at this many points per digit. Zero
+	// disables the dictionary.
+	HexWordWeight int `mapstructure:"hex_word_weight"`
+}
+
+// MagicSequence is one scoring.magic_sequences entry. Matching ignores case.
+type MagicSequence struct {
+	Sequence string `mapstructure:"sequence"`
+	Weight   int    `mapstructure:"weight"`
+}
+
+// IsZero reports whether c is the zero ScoringConfig, which selects the
+// classic defaults.
+func (c ScoringConfig) IsZero() bool {
+	if len(c.MagicSequences) == 0 {
+		c.MagicSequences = nil
+	}
+	return reflect.DeepEqual(c, ScoringConfig{})
+}
+
+// Named scoring windows. long, the last 16 digits, is the original behavior.
+const (
+	ScoringWindowShort = "short"
+	ScoringWindowLong  = "long"
+	ScoringWindowFull  = "full"
+)
+
+// MaxScoringWindow is the length of the longest fingerprint, a v6 SHA-256
+// fingerprint in hexadecimal.
+const MaxScoringWindow = 64
+
+// ScoringWindow is a parsed scoring.window. Offset counts digits from the
+// start of the fingerprint, or from its end when negative. Length zero
+// extends the window to the end of the fingerprint.
+type ScoringWindow struct {
+	Offset int
+	Length int
+}
+
+// ParseScoringWindow parses a scoring window: short (the last 8 digits, the
+// short key ID), long or empty (the last 16, the long key ID), full (every
+// digit), or OFFSET:LENGTH with a negative OFFSET counting from the end, so
+// that -8:8 equals short.
+func ParseScoringWindow(spec string) (ScoringWindow, error) {
+	switch strings.ToLower(strings.TrimSpace(spec)) {
+	case ScoringWindowShort:
+		return ScoringWindow{Offset: -8, Length: 8}, nil
+	case "", ScoringWindowLong:
+		return ScoringWindow{Offset: -16, Length: 16}, nil
+	case ScoringWindowFull:
+		return ScoringWindow{}, nil
+	}
+	offsetText, lengthText, ok := strings.Cut(spec, ":")
+	if !ok {
+		return ScoringWindow{}, fmt.Errorf("scoring window %q must be short, long, full, or OFFSET:LENGTH", spec)
+	}
+	offset, err := strconv.Atoi(strings.TrimSpace(offsetText))
+	if err != nil {
+		return ScoringWindow{}, fmt.Errorf("scoring window %q: invalid offset", spec)
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(lengthText))
+	if err != nil {
+		return ScoringWindow{}, fmt.Errorf("scoring window %q: invalid length", spec)
+	}
+	switch {
+	case offset < -MaxScoringWindow || offset >= MaxScoringWindow:
+		return ScoringWindow{}, fmt.Errorf("scoring window %q: offset must be between %d and %d", spec, -MaxScoringWindow, MaxScoringWindow-1)
+	case length < 1 || length > MaxScoringWindow:
+		return ScoringWindow{}, fmt.Errorf("scoring window %q: length must be between 1 and %d", spec, MaxScoringWindow)
+	case offset < 0 && length > -offset:
+		return ScoringWindow{}, fmt.Errorf("scoring window %q: length runs past the end of the fingerprint", spec)
+	}
+	return ScoringWindow{Offset: offset, Length: length}, nil
+}
+
+// String returns the canonical name of the window, which is what key rows
+// record in score_window.
+func (w ScoringWindow) String() string {
+	switch w {
+	case ScoringWindow{Offset: -8, Length: 8}:
+		return ScoringWindowShort
+	case ScoringWindow{Offset: -16, Length: 16}:
+		return ScoringWindowLong
+	case ScoringWindow{}:
+		return ScoringWindowFull
+	}
+	return fmt.Sprintf("%d:%d", w.Offset, w.Length)
+}
+
+// DefaultScoringConfig weighs the original classic components equally and
+// leaves the symmetry components off, so default scores stay comparable with
+// keys scored before they existed.
+func DefaultScoringConfig() ScoringConfig {
+	return ScoringConfig{
+		Strategy:          "classic",
+		RepeatWeight:      1,
+		IncreasingWeight:  1,
+		DecreasingWeight:  1,
+		MagicWeight:       1,
+		MinRepeatLength:   3,
+		MinSequenceLength: 4,
+		Window:            ScoringWindowLong,
+	}
+}
+
+func (c ScoringConfig) Validate() error {
+	switch {
+	case c.Strategy == "":
+		return fmt.Errorf("scoring.strategy must not be empty")
+	case c.MinRepeatLength < 2 || c.MinRepeatLength > 16:
+		return fmt.Errorf("scoring.min_repeat_length must be between 2 and 16")
+	case c.MinSequenceLength < 2 || c.MinSequenceLength > 16:
+		return fmt.Errorf("scoring.min_sequence_length must be between 2 and 16")
+	}
+	if _, err := ParseScoringWindow(c.Window); err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(c.MagicSequences))
+	for i, magic := range c.MagicSequences {
+		sequence := strings.ToLower(magic.Sequence)
+		switch {
+		case sequence == "" || len(sequence) > MaxScoringWindow:
+			return fmt.Errorf("scoring.magic_sequences[%d]: sequence must be 1 to %d hex digits", i, MaxScoringWindow)
+		case strings.Trim(sequence, "0123456789abcdef") != "":
+			return fmt.Errorf("scoring.magic_sequences[%d]: sequence %q is not hexadecimal", i, magic.Sequence)
+		case seen[sequence]:
+			return fmt.Errorf("scoring.magic_sequences[%d]: duplicate sequence %q", i, magic.Sequence)
+		}
+		seen[sequence] = true
+	}
+	for _, weight := range []struct {
+		name  string
+		value float64
+	}{
+		{"repeat_weight", c.RepeatWeight},
+		{"increasing_weight", c.IncreasingWeight},
+		{"decreasing_weight", c.DecreasingWeight},
+		{"magic_weight", c.MagicWeight},
+		{"palindrome_weight", c.PalindromeWeight},
+		{"block_weight", c.BlockWeight},
+		{"alternating_weight", c.AlternatingWeight},
+	} {
+		if math.IsNaN(weight.value) || math.IsInf(weight.value, 0) {
+			return fmt.Errorf("scoring.%s must be a finite number", weight.name)
+		}
+	}
+	return nil
+}
+
 type LoggingConfig struct {
 	LogLevel string `mapstructure:"log_level"`
 	LogFile  string `mapstructure:"log_file"`
@@ -64,18 +244,36 @@ type DatabaseConfig struct {
 }
 
 type KeyGenerationConfig struct {
-	NumGeneratorWorkers int    `mapstructure:"num_generator_workers"`
-	NumScorerWorkers    int    `mapstructure:"num_scorer_workers"`
-	TotalKeys           int    `mapstructure:"total_keys"`
-	MinScore            int    `mapstructure:"min_score"`
-	MaxLettersCount     int    `mapstructure:"max_letters_count"`
-	BatchSize           int    `mapstructure:"batch_size"`
-	Name                string `mapstructure:"name"`
-	Comment             string `mapstructure:"comment"`
-	Email               string `mapstructure:"email"`
-	EncryptorPublicKey  string `mapstructure:"encryptor_public_key"`
+	NumGeneratorWorkers int      `mapstructure:"num_generator_workers"`
+	NumScorerWorkers    int      `mapstructure:"num_scorer_workers"`
+	TotalKeys           int      `mapstructure:"total_keys"`
+	MinScore            int      `mapstructure:"min_score"`
+	MaxLettersCount     int      `mapstructure:"max_letters_count"`
+	BatchSize           int      `mapstructure:"batch_size"`
+	Name                string   `mapstructure:"name"`
+	Comment             string   `mapstructure:"comment"`
+	Email               string   `mapstructure:"email"`
+	EncryptorPublicKey  string   `mapstructure:"encryptor_public_key"`
+	Patterns            []string `mapstructure:"patterns"`
+	Algorithm           string   `mapstructure:"algorithm"`
+	RSABits             int      `mapstructure:"rsa_bits"`
+	Curve               string   `mapstructure:"curve"`
+	GrindWindow         int      `mapstructure:"grind_window"`
+	OnConflict          string   `mapstructure:"on_conflict"`
+	KeepTop             int      `mapstructure:"keep_top"`
+	// Accept is a boolean expression over a candidate's scores that replaces
+	// the min_score and max_letters_count acceptance rules. Pattern hits are
+	// accepted regardless.
+	Accept string `mapstructure:"accept"`
+	// KeyVersion selects OpenPGP v4 keys with SHA-1 fingerprints (0 or 4) or
+	// RFC 9580 v6 Ed25519 keys with SHA-256 fingerprints (6).
+	KeyVersion int `mapstructure:"key_version"`
 }
 
+// MaxGrindWindow bounds key_generation.grind_window to about 194 days of
+// creation timestamps per key.
+const MaxGrindWindow = 1 << 24
+
 func (c KeyGenerationConfig) Validate() error {
 	switch {
 	case c.NumGeneratorWorkers <= 0:
@@ -88,11 +286,71 @@ func (c KeyGenerationConfig) Validate() error {
 		return fmt.Errorf("batch_size must be greater than zero")
 	case c.MaxLettersCount < 0 || c.MaxLettersCount > 16:
 		return fmt.Errorf("max_letters_count must be between 0 and 16")
+	case c.KeepTop < 0:
+		return fmt.Errorf("keep_top must not be negative")
+	case c.GrindWindow < 0 || c.GrindWindow > MaxGrindWindow:
+		return fmt.Errorf("grind_window must be between 0 and %d", MaxGrindWindow)
+	case c.GrindWindow > 0 && c.Algorithm != "" && !strings.EqualFold(c.Algorithm, "ed25519"):
+		return fmt.Errorf("grind_window requires the ed25519 algorithm")
+	case c.KeyVersion != 0 && c.KeyVersion != 4 && c.KeyVersion != 6:
+		return fmt.Errorf("key_version must be 4 or 6")
+	case c.KeyVersion == 6 && c.Algorithm != "" && !strings.EqualFold(c.Algorithm, "ed25519"):
+		return fmt.Errorf("key_version 6 requires the ed25519 algorithm")
+	case c.KeyVersion == 6 && c.GrindWindow > 0:
+		return fmt.Errorf("grind_window does not support key_version 6")
+	}
+	switch c.OnConflict {
+	case "", "skip", "update", "fail":
+	default:
+		return fmt.Errorf("on_conflict must be skip, update, or fail")
+	}
+	return c.validateAlgorithm()
+}
+
+// validateAlgorithm checks the key algorithm settings. An empty algorithm
+// selects Ed25519; rsa_bits applies only to rsa and curve only to ecdsa.
+func (c KeyGenerationConfig) validateAlgorithm() error {
+	switch strings.ToLower(c.Algorithm) {
+	case "", "ed25519", "ed448":
+		if c.RSABits != 0 || c.Curve != "" {
+			return fmt.Errorf("rsa_bits and curve are not used by algorithm %q", c.Algorithm)
+		}
+	case "rsa":
+		switch c.RSABits {
+		case 0, 2048, 3072, 4096:
+		default:
+			return fmt.Errorf("rsa_bits must be 2048, 3072, or 4096")
+		}
+		if c.Curve != "" {
+			return fmt.Errorf("curve is not used by algorithm rsa")
+		}
+	case "ecdsa":
+		switch strings.ToLower(c.Curve) {
+		case "", "p256", "p384", "p521", "brainpoolp256", "brainpoolp384", "brainpoolp512":
+		default:
+			return fmt.Errorf("curve must be p256, p384, p521, brainpoolp256, brainpoolp384, or brainpoolp512")
+		}
+		if c.RSABits != 0 {
+			return fmt.Errorf("rsa_bits is not used by algorithm ecdsa")
+		}
+	default:
+		return fmt.Errorf("algorithm must be ed25519, ed448, rsa, or ecdsa")
 	}
 	return nil
 }
 
+// Load reads the configuration file with the profile selected by its
+// top-level profile key or GPGENIE_PROFILE, if any.
 func Load(configPath string) (*Config, error) {
+	return LoadProfile(configPath, "")
+}
+
+// LoadProfile reads the configuration file and merges the named entry of its
+// profiles map over the key_generation and vanity sections. An empty profile
+// falls back to the profile key of the file or GPGENIE_PROFILE. Environment
+// variables still override profile values, and the merged key_generation
+// section is validated.
+func LoadProfile(configPath, profile string) (*Config, error) {
 	v := viper.New()
 	v.SetConfigFile(configPath)
 	v.SetConfigType("json")
@@ -102,12 +360,27 @@ func Load(configPath string) (*Config, error) {
 		return nil, err
 	}
 
+	// Keys omitted from the scoring section keep the classic behavior.
+	defaults := DefaultScoringConfig()
+	v.SetDefault("scoring.strategy", defaults.Strategy)
+	v.SetDefault("scoring.repeat_weight", defaults.RepeatWeight)
+	v.SetDefault("scoring.increasing_weight", defaults.IncreasingWeight)
+	v.SetDefault("scoring.decreasing_weight", defaults.DecreasingWeight)
+	v.SetDefault("scoring.magic_weight", defaults.MagicWeight)
+	v.SetDefault("scoring.palindrome_weight", defaults.PalindromeWeight)
+	v.SetDefault("scoring.block_weight", defaults.BlockWeight)
+	v.SetDefault("scoring.alternating_weight", defaults.AlternatingWeight)
+	v.SetDefault("scoring.min_repeat_length", defaults.MinRepeatLength)
+	v.SetDefault("scoring.min_sequence_length", defaults.MinSequenceLength)
+	v.SetDefault("scoring.window", defaults.Window)
+	v.SetDefault("scoring.hex_word_weight", defaults.HexWordWeight)
+
 	// 绑定环境变量
 	v.SetEnvPrefix("GPGENIE")
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	v.AutomaticEnv()
 	for _, key := range []string{
-		"environment",
+		"environment", "profile",
 		"database.type", "database.host", "database.port", "database.user",
 		"database.password", "database.dbname", "database.max_open_conns",
 		"database.max_idle_conns", "database.conn_max_lifetime", "database.log_level",
@@ -115,9 +388,17 @@ func Load(configPath string) (*Config, error) {
 		"key_generation.total_keys", "key_generation.min_score",
 		"key_generation.max_letters_count", "key_generation.batch_size",
 		"key_generation.name", "key_generation.comment", "key_generation.email",
-		"key_generation.encryptor_public_key",
+		"key_generation.encryptor_public_key", "key_generation.patterns",
+		"key_generation.algorithm", "key_generation.rsa_bits", "key_generation.curve",
+		"key_generation.grind_window", "key_generation.on_conflict",
+		"key_generation.keep_top", "key_generation.accept", "key_generation.key_version",
 		"vanity.min_run", "vanity.save_to_database", "vanity.backend",
 		"vanity.opencl_devices", "vanity.gpu_key_batch", "vanity.gpu_work_items",
+		"scoring.strategy", "scoring.repeat_weight", "scoring.increasing_weight",
+		"scoring.decreasing_weight", "scoring.magic_weight",
+		"scoring.palindrome_weight", "scoring.block_weight", "scoring.alternating_weight",
+		"scoring.min_repeat_length", "scoring.min_sequence_length", "scoring.window",
+		"scoring.hex_word_weight",
 		"logging.log_level", "logging.log_file",
 	} {
 		if err := v.BindEnv(key); err != nil {
@@ -125,13 +406,64 @@ func Load(configPath string) (*Config, error) {
 		}
 	}
 
+	if profile == "" {
+		profile = v.GetString("profile")
+	}
+	if profile != "" {
+		if err := applyProfile(v, profile); err != nil {
+			return nil, err
+		}
+	}
+
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, err
 	}
+	cfg.Profile = profile
 	if err := cfg.Vanity.Validate(); err != nil {
 		return nil, err
 	}
+	if err := cfg.Scoring.Validate(); err != nil {
+		return nil, err
+	}
+	if profile != "" {
+		if err := cfg.KeyGeneration.Validate(); err != nil {
+			return nil, fmt.Errorf("profile %q: invalid key_generation: %w", profile, err)
+		}
+	}
 
 	return &cfg, nil
 }
+
+// profileSections are the configuration sections a profile may override.
+var profileSections = []string{"key_generation", "vanity"}
+
+// applyProfile merges profiles.<name> over the configuration read by v.
+func applyProfile(v *viper.Viper, name string) error {
+	profiles := v.GetStringMap("profiles")
+	overrides, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for defined := range profiles {
+			names = append(names, defined)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("profile %q is not defined: the configuration has no profiles", name)
+		}
+		return fmt.Errorf("profile %q is not defined (available: %s)", name, strings.Join(names, ", "))
+	}
+	sections, ok := overrides.(map[string]any)
+	if !ok {
+		return fmt.Errorf("profile %q must be an object", name)
+	}
+	for section, values := range sections {
+		if !slices.Contains(profileSections, section) {
+			return fmt.Errorf("profile %q: %s cannot be overridden; profiles may set %s", name, section, strings.Join(profileSections, " and "))
+		}
+		if _, ok := values.(map[string]any); !ok {
+			return fmt.Errorf("profile %q: %s must be an object", name, section)
+		}
+	}
+	return v.MergeConfigMap(sections)
+}
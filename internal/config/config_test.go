@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -69,6 +70,150 @@ func TestLoad(t *testing.T) {
 	assert.Equal(t, 128, cfg.Vanity.GPUKeyBatch)
 	assert.Equal(t, uint64(1048576), cfg.Vanity.GPUWorkItems)
 	assert.Equal(t, "info", cfg.Logging.LogLevel)
+	assert.Equal(t, DefaultScoringConfig(), cfg.Scoring)
+}
+
+func TestLoadScoringOverrides(t *testing.T) {
+	path := writeTempConfig(t, `{
+		"scoring": {
+			"repeat_weight": 0,
+			"magic_weight": 2.5,
+			"min_sequence_length": 3
+		}
+	}`)
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "classic", cfg.Scoring.Strategy)
+	assert.Zero(t, cfg.Scoring.RepeatWeight)
+	assert.Equal(t, 1.0, cfg.Scoring.IncreasingWeight)
+	assert.Equal(t, 2.5, cfg.Scoring.MagicWeight)
+	assert.Equal(t, 3, cfg.Scoring.MinRepeatLength)
+	assert.Equal(t, 3, cfg.Scoring.MinSequenceLength)
+	assert.Equal(t, ScoringWindowLong, cfg.Scoring.Window)
+
+	invalid := writeTempConfig(t, `{"scoring": {"min_repeat_length": 1}}`)
+	_, err = Load(invalid)
+	assert.Error(t, err)
+}
+
+func TestLoadMagicSequences(t *testing.T) {
+	path := writeTempConfig(t, `{
+		"scoring": {
+			"magic_sequences": [
+				{"sequence": "C0FFEE", "weight": 300},
+				{"sequence": "49", "weight": -100}
+			],
+			"hex_word_weight": 8
+		}
+	}`)
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, []MagicSequence{{Sequence: "C0FFEE", Weight: 300}, {Sequence: "49", Weight: -100}}, cfg.Scoring.MagicSequences)
+	assert.Equal(t, 8, cfg.Scoring.HexWordWeight)
+	assert.False(t, cfg.Scoring.IsZero())
+
+	for _, tc := range []struct {
+		sequences []MagicSequence
+		message   string
+	}{
+		{[]MagicSequence{{Sequence: ""}}, "hex digits"},
+		{[]MagicSequence{{Sequence: "C0FFEZ"}}, "not hexadecimal"},
+		{[]MagicSequence{{Sequence: "beef"}, {Sequence: "BEEF"}}, "duplicate"},
+	} {
+		scoring := DefaultScoringConfig()
+		scoring.MagicSequences = tc.sequences
+		assert.ErrorContains(t, scoring.Validate(), tc.message)
+	}
+	assert.True(t, ScoringConfig{MagicSequences: []MagicSequence{}}.IsZero())
+}
+
+func TestParseScoringWindow(t *testing.T) {
+	tests := []struct {
+		spec string
+		want ScoringWindow
+		name string
+	}{
+		{"", ScoringWindow{Offset: -16, Length: 16}, "long"},
+		{"long", ScoringWindow{Offset: -16, Length: 16}, "long"},
+		{"Short", ScoringWindow{Offset: -8, Length: 8}, "short"},
+		{"full", ScoringWindow{}, "full"},
+		{"-8:8", ScoringWindow{Offset: -8, Length: 8}, "short"},
+		{"0:8", ScoringWindow{Offset: 0, Length: 8}, "0:8"},
+		{"-24:8", ScoringWindow{Offset: -24, Length: 8}, "-24:8"},
+	}
+	for _, tt := range tests {
+		window, err := ParseScoringWindow(tt.spec)
+		require.NoError(t, err, tt.spec)
+		assert.Equal(t, tt.want, window, tt.spec)
+		assert.Equal(t, tt.name, window.String(), tt.spec)
+	}
+
+	for _, spec := range []string{"medium", "8", "a:8", "0:x", "0:0", "64:1", "-65:1", "0:65", "-8:9"} {
+		_, err := ParseScoringWindow(spec)
+		assert.Error(t, err, spec)
+	}
+
+	invalid := writeTempConfig(t, `{"scoring": {"window": "1:0"}}`)
+	_, err := Load(invalid)
+	assert.ErrorContains(t, err, "scoring window")
+}
+
+func TestLoadProfileMergesOverrides(t *testing.T) {
+	path := writeTempConfig(t, `{
+		"profile": "smoke",
+		"key_generation": {
+			"num_generator_workers": 4,
+			"num_scorer_workers": 2,
+			"total_keys": 1000,
+			"batch_size": 50,
+			"name": "Base"
+		},
+		"vanity": {"min_run": 12, "backend": "cpu"},
+		"profiles": {
+			"smoke": {"key_generation": {"total_keys": 10}},
+			"Grind": {
+				"key_generation": {"total_keys": 1000000, "keep_top": 100},
+				"vanity": {"backend": "auto"}
+			},
+			"broken": {"key_generation": {"batch_size": 0}},
+			"database": {"database": {"type": "sqlite"}}
+		}
+	}`)
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "smoke", cfg.Profile)
+	assert.Equal(t, 10, cfg.KeyGeneration.TotalKeys)
+	assert.Equal(t, 4, cfg.KeyGeneration.NumGeneratorWorkers)
+
+	cfg, err = LoadProfile(path, "grind")
+	require.NoError(t, err)
+	assert.Equal(t, "grind", cfg.Profile)
+	assert.Equal(t, 1000000, cfg.KeyGeneration.TotalKeys)
+	assert.Equal(t, 100, cfg.KeyGeneration.KeepTop)
+	assert.Equal(t, "Base", cfg.KeyGeneration.Name)
+	assert.Equal(t, "auto", cfg.Vanity.Backend)
+	assert.Equal(t, 12, cfg.Vanity.MinRun)
+
+	t.Setenv("GPGENIE_KEY_GENERATION_TOTAL_KEYS", "7")
+	cfg, err = LoadProfile(path, "grind")
+	require.NoError(t, err)
+	assert.Equal(t, 7, cfg.KeyGeneration.TotalKeys, "environment variables override profiles")
+
+	_, err = LoadProfile(path, "broken")
+	assert.ErrorContains(t, err, "batch_size")
+	_, err = LoadProfile(path, "database")
+	assert.ErrorContains(t, err, "cannot be overridden")
+	_, err = LoadProfile(path, "missing")
+	assert.ErrorContains(t, err, "available: broken, database, grind, smoke")
+}
+
+func writeTempConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
 }
 
 func TestVanityConfigValidate(t *testing.T) {
@@ -93,6 +238,15 @@ func TestKeyGenerationConfigValidate(t *testing.T) {
 		MaxLettersCount:     16,
 	}
 	require.NoError(t, valid.Validate())
+	for _, algorithm := range []struct {
+		name  string
+		bits  int
+		curve string
+	}{{"ed448", 0, ""}, {"RSA", 4096, ""}, {"ecdsa", 0, "BrainpoolP384"}} {
+		cfg := valid
+		cfg.Algorithm, cfg.RSABits, cfg.Curve = algorithm.name, algorithm.bits, algorithm.curve
+		require.NoError(t, cfg.Validate(), algorithm.name)
+	}
 
 	tests := []struct {
 		name   string
@@ -103,6 +257,18 @@ func TestKeyGenerationConfigValidate(t *testing.T) {
 		{"total keys", func(c *KeyGenerationConfig) { c.TotalKeys = -1 }},
 		{"batch size", func(c *KeyGenerationConfig) { c.BatchSize = 0 }},
 		{"letter count", func(c *KeyGenerationConfig) { c.MaxLettersCount = 17 }},
+		{"algorithm", func(c *KeyGenerationConfig) { c.Algorithm = "dsa" }},
+		{"rsa bits", func(c *KeyGenerationConfig) { c.Algorithm, c.RSABits = "rsa", 1024 }},
+		{"ecdsa curve", func(c *KeyGenerationConfig) { c.Algorithm, c.Curve = "ecdsa", "secp256k1" }},
+		{"eddsa curve", func(c *KeyGenerationConfig) { c.Algorithm, c.Curve = "ed25519", "p256" }},
+		{"ecdsa bits", func(c *KeyGenerationConfig) { c.Algorithm, c.RSABits = "ecdsa", 4096 }},
+		{"grind window", func(c *KeyGenerationConfig) { c.GrindWindow = MaxGrindWindow + 1 }},
+		{"grind algorithm", func(c *KeyGenerationConfig) { c.Algorithm, c.GrindWindow = "ed448", 10 }},
+		{"conflict policy", func(c *KeyGenerationConfig) { c.OnConflict = "merge" }},
+		{"keep top", func(c *KeyGenerationConfig) { c.KeepTop = -1 }},
+		{"key version", func(c *KeyGenerationConfig) { c.KeyVersion = 5 }},
+		{"v6 algorithm", func(c *KeyGenerationConfig) { c.Algorithm, c.KeyVersion = "rsa", 6 }},
+		{"v6 grind window", func(c *KeyGenerationConfig) { c.GrindWindow, c.KeyVersion = 10, 6 }},
 	}
 
 	for _, tt := range tests {
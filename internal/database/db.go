@@ -54,7 +54,7 @@ func Connect(cfg config.DatabaseConfig) (*DB, error) {
 		return nil, fmt.Errorf("failed to connect to database with GORM: %w", err)
 	}
 
-	if err := db.AutoMigrate(&models.KeyInfo{}); err != nil {
+	if err := db.AutoMigrate(&models.KeyInfo{}, &models.GenerationRun{}); err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
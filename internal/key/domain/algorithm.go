@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iyuangang/gpgenie/internal/config"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// Key algorithm names accepted by key_generation.algorithm.
+const (
+	AlgorithmEd25519 = "ed25519"
+	AlgorithmEd448   = "ed448"
+	AlgorithmRSA     = "rsa"
+	AlgorithmECDSA   = "ecdsa"
+)
+
+// AlgorithmCv25519 labels Curve25519 ECDH keys. Key generation does not
+// produce them, but vanity mines them as encryption subkeys.
+const AlgorithmCv25519 = "cv25519"
+
+const (
+	defaultRSABits    = 3072
+	defaultECDSACurve = "p256"
+)
+
+var ecdsaCurves = map[string]packet.Curve{
+	"p256":          packet.CurveNistP256,
+	"p384":          packet.CurveNistP384,
+	"p521":          packet.CurveNistP521,
+	"brainpoolp256": packet.CurveBrainpoolP256,
+	"brainpoolp384": packet.CurveBrainpoolP384,
+	"brainpoolp512": packet.CurveBrainpoolP512,
+}
+
+// KeyAlgorithm is a resolved key_generation algorithm selection.
+type KeyAlgorithm struct {
+	// Label identifies the algorithm and its size in stored keys, for example
+	// "ed25519", "rsa3072", or "ecdsa-p384".
+	Label     string
+	algorithm packet.PublicKeyAlgorithm
+	curve     packet.Curve
+	rsaBits   int
+}
+
+// ResolveKeyAlgorithm maps the algorithm, rsa_bits, and curve settings to an
+// OpenPGP key type. An empty algorithm selects Ed25519, RSA defaults to 3072
+// bits, and ECDSA defaults to P-256.
+func ResolveKeyAlgorithm(cfg config.KeyGenerationConfig) (KeyAlgorithm, error) {
+	switch name := strings.ToLower(cfg.Algorithm); name {
+	case "", AlgorithmEd25519:
+		return KeyAlgorithm{Label: AlgorithmEd25519, algorithm: packet.PubKeyAlgoEdDSA, curve: packet.Curve25519}, nil
+	case AlgorithmEd448:
+		return KeyAlgorithm{Label: AlgorithmEd448, algorithm: packet.PubKeyAlgoEdDSA, curve: packet.Curve448}, nil
+	case AlgorithmRSA:
+		bits := cfg.RSABits
+		if bits == 0 {
+			bits = defaultRSABits
+		}
+		if bits < 2048 || bits > 4096 {
+			return KeyAlgorithm{}, fmt.Errorf("unsupported RSA key size %d", bits)
+		}
+		return KeyAlgorithm{Label: fmt.Sprintf("rsa%d", bits), algorithm: packet.PubKeyAlgoRSA, rsaBits: bits}, nil
+	case AlgorithmECDSA:
+		curveName := strings.ToLower(cfg.Curve)
+		if curveName == "" {
+			curveName = defaultECDSACurve
+		}
+		curve, ok := ecdsaCurves[curveName]
+		if !ok {
+			return KeyAlgorithm{}, fmt.Errorf("unsupported ECDSA curve %q", cfg.Curve)
+		}
+		return KeyAlgorithm{Label: "ecdsa-" + curveName, algorithm: packet.PubKeyAlgoECDSA, curve: curve}, nil
+	default:
+		return KeyAlgorithm{}, fmt.Errorf("unsupported key algorithm %q", cfg.Algorithm)
+	}
+}
+
+// apply copies the algorithm selection into an OpenPGP key generation config.
+func (a KeyAlgorithm) apply(packetConfig *packet.Config) {
+	packetConfig.Algorithm = a.algorithm
+	packetConfig.Curve = a.curve
+	packetConfig.RSABits = a.rsaBits
+}
@@ -14,12 +14,26 @@ func NewAnalyzer(repo repository.KeyRepository) *Analyzer {
 	return &Analyzer{repo: repo}
 }
 
-func (a *Analyzer) PerformAnalysis() error {
-	stats, err := a.repo.GetAnalysisStats()
+// PerformAnalysis prints the statistics of the keys matching filter and, when
+// rarest is positive, lists that many of them ranked by rarity.
+func (a *Analyzer) PerformAnalysis(filter repository.KeyFilter, rarest int) error {
+	stats, err := a.repo.GetAnalysisStats(filter)
 	if err != nil {
 		return fmt.Errorf("failed to get analysis statistics: %w", err)
 	}
 
+	if filter.RunID != 0 {
+		fmt.Printf("Generation Run: %d\n", filter.RunID)
+	}
+	if filter.Algorithm != "" {
+		fmt.Printf("Algorithm: %s\n", filter.Algorithm)
+	}
+	if filter.ScoreWindow != "" {
+		fmt.Printf("Score Window: %s\n", filter.ScoreWindow)
+	}
+	if filter != (repository.KeyFilter{}) {
+		fmt.Println()
+	}
 	fmt.Println("=== Score Analysis ===")
 	fmt.Printf("Total Keys: %d\n", stats.Score.Count)
 	fmt.Printf("Average Score: %.2f\n", stats.Score.Average)
@@ -39,8 +53,36 @@ func (a *Analyzer) PerformAnalysis() error {
 	fmt.Printf("Average Increasing Letter Score: %.2f\n", stats.Components.AverageIncreasing)
 	fmt.Printf("Average Decreasing Letter Score: %.2f\n", stats.Components.AverageDecreasing)
 	fmt.Printf("Average Magic Letter Score: %.2f\n", stats.Components.AverageMagic)
+	fmt.Printf("Average Palindrome Score: %.2f\n", stats.Components.AveragePalindrome)
+	fmt.Printf("Average Repeating Block Score: %.2f\n", stats.Components.AverageRepeatingBlock)
+	fmt.Printf("Average Alternating Score: %.2f\n", stats.Components.AverageAlternating)
 	fmt.Println()
 
+	fmt.Println("=== Rarity Analysis ===")
+	fmt.Printf("Average Rarity: %.2f bits\n", stats.Rarity.Average)
+	fmt.Printf("Maximum Rarity: %.2f bits\n", stats.Rarity.Max)
+	fmt.Println()
+	if rarest > 0 {
+		keys, err := a.repo.GetRarestKeys(rarest, filter)
+		if err != nil {
+			return fmt.Errorf("failed to get rarest keys: %w", err)
+		}
+		if len(keys) > 0 {
+			fmt.Println("=== Rarest Keys ===")
+			DisplayKeys(keys)
+			fmt.Println()
+		}
+	}
+
+	if len(stats.Algorithms) > 0 {
+		fmt.Println("=== Algorithm Analysis ===")
+		for _, algorithm := range stats.Algorithms {
+			fmt.Printf("%-20s Keys: %-10d Average Score: %-8.2f Maximum Score: %.2f\n",
+				algorithm.Algorithm, algorithm.Count, algorithm.AverageScore, algorithm.MaxScore)
+		}
+		fmt.Println()
+	}
+
 	fmt.Println("=== Correlation Analysis ===")
 	fmt.Printf("Pearson Correlation Coefficient between Score and Unique Letters Count: %.4f\n", stats.Correlation)
 	switch {
@@ -16,9 +16,9 @@ type MockKeyRepository struct {
 }
 
 // 实现 KeyRepository 接口的所有方法
-func (m *MockKeyRepository) BatchCreate(keys []*models.KeyInfo) error {
-	args := m.Called(keys)
-	return args.Error(0)
+func (m *MockKeyRepository) BatchCreate(keys []*models.KeyInfo, onConflict repository.ConflictPolicy) (repository.BatchResult, error) {
+	args := m.Called(keys, onConflict)
+	return args.Get(0).(repository.BatchResult), args.Error(1)
 }
 
 func (m *MockKeyRepository) Upsert(key *models.KeyInfo) error {
@@ -26,13 +26,23 @@ func (m *MockKeyRepository) Upsert(key *models.KeyInfo) error {
 	return args.Error(0)
 }
 
-func (m *MockKeyRepository) GetTopKeys(limit int) ([]models.KeyInfo, error) {
-	args := m.Called(limit)
+func (m *MockKeyRepository) DeleteByFingerprints(fingerprints []string) (int64, error) {
+	args := m.Called(fingerprints)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockKeyRepository) GetTopKeys(limit int, filter repository.KeyFilter) ([]models.KeyInfo, error) {
+	args := m.Called(limit, filter)
+	return args.Get(0).([]models.KeyInfo), args.Error(1)
+}
+
+func (m *MockKeyRepository) GetLowLetterCountKeys(limit int, filter repository.KeyFilter) ([]models.KeyInfo, error) {
+	args := m.Called(limit, filter)
 	return args.Get(0).([]models.KeyInfo), args.Error(1)
 }
 
-func (m *MockKeyRepository) GetLowLetterCountKeys(limit int) ([]models.KeyInfo, error) {
-	args := m.Called(limit)
+func (m *MockKeyRepository) GetRarestKeys(limit int, filter repository.KeyFilter) ([]models.KeyInfo, error) {
+	args := m.Called(limit, filter)
 	return args.Get(0).([]models.KeyInfo), args.Error(1)
 }
 
@@ -44,20 +54,25 @@ func (m *MockKeyRepository) GetByFingerprint(fingerprint string) (*models.KeyInf
 	return args.Get(0).(*models.KeyInfo), args.Error(1)
 }
 
-func (m *MockKeyRepository) GetAnalysisStats() (*repository.AnalysisStats, error) {
-	args := m.Called()
+func (m *MockKeyRepository) GetAnalysisStats(filter repository.KeyFilter) (*repository.AnalysisStats, error) {
+	args := m.Called(filter)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*repository.AnalysisStats), args.Error(1)
 }
 
+func (m *MockKeyRepository) Rescore(filter repository.KeyFilter, batchSize int, rescore func(*models.KeyInfo) error) (int64, error) {
+	args := m.Called(filter, batchSize, rescore)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 func TestAnalyzer_PerformAnalysis(t *testing.T) {
 	mockRepo := new(MockKeyRepository)
 	analyzer := NewAnalyzer(mockRepo)
 
 	// Setup mock expectations
-	mockRepo.On("GetAnalysisStats").Return(&repository.AnalysisStats{
+	mockRepo.On("GetAnalysisStats", repository.KeyFilter{}).Return(&repository.AnalysisStats{
 		Score: repository.ScoreStats{
 			Average: 100.0,
 			Min:     50.0,
@@ -80,7 +95,7 @@ func TestAnalyzer_PerformAnalysis(t *testing.T) {
 	}, nil)
 
 	// Execute test
-	err := analyzer.PerformAnalysis()
+	err := analyzer.PerformAnalysis(repository.KeyFilter{}, 0)
 
 	// Verify results
 	assert.NoError(t, err)
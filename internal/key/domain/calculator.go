@@ -10,6 +10,9 @@ type Scores struct {
 	IncreasingLetterScore int
 	DecreasingLetterScore int
 	MagicLetterScore      int
+	PalindromeScore       int
+	RepeatingBlockScore   int
+	AlternatingScore      int
 	UniqueLettersCount    int
 }
 
@@ -23,8 +26,9 @@ const (
 // 预计算的分数映射表 - 使用const数组提高性能
 var (
 	// 使用更大的数组避免边界检查
-	repeatScoreMap   [32]int
-	sequenceScoreMap [32]int
+	// Any uint8 run length indexes them, however wide the scoring window.
+	repeatScoreMap   [256]int
+	sequenceScoreMap [256]int
 	// 使用更紧凑的查找表
 	charToValueMap [256]int8
 )
@@ -51,8 +55,8 @@ func init() {
 		charToValueMap[i] = int8(i-'a') + 10
 	}
 
-	// 预计算分数
-	for i := minSeqLength; i <= maxSeqLength; i++ {
+	// 预计算分数；从 1 开始以支持可配置的最小长度
+	for i := 1; i < len(repeatScoreMap); i++ {
 		// 使用位移操作替代乘法
 		repeatScoreMap[i] = int(math.Pow(float64(i), 1.5)) * 16
 		sequenceScoreMap[i] = int(math.Pow(float64(i-1), 1.5)) * 16
@@ -65,8 +69,32 @@ func charToValue(c byte) (int8, bool) {
 	return val, val >= 0
 }
 
+// scoreThresholds are the minimum run lengths that earn a repeat or sequence
+// score. symmetry enables the palindrome, block, and alternating components.
+type scoreThresholds struct {
+	minRepeat   uint8
+	minSequence uint8
+	symmetry    bool
+}
+
+// classicThresholds preserve the original rules: repeats score from three
+// characters, ascending/descending sequences from four, and symmetry is not
+// scored.
+var classicThresholds = scoreThresholds{minRepeat: minSeqLength, minSequence: minSeqLength + 1}
+
+// Total returns the sum of the score components. UniqueLettersCount is a
+// filter criterion rather than a score and is not included.
+func (s Scores) Total() int {
+	return s.RepeatLetterScore + s.IncreasingLetterScore + s.DecreasingLetterScore + s.MagicLetterScore +
+		s.PalindromeScore + s.RepeatingBlockScore + s.AlternatingScore
+}
+
 // CalculateScores 计算给定字符串的各种分数
 func CalculateScores(line string) (Scores, error) {
+	return calculateScores(line, classicThresholds)
+}
+
+func calculateScores(line string, thresholds scoreThresholds) (Scores, error) {
 	length := len(line)
 	if length == 0 {
 		return Scores{}, nil
@@ -114,7 +142,7 @@ func CalculateScores(line string) (Scores, error) {
 			if current == prevChar {
 				repeatLen++
 			} else {
-				if repeatLen >= minSeqLength {
+				if repeatLen >= thresholds.minRepeat {
 					score := repeatScoreMap[repeatLen]
 					if score > maxRepeatScore {
 						maxRepeatScore = score
@@ -133,13 +161,13 @@ func CalculateScores(line string) (Scores, error) {
 				decreasingLen++
 				increasingLen = 1
 			default:
-				if increasingLen > minSeqLength {
+				if increasingLen >= thresholds.minSequence {
 					score := sequenceScoreMap[increasingLen]
 					if score > maxIncreasingScore {
 						maxIncreasingScore = score
 					}
 				}
-				if decreasingLen > minSeqLength {
+				if decreasingLen >= thresholds.minSequence {
 					score := sequenceScoreMap[decreasingLen]
 					if score > maxDecreasingScore {
 						maxDecreasingScore = score
@@ -155,30 +183,37 @@ func CalculateScores(line string) (Scores, error) {
 	}
 
 	// 处理最后的序列
-	if repeatLen >= minSeqLength {
+	if repeatLen >= thresholds.minRepeat {
 		score := repeatScoreMap[repeatLen]
 		if score > maxRepeatScore {
 			maxRepeatScore = score
 		}
 	}
-	if increasingLen > minSeqLength {
+	if increasingLen >= thresholds.minSequence {
 		score := sequenceScoreMap[increasingLen]
 		if score > maxIncreasingScore {
 			maxIncreasingScore = score
 		}
 	}
-	if decreasingLen > minSeqLength {
+	if decreasingLen >= thresholds.minSequence {
 		score := sequenceScoreMap[decreasingLen]
 		if score > maxDecreasingScore {
 			maxDecreasingScore = score
 		}
 	}
 
+	var palindrome, block, alternating int
+	if thresholds.symmetry {
+		palindrome, block, alternating = symmetryScores(line)
+	}
 	return Scores{
 		RepeatLetterScore:     maxRepeatScore,
 		IncreasingLetterScore: maxIncreasingScore,
 		DecreasingLetterScore: maxDecreasingScore,
 		MagicLetterScore:      boolToInt(hasMagicSequence) * magicScore,
+		PalindromeScore:       palindrome,
+		RepeatingBlockScore:   block,
+		AlternatingScore:      alternating,
 		UniqueLettersCount:    uniqueCount,
 	}, nil
 }
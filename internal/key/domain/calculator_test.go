@@ -3,6 +3,7 @@ package domain
 import (
 	"fmt"
 	"math"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -61,6 +62,13 @@ func TestCalculateScores(t *testing.T) {
 				UniqueLettersCount:    6,
 			},
 		},
+		{
+			name:  "symmetry is not scored",
+			input: "AB1221BA",
+			expected: Scores{
+				UniqueLettersCount: 4,
+			},
+		},
 		{
 			name:  "mixed case",
 			input: "aAbBcC",
@@ -180,6 +188,78 @@ func TestScoreMaps(t *testing.T) {
 	}
 }
 
+func TestCalculateScoresWithSymmetry(t *testing.T) {
+	thresholds := classicThresholds
+	thresholds.symmetry = true
+	tests := []struct {
+		name     string
+		input    string
+		expected Scores
+	}{
+		{
+			name:  "palindrome",
+			input: "AB1221BA",
+			expected: Scores{
+				PalindromeScore:    repeatScoreMap[5],
+				UniqueLettersCount: 4,
+			},
+		},
+		{
+			name:  "repeating block",
+			input: "1A2B1A2B",
+			expected: Scores{
+				RepeatingBlockScore: repeatScoreMap[5],
+				UniqueLettersCount:  4,
+			},
+		},
+		{
+			name:  "alternating",
+			input: "A5A5A5A5",
+			expected: Scores{
+				PalindromeScore:    repeatScoreMap[4],
+				AlternatingScore:   repeatScoreMap[7],
+				UniqueLettersCount: 2,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scores, err := calculateScores(tt.input, thresholds)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, scores)
+		})
+	}
+}
+
+func TestSymmetryScoresIgnoreSingleDigitRuns(t *testing.T) {
+	// Runs are palindromic and periodic but score only as repeats.
+	palindrome, block, alternating := symmetryScores("7777777777")
+	assert.Zero(t, palindrome)
+	assert.Zero(t, block)
+	assert.Zero(t, alternating)
+
+	// An alternation is not counted again as a four-digit block.
+	palindrome, block, alternating = symmetryScores("0C0C0C0C")
+	assert.Equal(t, repeatScoreMap[4], palindrome)
+	assert.Zero(t, block)
+	assert.Equal(t, repeatScoreMap[7], alternating)
+
+	// The longest palindrome wins, even around a run.
+	assert.Equal(t, 11, longestPalindrome("12AB333BA21"))
+	assert.Equal(t, 0, longestPalindrome("1234"))
+	assert.Equal(t, 6, longestPeriodic("xABCABCABCy", 3))
+	assert.Equal(t, 0, longestPeriodic("ABCAB", 3))
+}
+
+func TestCalculateScoresFullWindow(t *testing.T) {
+	// A full v6 fingerprint can hold runs longer than any 16-digit suffix.
+	scores, err := CalculateScores(strings.Repeat("a", 40) + "0123456789abcdef0123")
+	require.NoError(t, err)
+	assert.Equal(t, repeatScoreMap[40], scores.RepeatLetterScore)
+	assert.Equal(t, sequenceScoreMap[20], scores.IncreasingLetterScore)
+}
+
 // 基准测试
 func BenchmarkCalculateScores(b *testing.B) {
 	benchmarks := []struct {
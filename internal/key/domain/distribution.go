@@ -0,0 +1,253 @@
+package domain
+
+import (
+	"math"
+	"slices"
+	"sort"
+)
+
+// Kinds of run the last scored digit belongs to.
+const (
+	runNone uint8 = iota
+	runRepeat
+	runIncreasing
+	runDecreasing
+)
+
+// runState is what calculateScores knows after a prefix of the digits: the
+// longest scored repeat, increasing, and decreasing runs so far (zero when
+// none scores), and the kind and length of the run still open.
+type runState struct {
+	repeat, increasing, decreasing uint8
+	kind, length                   uint8
+}
+
+// scoreDistribution is the exact distribution of a scorer's totals over
+// uniformly random digits.
+type scoreDistribution struct {
+	// scores are the reachable totals in descending order and tails[i] is
+	// the probability of scoring at least scores[i].
+	scores []int
+	tails  []float64
+}
+
+// hasDistribution reports whether distribution can compute the scores of
+// c exactly. Symmetry and configured magic sequences depend on the whole
+// digit string rather than on the runs, so they are sampled instead.
+func (c *classicScorer) hasDistribution() bool {
+	return c.magic == nil && !c.thresholds.symmetry
+}
+
+// distribution computes the distribution of c's totals over digits random
+// hexadecimal digits by dynamic programming over the digit position, with
+// one state per runState. While no 49 has been seen the state also tracks
+// the last digit, since that decides whether the next digit completes one.
+// The number of states grows with the cube of digits: 16 digits take
+// milliseconds, a full 64-digit version 6 fingerprint a few seconds.
+func (c *classicScorer) distribution(digits int) *scoreDistribution {
+	magic := applyWeight(magicScore, c.weights[3])
+	width := 1
+	if magic != 0 {
+		// Mass with no 49 yet by last digit, then mass with a 49.
+		width = 17
+	}
+	states := []runState{{kind: runNone, length: 1}}
+	mass := make([]float64, width)
+	if width == 1 {
+		mass[0] = 1
+	} else {
+		for d := 0; d < 16; d++ {
+			mass[d] = 1.0 / 16
+		}
+	}
+
+	// Next states are found by their longest runs, then by their open run
+	// in a dense table, which is much faster than one large map.
+	stride := 4 * (digits + 1)
+	absent := slices.Repeat([]int32{-1}, stride)
+	var empty [17]float64
+	var (
+		slots    []int32
+		next     []runState
+		nextMass []float64
+	)
+	for i := 1; i < digits; i++ {
+		longest := make(map[uint32]int, len(states)/8)
+		lastKey, lastID := uint32(1<<31), 0
+		slots, next, nextMass = slots[:0], next[:0], nextMass[:0]
+		slot := func(s runState) []float64 {
+			key := uint32(s.repeat) | uint32(s.increasing)<<8 | uint32(s.decreasing)<<16
+			if key != lastKey {
+				id, ok := longest[key]
+				if !ok {
+					id = len(longest)
+					longest[key] = id
+					slots = append(slots, absent...)
+				}
+				lastKey, lastID = key, id
+			}
+			at := lastID*stride + int(s.kind)*(digits+1) + int(s.length)
+			j := int(slots[at])
+			if j < 0 {
+				j = len(next)
+				slots[at] = int32(j)
+				next = append(next, s)
+				nextMass = append(nextMass, empty[:width]...)
+			}
+			return nextMass[j*width : (j+1)*width]
+		}
+		remaining := uint8(digits - 1 - i)
+		for k, s := range states {
+			from := mass[k*width : (k+1)*width]
+			shiftMass(slot(c.extend(s, runRepeat, remaining)), from, 0)
+			shiftMass(slot(c.extend(s, runIncreasing, remaining)), from, 1)
+			shiftMass(slot(c.extend(s, runDecreasing, remaining)), from, 15)
+			jumpMass(slot(c.extend(s, runNone, remaining)), from)
+		}
+		states, next, mass, nextMass = next, states, nextMass, mass
+	}
+
+	totals := make(map[int]float64)
+	for k, s := range states {
+		s = c.flush(s)
+		base := applyWeight(repeatScoreMap[s.repeat], c.weights[0]) +
+			applyWeight(sequenceScoreMap[s.increasing], c.weights[1]) +
+			applyWeight(sequenceScoreMap[s.decreasing], c.weights[2])
+		from := mass[k*width : (k+1)*width]
+		if width == 1 {
+			totals[base] += from[0]
+			continue
+		}
+		var clean float64
+		for _, m := range from[:16] {
+			clean += m
+		}
+		if clean > 0 {
+			totals[base] += clean
+		}
+		if from[16] > 0 {
+			totals[base+magic] += from[16]
+		}
+	}
+
+	dist := &scoreDistribution{scores: make([]int, 0, len(totals))}
+	for score := range totals {
+		dist.scores = append(dist.scores, score)
+	}
+	slices.Sort(dist.scores)
+	slices.Reverse(dist.scores)
+	// Summing from the rarest score keeps the small tails precise.
+	var tail float64
+	for _, score := range dist.scores {
+		tail += totals[score]
+		dist.tails = append(dist.tails, tail)
+	}
+	return dist
+}
+
+// extend returns the state after a digit that continues a run of kind, or
+// starts no run for runNone, with remaining digits still to come.
+func (c *classicScorer) extend(s runState, kind uint8, remaining uint8) runState {
+	if kind != runNone && kind == s.kind {
+		s.length++
+	} else {
+		// An increasing run broken by a decreasing step, or the reverse, is
+		// dropped without being scored, as calculateScores does.
+		if !(s.kind == runIncreasing && kind == runDecreasing || s.kind == runDecreasing && kind == runIncreasing) {
+			s = c.flush(s)
+		}
+		s.kind, s.length = kind, 2
+		if kind == runNone {
+			s.length = 1
+		}
+	}
+	// A repeat run at least as long as the longest one so far makes that
+	// one irrelevant; forgetting it merges otherwise identical states.
+	if s.kind == runRepeat && s.length >= s.repeat {
+		s.repeat = 0
+	}
+	// An open run that cannot grow into a scoring or longest run before the
+	// digits run out behaves like no run at all.
+	var needed uint8
+	switch s.kind {
+	case runRepeat:
+		needed = max(c.thresholds.minRepeat, s.repeat+1)
+	case runIncreasing:
+		needed = max(c.thresholds.minSequence, s.increasing+1)
+	case runDecreasing:
+		needed = max(c.thresholds.minSequence, s.decreasing+1)
+	}
+	if s.kind != runNone && (c.weights[s.kind-1] == 0 || int(s.length)+int(remaining) < int(needed)) {
+		s.kind, s.length = runNone, 1
+	}
+	return s
+}
+
+// flush scores the open run of s. Components with a zero weight are not
+// recorded, which merges states that differ only there.
+func (c *classicScorer) flush(s runState) runState {
+	switch s.kind {
+	case runRepeat:
+		if c.weights[0] != 0 && s.length >= c.thresholds.minRepeat {
+			s.repeat = max(s.repeat, s.length)
+		}
+	case runIncreasing:
+		if c.weights[1] != 0 && s.length >= c.thresholds.minSequence {
+			s.increasing = max(s.increasing, s.length)
+		}
+	case runDecreasing:
+		if c.weights[2] != 0 && s.length >= c.thresholds.minSequence {
+			s.decreasing = max(s.decreasing, s.length)
+		}
+	}
+	s.kind, s.length = runNone, 1
+	return s
+}
+
+// shiftMass adds the mass of from moved to the digit shift above the last
+// one (modulo 16), which has probability 1/16.
+func shiftMass(to, from []float64, shift int) {
+	if len(from) == 1 {
+		to[0] += from[0] / 16
+		return
+	}
+	for d := 0; d < 16; d++ {
+		to[(d+shift)&15] += from[d] / 16
+	}
+	to[16] += from[16] / 16
+}
+
+// jumpMass adds the mass of from moved to any of the 13 digits that neither
+// repeat the last digit nor continue a sequence. A 4 followed by 9 moves its
+// mass to the 49 slot.
+func jumpMass(to, from []float64) {
+	if len(from) == 1 {
+		to[0] += from[0] * 13 / 16
+		return
+	}
+	var sum float64
+	for _, m := range from[:16] {
+		sum += m
+	}
+	for d := 0; d < 16; d++ {
+		reached := sum - from[(d+15)&15] - from[d] - from[(d+1)&15]
+		if d == 9 {
+			reached -= from[4]
+		}
+		to[d] += max(reached, 0) / 16
+	}
+	to[16] += (13*from[16] + from[4]) / 16
+}
+
+// rarity returns -log2 of the probability of scoring at least score. A
+// score above every reachable total gets the rarity of the highest one.
+func (d *scoreDistribution) rarity(score int) float64 {
+	reached := sort.Search(len(d.scores), func(i int) bool { return d.scores[i] < score })
+	switch reached {
+	case len(d.scores):
+		return 0
+	case 0:
+		reached = 1
+	}
+	return -math.Log2(d.tails[reached-1])
+}
@@ -0,0 +1,414 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FilterInput holds the values an acceptance expression can reference for one
+// candidate.
+type FilterInput struct {
+	Scores Scores
+	// Suffix is the scored fingerprint suffix. Run lengths are derived from it
+	// only when the expression uses them.
+	Suffix string
+	// Pattern reports a pattern target hit.
+	Pattern bool
+
+	runs    [3]int
+	hasRuns bool
+}
+
+func (in *FilterInput) run(index int) int {
+	if !in.hasRuns {
+		in.runs[0], in.runs[1], in.runs[2] = LongestRuns(in.Suffix)
+		in.hasRuns = true
+	}
+	return in.runs[index]
+}
+
+// filterVariables are the names an expression may use. Integer variables
+// return their value; pattern is the only boolean.
+var filterVariables = map[string]func(*FilterInput) int{
+	"score":          func(in *FilterInput) int { return in.Scores.Total() },
+	"repeat":         func(in *FilterInput) int { return in.Scores.RepeatLetterScore },
+	"increasing":     func(in *FilterInput) int { return in.Scores.IncreasingLetterScore },
+	"decreasing":     func(in *FilterInput) int { return in.Scores.DecreasingLetterScore },
+	"magic":          func(in *FilterInput) int { return in.Scores.MagicLetterScore },
+	"palindrome":     func(in *FilterInput) int { return in.Scores.PalindromeScore },
+	"block":          func(in *FilterInput) int { return in.Scores.RepeatingBlockScore },
+	"alternating":    func(in *FilterInput) int { return in.Scores.AlternatingScore },
+	"unique":         func(in *FilterInput) int { return in.Scores.UniqueLettersCount },
+	"repeat_run":     func(in *FilterInput) int { return in.run(0) },
+	"increasing_run": func(in *FilterInput) int { return in.run(1) },
+	"decreasing_run": func(in *FilterInput) int { return in.run(2) },
+}
+
+const filterPatternVariable = "pattern"
+
+// FilterVariables returns the names accepted by CompileFilter in sorted order.
+func FilterVariables() []string {
+	names := []string{filterPatternVariable}
+	for name := range filterVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Filter is a compiled acceptance expression. It is safe for concurrent use.
+type Filter struct {
+	source string
+	eval   func(*FilterInput) bool
+}
+
+// CompileFilter compiles a boolean expression such as
+//
+//	score >= 300 || (unique <= 4 && repeat > 0)
+//
+// Operands are integer literals, true, false, and the variables listed by
+// FilterVariables. Operators, from lowest to highest precedence, are ||, &&,
+// the comparisons == != < <= > >=, + -, * / %, and the unary ! and -.
+func CompileFilter(source string) (*Filter, error) {
+	p := &filterParser{source: source}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEnd {
+		return nil, p.errorAt(tok, "unexpected %q", tok.text)
+	}
+	if node.boolean == nil {
+		return nil, fmt.Errorf("filter %q must be a boolean expression, e.g. score >= 300", source)
+	}
+	return &Filter{source: source, eval: node.boolean}, nil
+}
+
+// String returns the source expression.
+func (f *Filter) String() string { return f.source }
+
+// Eval reports whether the candidate passes the filter.
+func (f *Filter) Eval(in *FilterInput) bool { return f.eval(in) }
+
+// LongestRuns returns the longest run of one repeated digit and of ascending
+// and descending consecutive digits in a hexadecimal string. Sequences wrap
+// between f and 0 like the score calculation.
+func LongestRuns(hex string) (repeat, increasing, decreasing int) {
+	if hex == "" {
+		return 0, 0, 0
+	}
+	repeatLen, increasingLen, decreasingLen := 1, 1, 1
+	repeat, increasing, decreasing = 1, 1, 1
+	prev := charToValueMap[hex[0]]
+	for i := 1; i < len(hex); i++ {
+		current := charToValueMap[hex[i]]
+		if current < 0 || prev < 0 {
+			repeatLen, increasingLen, decreasingLen = 1, 1, 1
+			prev = current
+			continue
+		}
+		if current == prev {
+			repeatLen++
+		} else {
+			repeatLen = 1
+		}
+		switch (current - prev + 16) % 16 {
+		case 1:
+			increasingLen++
+			decreasingLen = 1
+		case 15:
+			decreasingLen++
+			increasingLen = 1
+		default:
+			increasingLen, decreasingLen = 1, 1
+		}
+		repeat = max(repeat, repeatLen)
+		increasing = max(increasing, increasingLen)
+		decreasing = max(decreasing, decreasingLen)
+		prev = current
+	}
+	return repeat, increasing, decreasing
+}
+
+type filterTokenKind int
+
+const (
+	tokenEnd filterTokenKind = iota
+	tokenNumber
+	tokenIdent
+	tokenOperator
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+	pos  int
+}
+
+// filterNode is a compiled subexpression; exactly one of its functions is set.
+type filterNode struct {
+	integer func(*FilterInput) int
+	boolean func(*FilterInput) bool
+}
+
+type filterParser struct {
+	source string
+	tokens []filterToken
+	next   int
+}
+
+// filterOperators lists two-character operators before their one-character
+// prefixes so that tokenize matches the longest operator.
+var filterOperators = []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "+", "-", "*", "/", "%", "!", "(", ")"}
+
+func (p *filterParser) tokenize() error {
+	for i := 0; i < len(p.source); {
+		char := p.source[i]
+		switch {
+		case char == ' ' || char == '\t' || char == '\n' || char == '\r':
+			i++
+		case char >= '0' && char <= '9':
+			start := i
+			for i < len(p.source) && p.source[i] >= '0' && p.source[i] <= '9' {
+				i++
+			}
+			p.tokens = append(p.tokens, filterToken{kind: tokenNumber, text: p.source[start:i], pos: start})
+		case char == '_' || (char|0x20 >= 'a' && char|0x20 <= 'z'):
+			start := i
+			for i < len(p.source) && (p.source[i] == '_' || (p.source[i]|0x20 >= 'a' && p.source[i]|0x20 <= 'z') || (p.source[i] >= '0' && p.source[i] <= '9')) {
+				i++
+			}
+			p.tokens = append(p.tokens, filterToken{kind: tokenIdent, text: strings.ToLower(p.source[start:i]), pos: start})
+		default:
+			matched := false
+			for _, op := range filterOperators {
+				if strings.HasPrefix(p.source[i:], op) {
+					p.tokens = append(p.tokens, filterToken{kind: tokenOperator, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return fmt.Errorf("filter %q: unexpected character %q at column %d", p.source, char, i+1)
+			}
+		}
+	}
+	p.tokens = append(p.tokens, filterToken{kind: tokenEnd, text: "end of expression", pos: len(p.source)})
+	return nil
+}
+
+func (p *filterParser) peek() filterToken { return p.tokens[p.next] }
+
+func (p *filterParser) accept(op string) bool {
+	if tok := p.peek(); tok.kind == tokenOperator && tok.text == op {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) errorAt(tok filterToken, format string, args ...any) error {
+	return fmt.Errorf("filter %q: %s at column %d", p.source, fmt.Sprintf(format, args...), tok.pos+1)
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peek().text == "||" {
+		tok := p.peek()
+		p.next++
+		var right filterNode
+		if right, err = p.parseAnd(); err != nil {
+			break
+		}
+		if left.boolean == nil || right.boolean == nil {
+			return left, p.errorAt(tok, "|| needs boolean operands")
+		}
+		l, r := left.boolean, right.boolean
+		left = filterNode{boolean: func(in *FilterInput) bool { return l(in) || r(in) }}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseComparison()
+	for err == nil && p.peek().text == "&&" {
+		tok := p.peek()
+		p.next++
+		var right filterNode
+		if right, err = p.parseComparison(); err != nil {
+			break
+		}
+		if left.boolean == nil || right.boolean == nil {
+			return left, p.errorAt(tok, "&& needs boolean operands")
+		}
+		l, r := left.boolean, right.boolean
+		left = filterNode{boolean: func(in *FilterInput) bool { return l(in) && r(in) }}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return left, err
+	}
+	tok := p.peek()
+	switch tok.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return left, nil
+	}
+	p.next++
+	right, err := p.parseSum()
+	if err != nil {
+		return left, err
+	}
+	if left.boolean != nil && right.boolean != nil && (tok.text == "==" || tok.text == "!=") {
+		l, r, equal := left.boolean, right.boolean, tok.text == "=="
+		return filterNode{boolean: func(in *FilterInput) bool { return (l(in) == r(in)) == equal }}, nil
+	}
+	if left.integer == nil || right.integer == nil {
+		return left, p.errorAt(tok, "%s needs integer operands", tok.text)
+	}
+	l, r := left.integer, right.integer
+	var compare func(a, b int) bool
+	switch tok.text {
+	case "==":
+		compare = func(a, b int) bool { return a == b }
+	case "!=":
+		compare = func(a, b int) bool { return a != b }
+	case "<":
+		compare = func(a, b int) bool { return a < b }
+	case "<=":
+		compare = func(a, b int) bool { return a <= b }
+	case ">":
+		compare = func(a, b int) bool { return a > b }
+	default:
+		compare = func(a, b int) bool { return a >= b }
+	}
+	if next := p.peek(); next.kind == tokenOperator && strings.ContainsAny(next.text, "<>=") && next.text != "!" {
+		return left, p.errorAt(next, "comparisons cannot be chained; combine them with &&")
+	}
+	return filterNode{boolean: func(in *FilterInput) bool { return compare(l(in), r(in)) }}, nil
+}
+
+func (p *filterParser) parseSum() (filterNode, error) {
+	return p.parseArithmetic(p.parseProduct, "+", "-")
+}
+
+func (p *filterParser) parseProduct() (filterNode, error) {
+	return p.parseArithmetic(p.parseUnary, "*", "/", "%")
+}
+
+func (p *filterParser) parseArithmetic(operand func() (filterNode, error), ops ...string) (filterNode, error) {
+	left, err := operand()
+	for err == nil {
+		tok := p.peek()
+		if tok.kind != tokenOperator || !slices.Contains(ops, tok.text) {
+			break
+		}
+		p.next++
+		var right filterNode
+		if right, err = operand(); err != nil {
+			break
+		}
+		if left.integer == nil || right.integer == nil {
+			return left, p.errorAt(tok, "%s needs integer operands", tok.text)
+		}
+		l, r := left.integer, right.integer
+		switch tok.text {
+		case "+":
+			left = filterNode{integer: func(in *FilterInput) int { return l(in) + r(in) }}
+		case "-":
+			left = filterNode{integer: func(in *FilterInput) int { return l(in) - r(in) }}
+		case "*":
+			left = filterNode{integer: func(in *FilterInput) int { return l(in) * r(in) }}
+		case "/":
+			left = filterNode{integer: func(in *FilterInput) int {
+				if divisor := r(in); divisor != 0 {
+					return l(in) / divisor
+				}
+				return 0
+			}}
+		default:
+			left = filterNode{integer: func(in *FilterInput) int {
+				if divisor := r(in); divisor != 0 {
+					return l(in) % divisor
+				}
+				return 0
+			}}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	tok := p.peek()
+	switch {
+	case p.accept("!"):
+		operand, err := p.parseUnary()
+		if err != nil {
+			return operand, err
+		}
+		if operand.boolean == nil {
+			return operand, p.errorAt(tok, "! needs a boolean operand")
+		}
+		f := operand.boolean
+		return filterNode{boolean: func(in *FilterInput) bool { return !f(in) }}, nil
+	case p.accept("-"):
+		operand, err := p.parseUnary()
+		if err != nil {
+			return operand, err
+		}
+		if operand.integer == nil {
+			return operand, p.errorAt(tok, "- needs an integer operand")
+		}
+		f := operand.integer
+		return filterNode{integer: func(in *FilterInput) int { return -f(in) }}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *filterParser) parsePrimary() (filterNode, error) {
+	tok := p.peek()
+	p.next++
+	switch tok.kind {
+	case tokenNumber:
+		value, err := strconv.Atoi(tok.text)
+		if err != nil {
+			return filterNode{}, p.errorAt(tok, "invalid number %q", tok.text)
+		}
+		return filterNode{integer: func(*FilterInput) int { return value }}, nil
+	case tokenIdent:
+		switch tok.text {
+		case "true", "false":
+			value := tok.text == "true"
+			return filterNode{boolean: func(*FilterInput) bool { return value }}, nil
+		case filterPatternVariable:
+			return filterNode{boolean: func(in *FilterInput) bool { return in.Pattern }}, nil
+		}
+		if variable, ok := filterVariables[tok.text]; ok {
+			return filterNode{integer: variable}, nil
+		}
+		return filterNode{}, p.errorAt(tok, "unknown variable %q (available: %s)", tok.text, strings.Join(FilterVariables(), ", "))
+	case tokenOperator:
+		if tok.text == "(" {
+			node, err := p.parseOr()
+			if err != nil {
+				return node, err
+			}
+			if !p.accept(")") {
+				return node, p.errorAt(p.peek(), "expected )")
+			}
+			return node, nil
+		}
+	}
+	return filterNode{}, p.errorAt(tok, "unexpected %q", tok.text)
+}
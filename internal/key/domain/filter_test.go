@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterEval(t *testing.T) {
+	input := FilterInput{
+		Scores: Scores{
+			RepeatLetterScore:     100,
+			IncreasingLetterScore: 40,
+			MagicLetterScore:      160,
+			UniqueLettersCount:    4,
+		},
+		Suffix: "aaaa0123fedc1111",
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"score >= 300", true},
+		{"score > 300", false},
+		{"score >= 300 || (unique <= 4 && repeat > 0)", true},
+		{"unique < 4 && repeat > 0", false},
+		{"!(magic == 160)", false},
+		{"repeat + increasing * 2 == 180", true},
+		{"score / 0 == 0 && score % 7 == 6", true},
+		{"-decreasing == 0 && decreasing != -1", true},
+		{"repeat_run == 4 && increasing_run == 4 && decreasing_run == 4", true},
+		{"pattern", false},
+		{"!pattern == true", true},
+		{"TRUE && Score >= 0", true},
+		{"false || 1 > 2", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			filter, err := CompileFilter(tt.expr)
+			require.NoError(t, err)
+			in := input
+			assert.Equal(t, tt.want, filter.Eval(&in))
+			assert.Equal(t, tt.expr, filter.String())
+		})
+	}
+}
+
+func TestCompileFilterRejectsInvalidExpressions(t *testing.T) {
+	tests := map[string]string{
+		"":                         "unexpected",
+		"score":                    "boolean expression",
+		"score >":                  "unexpected",
+		"score >= 1 >= 2":          "chained",
+		"luck > 3":                 "unknown variable",
+		"(score > 1":               "expected )",
+		"score > 1)":               "unexpected",
+		"score > 1 && 2":           "&& needs boolean",
+		"!score":                   "! needs a boolean",
+		"pattern + 1 > 0":          "+ needs integer",
+		"score = 1":                "unexpected character",
+		"99999999999999999999 > 1": "invalid number",
+	}
+	for expr, want := range tests {
+		t.Run(expr, func(t *testing.T) {
+			_, err := CompileFilter(expr)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), want)
+		})
+	}
+}
+
+func TestLongestRuns(t *testing.T) {
+	repeat, increasing, decreasing := LongestRuns("ef0123aaa98a")
+	assert.Equal(t, 3, repeat)
+	assert.Equal(t, 6, increasing, "sequences wrap from f to 0")
+	assert.Equal(t, 3, decreasing)
+
+	repeat, increasing, decreasing = LongestRuns("")
+	assert.Zero(t, repeat+increasing+decreasing)
+}
@@ -1,61 +1,30 @@
 package domain
 
 import (
-	"bytes"
 	"crypto/ed25519"
-	"crypto/sha256"
-	"encoding/binary"
 	"fmt"
 
+	"github.com/iyuangang/gpgenie/internal/config"
+
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/ProtonMail/go-crypto/openpgp/packet"
 )
 
-// CalculateFingerprint 计算公钥的 SHA256 指纹
+// CalculateFingerprint returns the RFC 9580 v6 fingerprint of an Ed25519
+// public key as upper-case hexadecimal.
 func CalculateFingerprint(pubKey *packet.PublicKey) (string, error) {
-	// 预分配足够大的缓冲区
-	buf := bytes.NewBuffer(make([]byte, 0, 128))
-
-	// 1. 写入包头
-	// Version 4
-	if err := buf.WriteByte(0x04); err != nil {
-		return "", fmt.Errorf("failed to write version: %w", err)
-	}
-
-	// 2. 写入创建时间
-	timeBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(timeBytes, uint32(pubKey.CreationTime.Unix()))
-	if _, err := buf.Write(timeBytes); err != nil {
-		return "", fmt.Errorf("failed to write creation time: %w", err)
-	}
-
-	// 3. 写入算法类型
-	if err := buf.WriteByte(byte(pubKey.PubKeyAlgo)); err != nil {
-		return "", fmt.Errorf("failed to write algorithm: %w", err)
-	}
-
-	// 4. 写入公钥数据
 	switch pubKey.PubKeyAlgo {
 	case packet.PubKeyAlgoEdDSA:
-		// ED25519 公钥长度固定为 32 字节
-		if err := buf.WriteByte(32); err != nil {
-			return "", fmt.Errorf("failed to write key length: %w", err)
-		}
-		if _, err := buf.Write(pubKey.PublicKey.(ed25519.PublicKey)); err != nil {
-			return "", fmt.Errorf("failed to write public key: %w", err)
+		public, ok := pubKey.PublicKey.(ed25519.PublicKey)
+		if !ok {
+			return "", fmt.Errorf("unsupported EdDSA public key type %T", pubKey.PublicKey)
 		}
+		fingerprint := v6Fingerprint(v6PublicKeyBody(pubKey.CreationTime, public))
+		return fmt.Sprintf("%X", fingerprint), nil
 	// 可以添加其他算法的支持
 	default:
 		return "", fmt.Errorf("unsupported public key algorithm: %v", pubKey.PubKeyAlgo)
 	}
-
-	// 5. 计算 SHA256 哈希
-	hash := sha256.New()
-	hash.Write(buf.Bytes())
-	fingerprint := hash.Sum(nil)
-
-	// 6. 转换为十六进制字符串
-	return fmt.Sprintf("%X", fingerprint), nil
 }
 
 // 用于验证指纹的辅助函数
@@ -74,3 +43,39 @@ func GetLastSixteen(fingerprint string) string {
 	}
 	return fingerprint[len(fingerprint)-16:]
 }
+
+// KeyID returns the long key ID of fingerprint: the last 16 digits of a v4
+// fingerprint, but the leading 16 of a 64-digit v6 one.
+func KeyID(fingerprint string) string {
+	if len(fingerprint) == 64 {
+		return fingerprint[:16]
+	}
+	return GetLastSixteen(fingerprint)
+}
+
+// ScoringDigits returns the digits of fingerprint that window selects. A
+// window reaching past either end of a shorter fingerprint is clipped to it.
+func ScoringDigits(window config.ScoringWindow, fingerprint string) string {
+	start, end := scoringBounds(window, len(fingerprint))
+	return fingerprint[start:end]
+}
+
+// ScoringDigitCount returns how many digits window selects from a
+// fingerprint of length digits.
+func ScoringDigitCount(window config.ScoringWindow, length int) int {
+	start, end := scoringBounds(window, length)
+	return end - start
+}
+
+func scoringBounds(window config.ScoringWindow, length int) (start, end int) {
+	start = window.Offset
+	if start < 0 {
+		start = max(length+start, 0)
+	}
+	start = min(start, length)
+	end = length
+	if window.Length > 0 {
+		end = min(start+window.Length, end)
+	}
+	return start, end
+}
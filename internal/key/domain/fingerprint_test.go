@@ -7,6 +7,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/iyuangang/gpgenie/internal/config"
+
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/ProtonMail/go-crypto/openpgp/packet"
 	"github.com/stretchr/testify/assert"
@@ -67,6 +69,19 @@ func TestCalculateFingerprint(t *testing.T) {
 	}
 }
 
+func TestCalculateFingerprintMatchesRFC9580Sample(t *testing.T) {
+	// The primary key of the sample v6 certificate in RFC 9580 appendix A.3.
+	pub, err := hex.DecodeString("f94da7bb48d60a61e567706a6587d0331999bb9d891a08242ead84543df895a3")
+	require.NoError(t, err)
+	fingerprint, err := CalculateFingerprint(&packet.PublicKey{
+		CreationTime: time.Unix(0x63877fe3, 0),
+		PubKeyAlgo:   packet.PubKeyAlgoEdDSA,
+		PublicKey:    ed25519.PublicKey(pub),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "CB186C4F0609A697E4D52DFA6C722B0C1F1E27C18A56708F6525EC27BAD9ACC9", fingerprint)
+}
+
 func TestVerifyFingerprint(t *testing.T) {
 	tests := []struct {
 		name                string
@@ -161,6 +176,34 @@ func TestGetLastSixteen(t *testing.T) {
 	}
 }
 
+func TestKeyID(t *testing.T) {
+	v4 := "0123456789ABCDEF0123456789ABCDEF01234567"
+	v6 := "CB186C4F0609A697E4D52DFA6C722B0C1F1E27C18A56708F6525EC27BAD9ACC9"
+	assert.Equal(t, "89ABCDEF01234567", KeyID(v4))
+	assert.Equal(t, "CB186C4F0609A697", KeyID(v6))
+	assert.Equal(t, "0123", KeyID("0123"))
+}
+
+func TestScoringDigits(t *testing.T) {
+	fingerprint := "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		window config.ScoringWindow
+		want   string
+	}{
+		{config.ScoringWindow{Offset: -16, Length: 16}, "89abcdef01234567"},
+		{config.ScoringWindow{Offset: -8, Length: 8}, "01234567"},
+		{config.ScoringWindow{}, fingerprint},
+		{config.ScoringWindow{Offset: 0, Length: 8}, "01234567"},
+		{config.ScoringWindow{Offset: 36, Length: 8}, "4567"},
+		{config.ScoringWindow{Offset: -64, Length: 4}, "0123"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ScoringDigits(tt.window, fingerprint), tt.window.String())
+		assert.Equal(t, len(tt.want), ScoringDigitCount(tt.window, len(fingerprint)), tt.window.String())
+	}
+	assert.Equal(t, "abc", ScoringDigits(config.ScoringWindow{Offset: -16, Length: 16}, "abc"))
+}
+
 // 基准测试
 func BenchmarkCalculateFingerprint(b *testing.B) {
 	pub, _, err := GenerateBareKeyPair()
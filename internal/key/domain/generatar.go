@@ -22,6 +22,46 @@ func GenerateKeyPair(cfg config.KeyGenerationConfig) (*openpgp.Entity, error) {
 	return entity, nil
 }
 
+// KeyPair is a generated key on its way through the generate pipeline:
+// scored by its fingerprint and serialized only when it is accepted.
+type KeyPair interface {
+	// Fingerprint returns the primary key fingerprint: 20 bytes for v4 keys
+	// and 32 bytes for v6 keys.
+	Fingerprint() []byte
+	// Serialize returns the armored public key and the encrypted armored
+	// private key.
+	Serialize(encryptor Encryptor) (publicKey, privateKey string, err error)
+}
+
+// GenerateKey generates a key of the configured key_version.
+func GenerateKey(cfg config.KeyGenerationConfig) (KeyPair, error) {
+	if ResolveKeyVersion(cfg) == KeyVersion6 {
+		key, err := NewV6Key(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	entity, err := GenerateKeyPair(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return EntityKeyPair{Entity: entity}, nil
+}
+
+// EntityKeyPair is a v4 key built by the OpenPGP library.
+type EntityKeyPair struct {
+	Entity *openpgp.Entity
+}
+
+func (k EntityKeyPair) Fingerprint() []byte {
+	return k.Entity.PrimaryKey.Fingerprint
+}
+
+func (k EntityKeyPair) Serialize(encryptor Encryptor) (string, string, error) {
+	return SerializeKeys(k.Entity, encryptor)
+}
+
 // generateBareKeyPair 生成裸ED25519密钥对
 func GenerateBareKeyPair() (ed25519.PublicKey, ed25519.PrivateKey, error) {
 	// 1. 直接生成ED25519密钥对
@@ -29,13 +29,19 @@ type Score struct {
 
 // NewEntity 生成一个新的 PGP 实体（密钥对）
 func NewEntity(cfg config.KeyGenerationConfig) (*openpgp.Entity, error) {
-	// 创建一个新的实体，包含用户信息
-	entity, err := openpgp.NewEntity(cfg.Name, cfg.Comment, cfg.Email, &packet.Config{
+	algorithm, err := ResolveKeyAlgorithm(cfg)
+	if err != nil {
+		return nil, err
+	}
+	packetConfig := &packet.Config{
 		DefaultHash:     crypto.SHA256,
 		Time:            time.Now,
-		Algorithm:       packet.PubKeyAlgoEdDSA,
 		KeyLifetimeSecs: 0,
-	})
+	}
+	algorithm.apply(packetConfig)
+
+	// 创建一个新的实体，包含用户信息
+	entity, err := openpgp.NewEntity(cfg.Name, cfg.Comment, cfg.Email, packetConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create PGP entity: %w", err)
 	}
@@ -85,11 +91,22 @@ func SerializeKeys(entity *openpgp.Entity, encryptor Encryptor) (string, string,
 
 // DisplayKeys 格式化并显示密钥信息
 func DisplayKeys(keys []models.KeyInfo) {
-	fmt.Println("Fingerprint      Score  Letters Count")
-	fmt.Println("---------------- ------ -------------")
+	fmt.Println("Key ID           Score  Rarity Letters Count Algorithm           Window Pattern")
+	fmt.Println("---------------- ------ ------ ------------- ------------------- ------ -------")
 	for _, key := range keys {
-		shortFingerprint := strings.ToUpper(GetLastSixteen(key.Fingerprint))
-		fmt.Printf("%-16s %6d %13d\n", shortFingerprint, key.Score, key.UniqueLettersCount)
+		keyID := strings.ToUpper(KeyID(key.Fingerprint))
+		fmt.Printf("%-16s %6d %6.1f %13d %-19s %-6s %s\n", keyID, key.Score, key.Rarity, key.UniqueLettersCount, key.Algorithm, key.ScoreWindow, key.MatchedPattern)
+	}
+}
+
+// DisplayRuns prints the generation run ledger, newest first.
+func DisplayRuns(runs []models.GenerationRun) {
+	fmt.Println("Run    Status     Target     Generated  Accepted   Saved      Started              Profile")
+	fmt.Println("------ ---------- ---------- ---------- ---------- ---------- -------------------- -------")
+	for _, run := range runs {
+		fmt.Printf("%-6d %-10s %10d %10d %10d %10d %s %s\n",
+			run.ID, run.Status, run.TargetKeys, run.Generated, run.Accepted, run.Saved,
+			run.StartedAt.UTC().Format(time.RFC3339), run.Profile)
 	}
 }
 
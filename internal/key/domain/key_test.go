@@ -11,6 +11,7 @@ import (
 	"github.com/iyuangang/gpgenie/models"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -53,6 +54,52 @@ func TestNewEntity(t *testing.T) {
 	}
 }
 
+func TestNewEntityAlgorithms(t *testing.T) {
+	tests := []struct {
+		cfg       config.KeyGenerationConfig
+		label     string
+		algorithm packet.PublicKeyAlgorithm
+		rsaBits   uint16
+	}{
+		{config.KeyGenerationConfig{}, "ed25519", packet.PubKeyAlgoEdDSA, 0},
+		{config.KeyGenerationConfig{Algorithm: "ed448"}, "ed448", packet.PubKeyAlgoEdDSA, 0},
+		{config.KeyGenerationConfig{Algorithm: "rsa", RSABits: 2048}, "rsa2048", packet.PubKeyAlgoRSA, 2048},
+		{config.KeyGenerationConfig{Algorithm: "ecdsa"}, "ecdsa-p256", packet.PubKeyAlgoECDSA, 0},
+		{config.KeyGenerationConfig{Algorithm: "ecdsa", Curve: "p384"}, "ecdsa-p384", packet.PubKeyAlgoECDSA, 0},
+		{config.KeyGenerationConfig{Algorithm: "ECDSA", Curve: "BrainpoolP256"}, "ecdsa-brainpoolp256", packet.PubKeyAlgoECDSA, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			algorithm, err := ResolveKeyAlgorithm(tt.cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.label, algorithm.Label)
+
+			entity, err := NewEntity(tt.cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.algorithm, entity.PrimaryKey.PubKeyAlgo)
+			if tt.rsaBits != 0 {
+				bits, err := entity.PrimaryKey.BitLength()
+				require.NoError(t, err)
+				assert.Equal(t, tt.rsaBits, bits)
+			}
+		})
+	}
+}
+
+func TestResolveKeyAlgorithmRejectsUnsupportedSettings(t *testing.T) {
+	for _, cfg := range []config.KeyGenerationConfig{
+		{Algorithm: "dsa"},
+		{Algorithm: "rsa", RSABits: 1024},
+		{Algorithm: "ecdsa", Curve: "secp256k1"},
+	} {
+		_, err := ResolveKeyAlgorithm(cfg)
+		assert.Error(t, err, cfg.Algorithm)
+		_, err = NewEntity(cfg)
+		assert.Error(t, err, cfg.Algorithm)
+	}
+}
+
 func TestSerializeKeys(t *testing.T) {
 	cfg := config.KeyGenerationConfig{
 		Name:    "Test User",
@@ -0,0 +1,143 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/iyuangang/gpgenie/internal/config"
+)
+
+// hexWords is the built-in dictionary scored by scoring.hex_word_weight:
+// English words spelled with hexadecimal digits, with 0 for O, 1 for I, and
+// 5 for S.
+var hexWords = []string{
+	"ABBA", "ACCEDE", "BABE", "BADE", "BEAD", "BEEF", "CAFE", "CEDE",
+	"DEAD", "DEAF", "DECADE", "DECAF", "DEED", "DEFACE", "FACADE", "FACE",
+	"FADE", "FEED",
+	"1DEA", "5AFE", "BA5E", "C0DE", "C0FFEE", "D00D", "DEC0DE", "F00D",
+	"BAADF00D", "CAFEBABE", "DEADBEEF", "DEADC0DE", "FEEDFACE",
+}
+
+// magicMatcher scores the magic sequences and hex words found in a
+// fingerprint. It is an Aho-Corasick automaton over the sixteen hexadecimal
+// digits whose transition table is complete, so matching costs one lookup
+// per digit however many patterns it holds.
+type magicMatcher struct {
+	next [][16]int32
+	// matches lists the patterns that end in each state, including those
+	// reached through failure links.
+	matches [][]int32
+	weights []int
+}
+
+// newMagicMatcher compiles the configured magic sequences and, when
+// hexWordWeight is not zero, the hex word dictionary. A configured sequence
+// overrides the dictionary entry with the same digits.
+func newMagicMatcher(sequences []config.MagicSequence, hexWordWeight int) (*magicMatcher, error) {
+	m := &magicMatcher{next: [][16]int32{newTrieState()}, matches: [][]int32{nil}}
+	configured := make(map[string]bool, len(sequences))
+	for _, magic := range sequences {
+		if err := m.add(magic.Sequence, magic.Weight); err != nil {
+			return nil, err
+		}
+		configured[strings.ToUpper(magic.Sequence)] = true
+	}
+	if hexWordWeight != 0 {
+		for _, word := range hexWords {
+			if configured[word] {
+				continue
+			}
+			if err := m.add(word, hexWordWeight*len(word)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	m.link()
+	return m, nil
+}
+
+func newTrieState() [16]int32 {
+	var state [16]int32
+	for i := range state {
+		state[i] = -1
+	}
+	return state
+}
+
+// add inserts a pattern into the trie.
+func (m *magicMatcher) add(pattern string, weight int) error {
+	if pattern == "" {
+		return fmt.Errorf("magic sequence must not be empty")
+	}
+	state := int32(0)
+	for i := 0; i < len(pattern); i++ {
+		val, ok := charToValue(pattern[i])
+		if !ok {
+			return fmt.Errorf("magic sequence %q is not hexadecimal", pattern)
+		}
+		if m.next[state][val] < 0 {
+			m.next[state][val] = int32(len(m.next))
+			m.next = append(m.next, newTrieState())
+			m.matches = append(m.matches, nil)
+		}
+		state = m.next[state][val]
+	}
+	m.matches[state] = append(m.matches[state], int32(len(m.weights)))
+	m.weights = append(m.weights, weight)
+	return nil
+}
+
+// link computes the failure links breadth first and folds them into the
+// transition table and the match lists.
+func (m *magicMatcher) link() {
+	fail := make([]int32, len(m.next))
+	queue := make([]int32, 0, len(m.next))
+	for val, child := range m.next[0] {
+		if child < 0 {
+			m.next[0][val] = 0
+			continue
+		}
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for val, child := range m.next[state] {
+			fallback := m.next[fail[state]][val]
+			if child < 0 {
+				m.next[state][val] = fallback
+				continue
+			}
+			fail[child] = fallback
+			m.matches[child] = append(m.matches[child], m.matches[fallback]...)
+			queue = append(queue, child)
+		}
+	}
+}
+
+// score returns the sum of the weights of the patterns found in digits. A
+// pattern counts once however often it occurs.
+func (m *magicMatcher) score(digits string) int {
+	// Fingerprints hold few matches, so deduplicating against the matches
+	// found so far is cheaper than a set sized by the pattern count.
+	var foundBuf [32]int32
+	found := foundBuf[:0]
+	total := 0
+	state := int32(0)
+	for i := 0; i < len(digits); i++ {
+		val, ok := charToValue(digits[i])
+		if !ok {
+			state = 0
+			continue
+		}
+		state = m.next[state][val]
+		for _, pattern := range m.matches[state] {
+			if !slices.Contains(found, pattern) {
+				found = append(found, pattern)
+				total += m.weights[pattern]
+			}
+		}
+	}
+	return total
+}
@@ -0,0 +1,164 @@
+package domain
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Pattern anchors. A leading "..." anchors a target to the end of the
+// fingerprint, a trailing "..." to the start, and a bare target matches
+// anywhere.
+const (
+	patternEllipsis    = "..."
+	patternRegexPrefix = "re:"
+	patternWildcard    = '?'
+)
+
+type patternAnchor int
+
+const (
+	anchorAnywhere patternAnchor = iota
+	anchorPrefix
+	anchorSuffix
+)
+
+// PatternSet is a compiled list of fingerprint targets. Targets are compiled
+// once and matched against the lower-case hexadecimal fingerprint of every
+// candidate. A nil PatternSet matches nothing.
+type PatternSet struct {
+	patterns []compiledPattern
+}
+
+type compiledPattern struct {
+	source string
+	anchor patternAnchor
+	digits []byte // lower-case hex digits; patternWildcard matches any digit
+	regex  *regexp.Regexp
+}
+
+// CompilePatterns compiles pattern targets of the following forms:
+//
+//	...C0FFEE           exact suffix
+//	C0FFEE...           exact prefix
+//	C0FFEE              exact digits anywhere
+//	...????DEAD????BEEF mask; "?" matches any hex digit
+//	re:^DEAD.*BEEF$     regular expression over the full fingerprint
+//
+// Matching is case-insensitive.
+func CompilePatterns(sources []string) (*PatternSet, error) {
+	set := &PatternSet{patterns: make([]compiledPattern, 0, len(sources))}
+	for _, source := range sources {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+		pattern, err := compilePattern(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", source, err)
+		}
+		set.patterns = append(set.patterns, pattern)
+	}
+	return set, nil
+}
+
+func compilePattern(source string) (compiledPattern, error) {
+	pattern := compiledPattern{source: source}
+	if expr, ok := strings.CutPrefix(source, patternRegexPrefix); ok {
+		regex, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return pattern, err
+		}
+		pattern.regex = regex
+		return pattern, nil
+	}
+
+	body := source
+	switch {
+	case strings.HasPrefix(body, patternEllipsis) && strings.HasSuffix(body, patternEllipsis) && len(body) > 2*len(patternEllipsis):
+		body = body[len(patternEllipsis) : len(body)-len(patternEllipsis)]
+	case strings.HasPrefix(body, patternEllipsis):
+		pattern.anchor = anchorSuffix
+		body = body[len(patternEllipsis):]
+	case strings.HasSuffix(body, patternEllipsis):
+		pattern.anchor = anchorPrefix
+		body = body[:len(body)-len(patternEllipsis)]
+	}
+	if body == "" {
+		return pattern, fmt.Errorf("pattern has no digits")
+	}
+	if len(body) > 64 {
+		return pattern, fmt.Errorf("pattern is longer than any fingerprint")
+	}
+	pattern.digits = make([]byte, len(body))
+	wildcards := 0
+	for i := 0; i < len(body); i++ {
+		char := body[i]
+		switch {
+		case char == patternWildcard:
+			wildcards++
+		case charToValueMap[char] < 0:
+			return pattern, fmt.Errorf("unexpected character %q; use hexadecimal digits or %q", char, patternWildcard)
+		case char >= 'A' && char <= 'F':
+			char += 'a' - 'A'
+		}
+		pattern.digits[i] = char
+	}
+	if wildcards == len(body) {
+		return pattern, fmt.Errorf("pattern contains only wildcards")
+	}
+	return pattern, nil
+}
+
+// Len returns the number of compiled targets.
+func (p *PatternSet) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.patterns)
+}
+
+// Match reports the first target matched by a lower-case hexadecimal
+// fingerprint and returns its source text.
+func (p *PatternSet) Match(fingerprint string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	for i := range p.patterns {
+		if p.patterns[i].match(fingerprint) {
+			return p.patterns[i].source, true
+		}
+	}
+	return "", false
+}
+
+func (c *compiledPattern) match(fingerprint string) bool {
+	if c.regex != nil {
+		return c.regex.MatchString(fingerprint)
+	}
+	last := len(fingerprint) - len(c.digits)
+	if last < 0 {
+		return false
+	}
+	switch c.anchor {
+	case anchorPrefix:
+		return c.matchAt(fingerprint, 0)
+	case anchorSuffix:
+		return c.matchAt(fingerprint, last)
+	}
+	for offset := 0; offset <= last; offset++ {
+		if c.matchAt(fingerprint, offset) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compiledPattern) matchAt(fingerprint string, offset int) bool {
+	for i, digit := range c.digits {
+		if digit != patternWildcard && digit != fingerprint[offset+i] {
+			return false
+		}
+	}
+	return true
+}
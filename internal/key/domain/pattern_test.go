@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatternSetMatch(t *testing.T) {
+	const fingerprint = "deadbeef0123456789abcdef0123456789c0ffee"
+
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"...C0FFEE", true},
+		{"...c0ffe", false},
+		{"DEADBEEF...", true},
+		{"BEEF...", false},
+		{"BEEF0123", true},
+		{"...456789?0FFEE", true},
+		{"????BEEF...", true},
+		{"????DEAD...", false},
+		{"re:^dead.*ffee$", true},
+		{"re:^DEAD[0-9]+", false},
+		{"...dead...", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			set, err := CompilePatterns([]string{tt.pattern})
+			require.NoError(t, err)
+			source, ok := set.Match(fingerprint)
+			assert.Equal(t, tt.want, ok)
+			if tt.want {
+				assert.Equal(t, tt.pattern, source)
+			}
+		})
+	}
+}
+
+func TestPatternSetReturnsFirstHit(t *testing.T) {
+	set, err := CompilePatterns([]string{"...0000", " ", "...FFEE", "re:ee$"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, set.Len())
+
+	source, ok := set.Match("0123456789abcdef0123456789abcdef0123ffee")
+	require.True(t, ok)
+	assert.Equal(t, "...FFEE", source)
+
+	var empty *PatternSet
+	_, ok = empty.Match("ffee")
+	assert.False(t, ok)
+	assert.Zero(t, empty.Len())
+}
+
+func TestCompilePatternsRejectsInvalidTargets(t *testing.T) {
+	for _, pattern := range []string{"...", "????", "C0FFEG", "re:[", "...XYZ"} {
+		_, err := CompilePatterns([]string{pattern})
+		assert.Error(t, err, pattern)
+	}
+}
+
+func BenchmarkPatternSetMatch(b *testing.B) {
+	set, err := CompilePatterns([]string{"...C0FFEE", "????DEAD????BEEF...", "DEADBEEF"})
+	require.NoError(b, err)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		set.Match("0123456789abcdef0123456789abcdef01234567")
+	}
+}
@@ -0,0 +1,177 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/iyuangang/gpgenie/internal/config"
+)
+
+// The classic strategy's rarity is computed exactly; see
+// classicScorer.distribution. Other strategies, and classic configurations
+// that score symmetry or magic sequences, are sampled: their tables are built
+// from raritySamples random fingerprints, generated in rarityChunks
+// independently seeded chunks so every process builds the same table. Scores
+// reached by fewer than rarityTailSamples samples are extrapolated along the
+// line through the last well-sampled score and the score reached by one
+// sample in 2^rarityFitBits. The extrapolation understates the rarity of the
+// longest patterns but keeps it increasing with the score.
+const (
+	raritySamples     = 1 << 18
+	rarityChunks      = 64
+	raritySeed        = 0x677067656e6965
+	rarityTailSamples = 16
+	rarityFitBits     = 8
+)
+
+var rarityTables = struct {
+	sync.Mutex
+	tables map[string]*rarityTable
+}{tables: make(map[string]*rarityTable)}
+
+// RarityEstimator converts scores into rarity: -log2 of the probability that
+// a uniformly random fingerprint scores at least as well under the same
+// strategy and number of scored digits. A rarity of 20 means about one
+// fingerprint in a million scores as well. Tables are built by Prepare or on
+// first use and shared by every estimator with the same scoring
+// configuration.
+type RarityEstimator struct {
+	scorer Scorer
+	key    string
+}
+
+// NewRarityEstimator returns an estimator for scores produced by scorer,
+// which was built from cfg.
+func NewRarityEstimator(scorer Scorer, cfg config.ScoringConfig) *RarityEstimator {
+	// Only the number of scored digits matters, not where they are.
+	cfg.Window = ""
+	return &RarityEstimator{scorer: scorer, key: fmt.Sprintf("%s|%+v", scorer.Name(), cfg)}
+}
+
+// Prepare builds the tables for each of the given numbers of scored digits,
+// concurrently, so that Rarity does not stall on them later. A sampled table
+// takes a fraction of a second, an exact classic table over 64 digits a few
+// seconds.
+func (e *RarityEstimator) Prepare(digits ...int) {
+	if e == nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, n := range slices.Compact(slices.Sorted(slices.Values(digits))) {
+		if n <= 0 {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.table(n)
+		}()
+	}
+	wg.Wait()
+}
+
+// Rarity returns the rarity in bits of score over digits scored digits. A nil
+// estimator returns zero.
+func (e *RarityEstimator) Rarity(digits, score int) float64 {
+	if e == nil || digits <= 0 {
+		return 0
+	}
+	return e.table(digits).rarity(score)
+}
+
+// table returns the built table for digits scored digits.
+func (e *RarityEstimator) table(digits int) *rarityTable {
+	key := fmt.Sprintf("%s|%d", e.key, digits)
+	rarityTables.Lock()
+	table, ok := rarityTables.tables[key]
+	if !ok {
+		table = &rarityTable{}
+		rarityTables.tables[key] = table
+	}
+	rarityTables.Unlock()
+	table.once.Do(func() { table.build(e.scorer, digits) })
+	return table
+}
+
+// rarityTable is the score distribution of one scoring configuration and
+// digit count, computed exactly when the scorer allows it and sampled
+// otherwise.
+type rarityTable struct {
+	once  sync.Once
+	exact *scoreDistribution
+	// scores are the sampled totals in descending order.
+	scores      []int
+	anchorScore int
+	anchorBits  float64
+	// slope is the rarity gained per score point beyond anchorScore.
+	slope float64
+}
+
+func (t *rarityTable) build(scorer Scorer, digits int) {
+	if classic, ok := scorer.(*classicScorer); ok && classic.hasDistribution() {
+		t.exact = classic.distribution(digits)
+		return
+	}
+	t.scores = make([]int, raritySamples)
+	chunk := raritySamples / rarityChunks
+	slots := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+	for c := 0; c < rarityChunks; c++ {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(c int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			random := rand.New(rand.NewPCG(raritySeed, uint64(c)))
+			sample := make([]byte, digits)
+			for i := c * chunk; i < (c+1)*chunk; i++ {
+				for j := range sample {
+					sample[j] = hexDigits[random.Uint32()&0xF]
+				}
+				scores, err := scorer.Score(string(sample))
+				if err != nil {
+					t.scores[i] = math.MinInt
+					continue
+				}
+				t.scores[i] = scores.Total()
+			}
+		}(c)
+	}
+	wg.Wait()
+	slices.Sort(t.scores)
+	slices.Reverse(t.scores)
+
+	t.anchorScore = t.scores[rarityTailSamples-1]
+	t.anchorBits = t.sampled(t.anchorScore)
+	fitScore := t.scores[raritySamples>>rarityFitBits-1]
+	if t.anchorScore > fitScore {
+		t.slope = (t.anchorBits - t.sampled(fitScore)) / float64(t.anchorScore-fitScore)
+	}
+}
+
+// sampled returns the rarity of score measured on the samples alone, with a
+// score no sample reached counted as reached by one.
+func (t *rarityTable) sampled(score int) float64 {
+	count := sort.Search(len(t.scores), func(i int) bool { return t.scores[i] < score })
+	return math.Log2(float64(len(t.scores)) / float64(max(count, 1)))
+}
+
+func (t *rarityTable) rarity(score int) float64 {
+	if t.exact != nil {
+		return t.exact.rarity(score)
+	}
+	sampled := t.sampled(score)
+	if score <= t.anchorScore {
+		return sampled
+	}
+	return max(sampled, t.anchorBits+t.slope*float64(score-t.anchorScore))
+}
+
+const hexDigits = "0123456789abcdef"
@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"math"
+	"testing"
+
+	"github.com/iyuangang/gpgenie/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRarityEstimatorGrowsWithScore(t *testing.T) {
+	cfg := config.DefaultScoringConfig()
+	scorer, err := NewScorer(cfg)
+	require.NoError(t, err)
+	estimator := NewRarityEstimator(scorer, cfg)
+
+	assert.Zero(t, estimator.Rarity(16, math.MinInt), "every fingerprint scores at least the minimum")
+	previous := 0.0
+	for score := -200; score <= 2000; score += 16 {
+		rarity := estimator.Rarity(16, score)
+		assert.GreaterOrEqual(t, rarity, previous, "score %d", score)
+		previous = rarity
+	}
+	// Sixteen equal digits are the best 16 digits can do: 16 of 2^64.
+	assert.InDelta(t, 60, estimator.Rarity(16, repeatScoreMap[16]), 1e-9)
+	assert.Equal(t, estimator.Rarity(16, repeatScoreMap[16]), previous, "unreachable scores get the highest rarity")
+
+	// About one fingerprint in 16 has a three-digit repeat somewhere in
+	// its last 16 digits.
+	assert.InDelta(t, 4, estimator.Rarity(16, repeatScoreMap[3]), 1.5)
+
+	// A longer window makes the same score more likely.
+	assert.Less(t, estimator.Rarity(40, repeatScoreMap[5]), estimator.Rarity(16, repeatScoreMap[5]))
+}
+
+func TestRarityEstimatorPrepareBuildsTables(t *testing.T) {
+	cfg := config.DefaultScoringConfig()
+	scorer, err := NewScorer(cfg)
+	require.NoError(t, err)
+	estimator := NewRarityEstimator(scorer, cfg)
+
+	estimator.Prepare(16, 0, 16, 8)
+	for _, digits := range []int{8, 16} {
+		estimator.table(digits).once.Do(func() { t.Errorf("table for %d digits was not built", digits) })
+	}
+	var nilEstimator *RarityEstimator
+	nilEstimator.Prepare(16)
+}
+
+func TestRarityEstimatorIsDeterministic(t *testing.T) {
+	cfg := config.DefaultScoringConfig()
+	cfg.RepeatWeight = 3
+	scorer, err := NewScorer(cfg)
+	require.NoError(t, err)
+	first := NewRarityEstimator(scorer, cfg).Rarity(8, 400)
+
+	table := &rarityTable{}
+	table.build(scorer, 8)
+	assert.Equal(t, first, table.rarity(400), "a rebuilt table gives the same rarity")
+
+	// Windows of the same length share a table.
+	cfg.Window = "0:8"
+	assert.Equal(t, first, NewRarityEstimator(scorer, cfg).Rarity(8, 400))
+
+	var none *RarityEstimator
+	assert.Zero(t, none.Rarity(16, 400))
+}
+
+func TestClassicDistributionMatchesEnumeration(t *testing.T) {
+	weighted := config.DefaultScoringConfig()
+	weighted.MinRepeatLength, weighted.MinSequenceLength = 2, 2
+	weighted.RepeatWeight, weighted.DecreasingWeight, weighted.MagicWeight = 1.5, -0.7, 2.5
+	noMagic := config.DefaultScoringConfig()
+	noMagic.MagicWeight, noMagic.IncreasingWeight = 0, 0
+
+	for name, cfg := range map[string]config.ScoringConfig{
+		"default": config.DefaultScoringConfig(), "weighted": weighted, "no magic": noMagic,
+	} {
+		scorer, err := NewScorer(cfg)
+		require.NoError(t, err)
+		for digits := 1; digits <= 5; digits++ {
+			// Score every string of digits hexadecimal digits.
+			counts := make(map[int]int)
+			line := make([]byte, digits)
+			for x := 0; x < 1<<(4*digits); x++ {
+				for j := range line {
+					line[j] = hexDigits[x>>(4*j)&0xF]
+				}
+				scores, err := scorer.Score(string(line))
+				require.NoError(t, err)
+				counts[scores.Total()]++
+			}
+
+			dist := scorer.(*classicScorer).distribution(digits)
+			require.Len(t, dist.scores, len(counts), "%s over %d digits", name, digits)
+			for _, score := range dist.scores {
+				atLeast := 0
+				for total, count := range counts {
+					if total >= score {
+						atLeast += count
+					}
+				}
+				want := float64(4*digits) - math.Log2(float64(atLeast))
+				assert.InDelta(t, want, dist.rarity(score), 1e-9, "%s over %d digits, score %d", name, digits, score)
+			}
+		}
+	}
+}
+
+func TestRarityEstimatorSamplesSymmetry(t *testing.T) {
+	cfg := config.DefaultScoringConfig()
+	cfg.PalindromeWeight = 1
+	scorer, err := NewScorer(cfg)
+	require.NoError(t, err)
+
+	table := &rarityTable{}
+	table.build(scorer, 16)
+	assert.Nil(t, table.exact, "symmetry is not covered by the exact distribution")
+	assert.Len(t, table.scores, raritySamples)
+	assert.Greater(t, table.rarity(repeatScoreMap[8]), table.rarity(repeatScoreMap[3]))
+}
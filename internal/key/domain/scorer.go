@@ -0,0 +1,155 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/iyuangang/gpgenie/internal/config"
+	"github.com/iyuangang/gpgenie/models"
+)
+
+// ClassicStrategy is the name of the original scoring strategy.
+const ClassicStrategy = "classic"
+
+// Scorer computes the score components of a fingerprint suffix. Scorers are
+// shared by concurrent pipeline workers and must be safe for concurrent use.
+type Scorer interface {
+	Name() string
+	Score(suffix string) (Scores, error)
+}
+
+// ScorerFactory builds a Scorer from the scoring configuration.
+type ScorerFactory func(cfg config.ScoringConfig) (Scorer, error)
+
+var scorerRegistry = struct {
+	sync.RWMutex
+	factories map[string]ScorerFactory
+}{
+	factories: map[string]ScorerFactory{
+		ClassicStrategy: newClassicScorer,
+	},
+}
+
+// RegisterScorer makes a named strategy available to NewScorer. Registering
+// an existing name replaces it.
+func RegisterScorer(name string, factory ScorerFactory) {
+	scorerRegistry.Lock()
+	defer scorerRegistry.Unlock()
+	scorerRegistry.factories[strings.ToLower(name)] = factory
+}
+
+// ScorerNames returns the registered strategy names in sorted order.
+func ScorerNames() []string {
+	scorerRegistry.RLock()
+	defer scorerRegistry.RUnlock()
+	names := make([]string, 0, len(scorerRegistry.factories))
+	for name := range scorerRegistry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewScorer builds the strategy selected by cfg. A zero ScoringConfig selects
+// the classic strategy with its default weights.
+func NewScorer(cfg config.ScoringConfig) (Scorer, error) {
+	if cfg.IsZero() {
+		cfg = config.DefaultScoringConfig()
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	scorerRegistry.RLock()
+	factory, ok := scorerRegistry.factories[strings.ToLower(cfg.Strategy)]
+	scorerRegistry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown scoring strategy %q (available: %s)", cfg.Strategy, strings.Join(ScorerNames(), ", "))
+	}
+	return factory(cfg)
+}
+
+// classicScorer applies configurable weights and minimum run lengths to
+// CalculateScores' repeat, sequence, magic, and symmetry components. With magic
+// sequences or hex words configured, magic scores them instead of the
+// built-in 49 penalty.
+type classicScorer struct {
+	thresholds scoreThresholds
+	weights    [7]float64
+	unweighted bool
+	magic      *magicMatcher
+}
+
+func newClassicScorer(cfg config.ScoringConfig) (Scorer, error) {
+	weights := [7]float64{
+		cfg.RepeatWeight, cfg.IncreasingWeight, cfg.DecreasingWeight, cfg.MagicWeight,
+		cfg.PalindromeWeight, cfg.BlockWeight, cfg.AlternatingWeight,
+	}
+	scorer := &classicScorer{
+		thresholds: scoreThresholds{
+			minRepeat:   uint8(cfg.MinRepeatLength),
+			minSequence: uint8(cfg.MinSequenceLength),
+			// Symmetry is only computed when it can contribute.
+			symmetry: weights[4] != 0 || weights[5] != 0 || weights[6] != 0,
+		},
+		weights:    weights,
+		unweighted: weights == [7]float64{1, 1, 1, 1, 0, 0, 0} || weights == [7]float64{1, 1, 1, 1, 1, 1, 1},
+	}
+	if len(cfg.MagicSequences) > 0 || cfg.HexWordWeight != 0 {
+		sequences := cfg.MagicSequences
+		if len(sequences) == 0 {
+			sequences = []config.MagicSequence{{Sequence: "49", Weight: magicScore}}
+		}
+		magic, err := newMagicMatcher(sequences, cfg.HexWordWeight)
+		if err != nil {
+			return nil, err
+		}
+		scorer.magic = magic
+	}
+	return scorer, nil
+}
+
+func (c *classicScorer) Name() string { return ClassicStrategy }
+
+func (c *classicScorer) Score(suffix string) (Scores, error) {
+	scores, err := calculateScores(suffix, c.thresholds)
+	if err != nil {
+		return scores, err
+	}
+	if c.magic != nil {
+		scores.MagicLetterScore = c.magic.score(suffix)
+	}
+	if c.unweighted {
+		return scores, nil
+	}
+	scores.RepeatLetterScore = applyWeight(scores.RepeatLetterScore, c.weights[0])
+	scores.IncreasingLetterScore = applyWeight(scores.IncreasingLetterScore, c.weights[1])
+	scores.DecreasingLetterScore = applyWeight(scores.DecreasingLetterScore, c.weights[2])
+	scores.MagicLetterScore = applyWeight(scores.MagicLetterScore, c.weights[3])
+	scores.PalindromeScore = applyWeight(scores.PalindromeScore, c.weights[4])
+	scores.RepeatingBlockScore = applyWeight(scores.RepeatingBlockScore, c.weights[5])
+	scores.AlternatingScore = applyWeight(scores.AlternatingScore, c.weights[6])
+	return scores, nil
+}
+
+func applyWeight(score int, weight float64) int {
+	return int(math.Round(float64(score) * weight))
+}
+
+// ApplyScores copies scores produced by scorer over window into the score
+// columns of key.
+func ApplyScores(key *models.KeyInfo, scorer Scorer, window config.ScoringWindow, scores Scores) {
+	key.RepeatLetterScore = scores.RepeatLetterScore
+	key.IncreasingLetterScore = scores.IncreasingLetterScore
+	key.DecreasingLetterScore = scores.DecreasingLetterScore
+	key.MagicLetterScore = scores.MagicLetterScore
+	key.PalindromeScore = scores.PalindromeScore
+	key.RepeatingBlockScore = scores.RepeatingBlockScore
+	key.AlternatingScore = scores.AlternatingScore
+	key.Score = scores.Total()
+	key.UniqueLettersCount = scores.UniqueLettersCount
+	key.ScoreStrategy = scorer.Name()
+	key.ScoreWindow = window.String()
+}
@@ -0,0 +1,174 @@
+package domain
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/iyuangang/gpgenie/internal/config"
+	"github.com/iyuangang/gpgenie/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassicScorerMatchesCalculateScoresByDefault(t *testing.T) {
+	scorer, err := NewScorer(config.ScoringConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, ClassicStrategy, scorer.Name())
+
+	for _, input := range []string{"", "AAAA", "0123456", "FEDCBA", "49ABCD", "B543260000001234"} {
+		want, err := CalculateScores(input)
+		require.NoError(t, err)
+		got, err := scorer.Score(input)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, input)
+	}
+}
+
+func TestDefaultScorerKeepsOriginalTotals(t *testing.T) {
+	scorer, err := NewScorer(config.DefaultScoringConfig())
+	require.NoError(t, err)
+
+	// Totals of the original rules; symmetry must not change them unless
+	// its weights are configured.
+	for input, want := range map[string]int{
+		"B543260000001234": 432,
+		"1234B54321000000": 480,
+		"AB1221BA49FFF012": 60,
+		"A5A5A5A5A5A5A5A5": 0,
+		"1A2B1A2B1A2B1A2B": 0,
+		"0123456789ABCDEF": 928,
+		"7777777777777777": 1024,
+	} {
+		scores, err := scorer.Score(input)
+		require.NoError(t, err)
+		assert.Equal(t, want, scores.Total(), input)
+	}
+
+	cfg := config.DefaultScoringConfig()
+	cfg.PalindromeWeight = 1
+	cfg.BlockWeight = 1
+	cfg.AlternatingWeight = 1
+	scorer, err = NewScorer(cfg)
+	require.NoError(t, err)
+	scores, err := scorer.Score("1A2B1A2B1A2B1A2B")
+	require.NoError(t, err)
+	assert.Positive(t, scores.RepeatingBlockScore)
+}
+
+func TestClassicScorerAppliesWeightsAndMinimumLengths(t *testing.T) {
+	cfg := config.DefaultScoringConfig()
+	cfg.RepeatWeight = 0.5
+	cfg.MagicWeight = 0
+	cfg.MinRepeatLength = 2
+	cfg.MinSequenceLength = 3
+	scorer, err := NewScorer(cfg)
+	require.NoError(t, err)
+
+	scores, err := scorer.Score("49AA012")
+	require.NoError(t, err)
+	assert.Equal(t, repeatScoreMap[2]/2, scores.RepeatLetterScore)
+	assert.Equal(t, sequenceScoreMap[3], scores.IncreasingLetterScore)
+	assert.Zero(t, scores.MagicLetterScore)
+	assert.Equal(t, scores.RepeatLetterScore+scores.IncreasingLetterScore, scores.Total())
+}
+
+func TestClassicScorerMagicSequencesAndHexWords(t *testing.T) {
+	cfg := config.DefaultScoringConfig()
+	cfg.MagicSequences = []config.MagicSequence{{Sequence: "c0ffee", Weight: 500}, {Sequence: "13", Weight: -50}}
+	scorer, err := NewScorer(cfg)
+	require.NoError(t, err)
+
+	scores, err := scorer.Score("49C0FFEE1313")
+	require.NoError(t, err)
+	assert.Equal(t, 450, scores.MagicLetterScore, "configured sequences replace 49 and count once each")
+
+	cfg = config.DefaultScoringConfig()
+	cfg.HexWordWeight = 10
+	scorer, err = NewScorer(cfg)
+	require.NoError(t, err)
+	scores, err = scorer.Score("49deadbeef")
+	require.NoError(t, err)
+	assert.Equal(t, -100+40+40+80, scores.MagicLetterScore, "DEAD, BEEF, and DEADBEEF with the classic 49 penalty")
+}
+
+func TestMagicMatcherFindsOverlappingPatterns(t *testing.T) {
+	matcher, err := newMagicMatcher([]config.MagicSequence{
+		{Sequence: "ABAB", Weight: 1},
+		{Sequence: "BA", Weight: 10},
+		{Sequence: "BABC", Weight: 100},
+		{Sequence: "C", Weight: 1000},
+	}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1111, matcher.score("ABABABC"))
+	assert.Equal(t, 10, matcher.score("ba-ba"))
+	assert.Zero(t, matcher.score("ABBE"))
+
+	_, err = newMagicMatcher([]config.MagicSequence{{Sequence: "XYZ", Weight: 1}}, 0)
+	assert.Error(t, err)
+}
+
+func TestMagicMatcherScoresManyPatterns(t *testing.T) {
+	var sequences []config.MagicSequence
+	for i := 0; i < 1000; i++ {
+		sequences = append(sequences, config.MagicSequence{Sequence: fmt.Sprintf("%04X", i*7), Weight: 1})
+	}
+	matcher, err := newMagicMatcher(sequences, 1)
+	require.NoError(t, err)
+	// 1B51 is 999*7 and 0000 is 0*7.
+	assert.Equal(t, 2, matcher.score("1B510000"))
+	assert.Equal(t, 2+4, matcher.score("1B510000CAFE"))
+}
+
+func TestNewScorerRejectsUnknownStrategy(t *testing.T) {
+	cfg := config.DefaultScoringConfig()
+	cfg.Strategy = "missing"
+	_, err := NewScorer(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ClassicStrategy)
+}
+
+type constantScorer struct{}
+
+func (constantScorer) Name() string { return "constant" }
+func (constantScorer) Score(string) (Scores, error) {
+	return Scores{RepeatLetterScore: 7, UniqueLettersCount: 1}, nil
+}
+
+func TestRegisterScorerAndApplyScores(t *testing.T) {
+	RegisterScorer("constant", func(config.ScoringConfig) (Scorer, error) { return constantScorer{}, nil })
+	assert.Contains(t, ScorerNames(), "constant")
+
+	cfg := config.DefaultScoringConfig()
+	cfg.Strategy = "Constant"
+	scorer, err := NewScorer(cfg)
+	require.NoError(t, err)
+	scores, err := scorer.Score("ignored")
+	require.NoError(t, err)
+
+	var key models.KeyInfo
+	ApplyScores(&key, scorer, config.ScoringWindow{Offset: -8, Length: 8}, scores)
+	assert.Equal(t, 7, key.Score)
+	assert.Equal(t, 1, key.UniqueLettersCount)
+	assert.Equal(t, "constant", key.ScoreStrategy)
+	assert.Equal(t, config.ScoringWindowShort, key.ScoreWindow)
+}
+
+// BenchmarkMagicMatcher shows the cost per fingerprint does not grow with
+// the number of patterns.
+func BenchmarkMagicMatcher(b *testing.B) {
+	for _, count := range []int{1, 100, 5000} {
+		var sequences []config.MagicSequence
+		for i := 0; i < count; i++ {
+			sequences = append(sequences, config.MagicSequence{Sequence: fmt.Sprintf("%05X", i*13), Weight: 1})
+		}
+		matcher, err := newMagicMatcher(sequences, 1)
+		require.NoError(b, err)
+		b.Run(fmt.Sprintf("patterns_%d", count), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				matcher.score("A1B2C3D4E5F60789DEADBEEF01234567")
+			}
+		})
+	}
+}
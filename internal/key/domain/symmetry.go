@@ -0,0 +1,100 @@
+package domain
+
+// Palindromes, alternations, and repeated blocks are scored by how many of
+// their digits the rest of the pattern predicts. A run of n equal digits
+// predicts n-1 of them, so a pattern that predicts m digits scores like a run
+// of m+1 and equally improbable patterns score the same.
+const (
+	// minPredictedDigits is the smallest pattern that scores, as likely as a
+	// three-digit repeat.
+	minPredictedDigits = 2
+	// Blocks are three to eight digits long and repeat at least once. Two
+	// digit blocks score as alternations.
+	minBlockLength = 3
+	maxBlockLength = 8
+)
+
+func predictedScore(predicted int) int {
+	return repeatScoreMap[min(predicted+1, len(repeatScoreMap)-1)]
+}
+
+// symmetryScores returns the palindrome, repeating block, and alternating
+// scores of line: the best of each kind of pattern it contains.
+func symmetryScores(line string) (palindrome, block, alternating int) {
+	if longest := longestPalindrome(line); longest/2 >= minPredictedDigits {
+		palindrome = predictedScore(longest / 2)
+	}
+	for period := 2; period <= maxBlockLength; period++ {
+		predicted := longestPeriodic(line, period)
+		if predicted < minPredictedDigits {
+			continue
+		}
+		if period == 2 {
+			alternating = predictedScore(predicted)
+		} else if period >= minBlockLength {
+			block = max(block, predictedScore(predicted))
+		}
+	}
+	return palindrome, block, alternating
+}
+
+// longestPalindrome returns the length of the longest palindrome in line
+// that is long enough to score and is not a run of one digit, which the
+// repeat score already covers.
+func longestPalindrome(line string) int {
+	longest := 0
+	for center := 1; center < 2*len(line)-1; center++ {
+		left, right := center/2, (center+1)/2
+		for left >= 0 && right < len(line) && line[left] == line[right] {
+			left--
+			right++
+		}
+		length := right - left - 1
+		if length > longest && length/2 >= minPredictedDigits && !isRun(line[left+1:right]) {
+			longest = length
+		}
+	}
+	return longest
+}
+
+// longestPeriodic returns the number of digits predicted by the longest
+// stretch of line that repeats a block of period digits at least twice. The
+// block must not itself repeat a shorter block, so a run of one digit or an
+// alternation is not counted again at a longer period.
+func longestPeriodic(line string, period int) int {
+	best, matched := 0, 0
+	for i := period; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-period] {
+			matched++
+			continue
+		}
+		if matched >= period && matched > best && isPrimitiveBlock(line[i-matched-period:i-matched]) {
+			best = matched
+		}
+		matched = 0
+	}
+	return best
+}
+
+// isPrimitiveBlock reports whether block is not a repetition of a shorter
+// block.
+func isPrimitiveBlock(block string) bool {
+	for period := 1; period < len(block); period++ {
+		if len(block)%period != 0 {
+			continue
+		}
+		if block[period:] == block[:len(block)-period] {
+			return false
+		}
+	}
+	return true
+}
+
+func isRun(digits string) bool {
+	for i := 1; i < len(digits); i++ {
+		if digits[i] != digits[0] {
+			return false
+		}
+	}
+	return true
+}
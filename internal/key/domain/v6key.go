@@ -0,0 +1,243 @@
+package domain
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/iyuangang/gpgenie/internal/config"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// OpenPGP key versions selected by key_generation.key_version.
+const (
+	KeyVersion4 = 4
+	KeyVersion6 = 6
+)
+
+// The OpenPGP library predates RFC 9580, so v6 packets are encoded here. Only
+// what a v6 Ed25519 certificate needs is covered.
+const (
+	v6PacketSignature = 2
+	v6PacketSecretKey = 5
+	v6PacketPublicKey = 6
+	v6PacketUserID    = 13
+
+	v6AlgoEd25519   = 27
+	v6HashSHA256    = 8
+	v6HashSHA512    = 10
+	v6CipherAES128  = 7
+	v6CipherAES256  = 9
+	v6SigPositiveID = 0x13
+	// v6SaltSize is the signature salt size RFC 9580 fixes for SHA-256.
+	v6SaltSize = 16
+
+	v6SubpacketCreationTime  = 2
+	v6SubpacketPrefCiphers   = 11
+	v6SubpacketPrefHashes    = 21
+	v6SubpacketPrimaryUserID = 25
+	v6SubpacketKeyFlags      = 27
+	v6SubpacketFeatures      = 30
+	v6SubpacketIssuerFP      = 33
+	v6SubpacketCritical      = 0x80
+	v6KeyFlagsCertifyAndSign = 0x03
+	v6FeaturesSEIPD          = 0x09
+)
+
+// ResolveKeyVersion returns the OpenPGP key version key_generation selects.
+// Zero selects v4.
+func ResolveKeyVersion(cfg config.KeyGenerationConfig) int {
+	if cfg.KeyVersion == KeyVersion6 {
+		return KeyVersion6
+	}
+	return KeyVersion4
+}
+
+// V6Key is an RFC 9580 v6 Ed25519 primary key with one user ID. The
+// self-signature is made when the key is serialized, so candidates that are
+// never accepted cost only a key generation and a SHA-256 fingerprint.
+type V6Key struct {
+	created     time.Time
+	public      ed25519.PublicKey
+	private     ed25519.PrivateKey
+	userID      string
+	fingerprint [sha256.Size]byte
+}
+
+// NewV6Key generates a v6 Ed25519 key for the key_generation identity.
+func NewV6Key(cfg config.KeyGenerationConfig) (*V6Key, error) {
+	userID := packet.NewUserId(cfg.Name, cfg.Comment, cfg.Email)
+	if userID == nil {
+		return nil, fmt.Errorf("invalid user id characters in name, comment, or email")
+	}
+	public, private, err := GenerateBareKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	key := &V6Key{
+		created: time.Now().Truncate(time.Second),
+		public:  public,
+		private: private,
+		userID:  userID.Id,
+	}
+	key.fingerprint = v6Fingerprint(key.publicKeyBody())
+	return key, nil
+}
+
+// Fingerprint returns the 32-byte v6 fingerprint.
+func (k *V6Key) Fingerprint() []byte {
+	return k.fingerprint[:]
+}
+
+// Serialize returns the armored certificate and the encrypted armored secret
+// key, both carrying the user ID and its self-signature.
+func (k *V6Key) Serialize(encryptor Encryptor) (string, string, error) {
+	if encryptor == nil {
+		return "", "", fmt.Errorf("encryptor is nil")
+	}
+	signature, err := k.selfSignature(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	publicBody := k.publicKeyBody()
+	identity := append(v6Packet(v6PacketUserID, []byte(k.userID)), v6Packet(v6PacketSignature, signature)...)
+
+	certificate := append(v6Packet(v6PacketPublicKey, publicBody), identity...)
+	publicKey, err := armorBlock(openpgp.PublicKeyType, certificate)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to armor public key: %w", err)
+	}
+
+	// S2K usage 0 leaves the seed in the clear; v6 keys carry no checksum.
+	secretBody := append(append(publicBody, 0), k.private.Seed()...)
+	secretKey := append(v6Packet(v6PacketSecretKey, secretBody), identity...)
+	armoredSecret, err := armorBlock(openpgp.PrivateKeyType, secretKey)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to armor private key: %w", err)
+	}
+	privateKey, err := encryptor.Encrypt(armoredSecret)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+	return publicKey, privateKey, nil
+}
+
+// publicKeyBody encodes the v6 public key packet body.
+func (k *V6Key) publicKeyBody() []byte {
+	return v6PublicKeyBody(k.created, k.public)
+}
+
+// selfSignature makes the positive certification of the user ID.
+func (k *V6Key) selfSignature(random io.Reader) ([]byte, error) {
+	created := uint32(k.created.Unix())
+	var hashed []byte
+	hashed = appendSubpacket(hashed, v6SubpacketCreationTime|v6SubpacketCritical, binary.BigEndian.AppendUint32(nil, created))
+	hashed = appendSubpacket(hashed, v6SubpacketKeyFlags|v6SubpacketCritical, []byte{v6KeyFlagsCertifyAndSign})
+	hashed = appendSubpacket(hashed, v6SubpacketPrefCiphers, []byte{v6CipherAES256, v6CipherAES128})
+	hashed = appendSubpacket(hashed, v6SubpacketPrefHashes, []byte{v6HashSHA512, v6HashSHA256})
+	hashed = appendSubpacket(hashed, v6SubpacketFeatures, []byte{v6FeaturesSEIPD})
+	hashed = appendSubpacket(hashed, v6SubpacketPrimaryUserID, []byte{1})
+	hashed = appendSubpacket(hashed, v6SubpacketIssuerFP, append([]byte{KeyVersion6}, k.fingerprint[:]...))
+
+	prefix := []byte{KeyVersion6, v6SigPositiveID, v6AlgoEd25519, v6HashSHA256}
+	prefix = binary.BigEndian.AppendUint32(prefix, uint32(len(hashed)))
+	prefix = append(prefix, hashed...)
+
+	salt := make([]byte, v6SaltSize)
+	if _, err := io.ReadFull(random, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate signature salt: %w", err)
+	}
+	digest := v6CertificationDigest(salt, k.publicKeyBody(), k.userID, prefix)
+
+	signature := binary.BigEndian.AppendUint32(prefix, 0) // no unhashed subpackets
+	signature = append(signature, digest[0], digest[1], v6SaltSize)
+	signature = append(signature, salt...)
+	return append(signature, ed25519.Sign(k.private, digest[:])...), nil
+}
+
+// v6PublicKeyBody encodes a v6 Ed25519 public key packet body: version,
+// creation time, algorithm, and the length-prefixed native key material.
+func v6PublicKeyBody(created time.Time, public ed25519.PublicKey) []byte {
+	body := make([]byte, 0, 10+ed25519.PublicKeySize)
+	body = append(body, KeyVersion6)
+	body = binary.BigEndian.AppendUint32(body, uint32(created.Unix()))
+	body = append(body, v6AlgoEd25519)
+	body = binary.BigEndian.AppendUint32(body, ed25519.PublicKeySize)
+	return append(body, public...)
+}
+
+// v6Fingerprint hashes a v6 public key packet body as RFC 9580 section 5.5.4
+// specifies.
+func v6Fingerprint(body []byte) [sha256.Size]byte {
+	hash := sha256.New()
+	hash.Write(v6HashedLength(0x9B, len(body)))
+	hash.Write(body)
+	var fingerprint [sha256.Size]byte
+	hash.Sum(fingerprint[:0])
+	return fingerprint
+}
+
+// v6CertificationDigest is the SHA-256 digest a v6 user ID certification
+// signs: salt, key, user ID, the hashed signature fields, and the trailer.
+func v6CertificationDigest(salt, publicBody []byte, userID string, prefix []byte) [sha256.Size]byte {
+	hash := sha256.New()
+	hash.Write(salt)
+	hash.Write(v6HashedLength(0x9B, len(publicBody)))
+	hash.Write(publicBody)
+	hash.Write(v6HashedLength(0xB4, len(userID)))
+	hash.Write([]byte(userID))
+	hash.Write(prefix)
+	hash.Write(binary.BigEndian.AppendUint32([]byte{KeyVersion6, 0xFF}, uint32(len(prefix))))
+	var digest [sha256.Size]byte
+	hash.Sum(digest[:0])
+	return digest
+}
+
+func v6HashedLength(marker byte, length int) []byte {
+	return binary.BigEndian.AppendUint32([]byte{marker}, uint32(length))
+}
+
+// appendSubpacket appends a signature subpacket with a one-octet length,
+// which is enough for every subpacket written here.
+func appendSubpacket(dst []byte, subpacketType byte, data []byte) []byte {
+	dst = append(dst, byte(1+len(data)), subpacketType)
+	return append(dst, data...)
+}
+
+// v6Packet frames a packet body with an OpenPGP packet header.
+func v6Packet(tag byte, body []byte) []byte {
+	out := []byte{0xC0 | tag}
+	switch n := len(body); {
+	case n < 192:
+		out = append(out, byte(n))
+	case n < 8384:
+		n -= 192
+		out = append(out, byte(n>>8)+192, byte(n))
+	default:
+		out = binary.BigEndian.AppendUint32(append(out, 0xFF), uint32(n))
+	}
+	return append(out, body...)
+}
+
+func armorBlock(blockType string, data []byte) (string, error) {
+	var buf bytes.Buffer
+	writer, err := armor.Encode(&buf, blockType, nil)
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
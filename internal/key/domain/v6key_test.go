@@ -0,0 +1,118 @@
+package domain
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/iyuangang/gpgenie/internal/config"
+
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// readV6Packets splits an armored block into packet tags and bodies. It only
+// handles the header forms v6Packet writes.
+func readV6Packets(t *testing.T, armored string) ([]byte, [][]byte) {
+	t.Helper()
+	block, err := armor.Decode(strings.NewReader(armored))
+	require.NoError(t, err)
+	data, err := io.ReadAll(block.Body)
+	require.NoError(t, err)
+
+	var tags []byte
+	var bodies [][]byte
+	for len(data) > 0 {
+		require.Equal(t, byte(0xC0), data[0]&0xC0, "new-format packet header")
+		tag := data[0] & 0x3F
+		var length, header int
+		switch first := int(data[1]); {
+		case first < 192:
+			length, header = first, 2
+		case first < 224:
+			length, header = (first-192)<<8+int(data[2])+192, 3
+		default:
+			length, header = int(binary.BigEndian.Uint32(data[2:6])), 6
+		}
+		tags = append(tags, tag)
+		bodies = append(bodies, data[header:header+length])
+		data = data[header+length:]
+	}
+	return tags, bodies
+}
+
+func TestNewV6KeyFingerprint(t *testing.T) {
+	key, err := NewV6Key(config.KeyGenerationConfig{Name: "Test User", Email: "test@example.com"})
+	require.NoError(t, err)
+
+	body := key.publicKeyBody()
+	assert.Equal(t, byte(KeyVersion6), body[0])
+	assert.Equal(t, byte(v6AlgoEd25519), body[5])
+	assert.Len(t, key.Fingerprint(), 32)
+	prefixed := append([]byte{0x9B, 0, 0, 0, byte(len(body))}, body...)
+	assert.Equal(t, sha256.Sum256(prefixed), key.fingerprint)
+}
+
+func TestV6KeySerialize(t *testing.T) {
+	key, err := NewV6Key(config.KeyGenerationConfig{Name: "Test User", Comment: "v6", Email: "test@example.com"})
+	require.NoError(t, err)
+
+	var armoredSecret string
+	encryptor := new(MockEncryptor)
+	encryptor.On("Encrypt", mock.Anything).Run(func(args mock.Arguments) {
+		armoredSecret = args.String(0)
+	}).Return("encrypted", nil)
+
+	publicKey, privateKey, err := key.Serialize(encryptor)
+	require.NoError(t, err)
+	assert.Equal(t, "encrypted", privateKey)
+
+	tags, bodies := readV6Packets(t, publicKey)
+	require.Equal(t, []byte{v6PacketPublicKey, v6PacketUserID, v6PacketSignature}, tags)
+	assert.Equal(t, key.publicKeyBody(), bodies[0])
+	assert.Equal(t, "Test User (v6) <test@example.com>", string(bodies[1]))
+
+	// The self-signature verifies against the key over the v6 digest.
+	signature := bodies[2]
+	require.Equal(t, []byte{KeyVersion6, v6SigPositiveID, v6AlgoEd25519, v6HashSHA256}, signature[:4])
+	hashedLength := int(binary.BigEndian.Uint32(signature[4:8]))
+	prefix := signature[:8+hashedLength]
+	rest := signature[len(prefix):]
+	require.Equal(t, []byte{0, 0, 0, 0}, rest[:4], "no unhashed subpackets")
+	hashTag, saltSize := rest[4:6], int(rest[6])
+	require.Equal(t, v6SaltSize, saltSize)
+	salt, sig := rest[7:7+saltSize], rest[7+saltSize:]
+	require.Len(t, sig, ed25519.SignatureSize)
+	digest := v6CertificationDigest(salt, bodies[0], string(bodies[1]), prefix)
+	assert.Equal(t, digest[:2], hashTag)
+	assert.True(t, ed25519.Verify(key.public, digest[:], sig))
+	assert.True(t, bytes.Contains(prefix, append([]byte{v6SubpacketIssuerFP, KeyVersion6}, key.Fingerprint()...)))
+
+	tags, bodies = readV6Packets(t, armoredSecret)
+	require.Equal(t, []byte{v6PacketSecretKey, v6PacketUserID, v6PacketSignature}, tags)
+	secret := bodies[0]
+	require.Len(t, secret, len(key.publicKeyBody())+1+ed25519.SeedSize)
+	assert.Equal(t, key.publicKeyBody(), secret[:len(key.publicKeyBody())])
+	assert.Equal(t, byte(0), secret[len(key.publicKeyBody())], "unencrypted secret key material")
+	seed := secret[len(key.publicKeyBody())+1:]
+	assert.Equal(t, key.public, ed25519.NewKeyFromSeed(seed).Public())
+}
+
+func TestGenerateKeySelectsVersion(t *testing.T) {
+	v4, err := GenerateKey(config.KeyGenerationConfig{Name: "Test User"})
+	require.NoError(t, err)
+	assert.Len(t, v4.Fingerprint(), 20)
+
+	v6, err := GenerateKey(config.KeyGenerationConfig{Name: "Test User", KeyVersion: KeyVersion6})
+	require.NoError(t, err)
+	assert.Len(t, v6.Fingerprint(), 32)
+
+	_, err = GenerateKey(config.KeyGenerationConfig{Name: "Bad\x00User", KeyVersion: KeyVersion6})
+	assert.Error(t, err)
+}
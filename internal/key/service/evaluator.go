@@ -0,0 +1,138 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/iyuangang/gpgenie/internal/config"
+	"github.com/iyuangang/gpgenie/internal/key/domain"
+	"github.com/iyuangang/gpgenie/models"
+)
+
+// candidateEvaluator scores a fingerprint and decides whether the key is kept.
+// It is built once per run and shared by all scorer workers.
+type candidateEvaluator struct {
+	scorer          domain.Scorer
+	rarity          *domain.RarityEstimator
+	window          config.ScoringWindow
+	patterns        *domain.PatternSet
+	minScore        int
+	maxLettersCount int
+	algorithm       string
+	keyVersion      int
+	runID           uint
+	// filter, when set, replaces the min_score and max_letters_count rules
+	// with a compiled accept expression. Pattern hits are still accepted.
+	filter *domain.Filter
+	// keeper, when set, replaces the min_score and max_letters_count
+	// thresholds with a keep_top ranking.
+	keeper *topKeeper
+}
+
+// evaluation is the outcome of scoring one fingerprint.
+type evaluation struct {
+	fingerprint string
+	suffix      string
+	// digits are the fingerprint digits the scoring window selects.
+	digits   string
+	scores   domain.Scores
+	pattern  string
+	accepted bool
+}
+
+func newCandidateEvaluator(cfg config.KeyGenerationConfig, scoring config.ScoringConfig, runID uint) (*candidateEvaluator, error) {
+	scorer, err := domain.NewScorer(scoring)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scoring configuration: %w", err)
+	}
+	window, err := config.ParseScoringWindow(scoring.Window)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scoring configuration: %w", err)
+	}
+	patterns, err := domain.CompilePatterns(cfg.Patterns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key generation patterns: %w", err)
+	}
+	algorithm, err := domain.ResolveKeyAlgorithm(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key algorithm: %w", err)
+	}
+	var filter *domain.Filter
+	if cfg.Accept != "" {
+		if filter, err = domain.CompileFilter(cfg.Accept); err != nil {
+			return nil, fmt.Errorf("invalid key generation accept expression: %w", err)
+		}
+	}
+	return &candidateEvaluator{
+		filter:          filter,
+		scorer:          scorer,
+		rarity:          domain.NewRarityEstimator(scorer, scoring),
+		window:          window,
+		patterns:        patterns,
+		minScore:        cfg.MinScore,
+		maxLettersCount: cfg.MaxLettersCount,
+		algorithm:       algorithm.Label,
+		keyVersion:      domain.ResolveKeyVersion(cfg),
+		runID:           runID,
+	}, nil
+}
+
+// prepareRarity builds the rarity table for the fingerprints of this run, so
+// that the scorer workers do not stall on it.
+func (e *candidateEvaluator) prepareRarity() {
+	length := 40
+	if e.keyVersion == domain.KeyVersion6 {
+		length = 64
+	}
+	e.rarity.Prepare(domain.ScoringDigitCount(e.window, length))
+}
+
+// evaluate scores a lower-case hexadecimal fingerprint. A key is accepted when
+// it hits a pattern target, exceeds min_score, or uses at most
+// max_letters_count distinct digits; an accept expression replaces the last
+// two rules. With keep_top, a key that is not a pattern hit must also rank among
+// the retained keys, and the thresholds no longer apply.
+func (e *candidateEvaluator) evaluate(fingerprint string) (evaluation, error) {
+	result := evaluation{
+		fingerprint: fingerprint,
+		suffix:      domain.GetLastSixteen(fingerprint),
+		digits:      domain.ScoringDigits(e.window, fingerprint),
+	}
+	scores, err := e.scorer.Score(result.digits)
+	if err != nil {
+		return result, err
+	}
+	result.scores = scores
+	var hit bool
+	result.pattern, hit = e.patterns.Match(fingerprint)
+	switch {
+	case hit:
+		result.accepted = true
+	case e.filter != nil:
+		result.accepted = e.filter.Eval(&domain.FilterInput{Scores: scores, Suffix: result.digits})
+	case e.keeper != nil:
+		result.accepted = true
+	default:
+		result.accepted = scores.Total() > e.minScore || scores.UniqueLettersCount <= e.maxLettersCount
+	}
+	if result.accepted && !hit && e.keeper != nil {
+		result.accepted = e.keeper.admits(scores.Total())
+	}
+	return result, nil
+}
+
+// keyInfo builds the database record for an accepted evaluation.
+func (e *candidateEvaluator) keyInfo(result evaluation, publicKey, privateKey string) *models.KeyInfo {
+	keyInfo := &models.KeyInfo{
+		Fingerprint:       result.fingerprint,
+		FingerprintSuffix: result.suffix,
+		PublicKey:         publicKey,
+		PrivateKey:        privateKey,
+		MatchedPattern:    result.pattern,
+		Algorithm:         e.algorithm,
+		KeyVersion:        e.keyVersion,
+		RunID:             e.runID,
+	}
+	domain.ApplyScores(keyInfo, e.scorer, e.window, result.scores)
+	keyInfo.Rarity = e.rarity.Rarity(len(result.digits), keyInfo.Score)
+	return keyInfo
+}
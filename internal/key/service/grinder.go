@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iyuangang/gpgenie/internal/config"
+	"github.com/iyuangang/gpgenie/internal/key/domain"
+	"github.com/iyuangang/gpgenie/internal/key/vanity"
+)
+
+// grindFlushInterval is how many fingerprints a grinder scores between
+// updates of the shared generated counter and checks for cancellation.
+const grindFlushInterval = 4096
+
+// evaluatedKeyPair is a key the grinder has already evaluated. The scorer
+// workers use its evaluation rather than scoring the fingerprint again.
+type evaluatedKeyPair struct {
+	domain.KeyPair
+	evaluation evaluation
+}
+
+// grinderWorker replaces generatorWorker when key_generation.grind_window is
+// set. Each job derives its fingerprints from an Ed25519 template by stepping
+// the creation timestamp back from now, and scores them in place. Only
+// accepted candidates are materialized as entities and passed, with their
+// evaluation, to the scorer workers, which serialize and encrypt them. Every
+// timestamp of a template shares its secret, so after an accepted candidate
+// the job continues with a fresh template. When produceCtx ends, the grinder
+// stops scoring but still hands over a materialized entity unless ctx is
+// canceled too.
+func (s *keyService) grinderWorker(
+	id int,
+	ctx context.Context,
+	produceCtx context.Context,
+	cfg config.KeyGenerationConfig,
+	evaluator *candidateEvaluator,
+	jobs <-chan int,
+	output chan<- domain.KeyPair,
+	wg *sync.WaitGroup,
+	generated *atomic.Uint64,
+	fail func(error),
+) {
+	defer wg.Done()
+	s.logger.Debugf("Grinder Worker %d started.", id)
+
+	identity := vanity.Identity{Name: cfg.Name, Comment: cfg.Comment, Email: cfg.Email}
+	var scored uint64
+	defer func() { generated.Add(scored) }()
+
+	for {
+		select {
+		case <-produceCtx.Done():
+			return
+		case count, ok := <-jobs:
+			if !ok || produceCtx.Err() != nil {
+				return
+			}
+			template, err := vanity.NewGrindTemplate()
+			if err != nil {
+				fail(fmt.Errorf("grinder worker %d: %w", id, err))
+				return
+			}
+			newest := uint32(time.Now().Unix())
+			step := uint32(0)
+			for i := 0; i < count; i++ {
+				if scored >= grindFlushInterval {
+					generated.Add(scored)
+					scored = 0
+					if produceCtx.Err() != nil {
+						return
+					}
+				}
+				timestamp := newest - step
+				step++
+				fingerprint, err := template.FingerprintAt(timestamp)
+				if err != nil {
+					fail(fmt.Errorf("grinder worker %d: %w", id, err))
+					return
+				}
+				scored++
+				result, err := evaluator.evaluate(hex.EncodeToString(fingerprint[:]))
+				if err != nil {
+					fail(fmt.Errorf("grinder worker %d: calculate score: %w", id, err))
+					return
+				}
+				if !result.accepted {
+					continue
+				}
+
+				entity, err := template.Entity(identity, timestamp)
+				if err != nil {
+					fail(fmt.Errorf("grinder worker %d: materialize key: %w", id, err))
+					return
+				}
+				select {
+				case output <- evaluatedKeyPair{KeyPair: domain.EntityKeyPair{Entity: entity}, evaluation: result}:
+				case <-ctx.Done():
+					return
+				}
+				template, err = vanity.NewGrindTemplate()
+				if err != nil {
+					fail(fmt.Errorf("grinder worker %d: %w", id, err))
+					return
+				}
+				newest, step = uint32(time.Now().Unix()), 0
+			}
+		}
+	}
+}
@@ -8,7 +8,7 @@ import (
 )
 
 // InitializeKeyService initializes the KeyService with all dependencies.
-func InitializeKeyService(cfg *config.Config, repo repository.KeyRepository, log *logger.Logger) (KeyService, error) {
+func InitializeKeyService(cfg *config.Config, repo repository.KeyRepository, runs repository.RunRepository, log *logger.Logger) (KeyService, error) {
 	// Initialize Encryptor
 	encryptor, err := NewPGPEncryptor(cfg.KeyGeneration.EncryptorPublicKey)
 	if err != nil {
@@ -16,6 +16,6 @@ func InitializeKeyService(cfg *config.Config, repo repository.KeyRepository, log
 	}
 
 	// Create KeyService
-	keyService := NewKeyService(repo, &cfg.KeyGeneration, encryptor, log)
+	keyService := NewKeyService(repo, runs, &cfg.KeyGeneration, &cfg.Scoring, encryptor, log)
 	return keyService, nil
 }
@@ -3,7 +3,9 @@ package service
 import (
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -11,58 +13,190 @@ import (
 	"github.com/iyuangang/gpgenie/internal/config"
 	"github.com/iyuangang/gpgenie/internal/key/domain"
 	"github.com/iyuangang/gpgenie/internal/logger"
+	"github.com/iyuangang/gpgenie/internal/metrics"
 	"github.com/iyuangang/gpgenie/internal/repository"
 	"github.com/iyuangang/gpgenie/models"
-
-	"github.com/ProtonMail/go-crypto/openpgp"
 )
 
 const pipelineBufferMultiplier = 2
 
 // KeyService defines the interface for the key service.
 type KeyService interface {
-	GenerateKeys(ctx context.Context) error
-	ShowTopKeys(n int) error
-	ShowMinimalKeys(n int) error
-	ExportKeyByFingerprint(lastSixteen, outputDir string, exportArmor bool) error
-	AnalyzeData() error
+	GenerateKeys(ctx context.Context, opts GenerateOptions) (*GenerateSummary, error)
+	GenerateSharded(ctx context.Context, opts GenerateOptions, shards ShardOptions) (*GenerateSummary, error)
+	ShowTopKeys(n int, filter repository.KeyFilter) error
+	ShowMinimalKeys(n int, filter repository.KeyFilter) error
+	ShowRuns(n int) error
+	RescoreKeys(filter repository.KeyFilter, batchSize int) (int64, error)
+	ExportKeyByFingerprint(fingerprint, outputDir string, exportArmor bool) error
+	AnalyzeData(filter repository.KeyFilter, rarest int) error
+}
+
+// GenerateOptions controls a single GenerateKeys invocation.
+type GenerateOptions struct {
+	// ResumeRunID continues an unfinished run toward its remaining target
+	// instead of starting a new run.
+	ResumeRunID uint
+	// Progress, when set, receives a snapshot every ProgressInterval (five
+	// seconds by default) and a final one when the pipeline stops.
+	Progress         ProgressFunc
+	ProgressInterval time.Duration
+	// Metrics, when set, receives the pipeline counters, queue depths, and
+	// batch insert latency.
+	Metrics *metrics.Registry
+	// Deadline, when set, stops issuing new candidates at that time. Work in
+	// flight is drained and saved, and the run is left resumable.
+	Deadline time.Time
+	// MaxRate caps the average number of candidates issued per second.
+	// Zero means unlimited.
+	MaxRate float64
+	// Abort, when closed, stops the pipeline at once. Canceling the context
+	// passed to GenerateKeys only stops new candidates and drains the keys
+	// in flight to the database; Abort discards them.
+	Abort <-chan struct{}
+	// Profile names the configuration profile in effect. It is recorded with
+	// a new run; a resumed run keeps the profile it was started with.
+	Profile string
+}
+
+// GenerateSummary reports the cumulative counters of the run that
+// GenerateKeys created or resumed.
+type GenerateSummary struct {
+	RunID     uint
+	Generated uint64
+	Accepted  uint64
+	Saved     uint64
+	Elapsed   time.Duration
+	// DeadlineReached reports that GenerateOptions.Deadline stopped the run
+	// before its target.
+	DeadlineReached bool
+	// Drained counts the keys saved after the run was interrupted or reached
+	// its deadline.
+	Drained uint64
+	// Inserted, Updated, and Skipped break down this invocation's batch
+	// inserts by the key_generation.on_conflict outcome. Saved includes the
+	// inserted and updated keys.
+	Inserted uint64
+	Updated  uint64
+	Skipped  uint64
+	// Evicted counts keys displaced from the keep_top ranking, whether they
+	// were deleted from the database or dropped before being saved.
+	Evicted uint64
 }
 
 type keyService struct {
 	repo      repository.KeyRepository
+	runs      repository.RunRepository
 	config    *config.KeyGenerationConfig
+	scoring   *config.ScoringConfig
 	encryptor domain.Encryptor
 	logger    *logger.Logger
 }
 
-// NewKeyService creates a key service. The configuration is kept by reference so
-// command-line overrides applied before GenerateKeys are honored.
-func NewKeyService(repo repository.KeyRepository, cfg *config.KeyGenerationConfig, encryptor domain.Encryptor, log *logger.Logger) KeyService {
+// NewKeyService creates a key service. The configurations are kept by reference
+// so command-line overrides applied before GenerateKeys are honored.
+func NewKeyService(
+	repo repository.KeyRepository,
+	runs repository.RunRepository,
+	cfg *config.KeyGenerationConfig,
+	scoring *config.ScoringConfig,
+	encryptor domain.Encryptor,
+	log *logger.Logger,
+) KeyService {
 	return &keyService{
 		repo:      repo,
+		runs:      runs,
 		config:    cfg,
+		scoring:   scoring,
 		encryptor: encryptor,
 		logger:    log,
 	}
 }
 
-// GenerateKeys runs a bounded generate -> score -> persist pipeline.
-func (s *keyService) GenerateKeys(parent context.Context) error {
+// GenerateKeys runs a bounded generate -> score -> persist pipeline. Every
+// invocation is tracked in the run ledger so an interrupted run can be resumed
+// with GenerateOptions.ResumeRunID. When parent is canceled, accepted keys
+// already in the pipeline are still saved before the context error is
+// returned; close GenerateOptions.Abort to skip that drain.
+func (s *keyService) GenerateKeys(parent context.Context, opts GenerateOptions) (*GenerateSummary, error) {
 	if parent == nil {
 		parent = context.Background()
 	}
+	if opts.MaxRate < 0 {
+		return nil, fmt.Errorf("max rate must not be negative")
+	}
+
+	snapshot := runSnapshot{Profile: opts.Profile, KeyGeneration: *s.config, Scoring: s.scoringConfig()}
+	if err := snapshot.KeyGeneration.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid key generation configuration: %w", err)
+	}
+
+	run, err := s.startRun(&snapshot, opts.ResumeRunID)
+	if err != nil {
+		return nil, err
+	}
+	evaluator, err := newCandidateEvaluator(snapshot.KeyGeneration, snapshot.Scoring, run.ID)
+	if err == nil && snapshot.KeyGeneration.KeepTop > 0 {
+		evaluator.keeper, err = s.seedTopKeeper(snapshot.KeyGeneration.KeepTop, evaluator.window)
+	}
+	if err != nil {
+		_ = s.finishRun(run.ID, nil, err)
+		return nil, err
+	}
+	evaluator.prepareRarity()
+	summary, err := s.runPipeline(parent, snapshot.KeyGeneration, evaluator, run, opts)
+	if finishErr := s.finishRun(run.ID, summary, err); finishErr != nil && err == nil {
+		err = finishErr
+	}
+	return summary, err
+}
 
-	cfg := *s.config
-	if err := cfg.Validate(); err != nil {
-		return fmt.Errorf("invalid key generation configuration: %w", err)
+// seedTopKeeper loads the best stored keys that keep_top may evict. Vanity
+// keys and pattern hits are never evicted and do not count toward the limit,
+// and neither do keys scored over another window, whose scores are not
+// comparable.
+func (s *keyService) seedTopKeeper(limit int, window config.ScoringWindow) (*topKeeper, error) {
+	seed, err := s.repo.GetTopKeys(limit, repository.KeyFilter{RankedOnly: true, ScoreWindow: window.String()})
+	if err != nil {
+		return nil, fmt.Errorf("load top keys: %w", err)
 	}
+	s.logger.Infof("Keeping the top %d keys; %d stored keys seed the ranking.", limit, len(seed))
+	return newTopKeeper(limit, seed), nil
+}
+
+// scoringConfig returns the configured scoring section, falling back to the
+// classic defaults when the service was built without one.
+func (s *keyService) scoringConfig() config.ScoringConfig {
+	if s.scoring == nil || s.scoring.IsZero() {
+		return config.DefaultScoringConfig()
+	}
+	return *s.scoring
+}
 
-	ctx, cancel := context.WithCancel(parent)
+func (s *keyService) runPipeline(
+	parent context.Context,
+	cfg config.KeyGenerationConfig,
+	evaluator *candidateEvaluator,
+	run *models.GenerationRun,
+	opts GenerateOptions,
+) (*GenerateSummary, error) {
+	// ctx stops every stage and ends only on a pipeline error or an abort.
+	// Canceling parent ends produceCtx below instead, so the pipeline drains.
+	ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
 	defer cancel()
-	startedAt := time.Now()
+	if opts.Abort != nil {
+		go func() {
+			select {
+			case <-opts.Abort:
+				s.logger.Warnf("Aborting key generation run %d; keys in flight are discarded.", run.ID)
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
 
-	generationJobs := make(chan struct{}, cfg.NumGeneratorWorkers*pipelineBufferMultiplier)
-	generatedEntities := make(chan *openpgp.Entity, (cfg.NumGeneratorWorkers+cfg.NumScorerWorkers)*pipelineBufferMultiplier)
+	generationJobs := make(chan int, cfg.NumGeneratorWorkers*pipelineBufferMultiplier)
+	generatedKeys := make(chan domain.KeyPair, (cfg.NumGeneratorWorkers+cfg.NumScorerWorkers)*pipelineBufferMultiplier)
 	scoredKeyInfos := make(chan *models.KeyInfo, cfg.NumScorerWorkers*pipelineBufferMultiplier)
 
 	var (
@@ -71,9 +205,39 @@ func (s *keyService) GenerateKeys(parent context.Context) error {
 		scorerWG     sync.WaitGroup
 		firstErr     error
 		firstErrOnce sync.Once
-		generated    atomic.Uint64
-		accepted     atomic.Uint64
 	)
+	counters := &pipelineCounters{
+		startedAt: time.Now(),
+		base: Progress{
+			RunID:      run.ID,
+			TargetKeys: run.TargetKeys,
+			Generated:  run.Generated,
+			Accepted:   run.Accepted,
+			Saved:      run.Saved,
+		},
+		queueLen: func() (int, int) {
+			return len(generatedKeys), len(scoredKeyInfos)
+		},
+		entityCap: cap(generatedKeys),
+		keyCap:    cap(scoredKeyInfos),
+	}
+	generated, accepted := &counters.generated, &counters.accepted
+
+	// produceCtx bounds only the issuing of new work. When it ends at the
+	// deadline or on interrupt, the generator, scorer, and persistence stages
+	// drain what is already in flight.
+	produceCtx, stopProducing := context.WithCancel(ctx)
+	if !opts.Deadline.IsZero() {
+		produceCtx, stopProducing = context.WithDeadline(ctx, opts.Deadline)
+	}
+	defer stopProducing()
+	stopInterrupt := context.AfterFunc(parent, func() {
+		s.logger.Infof("Key generation run %d interrupted; saving keys in flight.", run.ID)
+		stopProducing()
+	})
+	defer stopInterrupt()
+	stopProgress := startProgressReporter(opts.Progress, opts.ProgressInterval, counters)
+	insertLatency := registerPipelineMetrics(opts.Metrics, counters)
 
 	fail := func(err error) {
 		if err == nil {
@@ -85,14 +249,25 @@ func (s *keyService) GenerateKeys(parent context.Context) error {
 		})
 	}
 
+	// Each job asks a generator worker for a number of scored candidates: one
+	// entity, or one grind window of fingerprints from a single template.
+	jobSize := 1
+	if cfg.GrindWindow > 0 {
+		jobSize = cfg.GrindWindow
+	}
+	pacer := newRatePacer(opts.MaxRate)
 	producerWG.Add(1)
 	go func() {
 		defer producerWG.Done()
 		defer close(generationJobs)
-		for i := 0; i < cfg.TotalKeys; i++ {
+		for remaining := cfg.TotalKeys; remaining > 0; remaining -= jobSize {
+			count := min(jobSize, remaining)
+			if !pacer.wait(produceCtx, count) {
+				return
+			}
 			select {
-			case generationJobs <- struct{}{}:
-			case <-ctx.Done():
+			case generationJobs <- count:
+			case <-produceCtx.Done():
 				return
 			}
 		}
@@ -100,11 +275,15 @@ func (s *keyService) GenerateKeys(parent context.Context) error {
 
 	for i := 0; i < cfg.NumGeneratorWorkers; i++ {
 		generatorWG.Add(1)
-		go s.generatorWorker(i, ctx, cfg, generationJobs, generatedEntities, &generatorWG, &generated, fail)
+		if cfg.GrindWindow > 0 {
+			go s.grinderWorker(i, ctx, produceCtx, cfg, evaluator, generationJobs, generatedKeys, &generatorWG, generated, fail)
+			continue
+		}
+		go s.generatorWorker(i, ctx, produceCtx, cfg, generationJobs, generatedKeys, &generatorWG, generated, fail)
 	}
 	go func() {
 		generatorWG.Wait()
-		close(generatedEntities)
+		close(generatedKeys)
 	}()
 
 	for i := 0; i < cfg.NumScorerWorkers; i++ {
@@ -114,14 +293,28 @@ func (s *keyService) GenerateKeys(parent context.Context) error {
 			break
 		}
 		scorerWG.Add(1)
-		go s.scorerWorker(i, ctx, cfg, workerEncryptor, generatedEntities, scoredKeyInfos, &scorerWG, &accepted, fail)
+		go s.scorerWorker(i, ctx, evaluator, workerEncryptor, generatedKeys, scoredKeyInfos, &scorerWG, accepted, fail)
 	}
 	go func() {
 		scorerWG.Wait()
 		close(scoredKeyInfos)
 	}()
 
-	saved, persistErr := s.persistBatches(ctx, scoredKeyInfos, cfg.BatchSize)
+	var drained, savedBeforeFlush uint64
+	onConflict := repository.ConflictPolicy(cfg.OnConflict)
+	persisted, persistErr := s.persistBatches(ctx, scoredKeyInfos, cfg.BatchSize, onConflict, evaluator.keeper, insertLatency, func(saved uint64) error {
+		if produceCtx.Err() != nil {
+			drained += saved - savedBeforeFlush
+		}
+		savedBeforeFlush = saved
+		counters.saved.Store(saved)
+		return s.runs.UpdateRunProgress(
+			run.ID,
+			run.Generated+generated.Load(),
+			run.Accepted+accepted.Load(),
+			run.Saved+saved,
+		)
+	})
 	if persistErr != nil {
 		fail(persistErr)
 	}
@@ -130,59 +323,141 @@ func (s *keyService) GenerateKeys(parent context.Context) error {
 	generatorWG.Wait()
 	scorerWG.Wait()
 
+	stopProgress()
+	counters.saved.Store(uint64(persisted.Written()))
+	final := counters.snapshot(true)
+	if opts.Progress != nil {
+		opts.Progress(final)
+	}
+
+	elapsed := final.Elapsed
+	summary := &GenerateSummary{
+		RunID:     run.ID,
+		Generated: final.Generated,
+		Accepted:  final.Accepted,
+		Saved:     final.Saved,
+		Elapsed:   elapsed,
+		Drained:   drained,
+		Inserted:  uint64(persisted.Inserted),
+		Updated:   uint64(persisted.Updated),
+		Skipped:   uint64(persisted.Skipped),
+	}
+	if evaluator.keeper != nil {
+		summary.Evicted = evaluator.keeper.evicted.Load()
+	}
 	if firstErr != nil {
-		return firstErr
+		return summary, firstErr
 	}
 	if err := parent.Err(); err != nil {
-		return err
+		s.logger.Infof(
+			"Key generation interrupted: run=%d generated=%d accepted=%d saved=%d drained=%d elapsed=%s.",
+			run.ID, summary.Generated, summary.Accepted, summary.Saved, drained, elapsed.Round(time.Millisecond),
+		)
+		return summary, err
 	}
-
-	elapsed := time.Since(startedAt)
-	rate := 0.0
-	if elapsed > 0 {
-		rate = float64(generated.Load()) / elapsed.Seconds()
+	if final.Generated < uint64(run.TargetKeys) && errors.Is(produceCtx.Err(), context.DeadlineExceeded) {
+		summary.DeadlineReached = true
+		s.logger.Infof(
+			"Key generation stopped at its deadline: run=%d generated=%d/%d accepted=%d saved=%d drained=%d elapsed=%s.",
+			run.ID, summary.Generated, run.TargetKeys, summary.Accepted, summary.Saved, drained, elapsed.Round(time.Millisecond),
+		)
+		return summary, nil
 	}
+
 	s.logger.Infof(
-		"Key generation completed: generated=%d accepted=%d saved=%d elapsed=%s rate=%.2f candidates/s.",
-		generated.Load(), accepted.Load(), saved, elapsed.Round(time.Millisecond), rate,
+		"Key generation completed: run=%d generated=%d accepted=%d saved=%d skipped=%d elapsed=%s rate=%.2f candidates/s.",
+		run.ID, summary.Generated, summary.Accepted, summary.Saved, summary.Skipped, elapsed.Round(time.Millisecond), final.GenerateRate,
 	)
-	return nil
+	return summary, nil
 }
 
-func (s *keyService) persistBatches(ctx context.Context, input <-chan *models.KeyInfo, batchSize int) (uint64, error) {
+// persistBatches writes accepted keys in batches, resolving duplicate
+// fingerprints with onConflict, and records the duration of each insert in
+// latency. afterFlush is called with the number of keys written so far after
+// every successful batch. It flushes the final partial batch once input
+// is closed; ctx ends only on a pipeline error or an abort, which discard the
+// pending batch.
+//
+// With a keeper, keys that are not pattern hits are saved only if they enter
+// the top keys; a displaced key is dropped from the pending batch or deleted
+// after the next insert.
+func (s *keyService) persistBatches(
+	ctx context.Context,
+	input <-chan *models.KeyInfo,
+	batchSize int,
+	onConflict repository.ConflictPolicy,
+	keeper *topKeeper,
+	latency *metrics.Histogram,
+	afterFlush func(saved uint64) error,
+) (repository.BatchResult, error) {
 	batch := make([]*models.KeyInfo, 0, batchSize)
-	var saved uint64
+	var (
+		total     repository.BatchResult
+		evictions []string
+	)
 	flush := func() error {
 		if len(batch) == 0 {
 			return nil
 		}
 		s.logger.Debugf("Saving %d keys to database.", len(batch))
-		if err := s.repo.BatchCreate(batch); err != nil {
+		insertStartedAt := time.Now()
+		result, err := s.repo.BatchCreate(batch, onConflict)
+		if err != nil {
 			return fmt.Errorf("save key batch: %w", err)
 		}
-		saved += uint64(len(batch))
+		latency.Observe(time.Since(insertStartedAt).Seconds())
+		if result.Skipped > 0 {
+			s.logger.Debugf("Skipped %d keys with duplicate fingerprints.", result.Skipped)
+		}
+		total.Add(result)
 		batch = batch[:0]
+		if len(evictions) > 0 {
+			if _, err := s.repo.DeleteByFingerprints(evictions); err != nil {
+				return fmt.Errorf("evict displaced keys: %w", err)
+			}
+			evictions = evictions[:0]
+		}
+		if afterFlush != nil {
+			if err := afterFlush(uint64(total.Written())); err != nil {
+				return fmt.Errorf("record run progress: %w", err)
+			}
+		}
 		return nil
 	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			return saved, ctx.Err()
+			return total, ctx.Err()
 		case keyInfo, ok := <-input:
 			if !ok {
 				if err := flush(); err != nil {
-					return saved, err
+					return total, err
 				}
-				return saved, nil
+				return total, nil
 			}
 			if keyInfo == nil {
 				continue
 			}
+			if keeper != nil && keyInfo.MatchedPattern == "" {
+				admitted, evicted := keeper.offer(keyInfo.Fingerprint, keyInfo.Score, keyInfo.UniqueLettersCount)
+				if !admitted {
+					continue
+				}
+				if evicted != "" {
+					if i := slices.IndexFunc(batch, func(pending *models.KeyInfo) bool {
+						return pending.Fingerprint == evicted
+					}); i >= 0 {
+						batch = slices.Delete(batch, i, i+1)
+					} else {
+						evictions = append(evictions, evicted)
+					}
+				}
+			}
 			batch = append(batch, keyInfo)
 			if len(batch) >= batchSize {
 				if err := flush(); err != nil {
-					return saved, err
+					return total, err
 				}
 			}
 		}
@@ -192,9 +467,10 @@ func (s *keyService) persistBatches(ctx context.Context, input <-chan *models.Ke
 func (s *keyService) generatorWorker(
 	id int,
 	ctx context.Context,
+	produceCtx context.Context,
 	cfg config.KeyGenerationConfig,
-	jobs <-chan struct{},
-	output chan<- *openpgp.Entity,
+	jobs <-chan int,
+	output chan<- domain.KeyPair,
 	wg *sync.WaitGroup,
 	generated *atomic.Uint64,
 	fail func(error),
@@ -204,19 +480,19 @@ func (s *keyService) generatorWorker(
 
 	for {
 		select {
-		case <-ctx.Done():
+		case <-produceCtx.Done():
 			return
 		case _, ok := <-jobs:
-			if !ok {
+			if !ok || produceCtx.Err() != nil {
 				return
 			}
-			entity, err := domain.GenerateKeyPair(cfg)
+			key, err := domain.GenerateKey(cfg)
 			if err != nil {
 				fail(fmt.Errorf("generator worker %d: %w", id, err))
 				return
 			}
 			select {
-			case output <- entity:
+			case output <- key:
 				generated.Add(1)
 			case <-ctx.Done():
 				return
@@ -228,9 +504,9 @@ func (s *keyService) generatorWorker(
 func (s *keyService) scorerWorker(
 	id int,
 	ctx context.Context,
-	cfg config.KeyGenerationConfig,
+	evaluator *candidateEvaluator,
 	encryptor domain.Encryptor,
-	input <-chan *openpgp.Entity,
+	input <-chan domain.KeyPair,
 	output chan<- *models.KeyInfo,
 	wg *sync.WaitGroup,
 	accepted *atomic.Uint64,
@@ -243,43 +519,32 @@ func (s *keyService) scorerWorker(
 		select {
 		case <-ctx.Done():
 			return
-		case entity, ok := <-input:
+		case key, ok := <-input:
 			if !ok {
 				return
 			}
 
-			fingerprint := hex.EncodeToString(entity.PrimaryKey.Fingerprint[:])
-			lastSixteen := fingerprint[len(fingerprint)-16:]
-			scores, err := domain.CalculateScores(lastSixteen)
-			if err != nil {
-				fail(fmt.Errorf("scorer worker %d: calculate score: %w", id, err))
-				return
-			}
-
-			totalScore := scores.RepeatLetterScore + scores.IncreasingLetterScore +
-				scores.DecreasingLetterScore + scores.MagicLetterScore
-			if totalScore <= cfg.MinScore && scores.UniqueLettersCount > cfg.MaxLettersCount {
-				continue
+			var result evaluation
+			if ground, ok := key.(evaluatedKeyPair); ok {
+				result = ground.evaluation
+			} else {
+				var err error
+				result, err = evaluator.evaluate(hex.EncodeToString(key.Fingerprint()))
+				if err != nil {
+					fail(fmt.Errorf("scorer worker %d: calculate score: %w", id, err))
+					return
+				}
+				if !result.accepted {
+					continue
+				}
 			}
 
-			pubKey, privateKey, err := domain.SerializeKeys(entity, encryptor)
+			pubKey, privateKey, err := key.Serialize(encryptor)
 			if err != nil {
 				fail(fmt.Errorf("scorer worker %d: serialize keys: %w", id, err))
 				return
 			}
-
-			keyInfo := &models.KeyInfo{
-				Fingerprint:           fingerprint,
-				FingerprintSuffix:     lastSixteen,
-				PublicKey:             pubKey,
-				PrivateKey:            privateKey,
-				RepeatLetterScore:     scores.RepeatLetterScore,
-				IncreasingLetterScore: scores.IncreasingLetterScore,
-				DecreasingLetterScore: scores.DecreasingLetterScore,
-				MagicLetterScore:      scores.MagicLetterScore,
-				Score:                 totalScore,
-				UniqueLettersCount:    scores.UniqueLettersCount,
-			}
+			keyInfo := evaluator.keyInfo(result, pubKey, privateKey)
 
 			select {
 			case output <- keyInfo:
@@ -291,11 +556,11 @@ func (s *keyService) scorerWorker(
 	}
 }
 
-func (s *keyService) ShowTopKeys(n int) error {
+func (s *keyService) ShowTopKeys(n int, filter repository.KeyFilter) error {
 	if n <= 0 {
 		return fmt.Errorf("count must be greater than zero")
 	}
-	keys, err := s.repo.GetTopKeys(n)
+	keys, err := s.repo.GetTopKeys(n, filter)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve top keys: %w", err)
 	}
@@ -303,11 +568,11 @@ func (s *keyService) ShowTopKeys(n int) error {
 	return nil
 }
 
-func (s *keyService) ShowMinimalKeys(n int) error {
+func (s *keyService) ShowMinimalKeys(n int, filter repository.KeyFilter) error {
 	if n <= 0 {
 		return fmt.Errorf("count must be greater than zero")
 	}
-	keys, err := s.repo.GetLowLetterCountKeys(n)
+	keys, err := s.repo.GetLowLetterCountKeys(n, filter)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve low letter count keys: %w", err)
 	}
@@ -315,15 +580,61 @@ func (s *keyService) ShowMinimalKeys(n int) error {
 	return nil
 }
 
-func (s *keyService) ExportKeyByFingerprint(lastSixteen, outputDir string, exportArmor bool) error {
-	keyInfo, err := s.repo.GetByFingerprint(lastSixteen)
+func (s *keyService) ShowRuns(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("count must be greater than zero")
+	}
+	runs, err := s.runs.ListRuns(n)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve generation runs: %w", err)
+	}
+	domain.DisplayRuns(runs)
+	return nil
+}
+
+// RescoreKeys recomputes the stored score columns of every matching key with
+// the configured scoring strategy.
+func (s *keyService) RescoreKeys(filter repository.KeyFilter, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("batch size must be greater than zero")
+	}
+	scorer, err := domain.NewScorer(s.scoringConfig())
+	if err != nil {
+		return 0, fmt.Errorf("invalid scoring configuration: %w", err)
+	}
+	window, err := config.ParseScoringWindow(s.scoringConfig().Window)
+	if err != nil {
+		return 0, fmt.Errorf("invalid scoring configuration: %w", err)
+	}
+	rarity := domain.NewRarityEstimator(scorer, s.scoringConfig())
+	// v4 and v6 fingerprints may select different numbers of digits.
+	rarity.Prepare(domain.ScoringDigitCount(window, 40), domain.ScoringDigitCount(window, 64))
+	updated, err := s.repo.Rescore(filter, batchSize, func(key *models.KeyInfo) error {
+		digits := domain.ScoringDigits(window, key.Fingerprint)
+		scores, err := scorer.Score(digits)
+		if err != nil {
+			return fmt.Errorf("score %s: %w", key.Fingerprint, err)
+		}
+		domain.ApplyScores(key, scorer, window, scores)
+		key.Rarity = rarity.Rarity(len(digits), key.Score)
+		return nil
+	})
+	if err != nil {
+		return updated, fmt.Errorf("rescore keys: %w", err)
+	}
+	s.logger.Infof("Rescored %d keys with the %s strategy over the %s window.", updated, scorer.Name(), window)
+	return updated, nil
+}
+
+func (s *keyService) ExportKeyByFingerprint(fingerprint, outputDir string, exportArmor bool) error {
+	keyInfo, err := s.repo.GetByFingerprint(fingerprint)
 	if err != nil {
 		return fmt.Errorf("failed to find key: %w", err)
 	}
 	return domain.ExportKey(keyInfo, outputDir, exportArmor, s.encryptor, s.logger)
 }
 
-func (s *keyService) AnalyzeData() error {
+func (s *keyService) AnalyzeData(filter repository.KeyFilter, rarest int) error {
 	analyzer := domain.NewAnalyzer(s.repo)
-	return analyzer.PerformAnalysis()
+	return analyzer.PerformAnalysis(filter, rarest)
 }
@@ -1,15 +1,25 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
 	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/iyuangang/gpgenie/internal/config"
+	"github.com/iyuangang/gpgenie/internal/key/domain"
 	"github.com/iyuangang/gpgenie/internal/logger"
+	"github.com/iyuangang/gpgenie/internal/metrics"
 	"github.com/iyuangang/gpgenie/internal/repository"
 	"github.com/iyuangang/gpgenie/models"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/eddsa"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -20,24 +30,118 @@ type testEncryptor struct{}
 
 func (testEncryptor) Encrypt(string) (string, error) { return "encrypted", nil }
 
+// slowEncryptor keeps scorer workers busy so that a test can interrupt a run
+// while keys are still in flight.
+type slowEncryptor struct{ delay time.Duration }
+
+func (e slowEncryptor) Encrypt(string) (string, error) {
+	time.Sleep(e.delay)
+	return "encrypted", nil
+}
+
 type testRepository struct {
-	batchErr error
+	batchErr  error
+	saved     []*models.KeyInfo
+	duplicate func(*models.KeyInfo) bool
+	top       []models.KeyInfo
+	topFilter repository.KeyFilter
+	deleted   []string
 }
 
-func (r *testRepository) BatchCreate([]*models.KeyInfo) error { return r.batchErr }
-func (r *testRepository) Upsert(*models.KeyInfo) error        { return r.batchErr }
-func (r *testRepository) GetTopKeys(int) ([]models.KeyInfo, error) {
-	return nil, nil
+func (r *testRepository) BatchCreate(keys []*models.KeyInfo, onConflict repository.ConflictPolicy) (repository.BatchResult, error) {
+	var result repository.BatchResult
+	if r.batchErr != nil {
+		return result, r.batchErr
+	}
+	for _, key := range keys {
+		if r.duplicate != nil && r.duplicate(key) && onConflict != repository.ConflictUpdate {
+			result.Skipped++
+			continue
+		}
+		r.saved = append(r.saved, key)
+		result.Inserted++
+	}
+	return result, nil
+}
+func (r *testRepository) Upsert(*models.KeyInfo) error { return r.batchErr }
+func (r *testRepository) DeleteByFingerprints(fingerprints []string) (int64, error) {
+	r.deleted = append(r.deleted, fingerprints...)
+	return int64(len(fingerprints)), nil
 }
-func (r *testRepository) GetLowLetterCountKeys(int) ([]models.KeyInfo, error) {
+func (r *testRepository) GetTopKeys(_ int, filter repository.KeyFilter) ([]models.KeyInfo, error) {
+	r.topFilter = filter
+	if filter.ScoreWindow == "" {
+		return r.top, nil
+	}
+	var top []models.KeyInfo
+	for _, key := range r.top {
+		window := key.ScoreWindow
+		if window == "" {
+			window = config.ScoringWindowLong
+		}
+		if window == filter.ScoreWindow {
+			top = append(top, key)
+		}
+	}
+	return top, nil
+}
+func (r *testRepository) GetLowLetterCountKeys(int, repository.KeyFilter) ([]models.KeyInfo, error) {
 	return nil, nil
 }
+func (r *testRepository) GetRarestKeys(int, repository.KeyFilter) ([]models.KeyInfo, error) {
+	return r.top, nil
+}
 func (r *testRepository) GetByFingerprint(string) (*models.KeyInfo, error) {
 	return nil, nil
 }
-func (r *testRepository) GetAnalysisStats() (*repository.AnalysisStats, error) {
+func (r *testRepository) GetAnalysisStats(repository.KeyFilter) (*repository.AnalysisStats, error) {
 	return &repository.AnalysisStats{}, nil
 }
+func (r *testRepository) Rescore(_ repository.KeyFilter, _ int, rescore func(*models.KeyInfo) error) (int64, error) {
+	for _, key := range r.saved {
+		if err := rescore(key); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(r.saved)), nil
+}
+
+type testRunRepository struct {
+	runs map[uint]*models.GenerationRun
+}
+
+func newTestRunRepository() *testRunRepository {
+	return &testRunRepository{runs: make(map[uint]*models.GenerationRun)}
+}
+
+func (r *testRunRepository) CreateRun(run *models.GenerationRun) error {
+	run.ID = uint(len(r.runs) + 1)
+	stored := *run
+	r.runs[run.ID] = &stored
+	return nil
+}
+func (r *testRunRepository) GetRun(id uint) (*models.GenerationRun, error) {
+	run, ok := r.runs[id]
+	if !ok {
+		return nil, errors.New("run not found")
+	}
+	copied := *run
+	return &copied, nil
+}
+func (r *testRunRepository) ListRuns(int) ([]models.GenerationRun, error) { return nil, nil }
+func (r *testRunRepository) ReopenRun(id uint) error {
+	r.runs[id].Status = models.RunStatusRunning
+	return nil
+}
+func (r *testRunRepository) UpdateRunProgress(id uint, generated, accepted, saved uint64) error {
+	run := r.runs[id]
+	run.Generated, run.Accepted, run.Saved = generated, accepted, saved
+	return nil
+}
+func (r *testRunRepository) FinishRun(id uint, status string, _ error) error {
+	r.runs[id].Status = status
+	return nil
+}
 
 func TestGenerateKeysReturnsPersistenceError(t *testing.T) {
 	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
@@ -47,9 +151,9 @@ func TestGenerateKeysReturnsPersistenceError(t *testing.T) {
 	cfg := validKeyGenerationConfig()
 	cfg.TotalKeys = 1
 	cfg.BatchSize = 1
-	service := NewKeyService(&testRepository{batchErr: errBatchCreate}, &cfg, testEncryptor{}, log)
+	service := NewKeyService(&testRepository{batchErr: errBatchCreate}, newTestRunRepository(), &cfg, nil, testEncryptor{}, log)
 
-	err = service.GenerateKeys(context.Background())
+	_, err = service.GenerateKeys(context.Background(), GenerateOptions{})
 	require.Error(t, err)
 	assert.ErrorIs(t, err, errBatchCreate)
 }
@@ -61,11 +165,11 @@ func TestGenerateKeysHonorsCanceledContext(t *testing.T) {
 
 	cfg := validKeyGenerationConfig()
 	cfg.TotalKeys = 1_000_000
-	service := NewKeyService(&testRepository{}, &cfg, testEncryptor{}, log)
+	service := NewKeyService(&testRepository{}, newTestRunRepository(), &cfg, nil, testEncryptor{}, log)
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
 
-	err = service.GenerateKeys(ctx)
+	_, err = service.GenerateKeys(ctx, GenerateOptions{})
 	assert.ErrorIs(t, err, context.Canceled)
 }
 
@@ -76,13 +180,620 @@ func TestGenerateKeysValidatesConfiguration(t *testing.T) {
 
 	cfg := validKeyGenerationConfig()
 	cfg.BatchSize = 0
-	service := NewKeyService(&testRepository{}, &cfg, testEncryptor{}, log)
+	service := NewKeyService(&testRepository{}, newTestRunRepository(), &cfg, nil, testEncryptor{}, log)
 
-	err = service.GenerateKeys(context.Background())
+	_, err = service.GenerateKeys(context.Background(), GenerateOptions{})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "batch_size")
 }
 
+func TestGenerateKeysRecordsRunAndTagsKeys(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 3
+	repo := &testRepository{}
+	runs := newTestRunRepository()
+	service := NewKeyService(repo, runs, &cfg, nil, testEncryptor{}, log)
+
+	summary, err := service.GenerateKeys(context.Background(), GenerateOptions{Profile: "smoke"})
+	require.NoError(t, err)
+	require.NotZero(t, summary.RunID)
+	assert.Equal(t, uint64(3), summary.Generated)
+	assert.Equal(t, uint64(3), summary.Saved)
+
+	run := runs.runs[summary.RunID]
+	assert.Equal(t, models.RunStatusCompleted, run.Status)
+	assert.Equal(t, 3, run.TargetKeys)
+	assert.Equal(t, uint64(3), run.Generated)
+	assert.Contains(t, run.ConfigSnapshot, "MinScore")
+	assert.Equal(t, "smoke", run.Profile)
+	assert.Contains(t, run.ConfigSnapshot, `"Profile":"smoke"`)
+	require.Len(t, repo.saved, 3)
+	for _, key := range repo.saved {
+		assert.Equal(t, summary.RunID, key.RunID)
+	}
+}
+
+func TestGenerateKeysRecordsConfiguredAlgorithm(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 2
+	cfg.Algorithm = "ecdsa"
+	cfg.Curve = "p384"
+	repo := &testRepository{}
+	service := NewKeyService(repo, newTestRunRepository(), &cfg, nil, testEncryptor{}, log)
+
+	_, err = service.GenerateKeys(context.Background(), GenerateOptions{})
+	require.NoError(t, err)
+	require.Len(t, repo.saved, 2)
+	for _, key := range repo.saved {
+		assert.Equal(t, "ecdsa-p384", key.Algorithm)
+	}
+}
+
+func TestGenerateKeysStoresV6Fingerprints(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 3
+	cfg.KeyVersion = 6
+	repo := &testRepository{}
+	service := NewKeyService(repo, newTestRunRepository(), &cfg, nil, testEncryptor{}, log)
+
+	_, err = service.GenerateKeys(context.Background(), GenerateOptions{})
+	require.NoError(t, err)
+	require.Len(t, repo.saved, 3)
+	for _, key := range repo.saved {
+		assert.Len(t, key.Fingerprint, 64)
+		assert.Equal(t, key.Fingerprint[48:], key.FingerprintSuffix)
+		assert.Equal(t, domain.KeyVersion6, key.KeyVersion)
+		assert.Equal(t, domain.AlgorithmEd25519, key.Algorithm)
+		assert.Contains(t, key.PublicKey, "BEGIN PGP PUBLIC KEY BLOCK")
+	}
+}
+
+func TestGenerateKeysGrindsTimestampWindows(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 25
+	cfg.GrindWindow = 10
+	cfg.NumGeneratorWorkers = 2
+	repo := &testRepository{}
+	service := NewKeyService(repo, newTestRunRepository(), &cfg, nil, testEncryptor{}, log)
+
+	summary, err := service.GenerateKeys(context.Background(), GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(25), summary.Generated)
+	require.Len(t, repo.saved, 25)
+	fingerprints := make(map[string]bool)
+	for _, key := range repo.saved {
+		assert.Equal(t, domain.GetLastSixteen(key.Fingerprint), key.FingerprintSuffix)
+		assert.Equal(t, domain.AlgorithmEd25519, key.Algorithm)
+		fingerprints[key.Fingerprint] = true
+	}
+	assert.Len(t, fingerprints, 25)
+
+	// Timestamps of one template share its secret, so every accepted key
+	// must come from its own template.
+	material := make(map[string]bool)
+	for _, key := range repo.saved {
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(key.PublicKey))
+		require.NoError(t, err)
+		require.Len(t, entities, 1)
+		assert.Equal(t, hex.EncodeToString(entities[0].PrimaryKey.Fingerprint), key.Fingerprint)
+		publicKey, ok := entities[0].PrimaryKey.PublicKey.(*eddsa.PublicKey)
+		require.True(t, ok)
+		material[hex.EncodeToString(publicKey.X)] = true
+	}
+	assert.Len(t, material, 25)
+}
+
+func TestScorerWorkerReusesGrinderEvaluation(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	// Thresholds no key meets, so a second evaluation would drop the key.
+	cfg := validKeyGenerationConfig()
+	cfg.MinScore, cfg.MaxLettersCount = 1000, 0
+	evaluator, err := newCandidateEvaluator(cfg, config.ScoringConfig{}, 1)
+	require.NoError(t, err)
+	key, err := domain.GenerateKey(cfg)
+	require.NoError(t, err)
+	ground, err := evaluator.evaluate(hex.EncodeToString(key.Fingerprint()))
+	require.NoError(t, err)
+	ground.accepted, ground.pattern = true, "ground"
+
+	service := NewKeyService(&testRepository{}, newTestRunRepository(), &cfg, nil, testEncryptor{}, log).(*keyService)
+	input := make(chan domain.KeyPair, 1)
+	output := make(chan *models.KeyInfo, 1)
+	input <- evaluatedKeyPair{KeyPair: key, evaluation: ground}
+	close(input)
+	var wg sync.WaitGroup
+	var accepted atomic.Uint64
+	wg.Add(1)
+	service.scorerWorker(1, context.Background(), evaluator, testEncryptor{}, input, output, &wg, &accepted, func(err error) { t.Error(err) })
+
+	require.Len(t, output, 1)
+	keyInfo := <-output
+	assert.Equal(t, ground.fingerprint, keyInfo.Fingerprint)
+	assert.Equal(t, "ground", keyInfo.MatchedPattern)
+	assert.Equal(t, uint64(1), accepted.Load())
+}
+
+func TestGenerateKeysRejectsGrindingForOtherAlgorithms(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.GrindWindow = 10
+	cfg.Algorithm = "rsa"
+	service := NewKeyService(&testRepository{}, newTestRunRepository(), &cfg, nil, testEncryptor{}, log)
+
+	_, err = service.GenerateKeys(context.Background(), GenerateOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "grind_window")
+}
+
+func TestGenerateKeysReportsProgress(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 5
+	service := NewKeyService(&testRepository{}, newTestRunRepository(), &cfg, nil, testEncryptor{}, log)
+
+	var snapshots []Progress
+	summary, err := service.GenerateKeys(context.Background(), GenerateOptions{
+		ProgressInterval: time.Millisecond,
+		Progress:         func(progress Progress) { snapshots = append(snapshots, progress) },
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, snapshots)
+
+	final := snapshots[len(snapshots)-1]
+	assert.True(t, final.Final)
+	assert.Equal(t, summary.RunID, final.RunID)
+	assert.Equal(t, 5, final.TargetKeys)
+	assert.Equal(t, uint64(5), final.Generated)
+	assert.Equal(t, uint64(5), final.Accepted)
+	assert.Equal(t, uint64(5), final.Saved)
+	assert.Positive(t, final.GenerateRate)
+	assert.Zero(t, final.ETA)
+	for _, progress := range snapshots[:len(snapshots)-1] {
+		assert.False(t, progress.Final)
+		assert.LessOrEqual(t, progress.Generated, uint64(5))
+	}
+}
+
+func TestGenerateKeysPublishesMetrics(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 4
+	cfg.BatchSize = 2
+	service := NewKeyService(&testRepository{}, newTestRunRepository(), &cfg, nil, testEncryptor{}, log)
+	registry := metrics.NewRegistry()
+
+	_, err = service.GenerateKeys(context.Background(), GenerateOptions{Metrics: registry})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	_, err = registry.WriteTo(&out)
+	require.NoError(t, err)
+	text := out.String()
+	assert.Contains(t, text, "gpgenie_generate_generated_total 4\n")
+	assert.Contains(t, text, "gpgenie_generate_accepted_total 4\n")
+	assert.Contains(t, text, "gpgenie_generate_saved_total 4\n")
+	assert.Contains(t, text, "gpgenie_generate_target_keys 4\n")
+	assert.Contains(t, text, `gpgenie_generate_queue_capacity{queue="entities"} 4`)
+	assert.Contains(t, text, "gpgenie_generate_batch_insert_seconds_count 2\n")
+}
+
+func TestGenerateKeysResumesRemainingTarget(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 5
+	repo := &testRepository{}
+	runs := newTestRunRepository()
+	service := NewKeyService(repo, runs, &cfg, nil, testEncryptor{}, log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	summary, err := service.GenerateKeys(ctx, GenerateOptions{})
+	require.ErrorIs(t, err, context.Canceled)
+	runID := summary.RunID
+	assert.Equal(t, models.RunStatusCanceled, runs.runs[runID].Status)
+
+	// Simulate an interrupted run that generated three of its five keys.
+	runs.runs[runID].Generated = 3
+	runs.runs[runID].Accepted = 3
+	runs.runs[runID].Saved = 3
+	repo.saved = nil
+
+	summary, err = service.GenerateKeys(context.Background(), GenerateOptions{ResumeRunID: runID})
+	require.NoError(t, err)
+	assert.Equal(t, runID, summary.RunID)
+	assert.Equal(t, uint64(5), summary.Generated)
+	assert.Equal(t, uint64(5), summary.Saved)
+	assert.Equal(t, models.RunStatusCompleted, runs.runs[runID].Status)
+	assert.Len(t, repo.saved, 2)
+
+	_, err = service.GenerateKeys(context.Background(), GenerateOptions{ResumeRunID: runID})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already completed")
+}
+
+func TestGenerateKeysStopsCleanlyAtDeadline(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 1 << 30
+	cfg.BatchSize = 7
+	repo := &testRepository{}
+	runs := newTestRunRepository()
+	service := NewKeyService(repo, runs, &cfg, nil, testEncryptor{}, log)
+
+	summary, err := service.GenerateKeys(context.Background(), GenerateOptions{
+		Deadline: time.Now().Add(50 * time.Millisecond),
+	})
+	require.NoError(t, err)
+	assert.True(t, summary.DeadlineReached)
+	assert.Positive(t, summary.Generated)
+	assert.Less(t, summary.Generated, uint64(cfg.TotalKeys))
+	assert.Equal(t, summary.Accepted, summary.Saved, "keys in flight are flushed")
+	assert.Len(t, repo.saved, int(summary.Saved))
+	assert.Equal(t, models.RunStatusStopped, runs.runs[summary.RunID].Status)
+}
+
+func TestGenerateKeysDrainsInFlightKeysOnInterrupt(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 1 << 30
+	cfg.BatchSize = 1 << 20
+	repo := &testRepository{}
+	runs := newTestRunRepository()
+	service := NewKeyService(repo, runs, &cfg, nil, slowEncryptor{delay: time.Millisecond}, log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	summary, err := service.GenerateKeys(ctx, GenerateOptions{})
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Positive(t, summary.Accepted)
+	assert.Equal(t, summary.Accepted, summary.Saved, "accepted keys are saved before returning")
+	assert.Equal(t, summary.Saved, summary.Drained, "the only batch is flushed during the drain")
+	assert.Len(t, repo.saved, int(summary.Saved))
+	assert.Equal(t, models.RunStatusCanceled, runs.runs[summary.RunID].Status)
+	assert.Equal(t, summary.Saved, runs.runs[summary.RunID].Saved)
+}
+
+func TestGenerateKeysAbortSkipsDrain(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 1 << 30
+	cfg.BatchSize = 1 << 20
+	repo := &testRepository{}
+	service := NewKeyService(repo, newTestRunRepository(), &cfg, nil, slowEncryptor{delay: 20 * time.Millisecond}, log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	abort := make(chan struct{})
+	time.AfterFunc(50*time.Millisecond, func() {
+		cancel()
+		close(abort)
+	})
+	summary, err := service.GenerateKeys(ctx, GenerateOptions{Abort: abort})
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Positive(t, summary.Accepted)
+	assert.Zero(t, summary.Saved)
+	assert.Empty(t, repo.saved)
+}
+
+func TestGenerateKeysSkipsDuplicateFingerprints(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 6
+	cfg.BatchSize = 4
+	var seen atomic.Int64
+	repo := &testRepository{duplicate: func(*models.KeyInfo) bool { return seen.Add(1)%2 == 0 }}
+	runs := newTestRunRepository()
+	service := NewKeyService(repo, runs, &cfg, nil, testEncryptor{}, log)
+
+	summary, err := service.GenerateKeys(context.Background(), GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(6), summary.Accepted)
+	assert.Equal(t, uint64(3), summary.Inserted)
+	assert.Equal(t, uint64(3), summary.Skipped)
+	assert.Equal(t, uint64(3), summary.Saved)
+	assert.Equal(t, uint64(3), runs.runs[summary.RunID].Saved)
+	assert.Equal(t, models.RunStatusCompleted, runs.runs[summary.RunID].Status)
+}
+
+func TestGenerateKeysKeepsOnlyTopKeys(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 40
+	cfg.BatchSize = 3
+	cfg.KeepTop = 2
+	cfg.MinScore = 1 << 30 // keep_top replaces the thresholds
+	cfg.MaxLettersCount = 0
+	repo := &testRepository{top: []models.KeyInfo{
+		{Fingerprint: "stored-best", Score: 1 << 20},
+		{Fingerprint: "stored-worst", Score: -1 << 20},
+	}}
+	service := NewKeyService(repo, newTestRunRepository(), &cfg, nil, testEncryptor{}, log)
+
+	summary, err := service.GenerateKeys(context.Background(), GenerateOptions{})
+	require.NoError(t, err)
+	require.Positive(t, summary.Saved)
+	assert.Len(t, repo.saved, int(summary.Saved))
+	assert.Contains(t, repo.deleted, "stored-worst")
+	assert.NotContains(t, repo.deleted, "stored-best")
+	assert.GreaterOrEqual(t, summary.Evicted, uint64(len(repo.deleted)))
+	// The table keeps stored-best and exactly one generated key.
+	assert.Equal(t, int(summary.Saved)-1, len(repo.deleted)-1)
+}
+
+func TestGenerateKeysKeepsTopKeysOfTheScoringWindow(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 40
+	cfg.BatchSize = 3
+	cfg.KeepTop = 2
+	cfg.MinScore = 1 << 30
+	cfg.MaxLettersCount = 0
+	scoring := config.DefaultScoringConfig()
+	scoring.Window = config.ScoringWindowShort
+	repo := &testRepository{top: []models.KeyInfo{
+		{Fingerprint: "short-best", Score: 1 << 20, ScoreWindow: config.ScoringWindowShort},
+		{Fingerprint: "short-worst", Score: -1 << 20, ScoreWindow: config.ScoringWindowShort},
+		{Fingerprint: "long-worst", Score: -1 << 20, ScoreWindow: config.ScoringWindowLong},
+		{Fingerprint: "legacy-worst", Score: -1 << 20},
+	}}
+	service := NewKeyService(repo, newTestRunRepository(), &cfg, &scoring, testEncryptor{}, log)
+
+	_, err = service.GenerateKeys(context.Background(), GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, config.ScoringWindowShort, repo.topFilter.ScoreWindow)
+	assert.Contains(t, repo.deleted, "short-worst")
+	assert.NotContains(t, repo.deleted, "short-best")
+	assert.NotContains(t, repo.deleted, "long-worst", "keys of another window are not ranked")
+	assert.NotContains(t, repo.deleted, "legacy-worst", "keys without a window count as long")
+}
+
+func TestTopKeeperRanksByScoreThenUniqueLetters(t *testing.T) {
+	keeper := newTopKeeper(2, []models.KeyInfo{
+		{Fingerprint: "a", Score: 10, UniqueLettersCount: 5},
+		{Fingerprint: "b", Score: 20, UniqueLettersCount: 5},
+	})
+	assert.False(t, keeper.admits(9))
+	assert.True(t, keeper.admits(10))
+
+	admitted, evicted := keeper.offer("c", 10, 6)
+	assert.False(t, admitted, "a tie on score loses on more unique letters")
+	assert.Empty(t, evicted)
+
+	admitted, evicted = keeper.offer("d", 10, 4)
+	assert.True(t, admitted)
+	assert.Equal(t, "a", evicted)
+
+	admitted, _ = keeper.offer("d", 30, 1)
+	assert.False(t, admitted, "a retained fingerprint is not offered twice")
+
+	admitted, evicted = keeper.offer("e", 30, 8)
+	assert.True(t, admitted)
+	assert.Equal(t, "d", evicted)
+	assert.True(t, keeper.admits(20))
+	assert.False(t, keeper.admits(19))
+	assert.Equal(t, uint64(2), keeper.evicted.Load())
+}
+
+func TestGenerateKeysHonorsMaxRate(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 11
+	service := NewKeyService(&testRepository{}, newTestRunRepository(), &cfg, nil, testEncryptor{}, log)
+
+	startedAt := time.Now()
+	summary, err := service.GenerateKeys(context.Background(), GenerateOptions{MaxRate: 100})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(11), summary.Generated)
+	assert.GreaterOrEqual(t, time.Since(startedAt), 100*time.Millisecond)
+
+	_, err = service.GenerateKeys(context.Background(), GenerateOptions{MaxRate: -1})
+	assert.Error(t, err)
+}
+
+func TestGenerateKeysUsesConfiguredScoringStrategy(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	scoring := config.DefaultScoringConfig()
+	scoring.Strategy = "unknown"
+	service := NewKeyService(&testRepository{}, newTestRunRepository(), &cfg, &scoring, testEncryptor{}, log)
+
+	_, err = service.GenerateKeys(context.Background(), GenerateOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown scoring strategy")
+}
+
+func TestRescoreKeysAppliesConfiguredWeights(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	scoring := config.DefaultScoringConfig()
+	scoring.RepeatWeight = 2
+	repo := &testRepository{saved: []*models.KeyInfo{{Fingerprint: "0123456789abcdef0123456789ab0000000a1b2c"}}}
+	service := NewKeyService(repo, newTestRunRepository(), &cfg, &scoring, testEncryptor{}, log)
+
+	updated, err := service.RescoreKeys(repository.KeyFilter{}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), updated)
+
+	classic, err := domain.CalculateScores("89ab0000000a1b2c")
+	require.NoError(t, err)
+	assert.Equal(t, 2*classic.RepeatLetterScore, repo.saved[0].RepeatLetterScore)
+	assert.Equal(t, domain.ClassicStrategy, repo.saved[0].ScoreStrategy)
+	assert.Equal(t, config.ScoringWindowLong, repo.saved[0].ScoreWindow)
+	scorer, err := domain.NewScorer(scoring)
+	require.NoError(t, err)
+	rarity := domain.NewRarityEstimator(scorer, scoring).Rarity(16, repo.saved[0].Score)
+	assert.Positive(t, rarity)
+	assert.Equal(t, rarity, repo.saved[0].Rarity)
+}
+
+func TestScoringWindowSelectsScoredDigits(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 3
+	scoring := config.DefaultScoringConfig()
+	scoring.Window = config.ScoringWindowFull
+	repo := &testRepository{}
+	service := NewKeyService(repo, newTestRunRepository(), &cfg, &scoring, testEncryptor{}, log)
+
+	_, err = service.GenerateKeys(context.Background(), GenerateOptions{})
+	require.NoError(t, err)
+	require.Len(t, repo.saved, 3)
+	for _, key := range repo.saved {
+		want, err := domain.CalculateScores(key.Fingerprint)
+		require.NoError(t, err)
+		assert.Equal(t, want.UniqueLettersCount, key.UniqueLettersCount)
+		assert.Equal(t, want.Total(), key.Score)
+		assert.Equal(t, config.ScoringWindowFull, key.ScoreWindow)
+		assert.Equal(t, domain.GetLastSixteen(key.Fingerprint), key.FingerprintSuffix, "lookups still use the long key ID")
+	}
+
+	// Rescoring with the short window rewrites the scores and the window.
+	scoring.Window = "-8:8"
+	_, err = service.RescoreKeys(repository.KeyFilter{}, 10)
+	require.NoError(t, err)
+	for _, key := range repo.saved {
+		want, err := domain.CalculateScores(key.Fingerprint[32:])
+		require.NoError(t, err)
+		assert.Equal(t, want.Total(), key.Score)
+		assert.Equal(t, config.ScoringWindowShort, key.ScoreWindow)
+	}
+}
+
+func TestGenerateKeysAlwaysAcceptsPatternHits(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 3
+	cfg.MinScore = 1_000_000
+	cfg.MaxLettersCount = 0
+	cfg.Patterns = []string{"re:^[0-9a-f]{40}$"}
+	repo := &testRepository{}
+	service := NewKeyService(repo, newTestRunRepository(), &cfg, nil, testEncryptor{}, log)
+
+	summary, err := service.GenerateKeys(context.Background(), GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), summary.Saved)
+	for _, key := range repo.saved {
+		assert.Equal(t, cfg.Patterns[0], key.MatchedPattern)
+	}
+
+	cfg.Patterns = []string{"re:^$"}
+	repo.saved = nil
+	summary, err = service.GenerateKeys(context.Background(), GenerateOptions{})
+	require.NoError(t, err)
+	assert.Zero(t, summary.Saved)
+	assert.Empty(t, repo.saved)
+}
+
+func TestGenerateKeysAppliesAcceptExpression(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 3
+	cfg.Patterns = []string{"re:^[0-9a-f]{40}$"}
+	cfg.Accept = "!pattern && score > 1000000"
+	repo := &testRepository{}
+	service := NewKeyService(repo, newTestRunRepository(), &cfg, nil, testEncryptor{}, log)
+
+	summary, err := service.GenerateKeys(context.Background(), GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), summary.Saved, "pattern hits are accepted whatever the expression says")
+
+	cfg.Patterns = []string{"re:^$"}
+	cfg.MinScore = -1 << 30
+	summary, err = service.GenerateKeys(context.Background(), GenerateOptions{})
+	require.NoError(t, err)
+	assert.Zero(t, summary.Saved, "the expression replaces the thresholds")
+
+	cfg.Accept = "!pattern && unique >= 1 && repeat_run >= 1"
+	summary, err = service.GenerateKeys(context.Background(), GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), summary.Saved)
+
+	cfg.Accept = "score >>= 1"
+	_, err = service.GenerateKeys(context.Background(), GenerateOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "accept expression")
+}
+
+func TestGenerateKeysRejectsInvalidPattern(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.Patterns = []string{"...XYZ"}
+	service := NewKeyService(&testRepository{}, newTestRunRepository(), &cfg, nil, testEncryptor{}, log)
+
+	_, err = service.GenerateKeys(context.Background(), GenerateOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "patterns")
+}
+
 func validKeyGenerationConfig() config.KeyGenerationConfig {
 	return config.KeyGenerationConfig{
 		NumGeneratorWorkers: 1,
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"github.com/iyuangang/gpgenie/internal/metrics"
+)
+
+// batchInsertBuckets are the upper bounds, in seconds, of the batch insert
+// latency histogram.
+var batchInsertBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// registerPipelineMetrics exposes the live counters of a pipeline on registry
+// and returns the histogram that records batch insert latency. A nil registry
+// disables metrics.
+func registerPipelineMetrics(registry *metrics.Registry, counters *pipelineCounters) *metrics.Histogram {
+	if registry == nil {
+		return nil
+	}
+	registry.GaugeFunc("gpgenie_generate_run_id", "ID of the generation run being executed.",
+		func() float64 { return float64(counters.base.RunID) })
+	registry.GaugeFunc("gpgenie_generate_target_keys", "Number of candidates the run generates in total.",
+		func() float64 { return float64(counters.base.TargetKeys) })
+	registry.CounterFunc("gpgenie_generate_generated_total", "Candidates generated and scored by the run.",
+		func() float64 { return float64(counters.base.Generated + counters.generated.Load()) })
+	registry.CounterFunc("gpgenie_generate_accepted_total", "Candidates accepted by the run.",
+		func() float64 { return float64(counters.base.Accepted + counters.accepted.Load()) })
+	registry.CounterFunc("gpgenie_generate_saved_total", "Keys saved to the database by the run.",
+		func() float64 { return float64(counters.base.Saved + counters.saved.Load()) })
+
+	entities := metrics.Label{Name: "queue", Value: "entities"}
+	keys := metrics.Label{Name: "queue", Value: "keys"}
+	registry.GaugeFunc("gpgenie_generate_queue_items", "Items buffered between pipeline stages.",
+		func() float64 { n, _ := counters.queueLen(); return float64(n) }, entities)
+	registry.GaugeFunc("gpgenie_generate_queue_items", "Items buffered between pipeline stages.",
+		func() float64 { _, n := counters.queueLen(); return float64(n) }, keys)
+	registry.GaugeFunc("gpgenie_generate_queue_capacity", "Capacity of the buffers between pipeline stages.",
+		func() float64 { return float64(counters.entityCap) }, entities)
+	registry.GaugeFunc("gpgenie_generate_queue_capacity", "Capacity of the buffers between pipeline stages.",
+		func() float64 { return float64(counters.keyCap) }, keys)
+
+	return registry.Histogram("gpgenie_generate_batch_insert_seconds", "Latency of database batch inserts.",
+		batchInsertBuckets)
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultProgressInterval = 5 * time.Second
+
+// Progress is a snapshot of a running GenerateKeys call. Counters are
+// cumulative for the run, including work done before a resume; rates cover
+// only the current invocation.
+type Progress struct {
+	RunID      uint
+	TargetKeys int
+	Generated  uint64
+	Accepted   uint64
+	Saved      uint64
+	// GenerateRate, AcceptRate, and SaveRate are per-second rates of the
+	// generator, scorer, and persistence stages.
+	GenerateRate float64
+	AcceptRate   float64
+	SaveRate     float64
+	// EntityQueue and KeyQueue are the buffered items waiting for the scorer
+	// workers and for the next database batch.
+	EntityQueue    int
+	EntityCapacity int
+	KeyQueue       int
+	KeyCapacity    int
+	Elapsed        time.Duration
+	// ETA estimates the time until TargetKeys candidates are generated; it is
+	// zero until a rate is known.
+	ETA   time.Duration
+	Final bool
+}
+
+// ProgressFunc receives progress snapshots. Calls are never concurrent.
+type ProgressFunc func(Progress)
+
+// pipelineCounters are the live counters a progress snapshot is built from.
+type pipelineCounters struct {
+	startedAt time.Time
+	base      Progress
+	generated atomic.Uint64
+	accepted  atomic.Uint64
+	saved     atomic.Uint64
+	queueLen  func() (entities, keys int)
+	entityCap int
+	keyCap    int
+}
+
+func (c *pipelineCounters) snapshot(final bool) Progress {
+	elapsed := time.Since(c.startedAt)
+	generated, accepted, saved := c.generated.Load(), c.accepted.Load(), c.saved.Load()
+	progress := c.base
+	progress.Generated += generated
+	progress.Accepted += accepted
+	progress.Saved += saved
+	progress.EntityCapacity, progress.KeyCapacity = c.entityCap, c.keyCap
+	if c.queueLen != nil {
+		progress.EntityQueue, progress.KeyQueue = c.queueLen()
+	}
+	progress.Elapsed = elapsed
+	progress.Final = final
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		progress.GenerateRate = float64(generated) / seconds
+		progress.AcceptRate = float64(accepted) / seconds
+		progress.SaveRate = float64(saved) / seconds
+	}
+	if remaining := int64(progress.TargetKeys) - int64(progress.Generated); remaining > 0 && progress.GenerateRate > 0 {
+		progress.ETA = time.Duration(float64(remaining) / progress.GenerateRate * float64(time.Second))
+	}
+	return progress
+}
+
+// startProgressReporter emits a snapshot every interval until the returned
+// stop function is called. stop waits for an in-flight callback so the final
+// snapshot is never reported concurrently.
+func startProgressReporter(fn ProgressFunc, interval time.Duration, counters *pipelineCounters) (stop func()) {
+	if fn == nil {
+		return func() {}
+	}
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				fn(counters.snapshot(false))
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
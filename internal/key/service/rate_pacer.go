@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// ratePacer spaces out work so that, on average, no more than rate units are
+// issued per second since the first call. A nil pacer never waits.
+type ratePacer struct {
+	rate      float64
+	startedAt time.Time
+	issued    float64
+}
+
+func newRatePacer(rate float64) *ratePacer {
+	if rate <= 0 {
+		return nil
+	}
+	return &ratePacer{rate: rate}
+}
+
+// wait blocks until n more units may be issued and records them. It returns
+// false if ctx ends first.
+func (p *ratePacer) wait(ctx context.Context, n int) bool {
+	if p == nil {
+		return ctx.Err() == nil
+	}
+	if p.startedAt.IsZero() {
+		p.startedAt = time.Now()
+	}
+	due := p.startedAt.Add(time.Duration(p.issued / p.rate * float64(time.Second)))
+	if delay := time.Until(due); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	p.issued += float64(n)
+	return ctx.Err() == nil
+}
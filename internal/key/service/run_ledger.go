@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/iyuangang/gpgenie/internal/config"
+	"github.com/iyuangang/gpgenie/models"
+)
+
+// runSnapshot is the configuration recorded with every run.
+type runSnapshot struct {
+	Profile       string `json:",omitempty"`
+	KeyGeneration config.KeyGenerationConfig
+	Scoring       config.ScoringConfig
+}
+
+// startRun records a new run or reopens an unfinished one. When resuming, the
+// acceptance criteria and scoring come from the run's configuration snapshot
+// so the whole run is scored consistently; worker counts, batch size, and the
+// grind window remain tunable.
+func (s *keyService) startRun(current *runSnapshot, resumeRunID uint) (*models.GenerationRun, error) {
+	cfg := &current.KeyGeneration
+	if resumeRunID == 0 {
+		snapshot, err := json.Marshal(current)
+		if err != nil {
+			return nil, fmt.Errorf("encode run configuration: %w", err)
+		}
+		run := &models.GenerationRun{
+			Status:         models.RunStatusRunning,
+			Profile:        current.Profile,
+			ConfigSnapshot: string(snapshot),
+			TargetKeys:     cfg.TotalKeys,
+			StartedAt:      time.Now().UTC(),
+		}
+		if err := s.runs.CreateRun(run); err != nil {
+			return nil, fmt.Errorf("record generation run: %w", err)
+		}
+		s.logger.Infof("Generation run %d started: target=%d profile=%q.", run.ID, run.TargetKeys, run.Profile)
+		return run, nil
+	}
+
+	run, err := s.runs.GetRun(resumeRunID)
+	if err != nil {
+		return nil, fmt.Errorf("load generation run %d: %w", resumeRunID, err)
+	}
+	if run.Status == models.RunStatusCompleted {
+		return nil, fmt.Errorf("generation run %d is already completed", run.ID)
+	}
+
+	var snapshot runSnapshot
+	if err := json.Unmarshal([]byte(run.ConfigSnapshot), &snapshot); err != nil {
+		return nil, fmt.Errorf("decode configuration of run %d: %w", run.ID, err)
+	}
+	if current.Profile != "" && current.Profile != run.Profile {
+		s.logger.Warnf("Run %d was started with profile %q; its acceptance criteria are kept.", run.ID, run.Profile)
+	}
+	current.Profile = run.Profile
+	restored := snapshot.KeyGeneration
+	restored.NumGeneratorWorkers = cfg.NumGeneratorWorkers
+	restored.NumScorerWorkers = cfg.NumScorerWorkers
+	restored.BatchSize = cfg.BatchSize
+	restored.GrindWindow = cfg.GrindWindow
+	restored.TotalKeys = run.Remaining()
+	if err := restored.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration for run %d: %w", run.ID, err)
+	}
+	current.KeyGeneration = restored
+	if !snapshot.Scoring.IsZero() {
+		current.Scoring = snapshot.Scoring
+	}
+
+	if err := s.runs.ReopenRun(run.ID); err != nil {
+		return nil, fmt.Errorf("reopen generation run %d: %w", run.ID, err)
+	}
+	s.logger.Infof(
+		"Generation run %d resumed: generated=%d remaining=%d.",
+		run.ID, run.Generated, cfg.TotalKeys,
+	)
+	return run, nil
+}
+
+// finishRun stores the final counters and the terminal status for a run.
+func (s *keyService) finishRun(runID uint, summary *GenerateSummary, runErr error) error {
+	if summary != nil {
+		if err := s.runs.UpdateRunProgress(runID, summary.Generated, summary.Accepted, summary.Saved); err != nil {
+			return fmt.Errorf("record run progress: %w", err)
+		}
+	}
+	status := models.RunStatusCompleted
+	switch {
+	case runErr == nil && summary != nil && summary.DeadlineReached:
+		status = models.RunStatusStopped
+	case errors.Is(runErr, context.Canceled), errors.Is(runErr, context.DeadlineExceeded):
+		status = models.RunStatusCanceled
+	case runErr != nil:
+		status = models.RunStatusFailed
+	}
+	if err := s.runs.FinishRun(runID, status, runErr); err != nil {
+		return fmt.Errorf("finish generation run %d: %w", runID, err)
+	}
+	return nil
+}
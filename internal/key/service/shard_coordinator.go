@@ -0,0 +1,601 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/iyuangang/gpgenie/internal/metrics"
+	"github.com/iyuangang/gpgenie/internal/repository"
+	"github.com/iyuangang/gpgenie/models"
+)
+
+const (
+	// shardSlicesPerWorker splits the target into this many slices per
+	// spawned shard, so a lost shard costs a fraction of its share and fast
+	// shards take over the work of slow ones.
+	shardSlicesPerWorker       = 4
+	defaultShardConnectTimeout = time.Minute
+)
+
+// ShardOptions configures GenerateSharded.
+type ShardOptions struct {
+	// Listener accepts worker connections, typically on a Unix socket.
+	Listener net.Listener
+	// Shards is the number of workers started with Spawn. Further workers may
+	// connect to Listener on their own and share the remaining quota.
+	Shards int
+	// Spawn starts worker number shard, which connects to Listener and runs
+	// ShardWorker.Serve. A worker lost during a slice is replaced by calling
+	// Spawn again, at most Shards times per invocation.
+	Spawn func(shard int) error
+	// ConnectTimeout fails the run when quota remains and no worker has been
+	// connected for this long. Zero means one minute.
+	ConnectTimeout time.Duration
+}
+
+// GenerateSharded runs a generation run across worker processes. The
+// coordinator records the run, hands out slices of its target, aggregates
+// the workers' progress, and stores every batch they send through one
+// persister. A worker that disconnects during a slice has the rest of its
+// slice reassigned. Interrupts, deadlines, and Abort behave as in
+// GenerateKeys; MaxRate is divided among the spawned shards. keep_top is not
+// supported because the ranking cannot be shared between processes.
+func (s *keyService) GenerateSharded(parent context.Context, opts GenerateOptions, shards ShardOptions) (*GenerateSummary, error) {
+	if parent == nil {
+		parent = context.Background()
+	}
+	switch {
+	case shards.Listener == nil:
+		return nil, fmt.Errorf("sharded generation requires a listener")
+	case shards.Shards <= 0:
+		return nil, fmt.Errorf("shards must be greater than zero")
+	case opts.MaxRate < 0:
+		return nil, fmt.Errorf("max rate must not be negative")
+	}
+
+	snapshot := runSnapshot{Profile: opts.Profile, KeyGeneration: *s.config, Scoring: s.scoringConfig()}
+	if err := snapshot.KeyGeneration.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid key generation configuration: %w", err)
+	}
+	run, err := s.startRun(&snapshot, opts.ResumeRunID)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.KeyGeneration.KeepTop > 0 {
+		err = fmt.Errorf("keep_top cannot be combined with shards")
+	} else {
+		// Workers compile the same configuration; fail here instead of in
+		// every shard.
+		_, err = newCandidateEvaluator(snapshot.KeyGeneration, snapshot.Scoring, run.ID)
+	}
+	if err != nil {
+		_ = s.finishRun(run.ID, nil, err)
+		return nil, err
+	}
+	summary, err := s.coordinateShards(parent, snapshot, run, opts, shards)
+	if finishErr := s.finishRun(run.ID, summary, err); finishErr != nil && err == nil {
+		err = finishErr
+	}
+	return summary, err
+}
+
+// shardCoordinator is the state of one GenerateSharded invocation. Session
+// goroutines report to it; mu guards everything below it.
+type shardCoordinator struct {
+	s         *keyService
+	run       *models.GenerationRun
+	opts      GenerateOptions
+	shards    ShardOptions
+	welcome   shardMessage
+	sliceSize int
+	maxRate   float64
+	counters  *pipelineCounters
+	batches   chan shardBatchRequest
+	changed   chan struct{}
+
+	mu          sync.Mutex
+	conns       map[net.Conn]struct{}
+	sessions    map[*shardSession]struct{}
+	nextSession int
+	pending     int
+	generated   uint64
+	accepted    uint64
+	respawns    int
+	draining    bool
+	closing     bool
+	lonelySince time.Time
+	err         error
+}
+
+// shardSession is one connected worker. slice is nil while it is idle.
+type shardSession struct {
+	id    int
+	pid   int
+	conn  *shardConn
+	slice *shardSlice
+}
+
+type shardSlice struct {
+	quota     int
+	generated uint64
+	accepted  uint64
+	// batched counts the keys received from the slice. Progress reports lag
+	// behind batches, so it bounds the counters of a lost slice from below.
+	batched uint64
+}
+
+// counts returns the candidates generated and accepted by the slice so far.
+func (s *shardSlice) counts() (generated, accepted uint64) {
+	accepted = max(s.accepted, s.batched)
+	generated = min(max(s.generated, accepted), uint64(s.quota))
+	return generated, accepted
+}
+
+type shardBatchRequest struct {
+	keys  []*models.KeyInfo
+	reply chan shardMessage
+}
+
+func (s *keyService) coordinateShards(
+	parent context.Context,
+	snapshot runSnapshot,
+	run *models.GenerationRun,
+	opts GenerateOptions,
+	shards ShardOptions,
+) (*GenerateSummary, error) {
+	cfg := snapshot.KeyGeneration
+	c := &shardCoordinator{
+		s:      s,
+		run:    run,
+		opts:   opts,
+		shards: shards,
+		welcome: shardMessage{
+			Type:          shardWelcome,
+			RunID:         run.ID,
+			KeyGeneration: &snapshot.KeyGeneration,
+			Scoring:       &snapshot.Scoring,
+		},
+		sliceSize:   max(1, (cfg.TotalKeys+shards.Shards*shardSlicesPerWorker-1)/(shards.Shards*shardSlicesPerWorker)),
+		maxRate:     opts.MaxRate / float64(shards.Shards),
+		batches:     make(chan shardBatchRequest, shards.Shards),
+		changed:     make(chan struct{}, 1),
+		conns:       make(map[net.Conn]struct{}),
+		sessions:    make(map[*shardSession]struct{}),
+		pending:     cfg.TotalKeys,
+		lonelySince: time.Now(),
+	}
+	if encryptor, ok := s.encryptor.(*PGPEncryptor); ok {
+		c.welcome.PublicKey = string(encryptor.publicKeyData)
+	}
+	c.counters = &pipelineCounters{
+		startedAt: time.Now(),
+		base: Progress{
+			RunID:      run.ID,
+			TargetKeys: run.TargetKeys,
+			Generated:  run.Generated,
+			Accepted:   run.Accepted,
+			Saved:      run.Saved,
+		},
+		queueLen: func() (int, int) { return 0, len(c.batches) },
+		keyCap:   cap(c.batches),
+	}
+	stopProgress := startProgressReporter(opts.Progress, opts.ProgressInterval, c.counters)
+	latency := registerPipelineMetrics(opts.Metrics, c.counters)
+	s.logger.Infof("Generation run %d is coordinating %d shards: remaining=%d slice=%d.", run.ID, shards.Shards, cfg.TotalKeys, c.sliceSize)
+
+	var persisted repository.BatchResult
+	var drained uint64
+	var persisterWG sync.WaitGroup
+	persisterWG.Add(1)
+	go func() {
+		defer persisterWG.Done()
+		persisted, drained = c.persist(repository.ConflictPolicy(cfg.OnConflict), latency)
+	}()
+
+	var acceptWG, sessionWG sync.WaitGroup
+	acceptWG.Add(1)
+	go func() {
+		defer acceptWG.Done()
+		for {
+			conn, err := shards.Listener.Accept()
+			if err != nil {
+				return
+			}
+			c.mu.Lock()
+			c.conns[conn] = struct{}{}
+			c.mu.Unlock()
+			sessionWG.Add(1)
+			go func() {
+				defer sessionWG.Done()
+				c.serve(conn)
+			}()
+		}
+	}()
+
+	stopInterrupt := context.AfterFunc(parent, c.drain)
+	defer stopInterrupt()
+	finished := make(chan struct{})
+	if opts.Abort != nil {
+		go func() {
+			select {
+			case <-opts.Abort:
+				s.logger.Warnf("Aborting key generation run %d; keys in flight are discarded.", run.ID)
+				c.fail(context.Canceled)
+			case <-finished:
+			}
+		}()
+	}
+	for i := 0; i < shards.Shards && shards.Spawn != nil; i++ {
+		if err := shards.Spawn(i); err != nil {
+			c.fail(fmt.Errorf("start shard %d: %w", i, err))
+			break
+		}
+	}
+
+	c.wait()
+	close(finished)
+	c.mu.Lock()
+	c.closing = true
+	failed := c.err != nil
+	sessions := make([]*shardSession, 0, len(c.sessions))
+	for session := range c.sessions {
+		sessions = append(sessions, session)
+	}
+	c.mu.Unlock()
+	for _, session := range sessions {
+		if !failed {
+			_ = session.conn.send(shardMessage{Type: shardStop})
+		}
+	}
+	_ = shards.Listener.Close()
+	acceptWG.Wait()
+	// Closing every connection also releases workers that never said hello.
+	c.mu.Lock()
+	for conn := range c.conns {
+		_ = conn.Close()
+	}
+	c.mu.Unlock()
+	sessionWG.Wait()
+	close(c.batches)
+	persisterWG.Wait()
+
+	stopProgress()
+	final := c.counters.snapshot(true)
+	if opts.Progress != nil {
+		opts.Progress(final)
+	}
+	summary := &GenerateSummary{
+		RunID:     run.ID,
+		Generated: final.Generated,
+		Accepted:  final.Accepted,
+		Saved:     final.Saved,
+		Elapsed:   final.Elapsed,
+		Drained:   drained,
+		Inserted:  uint64(persisted.Inserted),
+		Updated:   uint64(persisted.Updated),
+		Skipped:   uint64(persisted.Skipped),
+	}
+	if c.err != nil {
+		return summary, c.err
+	}
+	if err := parent.Err(); err != nil {
+		s.logger.Infof(
+			"Key generation interrupted: run=%d generated=%d accepted=%d saved=%d drained=%d elapsed=%s.",
+			run.ID, summary.Generated, summary.Accepted, summary.Saved, drained, final.Elapsed.Round(time.Millisecond),
+		)
+		return summary, err
+	}
+	if final.Generated < uint64(run.TargetKeys) && c.deadlinePassed() {
+		summary.DeadlineReached = true
+		s.logger.Infof(
+			"Key generation stopped at its deadline: run=%d generated=%d/%d accepted=%d saved=%d drained=%d elapsed=%s.",
+			run.ID, summary.Generated, run.TargetKeys, summary.Accepted, summary.Saved, drained, final.Elapsed.Round(time.Millisecond),
+		)
+		return summary, nil
+	}
+	s.logger.Infof(
+		"Key generation completed: run=%d shards=%d generated=%d accepted=%d saved=%d skipped=%d elapsed=%s rate=%.2f candidates/s.",
+		run.ID, shards.Shards, summary.Generated, summary.Accepted, summary.Saved, summary.Skipped, final.Elapsed.Round(time.Millisecond), final.GenerateRate,
+	)
+	return summary, nil
+}
+
+// wait blocks until every slice has ended and no more will be assigned, the
+// run has failed, or no worker has been connected for ConnectTimeout.
+func (c *shardCoordinator) wait() {
+	timeout := c.shards.ConnectTimeout
+	if timeout <= 0 {
+		timeout = defaultShardConnectTimeout
+	}
+	ticker := time.NewTicker(min(time.Second, timeout/4))
+	defer ticker.Stop()
+	for {
+		c.mu.Lock()
+		active := 0
+		for session := range c.sessions {
+			if session.slice != nil {
+				active++
+			}
+		}
+		if len(c.sessions) == 0 && c.pending > 0 && c.err == nil && time.Since(c.lonelySince) >= timeout {
+			c.err = fmt.Errorf("no shard worker connected for %s", timeout)
+		}
+		done := c.err != nil || (active == 0 && (c.pending == 0 || c.draining || c.deadlinePassed()))
+		c.mu.Unlock()
+		if done {
+			return
+		}
+		select {
+		case <-c.changed:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *shardCoordinator) notify() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (c *shardCoordinator) fail(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+	c.notify()
+}
+
+func (c *shardCoordinator) deadlinePassed() bool {
+	return !c.opts.Deadline.IsZero() && !time.Now().Before(c.opts.Deadline)
+}
+
+// drain stops handing out slices and asks busy workers to save the keys they
+// have in flight.
+func (c *shardCoordinator) drain() {
+	c.s.logger.Infof("Key generation run %d interrupted; shards are saving keys in flight.", c.run.ID)
+	c.mu.Lock()
+	c.draining = true
+	var busy []*shardSession
+	for session := range c.sessions {
+		if session.slice != nil {
+			busy = append(busy, session)
+		}
+	}
+	c.mu.Unlock()
+	for _, session := range busy {
+		_ = session.conn.send(shardMessage{Type: shardDrain})
+	}
+	c.notify()
+}
+
+// serve handles one worker connection.
+func (c *shardCoordinator) serve(conn net.Conn) {
+	sc := newShardConn(conn)
+	defer func() {
+		_ = sc.Close()
+		c.mu.Lock()
+		delete(c.conns, conn)
+		c.mu.Unlock()
+	}()
+	hello, err := sc.expect(shardHello)
+	if err != nil {
+		c.s.logger.Warnf("Rejected shard connection: %v.", err)
+		return
+	}
+	if hello.Version != shardProtocolVersion {
+		_ = sc.send(shardMessage{Type: shardWelcome, Error: fmt.Sprintf("protocol version %d, coordinator speaks %d", hello.Version, shardProtocolVersion)})
+		return
+	}
+	session := c.join(sc, hello.PID)
+	if session == nil {
+		_ = sc.send(shardMessage{Type: shardWelcome, Error: fmt.Sprintf("run %d is finishing", c.run.ID)})
+		return
+	}
+	if err := sc.send(c.welcome); err != nil {
+		c.leave(session, err)
+		return
+	}
+	c.dispatch()
+	for {
+		message, err := sc.receive()
+		if err != nil {
+			c.leave(session, err)
+			return
+		}
+		switch message.Type {
+		case shardProgress:
+			c.mu.Lock()
+			if session.slice != nil {
+				session.slice.generated, session.slice.accepted = message.Generated, message.Accepted
+				c.updateCountersLocked()
+			}
+			c.mu.Unlock()
+		case shardBatch:
+			c.mu.Lock()
+			if session.slice != nil {
+				session.slice.batched += uint64(len(message.Keys))
+			}
+			c.mu.Unlock()
+			reply := make(chan shardMessage, 1)
+			c.batches <- shardBatchRequest{keys: message.Keys, reply: reply}
+			if err := sc.send(<-reply); err != nil {
+				c.leave(session, err)
+				return
+			}
+		case shardDone:
+			c.complete(session, message)
+		}
+	}
+}
+
+func (c *shardCoordinator) join(conn *shardConn, pid int) *shardSession {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closing {
+		return nil
+	}
+	c.nextSession++
+	session := &shardSession{id: c.nextSession, pid: pid, conn: conn}
+	c.sessions[session] = struct{}{}
+	c.s.logger.Infof("Shard %d (pid %d) joined run %d.", session.id, pid, c.run.ID)
+	return session
+}
+
+// complete ends a slice with the counters its worker reported and returns
+// the unfinished part of the slice to the pool.
+func (c *shardCoordinator) complete(session *shardSession, done shardMessage) {
+	c.mu.Lock()
+	slice := session.slice
+	session.slice = nil
+	if slice != nil {
+		slice.generated, slice.accepted = done.Generated, done.Accepted
+		c.releaseLocked(slice)
+		if done.Error != "" && c.err == nil {
+			c.err = fmt.Errorf("shard %d: %s", session.id, done.Error)
+		}
+	}
+	c.mu.Unlock()
+	c.dispatch()
+}
+
+// leave removes a disconnected worker. A slice it was running is reassigned,
+// and a replacement is spawned while the restart budget lasts.
+func (c *shardCoordinator) leave(session *shardSession, err error) {
+	c.mu.Lock()
+	if _, ok := c.sessions[session]; !ok {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.sessions, session)
+	if len(c.sessions) == 0 {
+		c.lonelySince = time.Now()
+	}
+	slice := session.slice
+	session.slice = nil
+	respawn := -1
+	if slice != nil && !c.closing {
+		lost := c.releaseLocked(slice)
+		c.s.logger.Warnf("Shard %d (pid %d) was lost during a slice: %v; reassigning %d candidates.", session.id, session.pid, err, lost)
+		if c.shards.Spawn != nil && c.respawns < c.shards.Shards && c.err == nil && !c.draining {
+			respawn = c.shards.Shards + c.respawns
+			c.respawns++
+		}
+	}
+	c.mu.Unlock()
+	if respawn >= 0 {
+		if err := c.shards.Spawn(respawn); err != nil {
+			c.fail(fmt.Errorf("restart shard: %w", err))
+		}
+	}
+	c.dispatch()
+}
+
+// releaseLocked folds an ended slice into the totals and returns the number
+// of its candidates that were not generated to the pool.
+func (c *shardCoordinator) releaseLocked(slice *shardSlice) int {
+	generated, accepted := slice.counts()
+	c.generated += generated
+	c.accepted += accepted
+	unfinished := slice.quota - int(generated)
+	c.pending += unfinished
+	c.updateCountersLocked()
+	return unfinished
+}
+
+func (c *shardCoordinator) updateCountersLocked() {
+	generated, accepted := c.generated, c.accepted
+	for session := range c.sessions {
+		if session.slice != nil {
+			sliceGenerated, sliceAccepted := session.slice.counts()
+			generated += sliceGenerated
+			accepted += sliceAccepted
+		}
+	}
+	c.counters.generated.Store(generated)
+	c.counters.accepted.Store(accepted)
+}
+
+// dispatch assigns slices to idle workers while quota remains.
+func (c *shardCoordinator) dispatch() {
+	type assignment struct {
+		session *shardSession
+		quota   int
+	}
+	var assignments []assignment
+	c.mu.Lock()
+	if c.err == nil && !c.draining && !c.closing && !c.deadlinePassed() {
+		for session := range c.sessions {
+			if c.pending == 0 {
+				break
+			}
+			if session.slice != nil {
+				continue
+			}
+			quota := min(c.sliceSize, c.pending)
+			c.pending -= quota
+			session.slice = &shardSlice{quota: quota}
+			assignments = append(assignments, assignment{session: session, quota: quota})
+		}
+	}
+	c.mu.Unlock()
+	for _, a := range assignments {
+		// A failed send surfaces as a receive error, which reassigns the slice.
+		_ = a.session.conn.send(shardMessage{
+			Type:     shardAssign,
+			Quota:    a.quota,
+			Deadline: c.opts.Deadline,
+			MaxRate:  c.maxRate,
+		})
+	}
+	c.notify()
+}
+
+// persist stores the batches of every worker until c.batches is closed and
+// records run progress after each one. After a failure the remaining
+// batches are refused.
+func (c *shardCoordinator) persist(onConflict repository.ConflictPolicy, latency *metrics.Histogram) (total repository.BatchResult, drained uint64) {
+	var failed error
+	for request := range c.batches {
+		if failed != nil {
+			request.reply <- shardMessage{Type: shardSaved, Error: failed.Error()}
+			continue
+		}
+		insertStartedAt := time.Now()
+		result, err := c.s.repo.BatchCreate(request.keys, onConflict)
+		if err == nil {
+			latency.Observe(time.Since(insertStartedAt).Seconds())
+			total.Add(result)
+			c.counters.saved.Store(uint64(total.Written()))
+			c.mu.Lock()
+			if c.draining {
+				drained += uint64(result.Written())
+			}
+			c.mu.Unlock()
+			err = c.s.runs.UpdateRunProgress(
+				c.run.ID,
+				c.run.Generated+c.counters.generated.Load(),
+				c.run.Accepted+c.counters.accepted.Load(),
+				c.run.Saved+uint64(total.Written()),
+			)
+			if err != nil {
+				err = fmt.Errorf("record run progress: %w", err)
+			}
+		} else {
+			err = fmt.Errorf("save key batch: %w", err)
+		}
+		if err != nil {
+			failed = err
+			c.fail(err)
+			request.reply <- shardMessage{Type: shardSaved, Error: err.Error()}
+			continue
+		}
+		request.reply <- shardMessage{Type: shardSaved, Result: &result}
+	}
+	return total, drained
+}
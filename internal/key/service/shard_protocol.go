@@ -0,0 +1,111 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/iyuangang/gpgenie/internal/config"
+	"github.com/iyuangang/gpgenie/internal/repository"
+	"github.com/iyuangang/gpgenie/models"
+)
+
+// shardProtocolVersion is checked when a worker connects, so a coordinator
+// and a worker from different builds refuse to work together.
+const shardProtocolVersion = 1
+
+// Shard message types. Workers send hello, progress, batch, and done; the
+// coordinator sends welcome, assign, saved, drain, and stop.
+const (
+	shardHello    = "hello"
+	shardWelcome  = "welcome"
+	shardAssign   = "assign"
+	shardProgress = "progress"
+	shardBatch    = "batch"
+	shardSaved    = "saved"
+	shardDone     = "done"
+	shardDrain    = "drain"
+	shardStop     = "stop"
+)
+
+// shardMessage is one line of the coordinator protocol. Each type uses a
+// subset of the fields.
+type shardMessage struct {
+	Type    string `json:"type"`
+	Version int    `json:"version,omitempty"`
+	PID     int    `json:"pid,omitempty"`
+
+	// welcome: the run that keys are tagged with and the configuration every
+	// shard applies, so all shards accept keys by the same rules.
+	RunID         uint                        `json:"run_id,omitempty"`
+	KeyGeneration *config.KeyGenerationConfig `json:"key_generation,omitempty"`
+	Scoring       *config.ScoringConfig       `json:"scoring,omitempty"`
+	PublicKey     string                      `json:"public_key,omitempty"`
+
+	// assign: a slice of the run's target and the limits that apply to it.
+	Quota    int       `json:"quota,omitempty"`
+	Deadline time.Time `json:"deadline,omitzero"`
+	MaxRate  float64   `json:"max_rate,omitempty"`
+
+	// batch and saved.
+	Keys   []*models.KeyInfo       `json:"keys,omitempty"`
+	Result *repository.BatchResult `json:"result,omitempty"`
+
+	// progress and done: counters of the current slice.
+	Generated uint64 `json:"generated,omitempty"`
+	Accepted  uint64 `json:"accepted,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// shardConn exchanges newline-delimited JSON messages. Sends may come from
+// several goroutines; receives must come from one.
+type shardConn struct {
+	closer  io.Closer
+	decoder *json.Decoder
+	mu      sync.Mutex
+	writer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+func newShardConn(conn io.ReadWriteCloser) *shardConn {
+	writer := bufio.NewWriter(conn)
+	return &shardConn{
+		closer:  conn,
+		decoder: json.NewDecoder(bufio.NewReader(conn)),
+		writer:  writer,
+		encoder: json.NewEncoder(writer),
+	}
+}
+
+func (c *shardConn) send(message shardMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.encoder.Encode(message); err != nil {
+		return fmt.Errorf("send %s message: %w", message.Type, err)
+	}
+	return c.writer.Flush()
+}
+
+func (c *shardConn) receive() (shardMessage, error) {
+	var message shardMessage
+	err := c.decoder.Decode(&message)
+	return message, err
+}
+
+// expect receives one message and checks its type.
+func (c *shardConn) expect(messageType string) (shardMessage, error) {
+	message, err := c.receive()
+	if err != nil {
+		return message, fmt.Errorf("receive %s message: %w", messageType, err)
+	}
+	if message.Type != messageType {
+		return message, fmt.Errorf("expected %s message, got %q", messageType, message.Type)
+	}
+	return message, nil
+}
+
+func (c *shardConn) Close() error { return c.closer.Close() }
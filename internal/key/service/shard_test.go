@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iyuangang/gpgenie/internal/config"
+	"github.com/iyuangang/gpgenie/internal/logger"
+	"github.com/iyuangang/gpgenie/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startTestShards returns ShardOptions whose Spawn runs an in-process worker
+// for each shard, or crash for the shard numbers it is given.
+func startTestShards(t *testing.T, log *logger.Logger, shards int, crash map[int]func(net.Conn)) ShardOptions {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "coordinator.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	var workers sync.WaitGroup
+	t.Cleanup(workers.Wait)
+	return ShardOptions{
+		Listener:       listener,
+		Shards:         shards,
+		ConnectTimeout: 5 * time.Second,
+		Spawn: func(shard int) error {
+			conn, err := net.Dial("unix", socket)
+			if err != nil {
+				return err
+			}
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				if fake, ok := crash[shard]; ok {
+					fake(conn)
+					return
+				}
+				_ = ShardWorker{Logger: log, Encryptor: testEncryptor{}}.Serve(context.Background(), conn)
+			}()
+			return nil
+		},
+	}
+}
+
+func TestGenerateShardedFunnelsBatchesToOnePersister(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 20
+	cfg.BatchSize = 3
+	repo := &testRepository{}
+	runs := newTestRunRepository()
+	service := NewKeyService(repo, runs, &cfg, nil, testEncryptor{}, log)
+
+	var snapshots atomic.Int32
+	summary, err := service.GenerateSharded(context.Background(), GenerateOptions{
+		ProgressInterval: 10 * time.Millisecond,
+		Progress:         func(Progress) { snapshots.Add(1) },
+	}, startTestShards(t, log, 3, nil))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(20), summary.Generated)
+	assert.Equal(t, uint64(20), summary.Saved)
+	assert.Positive(t, snapshots.Load())
+	require.Len(t, repo.saved, 20)
+	for _, key := range repo.saved {
+		assert.Equal(t, summary.RunID, key.RunID)
+	}
+
+	run := runs.runs[summary.RunID]
+	assert.Equal(t, models.RunStatusCompleted, run.Status)
+	assert.Equal(t, uint64(20), run.Generated)
+	assert.Equal(t, uint64(20), run.Saved)
+}
+
+func TestGenerateShardedReassignsLostShardQuota(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.TotalKeys = 16
+	repo := &testRepository{}
+	service := NewKeyService(repo, newTestRunRepository(), &cfg, nil, testEncryptor{}, log)
+
+	// Shard 0 takes a slice, reports one candidate, and dies.
+	var assigned atomic.Int32
+	crash := func(conn net.Conn) {
+		c := newShardConn(conn)
+		defer c.Close()
+		if c.send(shardMessage{Type: shardHello, Version: shardProtocolVersion}) != nil {
+			return
+		}
+		if _, err := c.expect(shardWelcome); err != nil {
+			return
+		}
+		assignment, err := c.expect(shardAssign)
+		if err != nil {
+			return
+		}
+		assigned.Store(int32(assignment.Quota))
+		_ = c.send(shardMessage{Type: shardProgress, Generated: 1})
+	}
+	shards := startTestShards(t, log, 2, map[int]func(net.Conn){0: crash})
+	var spawned atomic.Int32
+	spawn := shards.Spawn
+	shards.Spawn = func(shard int) error {
+		spawned.Add(1)
+		return spawn(shard)
+	}
+
+	summary, err := service.GenerateSharded(context.Background(), GenerateOptions{}, shards)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), assigned.Load(), "16 candidates over 2 shards make slices of 2")
+	assert.Equal(t, uint64(16), summary.Generated, "the lost shard's unfinished quota is generated elsewhere")
+	assert.Equal(t, uint64(15), summary.Saved, "the candidate reported by the lost shard was never saved")
+	assert.Len(t, repo.saved, 15)
+	assert.Equal(t, int32(3), spawned.Load(), "the lost shard is replaced")
+}
+
+func TestGenerateShardedRejectsKeepTop(t *testing.T) {
+	log, err := logger.InitLogger(&config.LoggingConfig{LogLevel: "warn"})
+	require.NoError(t, err)
+	t.Cleanup(log.SyncLogger)
+
+	cfg := validKeyGenerationConfig()
+	cfg.KeepTop = 10
+	runs := newTestRunRepository()
+	service := NewKeyService(&testRepository{}, runs, &cfg, nil, testEncryptor{}, log)
+
+	shards := startTestShards(t, log, 1, nil)
+	defer shards.Listener.Close()
+	_, err = service.GenerateSharded(context.Background(), GenerateOptions{}, shards)
+	require.ErrorContains(t, err, "keep_top")
+	assert.Equal(t, models.RunStatusFailed, runs.runs[1].Status)
+}
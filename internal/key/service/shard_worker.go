@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/iyuangang/gpgenie/internal/key/domain"
+	"github.com/iyuangang/gpgenie/internal/logger"
+	"github.com/iyuangang/gpgenie/internal/repository"
+	"github.com/iyuangang/gpgenie/models"
+)
+
+// shardProgressInterval is how often a worker reports the counters of its
+// slice to the coordinator.
+const shardProgressInterval = time.Second
+
+var (
+	errShardQuery          = errors.New("key queries are not available in a shard worker")
+	errShardConnectionLost = errors.New("coordinator connection lost")
+)
+
+// ShardWorker runs quota slices for a GenerateSharded coordinator. Each slice
+// runs the GenerateKeys pipeline with batches sent to the coordinator, which
+// stores them, instead of to a repository.
+type ShardWorker struct {
+	Logger *logger.Logger
+	// Encryptor, when set, replaces the encryptor built from the public key
+	// the coordinator sends.
+	Encryptor domain.Encryptor
+}
+
+// Serve speaks the shard protocol on conn until the coordinator sends stop,
+// which returns nil, or the connection fails, which aborts the current slice.
+// Canceling ctx drains the current slice, reports it, and returns ctx's error.
+func (w ShardWorker) Serve(ctx context.Context, conn io.ReadWriteCloser) error {
+	c := newShardConn(conn)
+	defer c.Close()
+	if err := c.send(shardMessage{Type: shardHello, Version: shardProtocolVersion, PID: os.Getpid()}); err != nil {
+		return err
+	}
+	welcome, err := c.expect(shardWelcome)
+	if err != nil {
+		return err
+	}
+	if welcome.Error != "" {
+		return fmt.Errorf("coordinator refused the worker: %s", welcome.Error)
+	}
+	if welcome.KeyGeneration == nil {
+		return fmt.Errorf("coordinator sent no key generation configuration")
+	}
+	encryptor := w.Encryptor
+	if encryptor == nil {
+		if encryptor, err = newPGPEncryptor([]byte(welcome.PublicKey)); err != nil {
+			return fmt.Errorf("load coordinator public key: %w", err)
+		}
+	}
+
+	// The reader goroutine owns receives. lost is closed when the
+	// coordinator sends stop or the connection fails.
+	var (
+		stopped atomic.Bool
+		readErr error
+	)
+	lost := make(chan struct{})
+	assignments := make(chan shardMessage, 1)
+	drains := make(chan struct{}, 1)
+	repo := &shardRepository{conn: c, results: make(chan shardMessage, 1), lost: lost}
+	go func() {
+		defer close(lost)
+		for {
+			message, err := c.receive()
+			if err != nil {
+				readErr = err
+				return
+			}
+			switch message.Type {
+			case shardAssign:
+				assignments <- message
+			case shardSaved:
+				repo.results <- message
+			case shardDrain:
+				select {
+				case drains <- struct{}{}:
+				default:
+				}
+			case shardStop:
+				stopped.Store(true)
+				return
+			}
+		}
+	}()
+
+	w.Logger.Infof("Shard worker joined run %d.", welcome.RunID)
+	for {
+		var assignment shardMessage
+		select {
+		case assignment = <-assignments:
+		case <-lost:
+			if stopped.Load() {
+				return nil
+			}
+			return fmt.Errorf("%w: %v", errShardConnectionLost, readErr)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		cfg := *welcome.KeyGeneration
+		cfg.TotalKeys = assignment.Quota
+		runner := &keyService{
+			repo:      repo,
+			runs:      repository.NewMemoryRunRepository(welcome.RunID),
+			config:    &cfg,
+			scoring:   welcome.Scoring,
+			encryptor: encryptor,
+			logger:    w.Logger,
+		}
+		if err := w.runSlice(ctx, c, runner, assignment, drains, lost); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// runSlice generates one quota slice and reports it with a done message. A
+// drain message or ctx ends the slice early; its keys in flight are saved.
+func (w ShardWorker) runSlice(
+	ctx context.Context,
+	c *shardConn,
+	runner *keyService,
+	assignment shardMessage,
+	drains <-chan struct{},
+	lost <-chan struct{},
+) error {
+	sliceCtx, stopSlice := context.WithCancel(ctx)
+	defer stopSlice()
+	go func() {
+		select {
+		case <-drains:
+			stopSlice()
+		case <-sliceCtx.Done():
+		}
+	}()
+
+	summary, err := runner.GenerateKeys(sliceCtx, GenerateOptions{
+		Deadline:         assignment.Deadline,
+		MaxRate:          assignment.MaxRate,
+		Abort:            lost,
+		ProgressInterval: shardProgressInterval,
+		Progress: func(progress Progress) {
+			if !progress.Final {
+				_ = c.send(shardMessage{Type: shardProgress, Generated: progress.Generated, Accepted: progress.Accepted})
+			}
+		},
+	})
+	done := shardMessage{Type: shardDone}
+	if summary != nil {
+		done.Generated, done.Accepted = summary.Generated, summary.Accepted
+	}
+	interrupted := errors.Is(err, context.Canceled) && sliceCtx.Err() != nil
+	if err != nil && !interrupted {
+		done.Error = err.Error()
+	}
+	if sendErr := c.send(done); sendErr != nil {
+		return sendErr
+	}
+	if err != nil && !interrupted {
+		return err
+	}
+	return nil
+}
+
+// shardRepository sends a worker's batches to the coordinator and waits for
+// the outcome. The coordinator applies its own on_conflict policy.
+type shardRepository struct {
+	conn    *shardConn
+	results chan shardMessage
+	lost    <-chan struct{}
+}
+
+func (r *shardRepository) BatchCreate(keys []*models.KeyInfo, _ repository.ConflictPolicy) (repository.BatchResult, error) {
+	if err := r.conn.send(shardMessage{Type: shardBatch, Keys: keys}); err != nil {
+		return repository.BatchResult{}, err
+	}
+	select {
+	case reply := <-r.results:
+		if reply.Error != "" {
+			return repository.BatchResult{}, fmt.Errorf("coordinator: %s", reply.Error)
+		}
+		if reply.Result == nil {
+			return repository.BatchResult{}, fmt.Errorf("coordinator sent no batch result")
+		}
+		return *reply.Result, nil
+	case <-r.lost:
+		return repository.BatchResult{}, errShardConnectionLost
+	}
+}
+
+func (r *shardRepository) Upsert(*models.KeyInfo) error { return errShardQuery }
+
+func (r *shardRepository) DeleteByFingerprints([]string) (int64, error) { return 0, errShardQuery }
+
+func (r *shardRepository) GetTopKeys(int, repository.KeyFilter) ([]models.KeyInfo, error) {
+	return nil, errShardQuery
+}
+
+func (r *shardRepository) GetLowLetterCountKeys(int, repository.KeyFilter) ([]models.KeyInfo, error) {
+	return nil, errShardQuery
+}
+
+func (r *shardRepository) GetRarestKeys(int, repository.KeyFilter) ([]models.KeyInfo, error) {
+	return nil, errShardQuery
+}
+
+func (r *shardRepository) GetByFingerprint(string) (*models.KeyInfo, error) {
+	return nil, errShardQuery
+}
+
+func (r *shardRepository) GetAnalysisStats(repository.KeyFilter) (*repository.AnalysisStats, error) {
+	return nil, errShardQuery
+}
+
+func (r *shardRepository) Rescore(repository.KeyFilter, int, func(*models.KeyInfo) error) (int64, error) {
+	return 0, errShardQuery
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"container/heap"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/iyuangang/gpgenie/models"
+)
+
+// rankedKey is a heap entry ranked like GetTopKeys: higher score first, then
+// fewer unique letters.
+type rankedKey struct {
+	fingerprint   string
+	score         int
+	uniqueLetters int
+}
+
+func (k rankedKey) beats(other rankedKey) bool {
+	if k.score != other.score {
+		return k.score > other.score
+	}
+	return k.uniqueLetters < other.uniqueLetters
+}
+
+// rankedHeap keeps the worst retained key at the root.
+type rankedHeap []rankedKey
+
+func (h rankedHeap) Len() int           { return len(h) }
+func (h rankedHeap) Less(i, j int) bool { return h[j].beats(h[i]) }
+func (h rankedHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *rankedHeap) Push(x any)        { *h = append(*h, x.(rankedKey)) }
+func (h *rankedHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// topKeeper tracks the best limit keys of a keep_top run. Scorer workers use
+// admits as a lock-free pre-filter; the persister decides with offer, which
+// reports the key that a new one displaces.
+type topKeeper struct {
+	mu        sync.Mutex
+	limit     int
+	keys      rankedHeap
+	members   map[string]struct{}
+	threshold atomic.Int64 // score of the worst retained key once full
+	evicted   atomic.Uint64
+}
+
+// newTopKeeper seeds the keeper with stored keys, typically from GetTopKeys.
+func newTopKeeper(limit int, seed []models.KeyInfo) *topKeeper {
+	k := &topKeeper{
+		limit:   limit,
+		keys:    make(rankedHeap, 0, limit),
+		members: make(map[string]struct{}, limit),
+	}
+	k.threshold.Store(math.MinInt64)
+	for _, key := range seed {
+		k.offer(key.Fingerprint, key.Score, key.UniqueLettersCount)
+	}
+	return k
+}
+
+// admits reports whether a key with score might enter the top keys. A true
+// result can still be refused by offer.
+func (k *topKeeper) admits(score int) bool {
+	return int64(score) >= k.threshold.Load()
+}
+
+// offer adds the key if it beats the worst retained key or the keeper is not
+// yet full. The displaced key's fingerprint is returned in evicted.
+func (k *topKeeper) offer(fingerprint string, score, uniqueLetters int) (admitted bool, evicted string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.members[fingerprint]; ok {
+		return false, ""
+	}
+	candidate := rankedKey{fingerprint: fingerprint, score: score, uniqueLetters: uniqueLetters}
+	if len(k.keys) >= k.limit {
+		if !candidate.beats(k.keys[0]) {
+			return false, ""
+		}
+		worst := heap.Pop(&k.keys).(rankedKey)
+		delete(k.members, worst.fingerprint)
+		evicted = worst.fingerprint
+		k.evicted.Add(1)
+	}
+	heap.Push(&k.keys, candidate)
+	k.members[fingerprint] = struct{}{}
+	if len(k.keys) >= k.limit {
+		k.threshold.Store(int64(k.keys[0].score))
+	}
+	return true, evicted
+}
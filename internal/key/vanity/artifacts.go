@@ -8,24 +8,58 @@ import (
 	"time"
 
 	"github.com/iyuangang/gpgenie/internal/key/domain"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
 )
 
+// ArtifactMetadata describes a finalized vanity keyring. KeyKind names the
+// key that carries the mined fingerprint; the signing fields name the key
+// that signs, which for a primary keyring is the primary key unless a fresh
+// signing subkey was added, and for an encryption-subkey keyring is the
+// primary key. EncryptionSubkeyFingerprint is empty without an encryption
+// subkey.
 type ArtifactMetadata struct {
-	PrimaryFingerprint       string  `json:"primary_fingerprint"`
-	SigningSubkeyFingerprint string  `json:"signing_subkey_fingerprint"`
-	SigningKeyID             string  `json:"signing_key_id"`
-	Scope                    Scope   `json:"scope"`
-	TargetDigits             string  `json:"target_digits"`
-	RunLength                int     `json:"run_length"`
-	RunStart                 int     `json:"run_start"`
-	RepeatedDigit            string  `json:"repeated_digit"`
-	SubkeyCreatedAt          string  `json:"subkey_created_at"`
-	PrimaryCreatedAt         string  `json:"primary_created_at"`
-	Attempts                 uint64  `json:"attempts"`
-	RunAttempts              uint64  `json:"run_attempts"`
-	Elapsed                  string  `json:"elapsed"`
-	Rate                     float64 `json:"candidates_per_second"`
-	CreatedAt                string  `json:"created_at"`
+	KeyKind                     KeyKind `json:"key_kind,omitempty"`
+	PrimaryFingerprint          string  `json:"primary_fingerprint"`
+	SigningSubkeyFingerprint    string  `json:"signing_subkey_fingerprint"`
+	SigningKeyID                string  `json:"signing_key_id"`
+	EncryptionSubkeyFingerprint string  `json:"encryption_subkey_fingerprint,omitempty"`
+	Scope                       Scope   `json:"scope"`
+	TargetDigits                string  `json:"target_digits"`
+	Pattern                     string  `json:"pattern,omitempty"`
+	RunLength                   int     `json:"run_length"`
+	RunStart                    int     `json:"run_start"`
+	RepeatedDigit               string  `json:"repeated_digit"`
+	SubkeyCreatedAt             string  `json:"subkey_created_at"`
+	PrimaryCreatedAt            string  `json:"primary_created_at"`
+	Attempts                    uint64  `json:"attempts"`
+	RunAttempts                 uint64  `json:"run_attempts"`
+	Elapsed                     string  `json:"elapsed"`
+	Rate                        float64 `json:"candidates_per_second"`
+	CreatedAt                   string  `json:"created_at"`
+}
+
+// MinedFingerprint returns the fingerprint of the key that carries the mined
+// key ID.
+func (m ArtifactMetadata) MinedFingerprint() string {
+	switch m.KeyKind {
+	case KeyKindPrimary:
+		return m.PrimaryFingerprint
+	case KeyKindEncryptionSubkey:
+		return m.EncryptionSubkeyFingerprint
+	default:
+		return m.SigningSubkeyFingerprint
+	}
+}
+
+// MinedKeyID returns the mined 16-digit key ID.
+func (m ArtifactMetadata) MinedKeyID() string {
+	fingerprint := m.MinedFingerprint()
+	if len(fingerprint) < 16 {
+		return ""
+	}
+	return fingerprint[len(fingerprint)-16:]
 }
 
 type Artifacts struct {
@@ -45,6 +79,8 @@ func FinalizeAndWrite(
 	searchResult *SearchResult,
 	scope Scope,
 	targetDigits string,
+	pattern *Pattern,
+	options KeyringOptions,
 	encryptor domain.Encryptor,
 ) (*Artifacts, error) {
 	if encryptor == nil {
@@ -54,7 +90,19 @@ func FinalizeAndWrite(
 		return nil, fmt.Errorf("search result is nil")
 	}
 
-	entity, err := BuildSigningKeyring(identity, candidate, primaryCreatedAt)
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	if candidate.privateKey != nil && (candidate.privateKey.PubKeyAlgo == packet.PubKeyAlgoECDH) != options.kind().encryption() {
+		return nil, fmt.Errorf("candidate key algorithm does not suit the %s target", options.kind())
+	}
+	var entity *openpgp.Entity
+	var err error
+	if options.kind() == KeyKindPrimary {
+		entity, err = BuildPrimaryKeyring(identity, candidate, options)
+	} else {
+		entity, err = BuildSigningKeyring(identity, candidate, primaryCreatedAt)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -78,6 +126,7 @@ func FinalizeAndWrite(
 	metadataPath := filepath.Join(absOutputDir, baseName+"-result.json")
 
 	metadata := ArtifactMetadata{
+		KeyKind:                  options.kind(),
 		PrimaryFingerprint:       fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint),
 		SigningSubkeyFingerprint: candidate.FingerprintHex(),
 		SigningKeyID:             keyID,
@@ -87,13 +136,40 @@ func FinalizeAndWrite(
 		RunStart:                 candidate.Match.Start,
 		RepeatedDigit:            candidate.RepeatedDigit(),
 		SubkeyCreatedAt:          time.Unix(int64(candidate.Timestamp), 0).UTC().Format(time.RFC3339),
-		PrimaryCreatedAt:         primaryCreatedAt.UTC().Format(time.RFC3339),
+		PrimaryCreatedAt:         entity.PrimaryKey.CreationTime.UTC().Format(time.RFC3339),
 		Attempts:                 searchResult.Attempts,
 		RunAttempts:              searchResult.RunAttempts,
 		Elapsed:                  searchResult.Elapsed.Round(time.Millisecond).String(),
 		Rate:                     searchResult.Rate,
 		CreatedAt:                time.Now().UTC().Format(time.RFC3339),
 	}
+	if options.kind() == KeyKindEncryptionSubkey {
+		metadata.SigningSubkeyFingerprint = metadata.PrimaryFingerprint
+		metadata.SigningKeyID = fmt.Sprintf("%016X", entity.PrimaryKey.KeyId)
+	}
+	if options.kind() == KeyKindPrimary {
+		metadata.SubkeyCreatedAt = ""
+		for _, subkey := range entity.Subkeys {
+			metadata.SubkeyCreatedAt = subkey.PublicKey.CreationTime.UTC().Format(time.RFC3339)
+			if subkey.Sig.FlagSign {
+				metadata.SigningSubkeyFingerprint = fmt.Sprintf("%X", subkey.PublicKey.Fingerprint)
+				metadata.SigningKeyID = fmt.Sprintf("%016X", subkey.PublicKey.KeyId)
+			}
+		}
+	}
+	for _, subkey := range entity.Subkeys {
+		if subkey.Sig.FlagEncryptCommunications {
+			metadata.EncryptionSubkeyFingerprint = fmt.Sprintf("%X", subkey.PublicKey.Fingerprint)
+		}
+	}
+	if pattern != nil {
+		// A pattern replaces the repeated-run criteria, so record only the
+		// pattern and where its constrained digits start.
+		metadata.Scope = ""
+		metadata.TargetDigits = ""
+		metadata.Pattern = pattern.String()
+		metadata.RepeatedDigit = ""
+	}
 	metadataJSON, err := json.MarshalIndent(metadata, "", "  ")
 	if err != nil {
 		return nil, fmt.Errorf("encode result metadata: %w", err)
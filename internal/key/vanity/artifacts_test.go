@@ -7,6 +7,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/iyuangang/gpgenie/internal/config"
+	"github.com/iyuangang/gpgenie/internal/key/domain"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -36,6 +39,8 @@ func TestFinalizeAndWriteProducesEncryptedArtifacts(t *testing.T) {
 		result,
 		ScopeSuffix,
 		"018",
+		nil,
+		KeyringOptions{},
 		testArtifactEncryptor{},
 	)
 	require.NoError(t, err)
@@ -58,7 +63,11 @@ func TestFinalizeAndWriteProducesEncryptedArtifacts(t *testing.T) {
 		artifacts.MetadataPath,
 	)
 	require.NoError(t, err)
-	record, err := reloaded.ToDatabaseKeyInfo()
+	scorer, err := domain.NewScorer(config.ScoringConfig{})
+	require.NoError(t, err)
+	window, err := config.ParseScoringWindow("")
+	require.NoError(t, err)
+	record, err := reloaded.ToDatabaseKeyInfo(scorer, window, nil)
 	require.NoError(t, err)
 	assert.Equal(t, strings.ToLower(candidate.FingerprintHex()), record.Fingerprint)
 	assert.Equal(t, strings.ToLower(candidate.KeyIDHex()), record.FingerprintSuffix)
@@ -66,11 +75,17 @@ func TestFinalizeAndWriteProducesEncryptedArtifacts(t *testing.T) {
 	assert.Equal(t, string(publicData), record.PublicKey)
 	assert.Equal(t, string(privateData), record.PrivateKey)
 	assert.True(t, record.IsVanity)
+	assert.Equal(t, "ed25519", record.Algorithm)
 	assert.Equal(t, candidate.Match.RunLength, record.VanityRunLength)
 	assert.Equal(t, candidate.Match.Start, record.VanityRunStart)
 	assert.Equal(t, candidate.RepeatedDigit(), record.VanityDigit)
 	assert.Equal(t, string(ScopeSuffix), record.VanityScope)
 	assert.Equal(t, "018", record.VanityTargetDigits)
+	assert.Equal(t, domain.ClassicStrategy, record.ScoreStrategy)
+	assert.Equal(t, config.ScoringWindowLong, record.ScoreWindow)
+	scores, err := domain.CalculateScores(record.FingerprintSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, scores.Total(), record.Score)
 }
 
 func TestCheckpointRoundTrip(t *testing.T) {
@@ -85,6 +100,10 @@ func TestCheckpointRoundTrip(t *testing.T) {
 		LatestMetadataPath:     "result.json",
 		BestSigningFingerprint: "0123456789ABCDEF01234567ABCDEF1234999999",
 		SavedToDatabase:        true,
+		Targets: []TargetCheckpoint{
+			{Name: "coffee", Criteria: "pattern=...C0FFEE", KeyID: "ABCDEF1234C0FFEE", SavedToDatabase: true},
+			{Name: "ops", Criteria: "scope=suffix digits=018 min_run=9"},
+		},
 	}
 	require.NoError(t, SaveCheckpoint(path, want))
 
@@ -96,6 +115,9 @@ func TestCheckpointRoundTrip(t *testing.T) {
 	assert.Equal(t, want.Scope, got.Scope)
 	assert.Equal(t, want.TargetDigits, got.TargetDigits)
 	assert.True(t, got.SavedToDatabase)
+	assert.Equal(t, want.Targets, got.Targets)
+	assert.True(t, got.Targets[0].Satisfied())
+	assert.False(t, got.Targets[1].Satisfied())
 	assert.NotEmpty(t, got.UpdatedAt)
 }
 
@@ -104,3 +126,84 @@ func TestLoadMissingCheckpointReturnsEmptyState(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, &Checkpoint{}, checkpoint)
 }
+
+func TestFinalizeAndWriteRecordsPattern(t *testing.T) {
+	candidate := testCandidate(t)
+	pattern, err := ParsePattern("..." + candidate.KeyIDHex()[12:])
+	require.NoError(t, err)
+	candidate.Match = pattern.Evaluate(candidate.KeyID)
+	result := &SearchResult{Candidate: &candidate, Attempts: 1, RunAttempts: 1, BestRun: candidate.Match.RunLength}
+	artifacts, err := FinalizeAndWrite(
+		t.TempDir(),
+		Identity{Name: "Artifact Test", Email: "artifact@example.com"},
+		candidate,
+		time.Unix(int64(candidate.Timestamp)-3600, 0),
+		result,
+		ScopeSuffix,
+		AllDigits.String(),
+		pattern,
+		KeyringOptions{},
+		testArtifactEncryptor{},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, pattern.String(), artifacts.Metadata.Pattern)
+	assert.Equal(t, 4, artifacts.Metadata.RunLength)
+	assert.Empty(t, artifacts.Metadata.Scope)
+	assert.Empty(t, artifacts.Metadata.RepeatedDigit)
+
+	scorer, err := domain.NewScorer(config.ScoringConfig{})
+	require.NoError(t, err)
+	window, err := config.ParseScoringWindow("")
+	require.NoError(t, err)
+	record, err := artifacts.ToDatabaseKeyInfo(scorer, window, nil)
+	require.NoError(t, err)
+	assert.Equal(t, pattern.String(), record.MatchedPattern)
+}
+
+func TestFinalizeAndWriteRecordsEncryptionSubkey(t *testing.T) {
+	candidate := testCandidateFor(t, KeyKindEncryptionSubkey)
+	result := &SearchResult{Candidate: &candidate, Attempts: 1, RunAttempts: 1, BestRun: candidate.Match.RunLength}
+	finalize := func(candidate Candidate, options KeyringOptions) (*Artifacts, error) {
+		return FinalizeAndWrite(
+			t.TempDir(),
+			Identity{Name: "Artifact Test", Email: "artifact@example.com"},
+			candidate,
+			time.Unix(int64(candidate.Timestamp)-3600, 0),
+			result,
+			ScopeSuffix,
+			AllDigits.String(),
+			nil,
+			options,
+			testArtifactEncryptor{},
+		)
+	}
+
+	artifacts, err := finalize(candidate, KeyringOptions{Kind: KeyKindEncryptionSubkey})
+	require.NoError(t, err)
+	metadata := artifacts.Metadata
+	assert.Equal(t, KeyKindEncryptionSubkey, metadata.KeyKind)
+	assert.Equal(t, candidate.FingerprintHex(), metadata.EncryptionSubkeyFingerprint)
+	assert.Equal(t, candidate.FingerprintHex(), metadata.MinedFingerprint())
+	assert.Equal(t, candidate.KeyIDHex(), metadata.MinedKeyID())
+	// The primary key signs.
+	assert.Equal(t, metadata.PrimaryFingerprint, metadata.SigningSubkeyFingerprint)
+
+	scorer, err := domain.NewScorer(config.ScoringConfig{})
+	require.NoError(t, err)
+	window, err := config.ParseScoringWindow("")
+	require.NoError(t, err)
+	record, err := artifacts.ToDatabaseKeyInfo(scorer, window, nil)
+	require.NoError(t, err)
+	assert.Equal(t, strings.ToLower(candidate.FingerprintHex()), record.Fingerprint)
+	assert.Equal(t, domain.AlgorithmCv25519, record.Algorithm)
+
+	// Metadata edited on disk may lose the encryption subkey fingerprint.
+	artifacts.Metadata.EncryptionSubkeyFingerprint = ""
+	_, err = artifacts.ToDatabaseKeyInfo(scorer, window, nil)
+	assert.ErrorContains(t, err, "invalid mined fingerprint")
+
+	_, err = finalize(candidate, KeyringOptions{})
+	assert.Error(t, err)
+	_, err = finalize(testCandidate(t), KeyringOptions{Kind: KeyKindEncryptionSubkey})
+	assert.Error(t, err)
+}
@@ -9,14 +9,24 @@ import (
 	"time"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
+	openpgpECDH "github.com/ProtonMail/go-crypto/openpgp/ecdh"
 	openpgpEdDSA "github.com/ProtonMail/go-crypto/openpgp/eddsa"
 	"github.com/ProtonMail/go-crypto/openpgp/packet"
 )
 
 var candidateCurve struct {
 	sync.Once
-	publicKey *openpgpEdDSA.PublicKey
-	err       error
+	publicKey           *openpgpEdDSA.PublicKey
+	encryptionPublicKey *openpgpECDH.PublicKey
+	err                 error
+}
+
+// generateCandidateKeyFor creates the candidate material mined for kind.
+func generateCandidateKeyFor(kind KeyKind) (*packet.PrivateKey, []byte, error) {
+	if kind.encryption() {
+		return generateEncryptionCandidateKey()
+	}
+	return generateCandidateKey()
 }
 
 // generateCandidateKey creates only the Ed25519 material needed by a vanity
@@ -25,26 +35,8 @@ var candidateCurve struct {
 // use crypto/ed25519 directly and avoid NewEntity's user ID, signatures, and
 // encryption subkey generation.
 func generateCandidateKey() (*packet.PrivateKey, []byte, error) {
-	candidateCurve.Do(func() {
-		createdAt := time.Unix(1, 0).UTC()
-		entity, err := openpgp.NewEntity("GPGenie Candidate", "", "candidate@gpgenie.invalid", &packet.Config{
-			DefaultHash: crypto.SHA256,
-			Time:        func() time.Time { return createdAt },
-			Algorithm:   packet.PubKeyAlgoEdDSA,
-		})
-		if err != nil {
-			candidateCurve.err = fmt.Errorf("initialize Ed25519 curve: %w", err)
-			return
-		}
-		privateKey, ok := entity.PrivateKey.PrivateKey.(*openpgpEdDSA.PrivateKey)
-		if !ok {
-			candidateCurve.err = fmt.Errorf("unexpected Ed25519 private key type %T", entity.PrivateKey.PrivateKey)
-			return
-		}
-		candidateCurve.publicKey = &privateKey.PublicKey
-	})
-	if candidateCurve.err != nil {
-		return nil, nil, candidateCurve.err
+	if err := initCandidateCurves(); err != nil {
+		return nil, nil, err
 	}
 
 	publicBytes, privateBytes, err := ed25519.GenerateKey(rand.Reader)
@@ -64,3 +56,58 @@ func generateCandidateKey() (*packet.PrivateKey, []byte, error) {
 	}
 	return packetKey, template, nil
 }
+
+// generateEncryptionCandidateKey creates the Curve25519 ECDH material of a
+// vanity encryption subkey, with the curve and KDF parameters of the
+// encryption subkey NewEntity generates.
+func generateEncryptionCandidateKey() (*packet.PrivateKey, []byte, error) {
+	if err := initCandidateCurves(); err != nil {
+		return nil, nil, err
+	}
+
+	prototype := candidateCurve.encryptionPublicKey
+	privateKey, err := openpgpECDH.GenerateKey(rand.Reader, prototype.GetCurve(), prototype.KDF)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate Curve25519 candidate: %w", err)
+	}
+
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	packetKey := packet.NewECDHPrivateKey(createdAt, privateKey)
+	template, err := newFingerprintTemplate(&packetKey.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return packetKey, template, nil
+}
+
+func initCandidateCurves() error {
+	candidateCurve.Do(func() {
+		createdAt := time.Unix(1, 0).UTC()
+		entity, err := openpgp.NewEntity("GPGenie Candidate", "", "candidate@gpgenie.invalid", &packet.Config{
+			DefaultHash: crypto.SHA256,
+			Time:        func() time.Time { return createdAt },
+			Algorithm:   packet.PubKeyAlgoEdDSA,
+		})
+		if err != nil {
+			candidateCurve.err = fmt.Errorf("initialize Ed25519 curve: %w", err)
+			return
+		}
+		privateKey, ok := entity.PrivateKey.PrivateKey.(*openpgpEdDSA.PrivateKey)
+		if !ok {
+			candidateCurve.err = fmt.Errorf("unexpected Ed25519 private key type %T", entity.PrivateKey.PrivateKey)
+			return
+		}
+		candidateCurve.publicKey = &privateKey.PublicKey
+		if len(entity.Subkeys) != 1 {
+			candidateCurve.err = fmt.Errorf("initialize Curve25519 curve: expected one encryption subkey, got %d", len(entity.Subkeys))
+			return
+		}
+		encryptionKey, ok := entity.Subkeys[0].PrivateKey.PrivateKey.(*openpgpECDH.PrivateKey)
+		if !ok {
+			candidateCurve.err = fmt.Errorf("unexpected Curve25519 private key type %T", entity.Subkeys[0].PrivateKey.PrivateKey)
+			return
+		}
+		candidateCurve.encryptionPublicKey = &encryptionKey.PublicKey
+	})
+	return candidateCurve.err
+}
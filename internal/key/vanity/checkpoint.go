@@ -14,13 +14,37 @@ type Checkpoint struct {
 	BestRun                    int    `json:"best_run"`
 	Scope                      Scope  `json:"scope,omitempty"`
 	TargetDigits               string `json:"target_digits,omitempty"`
+	Pattern                    string `json:"pattern,omitempty"`
+	KeyKind                    string `json:"key_kind,omitempty"`
 	BestKeyID                  string `json:"best_key_id,omitempty"`
 	BestSigningFingerprint     string `json:"best_signing_fingerprint,omitempty"`
 	LatestPublicKeyPath        string `json:"latest_public_key_path,omitempty"`
 	LatestEncryptedPrivatePath string `json:"latest_encrypted_private_path,omitempty"`
 	LatestMetadataPath         string `json:"latest_metadata_path,omitempty"`
 	SavedToDatabase            bool   `json:"saved_to_database,omitempty"`
-	UpdatedAt                  string `json:"updated_at"`
+	// Targets records each target of a multi-target search. Attempts then
+	// counts the work of the whole search and the single-target fields are
+	// unused.
+	Targets   []TargetCheckpoint `json:"targets,omitempty"`
+	UpdatedAt string             `json:"updated_at"`
+}
+
+// TargetCheckpoint is the state of one multi-target search target. A target
+// is satisfied once its artifacts have been written.
+type TargetCheckpoint struct {
+	Name                 string `json:"name"`
+	Criteria             string `json:"criteria"`
+	KeyID                string `json:"key_id,omitempty"`
+	SigningFingerprint   string `json:"signing_fingerprint,omitempty"`
+	PublicKeyPath        string `json:"public_key_path,omitempty"`
+	EncryptedPrivatePath string `json:"encrypted_private_path,omitempty"`
+	MetadataPath         string `json:"metadata_path,omitempty"`
+	SavedToDatabase      bool   `json:"saved_to_database,omitempty"`
+}
+
+// Satisfied reports whether the target has been found and finalized.
+func (t TargetCheckpoint) Satisfied() bool {
+	return t.KeyID != ""
 }
 
 func LoadCheckpoint(path string) (*Checkpoint, error) {
@@ -7,6 +7,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/iyuangang/gpgenie/internal/config"
 	"github.com/iyuangang/gpgenie/internal/key/domain"
 	"github.com/iyuangang/gpgenie/models"
 )
@@ -42,12 +43,19 @@ func LoadArtifacts(publicPath, encryptedPrivatePath, metadataPath string) (*Arti
 }
 
 // ToDatabaseKeyInfo converts finalized artifacts into the existing encrypted
-// key record format. Fingerprint identifies the signing subkey because that is
-// the fingerprint Git and GitHub use for commit signatures.
-func (a *Artifacts) ToDatabaseKeyInfo() (*models.KeyInfo, error) {
+// key record format. Fingerprint identifies the mined key: the signing subkey,
+// whose fingerprint Git and GitHub use for commit signatures, the primary key
+// of a primary keyring, or the encryption subkey of an encryption-subkey
+// keyring. The score columns are computed by scorer over the window of that
+// fingerprint so vanity keys rank alongside generated keys. rarity, when not
+// nil, fills in their rarity.
+func (a *Artifacts) ToDatabaseKeyInfo(scorer domain.Scorer, window config.ScoringWindow, rarity *domain.RarityEstimator) (*models.KeyInfo, error) {
 	if a == nil {
 		return nil, fmt.Errorf("vanity artifacts are nil")
 	}
+	if scorer == nil {
+		return nil, fmt.Errorf("scorer is nil")
+	}
 	metadata := a.Metadata
 	signingFingerprint := strings.ToLower(metadata.SigningSubkeyFingerprint)
 	signingKeyID := strings.ToLower(metadata.SigningKeyID)
@@ -61,6 +69,10 @@ func (a *Artifacts) ToDatabaseKeyInfo() (*models.KeyInfo, error) {
 	if !validHexLength(primaryFingerprint, 40) {
 		return nil, fmt.Errorf("invalid primary fingerprint %q", metadata.PrimaryFingerprint)
 	}
+	minedFingerprint := strings.ToLower(metadata.MinedFingerprint())
+	if !validHexLength(minedFingerprint, 40) {
+		return nil, fmt.Errorf("invalid mined fingerprint %q", metadata.MinedFingerprint())
+	}
 	if metadata.RunLength < 1 || metadata.RunLength > 16 {
 		return nil, fmt.Errorf("invalid vanity run length %d", metadata.RunLength)
 	}
@@ -71,30 +83,30 @@ func (a *Artifacts) ToDatabaseKeyInfo() (*models.KeyInfo, error) {
 		return nil, fmt.Errorf("encrypted vanity private key is empty")
 	}
 
-	scores, err := domain.CalculateScores(signingKeyID)
+	digits := domain.ScoringDigits(window, minedFingerprint)
+	scores, err := scorer.Score(digits)
 	if err != nil {
 		return nil, fmt.Errorf("calculate vanity key scores: %w", err)
 	}
-	return &models.KeyInfo{
-		Fingerprint:           signingFingerprint,
-		FingerprintSuffix:     signingKeyID,
-		PrimaryFingerprint:    primaryFingerprint,
-		PublicKey:             a.PublicKey,
-		PrivateKey:            a.EncryptedPrivateKey,
-		RepeatLetterScore:     scores.RepeatLetterScore,
-		IncreasingLetterScore: scores.IncreasingLetterScore,
-		DecreasingLetterScore: scores.DecreasingLetterScore,
-		MagicLetterScore:      scores.MagicLetterScore,
-		Score: scores.RepeatLetterScore + scores.IncreasingLetterScore +
-			scores.DecreasingLetterScore + scores.MagicLetterScore,
-		UniqueLettersCount: scores.UniqueLettersCount,
+	record := &models.KeyInfo{
+		Fingerprint:        minedFingerprint,
+		FingerprintSuffix:  minedFingerprint[len(minedFingerprint)-16:],
+		PrimaryFingerprint: primaryFingerprint,
+		PublicKey:          a.PublicKey,
+		PrivateKey:         a.EncryptedPrivateKey,
+		Algorithm:          metadata.KeyKind.algorithm(),
+		KeyVersion:         domain.KeyVersion4,
 		IsVanity:           true,
 		VanityRunLength:    metadata.RunLength,
 		VanityRunStart:     metadata.RunStart,
 		VanityDigit:        metadata.RepeatedDigit,
 		VanityScope:        string(metadata.Scope),
 		VanityTargetDigits: metadata.TargetDigits,
-	}, nil
+		MatchedPattern:     metadata.Pattern,
+	}
+	domain.ApplyScores(record, scorer, window, scores)
+	record.Rarity = rarity.Rarity(len(digits), record.Score)
+	return record, nil
 }
 
 func validHexLength(value string, length int) bool {
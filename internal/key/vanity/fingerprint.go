@@ -13,8 +13,16 @@ const (
 	v4FingerprintPrefixLength = 3
 	v4VersionOffset           = v4FingerprintPrefixLength
 	v4TimestampOffset         = v4VersionOffset + 1
+	v4AlgorithmOffset         = v4TimestampOffset + 4
+	// ecdhKDFLength is the size of the KDF parameters that end ECDH key
+	// material: a length byte, a reserved 0x01, and the hash and cipher IDs.
+	ecdhKDFLength = 4
 )
 
+// newFingerprintTemplate returns the v4 fingerprint material of publicKey,
+// whose creation timestamp fingerprintAt overwrites. Ed25519 material ends
+// with the public point; ECDH material adds an algorithm-specific curve OID
+// and ends with KDF parameters, so it no longer fits one SHA-1 block.
 func newFingerprintTemplate(publicKey *packet.PublicKey) ([]byte, error) {
 	if publicKey == nil {
 		return nil, fmt.Errorf("public key is nil")
@@ -28,9 +36,20 @@ func newFingerprintTemplate(publicKey *packet.PublicKey) ([]byte, error) {
 		return nil, fmt.Errorf("serialize public key for fingerprint: %w", err)
 	}
 	data := material.Bytes()
-	if len(data) < v4TimestampOffset+4 || data[0] != 0x99 || data[v4VersionOffset] != 4 {
+	if len(data) <= v4AlgorithmOffset || data[0] != 0x99 || data[v4VersionOffset] != 4 {
 		return nil, fmt.Errorf("unexpected OpenPGP v4 fingerprint material")
 	}
+	if packet.PublicKeyAlgorithm(data[v4AlgorithmOffset]) != publicKey.PubKeyAlgo {
+		return nil, fmt.Errorf("unexpected algorithm %d in fingerprint material", data[v4AlgorithmOffset])
+	}
+	if publicKey.PubKeyAlgo == packet.PubKeyAlgoECDH {
+		if len(data) < v4AlgorithmOffset+1+ecdhKDFLength {
+			return nil, fmt.Errorf("unexpected ECDH KDF parameters in fingerprint material")
+		}
+		if kdf := data[len(data)-ecdhKDFLength:]; kdf[0] != ecdhKDFLength-1 || kdf[1] != 0x01 {
+			return nil, fmt.Errorf("unexpected ECDH KDF parameters in fingerprint material")
+		}
+	}
 	return append([]byte(nil), data...), nil
 }
 
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -29,6 +30,25 @@ func TestFingerprintAtMatchesOpenPGPV4Serialization(t *testing.T) {
 	assert.Equal(t, binary.BigEndian.Uint64(wantFingerprint[12:]), keyID)
 }
 
+func TestEncryptionFingerprintTemplateLayout(t *testing.T) {
+	privateKey, template, err := generateEncryptionCandidateKey()
+	require.NoError(t, err)
+	assert.Equal(t, packet.PubKeyAlgoECDH, packet.PublicKeyAlgorithm(template[v4AlgorithmOffset]))
+	// ECDH material ends with the KDF parameters and, unlike Ed25519
+	// material, needs more than one SHA-1 block.
+	assert.Equal(t, []byte{0x03, 0x01}, template[len(template)-ecdhKDFLength:len(template)-2])
+	assert.Greater(t, len(template), 55)
+
+	timestamp := uint32(time.Now().Add(-24 * time.Hour).Unix())
+	fingerprint, keyID, err := fingerprintAt(template, timestamp)
+	require.NoError(t, err)
+	privateKey.CreationTime = time.Unix(int64(timestamp), 0)
+	var material bytes.Buffer
+	require.NoError(t, privateKey.PublicKey.SerializeForHash(&material))
+	assert.Equal(t, sha1.Sum(material.Bytes()), fingerprint)
+	assert.Equal(t, binary.BigEndian.Uint64(fingerprint[12:]), keyID)
+}
+
 func TestFingerprintTemplateRejectsNil(t *testing.T) {
 	_, err := newFingerprintTemplate(nil)
 	require.Error(t, err)
@@ -0,0 +1,75 @@
+package vanity
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1" // OpenPGP v4 fingerprints require SHA-1 by specification.
+	"fmt"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	openpgpEdDSA "github.com/ProtonMail/go-crypto/openpgp/eddsa"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// GrindTemplate derives the OpenPGP v4 fingerprints of one Ed25519 key at
+// different creation timestamps. Only the SHA-1 over the fingerprint template
+// is computed per timestamp; Entity builds the full key for a chosen one. A
+// GrindTemplate is not safe for concurrent use.
+type GrindTemplate struct {
+	privateKey *openpgpEdDSA.PrivateKey
+	template   []byte
+}
+
+// NewGrindTemplate generates a fresh Ed25519 key and its fingerprint template.
+func NewGrindTemplate() (*GrindTemplate, error) {
+	packetKey, template, err := generateCandidateKey()
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := packetKey.PrivateKey.(*openpgpEdDSA.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unexpected Ed25519 private key type %T", packetKey.PrivateKey)
+	}
+	return &GrindTemplate{privateKey: privateKey, template: template}, nil
+}
+
+// FingerprintAt returns the v4 fingerprint the key would have if it had been
+// created at timestamp.
+func (g *GrindTemplate) FingerprintAt(timestamp uint32) ([sha1.Size]byte, error) {
+	fingerprint, _, err := fingerprintAt(g.template, timestamp)
+	return fingerprint, err
+}
+
+// Entity materializes the key as a primary key created at timestamp, with a
+// self-signed user ID and an encryption subkey, like openpgp.NewEntity. The
+// result is checked against FingerprintAt.
+func (g *GrindTemplate) Entity(identity Identity, timestamp uint32) (*openpgp.Entity, error) {
+	createdAt := time.Unix(int64(timestamp), 0).UTC()
+	config := &packet.Config{
+		DefaultHash: crypto.SHA256,
+		Time:        func() time.Time { return createdAt },
+		Algorithm:   packet.PubKeyAlgoEdDSA,
+	}
+	primary := packet.NewEdDSAPrivateKey(createdAt, g.privateKey)
+	entity := &openpgp.Entity{
+		PrimaryKey: &primary.PublicKey,
+		PrivateKey: primary,
+		Identities: make(map[string]*openpgp.Identity),
+	}
+	if err := entity.AddUserId(identity.Name, identity.Comment, identity.Email, config); err != nil {
+		return nil, fmt.Errorf("add user ID: %w", err)
+	}
+	if err := entity.AddEncryptionSubkey(config); err != nil {
+		return nil, fmt.Errorf("add encryption subkey: %w", err)
+	}
+
+	expected, err := g.FingerprintAt(timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(entity.PrimaryKey.Fingerprint, expected[:]) {
+		return nil, fmt.Errorf("materialized key fingerprint does not match the template")
+	}
+	return entity, nil
+}
@@ -0,0 +1,39 @@
+package vanity
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrindTemplateEntityMatchesFingerprint(t *testing.T) {
+	template, err := NewGrindTemplate()
+	require.NoError(t, err)
+	timestamp := uint32(time.Now().Add(-time.Hour).Unix())
+
+	fingerprint, err := template.FingerprintAt(timestamp)
+	require.NoError(t, err)
+	previous, err := template.FingerprintAt(timestamp - 1)
+	require.NoError(t, err)
+	assert.NotEqual(t, fingerprint, previous)
+
+	entity, err := template.Entity(Identity{Name: "Grind", Email: "grind@example.com"}, timestamp)
+	require.NoError(t, err)
+	assert.Equal(t, fingerprint[:], entity.PrimaryKey.Fingerprint)
+	assert.Equal(t, int64(timestamp), entity.PrimaryKey.CreationTime.Unix())
+	require.Len(t, entity.Subkeys, 1)
+
+	var serialized bytes.Buffer
+	require.NoError(t, entity.SerializePrivate(&serialized, nil))
+	parsed, err := openpgp.ReadKeyRing(&serialized)
+	require.NoError(t, err)
+	require.Len(t, parsed, 1)
+	assert.Equal(t, fingerprint[:], parsed[0].PrimaryKey.Fingerprint)
+	assert.Equal(t, "Grind <grind@example.com>", parsed[0].PrimaryIdentity().Name)
+	_, ok := parsed[0].EncryptionKey(time.Now())
+	assert.True(t, ok)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
@@ -11,13 +12,15 @@ import (
 )
 
 type Identity struct {
-	Name    string
-	Comment string
-	Email   string
+	Name    string `json:"name,omitempty"`
+	Comment string `json:"comment,omitempty"`
+	Email   string `json:"email,omitempty"`
 }
 
 // BuildSigningKeyring creates a normal Ed25519 primary key and binds the
-// mined candidate as a cross-certified Ed25519 signing subkey.
+// mined candidate as a cross-certified Ed25519 signing subkey. A Curve25519
+// ECDH candidate is bound as an encryption subkey instead, and the primary
+// key keeps signing.
 func BuildSigningKeyring(identity Identity, candidate Candidate, primaryCreatedAt time.Time) (*openpgp.Entity, error) {
 	if candidate.privateKey == nil {
 		return nil, fmt.Errorf("candidate private key is missing")
@@ -26,10 +29,16 @@ func BuildSigningKeyring(identity Identity, candidate Candidate, primaryCreatedA
 		return nil, fmt.Errorf("name and email are required")
 	}
 
+	encryption := candidate.privateKey.PubKeyAlgo == packet.PubKeyAlgoECDH
+	subkeyName := "signing subkey"
+	if encryption {
+		subkeyName = "encryption subkey"
+	}
+
 	subkeyCreatedAt := time.Unix(int64(candidate.Timestamp), 0).UTC()
 	primaryCreatedAt = primaryCreatedAt.UTC().Truncate(time.Second)
 	if !primaryCreatedAt.Before(subkeyCreatedAt) {
-		return nil, fmt.Errorf("primary key creation time must be before signing subkey creation time")
+		return nil, fmt.Errorf("primary key creation time must be before %s creation time", subkeyName)
 	}
 
 	primaryConfig := &packet.Config{
@@ -43,7 +52,7 @@ func BuildSigningKeyring(identity Identity, candidate Candidate, primaryCreatedA
 	}
 	// GitHub commit signing does not require the automatically generated
 	// encryption subkey. Keep the transferable key focused on certification
-	// and the mined signing subkey.
+	// and the mined subkey.
 	entity.Subkeys = nil
 	for _, identity := range entity.Identities {
 		if identity.SelfSignature == nil {
@@ -51,7 +60,7 @@ func BuildSigningKeyring(identity Identity, candidate Candidate, primaryCreatedA
 		}
 		identity.SelfSignature.FlagsValid = true
 		identity.SelfSignature.FlagCertify = true
-		identity.SelfSignature.FlagSign = false
+		identity.SelfSignature.FlagSign = encryption
 		if err := identity.SelfSignature.SignUserId(
 			identity.UserId.Id,
 			entity.PrimaryKey,
@@ -79,7 +88,7 @@ func BuildSigningKeyring(identity Identity, candidate Candidate, primaryCreatedA
 		return nil, err
 	}
 	if verifiedFingerprint != candidate.Fingerprint || verifiedKeyID != candidate.KeyID {
-		return nil, fmt.Errorf("candidate fingerprint changed while constructing signing subkey")
+		return nil, fmt.Errorf("candidate fingerprint changed while constructing %s", subkeyName)
 	}
 
 	bindingTime := time.Now().UTC().Truncate(time.Second)
@@ -95,15 +104,20 @@ func BuildSigningKeyring(identity Identity, candidate Candidate, primaryCreatedA
 	keyLifetime := uint32(0)
 	binding.KeyLifetimeSecs = &keyLifetime
 	binding.FlagsValid = true
-	binding.FlagSign = true
-
-	embedded := newSignature(subPublic, packet.SigTypePrimaryKeyBinding, bindingTime)
-	if err := embedded.CrossSignKey(subPublic, entity.PrimaryKey, subPrivate, signConfig); err != nil {
-		return nil, fmt.Errorf("cross-sign vanity signing subkey: %w", err)
+	if encryption {
+		// An encryption subkey cannot sign, so it carries no cross-signature.
+		binding.FlagEncryptCommunications = true
+		binding.FlagEncryptStorage = true
+	} else {
+		binding.FlagSign = true
+		embedded := newSignature(subPublic, packet.SigTypePrimaryKeyBinding, bindingTime)
+		if err := embedded.CrossSignKey(subPublic, entity.PrimaryKey, subPrivate, signConfig); err != nil {
+			return nil, fmt.Errorf("cross-sign vanity signing subkey: %w", err)
+		}
+		binding.EmbeddedSignature = embedded
 	}
-	binding.EmbeddedSignature = embedded
 	if err := binding.SignKey(subPublic, entity.PrivateKey, signConfig); err != nil {
-		return nil, fmt.Errorf("bind vanity signing subkey: %w", err)
+		return nil, fmt.Errorf("bind vanity %s: %w", subkeyName, err)
 	}
 
 	entity.Subkeys = []openpgp.Subkey{{
@@ -111,7 +125,12 @@ func BuildSigningKeyring(identity Identity, candidate Candidate, primaryCreatedA
 		PrivateKey: subPrivate,
 		Sig:        binding,
 	}}
-	if err := ValidateSigningKeyring(entity, candidate.KeyID); err != nil {
+	if encryption {
+		err = ValidateEncryptionKeyring(entity, candidate.KeyID)
+	} else {
+		err = ValidateSigningKeyring(entity, candidate.KeyID)
+	}
+	if err != nil {
 		return nil, err
 	}
 	return entity, nil
@@ -146,11 +165,73 @@ func ValidateSigningKeyring(entity *openpgp.Entity, signingKeyID uint64) error {
 	if err := entity.PrimaryKey.VerifyKeySignature(subkey.PublicKey, subkey.Sig); err != nil {
 		return fmt.Errorf("verify signing subkey binding: %w", err)
 	}
+	return verifySigningRoundTrip(entity, signingKeyID)
+}
+
+// ValidateEncryptionKeyring checks that encryptionKeyID is the only subkey,
+// that its binding verifies, and that it is the key the keyring encrypts to.
+// When the private keyring is present, a message encrypted to it must decrypt.
+func ValidateEncryptionKeyring(entity *openpgp.Entity, encryptionKeyID uint64) error {
+	if entity == nil || entity.PrimaryKey == nil {
+		return fmt.Errorf("keyring is incomplete")
+	}
+	if len(entity.Subkeys) != 1 {
+		return fmt.Errorf("expected one encryption subkey, got %d", len(entity.Subkeys))
+	}
+	subkey := entity.Subkeys[0]
+	if subkey.PublicKey.KeyId != encryptionKeyID {
+		return fmt.Errorf("unexpected encryption subkey ID: got %016X, want %016X", subkey.PublicKey.KeyId, encryptionKeyID)
+	}
+	if err := entity.PrimaryKey.VerifyKeySignature(subkey.PublicKey, subkey.Sig); err != nil {
+		return fmt.Errorf("verify encryption subkey binding: %w", err)
+	}
+	now := time.Now().UTC()
+	selected, ok := entity.EncryptionKey(now)
+	if !ok || selected.PublicKey.KeyId != encryptionKeyID {
+		return fmt.Errorf("vanity encryption key %016X is not selectable", encryptionKeyID)
+	}
+	if entity.PrivateKey == nil || selected.PrivateKey == nil {
+		return nil
+	}
+
+	message := []byte("gpgenie vanity encryption key validation")
+	config := &packet.Config{
+		DefaultHash: crypto.SHA256,
+		Time:        func() time.Time { return now },
+	}
+	var ciphertext bytes.Buffer
+	writer, err := openpgp.Encrypt(&ciphertext, openpgp.EntityList{entity}, nil, nil, config)
+	if err != nil {
+		return fmt.Errorf("encrypt validation message: %w", err)
+	}
+	if _, err := writer.Write(message); err != nil {
+		return fmt.Errorf("encrypt validation message: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("encrypt validation message: %w", err)
+	}
+	details, err := openpgp.ReadMessage(&ciphertext, openpgp.EntityList{entity}, nil, config)
+	if err != nil {
+		return fmt.Errorf("decrypt validation message: %w", err)
+	}
+	plaintext, err := io.ReadAll(details.UnverifiedBody)
+	if err != nil {
+		return fmt.Errorf("decrypt validation message: %w", err)
+	}
+	if !bytes.Equal(plaintext, message) || len(details.EncryptedToKeyIds) != 1 || details.EncryptedToKeyIds[0] != encryptionKeyID {
+		return fmt.Errorf("validation message was not encrypted to the vanity encryption key")
+	}
+	return nil
+}
 
+// verifySigningRoundTrip checks that signingKeyID is the key the keyring
+// selects for signing and, when the private keyring is present, that it
+// signs a message that verifies.
+func verifySigningRoundTrip(entity *openpgp.Entity, signingKeyID uint64) error {
 	now := time.Now().UTC()
 	selected, ok := entity.SigningKeyById(now, signingKeyID)
 	if !ok || selected.PublicKey.KeyId != signingKeyID {
-		return fmt.Errorf("vanity signing subkey is not selectable")
+		return fmt.Errorf("vanity signing key %016X is not selectable", signingKeyID)
 	}
 	// A public-only keyring can validate the binding and key selection but
 	// cannot perform the private signing round trip below.
@@ -178,7 +259,7 @@ func ValidateSigningKeyring(entity *openpgp.Entity, signingKeyID uint64) error {
 		return fmt.Errorf("verify validation signature: %w", err)
 	}
 	if signaturePacket.IssuerKeyId == nil || *signaturePacket.IssuerKeyId != signingKeyID {
-		return fmt.Errorf("validation signature was not produced by the vanity signing subkey")
+		return fmt.Errorf("validation signature was not produced by the vanity signing key")
 	}
 	return nil
 }
@@ -12,6 +12,7 @@ import (
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -104,9 +105,101 @@ func TestGnuPGImportsAndSignsWithGeneratedKeyring(t *testing.T) {
 	assert.Contains(t, string(output), "VALIDSIG "+candidate.FingerprintHex())
 }
 
+func TestBuildSigningKeyringBindsEncryptionCandidate(t *testing.T) {
+	candidate := testCandidateFor(t, KeyKindEncryptionSubkey)
+	entity, err := BuildSigningKeyring(Identity{
+		Name:  "Vanity Test",
+		Email: "vanity@example.com",
+	}, candidate, time.Unix(int64(candidate.Timestamp)-3600, 0))
+	require.NoError(t, err)
+	require.NoError(t, ValidateEncryptionKeyring(entity, candidate.KeyID))
+
+	var publicArmor bytes.Buffer
+	armorWriter, err := armor.Encode(&publicArmor, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(armorWriter))
+	require.NoError(t, armorWriter.Close())
+
+	parsed, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(publicArmor.Bytes()))
+	require.NoError(t, err)
+	require.Len(t, parsed, 1)
+	require.Len(t, parsed[0].Subkeys, 1)
+	subkey := parsed[0].Subkeys[0]
+	assert.Equal(t, candidate.KeyID, subkey.PublicKey.KeyId)
+	assert.Equal(t, packet.PubKeyAlgoECDH, subkey.PublicKey.PubKeyAlgo)
+	assert.True(t, subkey.Sig.FlagEncryptCommunications)
+	assert.True(t, subkey.Sig.FlagEncryptStorage)
+	assert.False(t, subkey.Sig.FlagSign)
+	require.NoError(t, ValidateEncryptionKeyring(parsed[0], candidate.KeyID))
+	// The primary key signs in place of the encryption subkey.
+	require.NoError(t, verifySigningRoundTrip(entity, entity.PrimaryKey.KeyId))
+}
+
+func TestGnuPGEncryptsToVanityEncryptionSubkey(t *testing.T) {
+	gpgPath := findGPG()
+	if gpgPath == "" {
+		t.Skip("GnuPG is not installed")
+	}
+
+	candidate := testCandidateFor(t, KeyKindEncryptionSubkey)
+	entity, err := BuildSigningKeyring(Identity{
+		Name:  "Vanity GnuPG Test",
+		Email: "vanity-gpg@example.com",
+	}, candidate, time.Unix(int64(candidate.Timestamp)-3600, 0))
+	require.NoError(t, err)
+
+	var privateArmor bytes.Buffer
+	privateArmorWriter, err := armor.Encode(&privateArmor, openpgp.PrivateKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.SerializePrivate(privateArmorWriter, nil))
+	require.NoError(t, privateArmorWriter.Close())
+
+	gnupgHome := filepath.Join(t.TempDir(), "gnupg")
+	require.NoError(t, os.MkdirAll(gnupgHome, 0o700))
+	privatePath := filepath.Join(t.TempDir(), "vanity-private.asc")
+	require.NoError(t, os.WriteFile(privatePath, privateArmor.Bytes(), 0o600))
+
+	command := exec.Command(gpgPath, "--batch", "--homedir", gnupgHome, "--import", privatePath)
+	output, err := command.CombinedOutput()
+	require.NoError(t, err, string(output))
+	command = exec.Command(gpgPath, "--batch", "--homedir", gnupgHome, "--with-colons", "--list-keys", candidate.FingerprintHex())
+	output, err = command.CombinedOutput()
+	require.NoError(t, err, string(output))
+	assert.Contains(t, string(output), "fpr:::::::::"+candidate.FingerprintHex()+":")
+	assert.Contains(t, string(output), ":e:")
+
+	messagePath := filepath.Join(t.TempDir(), "message.txt")
+	encryptedPath := filepath.Join(t.TempDir(), "message.txt.gpg")
+	require.NoError(t, os.WriteFile(messagePath, []byte("gpgenie GnuPG interoperability test\n"), 0o600))
+	command = exec.Command(
+		gpgPath,
+		"--batch", "--yes", "--homedir", gnupgHome, "--trust-model", "always",
+		"--recipient", candidate.FingerprintHex()+"!",
+		"--output", encryptedPath, "--encrypt", messagePath,
+	)
+	output, err = command.CombinedOutput()
+	require.NoError(t, err, string(output))
+
+	// The mined key ID is the one encrypted messages name.
+	command = exec.Command(gpgPath, "--batch", "--homedir", gnupgHome, "--list-packets", encryptedPath)
+	output, err = command.CombinedOutput()
+	require.NoError(t, err, string(output))
+	assert.Contains(t, string(output), "keyid "+candidate.KeyIDHex())
+
+	command = exec.Command(gpgPath, "--batch", "--homedir", gnupgHome, "--decrypt", encryptedPath)
+	output, err = command.Output()
+	require.NoError(t, err)
+	assert.Equal(t, "gpgenie GnuPG interoperability test\n", string(output))
+}
+
 func testCandidate(t *testing.T) Candidate {
 	t.Helper()
-	privateKey, template, err := generateCandidateKey()
+	return testCandidateFor(t, KeyKindSigningSubkey)
+}
+
+func testCandidateFor(t *testing.T, kind KeyKind) Candidate {
+	t.Helper()
+	privateKey, template, err := generateCandidateKeyFor(kind)
 	require.NoError(t, err)
 	timestamp := uint32(time.Now().Add(-time.Hour).Unix())
 	fingerprint, keyID, err := fingerprintAt(template, timestamp)
@@ -0,0 +1,87 @@
+package vanity
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/iyuangang/gpgenie/internal/metrics"
+)
+
+// searchRunner counts the attempts completed by one CPU worker or OpenCL
+// device.
+type searchRunner struct {
+	name     string
+	attempts atomic.Uint64
+}
+
+func totalAttempts(runners []*searchRunner) uint64 {
+	var total uint64
+	for _, runner := range runners {
+		total += runner.attempts.Load()
+	}
+	return total
+}
+
+// searchMetrics publishes search counters on a registry. Per-runner rates are
+// recomputed over each progress interval so a stalled runner drops to zero.
+type searchMetrics struct {
+	runners      []*searchRunner
+	rates        []*metrics.Gauge
+	rate         *metrics.Gauge
+	lastAttempts []uint64
+	lastObserved time.Time
+}
+
+func newSearchMetrics(registry *metrics.Registry, cfg SearchConfig, runners []*searchRunner, bestRun *atomic.Int32, satisfied *atomic.Uint64, startedAt time.Time) *searchMetrics {
+	if registry == nil {
+		return nil
+	}
+	registry.CounterFunc("gpgenie_vanity_attempts_total", "Vanity candidates evaluated, including resumed attempts.",
+		func() float64 { return float64(cfg.InitialAttempts + totalAttempts(runners)) })
+	registry.GaugeFunc("gpgenie_vanity_best_run", "Longest repeated-digit run found so far.",
+		func() float64 { return float64(bestRun.Load()) })
+	registry.GaugeFunc("gpgenie_vanity_target_run", "Repeated-digit run length the search stops at.",
+		func() float64 { return float64(cfg.MinRun) })
+	if len(cfg.Targets) > 0 {
+		registry.GaugeFunc("gpgenie_vanity_targets_satisfied", "Targets of a multi-target search satisfied so far.",
+			func() float64 { return float64(satisfiedCount(satisfied)) })
+	}
+
+	m := &searchMetrics{
+		runners:      runners,
+		rates:        make([]*metrics.Gauge, len(runners)),
+		rate:         registry.Gauge("gpgenie_vanity_attempts_per_second", "Vanity attempts per second over the last progress interval."),
+		lastAttempts: make([]uint64, len(runners)),
+		lastObserved: startedAt,
+	}
+	for i, runner := range runners {
+		label := metrics.Label{Name: "runner", Value: runner.name}
+		registry.CounterFunc("gpgenie_vanity_runner_attempts_total", "Vanity candidates evaluated by one runner.",
+			func() float64 { return float64(runner.attempts.Load()) }, label)
+		m.rates[i] = registry.Gauge("gpgenie_vanity_runner_attempts_per_second",
+			"Vanity attempts per second of one runner over the last progress interval.", label)
+	}
+	return m
+}
+
+// observe updates the rate gauges. It is called from the search coordinator
+// only.
+func (m *searchMetrics) observe(now time.Time) {
+	if m == nil {
+		return
+	}
+	seconds := now.Sub(m.lastObserved).Seconds()
+	if seconds <= 0 {
+		return
+	}
+	var total float64
+	for i, runner := range m.runners {
+		attempts := runner.attempts.Load()
+		rate := float64(attempts-m.lastAttempts[i]) / seconds
+		m.rates[i].Set(rate)
+		total += rate
+		m.lastAttempts[i] = attempts
+	}
+	m.rate.Set(total)
+	m.lastObserved = now
+}
@@ -0,0 +1,237 @@
+package vanity
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// patternAnchor marks the open end of a pattern shorter than a key ID.
+const patternAnchor = "..."
+
+// Pattern is a compiled key ID target. Fixed digits are checked with one
+// mask and value comparison; positions restricted to a digit class are then
+// checked one nibble each.
+type Pattern struct {
+	text    string
+	mask    uint64
+	value   uint64
+	classes []nibbleClass
+	// constrained counts the positions that are not wildcards and start is
+	// the first of them, zero-based from the most-significant digit.
+	constrained int
+	start       int
+}
+
+type nibbleClass struct {
+	shift  uint
+	digits DigitSet
+}
+
+// ParsePattern compiles a key ID pattern. A pattern is a sequence of
+// hexadecimal digits, '?' wildcards, and digit classes such as [0-3] or
+// [18F]. It describes all 16 digits of the key ID unless a leading "..."
+// anchors it to the end (...C0FFEE) or a trailing "..." anchors it to the
+// start (C0FFEE...). Digits are case-insensitive.
+func ParsePattern(value string) (*Pattern, error) {
+	body := strings.TrimSpace(value)
+	suffix := strings.HasPrefix(body, patternAnchor)
+	prefix := strings.HasSuffix(body, patternAnchor) && len(body) > len(patternAnchor)
+	switch {
+	case suffix && prefix:
+		return nil, fmt.Errorf("pattern %q must be anchored at one end only", value)
+	case suffix:
+		body = body[len(patternAnchor):]
+	case prefix:
+		body = body[:len(body)-len(patternAnchor)]
+	}
+
+	positions, err := parsePatternPositions(body)
+	if err != nil {
+		return nil, fmt.Errorf("pattern %q: %w", value, err)
+	}
+	if len(positions) == 0 {
+		return nil, fmt.Errorf("pattern %q is empty", value)
+	}
+	if len(positions) > 16 {
+		return nil, fmt.Errorf("pattern %q has %d digits; a key ID has 16", value, len(positions))
+	}
+	if !suffix && !prefix && len(positions) != 16 {
+		return nil, fmt.Errorf("pattern %q has %d digits; use ... to anchor a shorter pattern to the start or end", value, len(positions))
+	}
+
+	offset := 0
+	if suffix {
+		offset = 16 - len(positions)
+	}
+	pattern := &Pattern{start: -1}
+	var text strings.Builder
+	if suffix {
+		text.WriteString(patternAnchor)
+	}
+	for i, digits := range positions {
+		position := offset + i
+		shift := uint(15-position) * 4
+		switch {
+		case digits == AllDigits:
+			text.WriteByte('?')
+			continue
+		case digits&(digits-1) == 0:
+			digit := singleDigit(digits)
+			pattern.mask |= 0x0f << shift
+			pattern.value |= uint64(digit) << shift
+			text.WriteString(formatHexDigit(digit))
+		default:
+			pattern.classes = append(pattern.classes, nibbleClass{shift: shift, digits: digits})
+			text.WriteString("[" + digits.String() + "]")
+		}
+		pattern.constrained++
+		if pattern.start < 0 {
+			pattern.start = position
+		}
+	}
+	if prefix {
+		text.WriteString(patternAnchor)
+	}
+	if pattern.constrained == 0 {
+		return nil, fmt.Errorf("pattern %q matches every key ID", value)
+	}
+	pattern.text = text.String()
+	return pattern, nil
+}
+
+// parsePatternPositions returns the digits allowed at each position of body.
+func parsePatternPositions(body string) ([]DigitSet, error) {
+	var positions []DigitSet
+	for i := 0; i < len(body); i++ {
+		switch char := body[i]; {
+		case char == '?':
+			positions = append(positions, AllDigits)
+		case char == '[':
+			end := strings.IndexByte(body[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("digit class is not closed")
+			}
+			digits, err := parseDigitClass(body[i+1 : i+end])
+			if err != nil {
+				return nil, err
+			}
+			positions = append(positions, digits)
+			i += end
+		default:
+			digit, ok := hexDigitValue(char)
+			if !ok {
+				return nil, fmt.Errorf("unexpected %q; use hexadecimal digits, ?, or a digit class like [0-3]", char)
+			}
+			positions = append(positions, 1<<digit)
+		}
+	}
+	return positions, nil
+}
+
+// parseDigitClass parses the inside of a digit class: digits and ranges
+// such as 0-3.
+func parseDigitClass(class string) (DigitSet, error) {
+	var digits DigitSet
+	for i := 0; i < len(class); i++ {
+		low, ok := hexDigitValue(class[i])
+		if !ok {
+			return 0, fmt.Errorf("digit class [%s] must contain only hexadecimal digits and ranges", class)
+		}
+		high := low
+		if i+2 < len(class) && class[i+1] == '-' {
+			high, ok = hexDigitValue(class[i+2])
+			if !ok || high < low {
+				return 0, fmt.Errorf("digit class [%s] has an invalid range", class)
+			}
+			i += 2
+		}
+		for digit := low; digit <= high; digit++ {
+			digits |= 1 << digit
+		}
+	}
+	if digits == 0 {
+		return 0, fmt.Errorf("digit class must not be empty")
+	}
+	return digits, nil
+}
+
+func hexDigitValue(char byte) (byte, bool) {
+	switch {
+	case char >= '0' && char <= '9':
+		return char - '0', true
+	case char >= 'a' && char <= 'f':
+		return char - 'a' + 10, true
+	case char >= 'A' && char <= 'F':
+		return char - 'A' + 10, true
+	default:
+		return 0, false
+	}
+}
+
+func singleDigit(digits DigitSet) byte {
+	for digit := byte(0); digit < 16; digit++ {
+		if digits.Allows(digit) {
+			return digit
+		}
+	}
+	return 0
+}
+
+// String returns the canonical pattern: upper-case digits and sorted digit
+// classes, suitable for checkpoints and metadata.
+func (p *Pattern) String() string {
+	if p == nil {
+		return ""
+	}
+	return p.text
+}
+
+// Matches reports whether keyID satisfies the pattern.
+func (p *Pattern) Matches(keyID uint64) bool {
+	if keyID&p.mask != p.value {
+		return false
+	}
+	for _, class := range p.classes {
+		if !class.digits.Allows(byte(keyID >> class.shift & 0x0f)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Length returns the number of positions the pattern constrains. A match
+// reports it as its run length, so the search target is reached by any
+// match.
+func (p *Pattern) Length() int {
+	return p.constrained
+}
+
+// Evaluate returns the match of keyID, or a zero Match when it does not
+// satisfy the pattern.
+func (p *Pattern) Evaluate(keyID uint64) Match {
+	if !p.Matches(keyID) {
+		return Match{}
+	}
+	return Match{
+		RunLength: p.constrained,
+		Start:     p.start,
+		Digit:     byte(keyID >> (uint(15-p.start) * 4) & 0x0f),
+	}
+}
+
+// ExpectedAttempts returns the mean number of uniformly random key IDs
+// examined before one matches: the inverse of the match probability.
+func (p *Pattern) ExpectedAttempts() float64 {
+	fixed := 0
+	for mask := p.mask; mask != 0; mask >>= 4 {
+		if mask&0x0f != 0 {
+			fixed++
+		}
+	}
+	attempts := math.Pow(16, float64(fixed))
+	for _, class := range p.classes {
+		attempts *= 16 / float64(len(class.digits.String()))
+	}
+	return attempts
+}
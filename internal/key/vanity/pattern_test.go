@@ -0,0 +1,91 @@
+package vanity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		input     string
+		canonical string
+		length    int
+		start     int
+		expected  float64
+	}{
+		{input: "...c0ffee", canonical: "...C0FFEE", length: 6, start: 10, expected: 1 << 24},
+		{input: "C0FFEE...", canonical: "C0FFEE...", length: 6, start: 0, expected: 1 << 24},
+		{input: "DEAD????BEEF????", canonical: "DEAD????BEEF????", length: 8, start: 0, expected: 1 << 32},
+		{input: "...[01][0-3a]", canonical: "...[01][0123A]", length: 2, start: 14, expected: 8 * 16 / 5.0},
+		{input: "???[f]...", canonical: "???F...", length: 1, start: 3, expected: 16},
+		{input: "...[0-9a-f]7", canonical: "...?7", length: 1, start: 15, expected: 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			pattern, err := ParsePattern(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.canonical, pattern.String())
+			assert.Equal(t, tt.length, pattern.Length())
+			assert.Equal(t, tt.start, pattern.start)
+			assert.InDelta(t, tt.expected, pattern.ExpectedAttempts(), 1e-9)
+		})
+	}
+
+	for _, input := range []string{"", "...", "C0FFEE", "...C0FFEE...", "...C0G", "...[01", "...[]", "...[3-0]", "????????????????", "...0123456789ABCDEF0"} {
+		_, err := ParsePattern(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestPatternMatches(t *testing.T) {
+	suffix, err := ParsePattern("...C0FFEE")
+	require.NoError(t, err)
+	assert.True(t, suffix.Matches(0x123456789AC0FFEE))
+	assert.False(t, suffix.Matches(0x123456789AC0FFEF))
+	assert.Equal(t, Match{RunLength: 6, Start: 10, Digit: 0xC}, suffix.Evaluate(0x123456789AC0FFEE))
+	assert.Equal(t, Match{}, suffix.Evaluate(0xC0FFEE0000000000))
+
+	mask, err := ParsePattern("DEAD????BEEF????")
+	require.NoError(t, err)
+	assert.True(t, mask.Matches(0xDEAD1234BEEF5678))
+	assert.False(t, mask.Matches(0xDEAD1234BEEE5678))
+
+	classes, err := ParsePattern("[0-3]...")
+	require.NoError(t, err)
+	assert.True(t, classes.Matches(0x3FFFFFFFFFFFFFFF))
+	assert.False(t, classes.Matches(0x4000000000000000))
+	assert.InDelta(t, 4.0, classes.ExpectedAttempts(), 1e-9)
+}
+
+func TestSearchStopsOnPatternMatch(t *testing.T) {
+	pattern, err := ParsePattern("...[0-7]")
+	require.NoError(t, err)
+	now := uint32(time.Now().Unix())
+	result, err := Search(context.Background(), SearchConfig{
+		Workers:        1,
+		Scope:          ScopeSuffix,
+		Pattern:        pattern,
+		TimestampStart: now - 100,
+		TimestampEnd:   now,
+		MaxAttempts:    1000,
+	}, nil)
+
+	require.NoError(t, err)
+	require.NotNil(t, result.Candidate)
+	assert.True(t, result.TargetReached)
+	assert.True(t, pattern.Matches(result.Candidate.KeyID))
+	assert.Equal(t, 1, result.BestRun)
+
+	_, err = Search(context.Background(), SearchConfig{
+		Backend:        BackendOpenCL,
+		Scope:          ScopeSuffix,
+		Pattern:        pattern,
+		TimestampStart: now - 100,
+		TimestampEnd:   now,
+	}, nil)
+	assert.Error(t, err)
+}
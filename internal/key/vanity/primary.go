@@ -0,0 +1,198 @@
+package vanity
+
+import (
+	"crypto"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iyuangang/gpgenie/internal/key/domain"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// KeyKind names the key of the finalized keyring that carries the mined
+// fingerprint.
+type KeyKind string
+
+const (
+	// KeyKindSigningSubkey binds the mined key as a signing subkey of a
+	// fresh primary key. It is the default.
+	KeyKindSigningSubkey KeyKind = "signing-subkey"
+	// KeyKindPrimary uses the mined key as the primary key, which is the
+	// fingerprint gpg --list-keys and keyservers show.
+	KeyKindPrimary KeyKind = "primary"
+	// KeyKindEncryptionSubkey mines a Curve25519 ECDH key and binds it as
+	// the encryption subkey of a fresh primary key, whose key ID appears in
+	// the headers of messages encrypted to it.
+	KeyKindEncryptionSubkey KeyKind = "encryption-subkey"
+)
+
+func (k KeyKind) Validate() error {
+	switch k {
+	case KeyKindSigningSubkey, KeyKindPrimary, KeyKindEncryptionSubkey:
+		return nil
+	default:
+		return fmt.Errorf("target must be %q, %q, or %q", KeyKindSigningSubkey, KeyKindPrimary, KeyKindEncryptionSubkey)
+	}
+}
+
+// encryption reports whether candidates of the kind are Curve25519 ECDH
+// keys rather than Ed25519 keys.
+func (k KeyKind) encryption() bool {
+	return k == KeyKindEncryptionSubkey
+}
+
+// algorithm returns the algorithm label of the mined key.
+func (k KeyKind) algorithm() string {
+	if k.encryption() {
+		return domain.AlgorithmCv25519
+	}
+	return domain.AlgorithmEd25519
+}
+
+// KeyringOptions selects how a candidate is finalized. The subkey options
+// add freshly generated subkeys to a primary keyring.
+type KeyringOptions struct {
+	Kind             KeyKind
+	SigningSubkey    bool
+	EncryptionSubkey bool
+}
+
+func (o KeyringOptions) kind() KeyKind {
+	if o.Kind == "" {
+		return KeyKindSigningSubkey
+	}
+	return o.Kind
+}
+
+func (o KeyringOptions) Validate() error {
+	if err := o.kind().Validate(); err != nil {
+		return err
+	}
+	if o.kind() != KeyKindPrimary && (o.SigningSubkey || o.EncryptionSubkey) {
+		return fmt.Errorf("additional subkeys require the %s target", KeyKindPrimary)
+	}
+	return nil
+}
+
+// ParseAdditionalSubkeys parses a comma-separated list of the fresh subkeys
+// a primary keyring should carry: sign, encrypt, or both.
+func ParseAdditionalSubkeys(value string, options *KeyringOptions) error {
+	for _, part := range strings.FieldsFunc(value, func(char rune) bool { return char == ',' || char == ' ' }) {
+		switch strings.ToLower(part) {
+		case "sign":
+			options.SigningSubkey = true
+		case "encrypt":
+			options.EncryptionSubkey = true
+		default:
+			return fmt.Errorf("subkeys must be sign, encrypt, or both; got %q", part)
+		}
+	}
+	return nil
+}
+
+// BuildPrimaryKeyring uses the mined candidate as an Ed25519 primary key
+// created at the candidate timestamp, certifies identity with it, and adds
+// the fresh subkeys options asks for. The primary key signs unless a signing
+// subkey is added.
+func BuildPrimaryKeyring(identity Identity, candidate Candidate, options KeyringOptions) (*openpgp.Entity, error) {
+	if candidate.privateKey == nil {
+		return nil, fmt.Errorf("candidate private key is missing")
+	}
+	if identity.Name == "" || identity.Email == "" {
+		return nil, fmt.Errorf("name and email are required")
+	}
+
+	primaryCreatedAt := time.Unix(int64(candidate.Timestamp), 0).UTC()
+	primary := candidate.privateKey
+	primary.Version = 4
+	primary.CreationTime = primaryCreatedAt
+	primary.IsSubkey = false
+	primary.Fingerprint = append([]byte(nil), candidate.Fingerprint[:]...)
+	primary.KeyId = candidate.KeyID
+
+	verificationTemplate, err := newFingerprintTemplate(&primary.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	verifiedFingerprint, verifiedKeyID, err := fingerprintAt(verificationTemplate, candidate.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if verifiedFingerprint != candidate.Fingerprint || verifiedKeyID != candidate.KeyID {
+		return nil, fmt.Errorf("candidate fingerprint changed while constructing primary key")
+	}
+
+	bindingTime := time.Now().UTC().Truncate(time.Second)
+	if !bindingTime.After(primaryCreatedAt) {
+		bindingTime = primaryCreatedAt.Add(time.Second)
+	}
+	config := &packet.Config{
+		DefaultHash: crypto.SHA256,
+		Time:        func() time.Time { return bindingTime },
+		Algorithm:   packet.PubKeyAlgoEdDSA,
+	}
+	entity := &openpgp.Entity{
+		PrimaryKey: &primary.PublicKey,
+		PrivateKey: primary,
+		Identities: make(map[string]*openpgp.Identity),
+	}
+	if err := entity.AddUserId(identity.Name, identity.Comment, identity.Email, config); err != nil {
+		return nil, fmt.Errorf("certify primary identity: %w", err)
+	}
+	if options.SigningSubkey {
+		// Leave signing to the subkey, as GnuPG does for new keys.
+		for _, identity := range entity.Identities {
+			identity.SelfSignature.FlagSign = false
+			if err := identity.SelfSignature.SignUserId(identity.UserId.Id, entity.PrimaryKey, entity.PrivateKey, config); err != nil {
+				return nil, fmt.Errorf("restrict primary key to certification: %w", err)
+			}
+		}
+		if err := entity.AddSigningSubkey(config); err != nil {
+			return nil, fmt.Errorf("add signing subkey: %w", err)
+		}
+	}
+	if options.EncryptionSubkey {
+		if err := entity.AddEncryptionSubkey(config); err != nil {
+			return nil, fmt.Errorf("add encryption subkey: %w", err)
+		}
+	}
+	if err := ValidatePrimaryKeyring(entity, candidate.KeyID); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// ValidatePrimaryKeyring checks that primaryKeyID is the primary key, that
+// every identity and subkey binding verifies, and that the keyring signs.
+func ValidatePrimaryKeyring(entity *openpgp.Entity, primaryKeyID uint64) error {
+	if entity == nil || entity.PrimaryKey == nil {
+		return fmt.Errorf("keyring is incomplete")
+	}
+	if entity.PrimaryKey.KeyId != primaryKeyID {
+		return fmt.Errorf("unexpected primary key ID: got %016X, want %016X", entity.PrimaryKey.KeyId, primaryKeyID)
+	}
+	if len(entity.Identities) == 0 {
+		return fmt.Errorf("primary key has no identity")
+	}
+	for _, identity := range entity.Identities {
+		if identity.SelfSignature == nil {
+			return fmt.Errorf("primary identity is missing its self-signature")
+		}
+		if err := entity.PrimaryKey.VerifyUserIdSignature(identity.UserId.Id, entity.PrimaryKey, identity.SelfSignature); err != nil {
+			return fmt.Errorf("verify primary identity: %w", err)
+		}
+	}
+	signingKeyID := primaryKeyID
+	for _, subkey := range entity.Subkeys {
+		if err := entity.PrimaryKey.VerifyKeySignature(subkey.PublicKey, subkey.Sig); err != nil {
+			return fmt.Errorf("verify subkey %016X binding: %w", subkey.PublicKey.KeyId, err)
+		}
+		if subkey.Sig.FlagSign {
+			signingKeyID = subkey.PublicKey.KeyId
+		}
+	}
+	return verifySigningRoundTrip(entity, signingKeyID)
+}
@@ -0,0 +1,107 @@
+package vanity
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildPrimaryKeyringRoundTrips(t *testing.T) {
+	tests := []struct {
+		name    string
+		options KeyringOptions
+	}{
+		{name: "primary only", options: KeyringOptions{Kind: KeyKindPrimary}},
+		{name: "with subkeys", options: KeyringOptions{Kind: KeyKindPrimary, SigningSubkey: true, EncryptionSubkey: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidate := testCandidate(t)
+			entity, err := BuildPrimaryKeyring(Identity{Name: "Vanity Test", Email: "vanity@example.com"}, candidate, tt.options)
+			require.NoError(t, err)
+
+			var publicArmor bytes.Buffer
+			armorWriter, err := armor.Encode(&publicArmor, openpgp.PublicKeyType, nil)
+			require.NoError(t, err)
+			require.NoError(t, entity.Serialize(armorWriter))
+			require.NoError(t, armorWriter.Close())
+
+			parsed, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(publicArmor.Bytes()))
+			require.NoError(t, err)
+			require.Len(t, parsed, 1)
+			primary := parsed[0]
+			assert.Equal(t, candidate.KeyID, primary.PrimaryKey.KeyId)
+			assert.Equal(t, candidate.Fingerprint[:], primary.PrimaryKey.Fingerprint)
+			assert.Equal(t, int64(candidate.Timestamp), primary.PrimaryKey.CreationTime.Unix())
+			require.NoError(t, ValidatePrimaryKeyring(primary, candidate.KeyID))
+
+			identity := primary.PrimaryIdentity()
+			require.NotNil(t, identity)
+			assert.True(t, identity.SelfSignature.FlagCertify)
+			assert.Equal(t, !tt.options.SigningSubkey, identity.SelfSignature.FlagSign)
+			if tt.options.SigningSubkey {
+				require.Len(t, primary.Subkeys, 2)
+				assert.True(t, primary.Subkeys[0].Sig.FlagSign)
+				assert.True(t, primary.Subkeys[1].Sig.FlagEncryptCommunications)
+				_, ok := primary.EncryptionKey(primary.Subkeys[1].PublicKey.CreationTime)
+				assert.True(t, ok)
+			} else {
+				assert.Empty(t, primary.Subkeys)
+			}
+		})
+	}
+}
+
+func TestKeyringOptionsValidate(t *testing.T) {
+	assert.NoError(t, KeyringOptions{}.Validate())
+	assert.NoError(t, KeyringOptions{Kind: KeyKindPrimary, EncryptionSubkey: true}.Validate())
+	assert.Error(t, KeyringOptions{Kind: "master"}.Validate())
+	assert.Error(t, KeyringOptions{Kind: KeyKindSigningSubkey, SigningSubkey: true}.Validate())
+
+	var options KeyringOptions
+	require.NoError(t, ParseAdditionalSubkeys("sign, encrypt", &options))
+	assert.True(t, options.SigningSubkey)
+	assert.True(t, options.EncryptionSubkey)
+	assert.Error(t, ParseAdditionalSubkeys("certify", &options))
+}
+
+func TestGnuPGListsVanityPrimaryKey(t *testing.T) {
+	gpgPath := findGPG()
+	if gpgPath == "" {
+		t.Skip("GnuPG is not installed")
+	}
+
+	candidate := testCandidate(t)
+	entity, err := BuildPrimaryKeyring(Identity{Name: "Vanity GnuPG Test", Email: "vanity-gpg@example.com"}, candidate,
+		KeyringOptions{Kind: KeyKindPrimary, SigningSubkey: true, EncryptionSubkey: true})
+	require.NoError(t, err)
+
+	var publicArmor bytes.Buffer
+	armorWriter, err := armor.Encode(&publicArmor, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(armorWriter))
+	require.NoError(t, armorWriter.Close())
+	gnupgHome := filepath.Join(t.TempDir(), "gnupg")
+	require.NoError(t, os.MkdirAll(gnupgHome, 0o700))
+	publicPath := filepath.Join(t.TempDir(), "vanity-public.asc")
+	require.NoError(t, os.WriteFile(publicPath, publicArmor.Bytes(), 0o600))
+
+	command := exec.Command(gpgPath, "--batch", "--homedir", gnupgHome, "--import", publicPath)
+	output, err := command.CombinedOutput()
+	require.NoError(t, err, string(output))
+	command = exec.Command(gpgPath, "--batch", "--homedir", gnupgHome, "--with-colons", "--list-keys", candidate.FingerprintHex())
+	output, err = command.CombinedOutput()
+	require.NoError(t, err, string(output))
+	assert.Contains(t, string(output), "fpr:::::::::"+candidate.FingerprintHex()+":")
+	// The primary key only certifies; the subkeys sign and encrypt.
+	assert.Contains(t, string(output), ":cESC:")
+	assert.Contains(t, string(output), ":s:")
+	assert.Contains(t, string(output), ":e:")
+}
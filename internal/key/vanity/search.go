@@ -4,10 +4,13 @@ import (
 	"context"
 	"fmt"
 	"runtime"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/iyuangang/gpgenie/internal/metrics"
+
 	"github.com/ProtonMail/go-crypto/openpgp/packet"
 )
 
@@ -23,20 +26,40 @@ const (
 )
 
 type SearchConfig struct {
-	Backend          Backend
-	Workers          int
-	OpenCLDevices    []int
-	GPUKeyBatch      int
-	GPUWorkItems     uint64
-	MinRun           int
-	Scope            Scope
-	AllowedDigits    DigitSet
+	Backend       Backend
+	Workers       int
+	OpenCLDevices []int
+	GPUKeyBatch   int
+	GPUWorkItems  uint64
+	MinRun        int
+	Scope         Scope
+	AllowedDigits DigitSet
+	// Pattern, when set, replaces the repeated-run target: only key IDs
+	// that match it are candidates and MinRun is its length.
+	Pattern *Pattern
+	// Targets, when set, replaces MinRun, Scope, AllowedDigits, and Pattern:
+	// every key ID is checked against each unsatisfied target and the search
+	// stops once all of them are satisfied.
+	Targets []Target
+	// Collect, when positive, keeps searching after MinRun is reached until
+	// the attempt budget is spent, the search is cancelled, or Collect
+	// candidates have the longest run a key ID allows. It retains the Collect
+	// best distinct candidates that reach MinRun and every candidate tied
+	// with the last of them.
+	Collect int
+	// KeyKind selects the key material candidates are generated from:
+	// Curve25519 ECDH keys for KeyKindEncryptionSubkey, Ed25519 keys
+	// otherwise.
+	KeyKind          KeyKind
 	TimestampStart   uint32
 	TimestampEnd     uint32
 	MaxAttempts      uint64
 	InitialAttempts  uint64
 	InitialBestRun   int
 	ProgressInterval time.Duration
+	// Metrics, when set, receives attempt counters, per-runner rates, and the
+	// best run.
+	Metrics *metrics.Registry
 }
 
 type Candidate struct {
@@ -44,7 +67,10 @@ type Candidate struct {
 	KeyID       uint64
 	Timestamp   uint32
 	Match       Match
-	privateKey  *packet.PrivateKey
+	// Target is the index in SearchConfig.Targets of the target a
+	// multi-target hit satisfies.
+	Target     int
+	privateKey *packet.PrivateKey
 }
 
 func (c Candidate) FingerprintHex() string {
@@ -67,6 +93,9 @@ type Progress struct {
 	Elapsed     time.Duration
 	Rate        float64
 	Final       bool
+	// TargetsSatisfied counts the targets of a multi-target search satisfied
+	// in this run.
+	TargetsSatisfied int
 }
 
 type SearchResult struct {
@@ -77,6 +106,14 @@ type SearchResult struct {
 	Elapsed       time.Duration
 	Rate          float64
 	TargetReached bool
+	// Hits holds one candidate per target a multi-target search satisfied,
+	// in the order they were found.
+	Hits []Candidate
+	// Collected holds the candidates a collecting search retained, longest
+	// run first; among equal runs the first found comes first. Ties with the
+	// last place are all kept, so it may hold more than Collect. Candidate is
+	// the first of them.
+	Collected []Candidate
 }
 
 type ProgressFunc func(Progress)
@@ -100,11 +137,47 @@ func (c SearchConfig) validate() error {
 	if c.GPUWorkItems > maxGPUWorkItems {
 		return fmt.Errorf("GPU work items must not exceed %d", maxGPUWorkItems)
 	}
-	if c.MinRun < 1 || c.MinRun > 16 {
-		return fmt.Errorf("min run must be between 1 and 16")
+	if len(c.Targets) > 0 {
+		if len(c.Targets) > MaxTargets {
+			return fmt.Errorf("at most %d targets are supported", MaxTargets)
+		}
+		if c.Backend != BackendCPU {
+			return fmt.Errorf("multi-target searches are only supported by the %s backend", BackendCPU)
+		}
+		for _, target := range c.Targets {
+			if err := target.validate(); err != nil {
+				return fmt.Errorf("target %q: %w", target.Name, err)
+			}
+		}
+	} else {
+		if c.MinRun < 1 || c.MinRun > 16 {
+			return fmt.Errorf("min run must be between 1 and 16")
+		}
+		if err := c.Scope.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Collect < 0 {
+		return fmt.Errorf("collect must not be negative")
 	}
-	if err := c.Scope.Validate(); err != nil {
-		return err
+	if c.Collect > 0 && len(c.Targets) > 0 {
+		return fmt.Errorf("collect cannot be combined with targets")
+	}
+	if c.Collect > 0 && c.Backend != BackendCPU {
+		return fmt.Errorf("collecting searches are only supported by the %s backend", BackendCPU)
+	}
+	if c.Pattern != nil && c.Backend != BackendCPU {
+		return fmt.Errorf("pattern targets are only supported by the %s backend", BackendCPU)
+	}
+	if c.KeyKind != "" {
+		if err := c.KeyKind.Validate(); err != nil {
+			return err
+		}
+	}
+	// The OpenCL kernel hashes Ed25519 material in one SHA-1 block; ECDH
+	// material is longer.
+	if c.KeyKind.encryption() && c.Backend != BackendCPU {
+		return fmt.Errorf("encryption subkey searches are only supported by the %s backend", BackendCPU)
 	}
 	if c.TimestampStart > c.TimestampEnd {
 		return fmt.Errorf("timestamp start must not be after timestamp end")
@@ -125,6 +198,9 @@ func Search(ctx context.Context, cfg SearchConfig, progressFn ProgressFunc) (*Se
 	if cfg.AllowedDigits == 0 {
 		cfg.AllowedDigits = AllDigits
 	}
+	if cfg.Pattern != nil {
+		cfg.MinRun = cfg.Pattern.Length()
+	}
 	if err := cfg.validate(); err != nil {
 		return nil, err
 	}
@@ -138,10 +214,20 @@ func Search(ctx context.Context, cfg SearchConfig, progressFn ProgressFunc) (*Se
 	searchCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	var completed atomic.Uint64
+	var runners []*searchRunner
 	var reserved atomic.Uint64
 	var bestRun atomic.Int32
 	bestRun.Store(int32(cfg.InitialBestRun))
+	var satisfied atomic.Uint64
+	// collectFloor is the shortest run a collecting search still retains.
+	var collectFloor atomic.Int32
+	collectFloor.Store(int32(cfg.MinRun))
+	// A collecting search ends once every retained run is as long as a key
+	// ID allows, since nothing better can be found.
+	longestRun := 16
+	if cfg.Pattern != nil {
+		longestRun = cfg.Pattern.Length()
+	}
 
 	runnerCount := 0
 	if effectiveBackend == BackendCPU || effectiveBackend == BackendHybrid {
@@ -153,11 +239,13 @@ func Search(ctx context.Context, cfg SearchConfig, progressFn ProgressFunc) (*Se
 	candidates := make(chan Candidate, max(2, runnerCount*2))
 	errorsCh := make(chan error, 1)
 	var workers sync.WaitGroup
-	startRunner := func(name string, run func() error) {
+	startRunner := func(name string, run func(completed *atomic.Uint64) error) {
+		runner := &searchRunner{name: name}
+		runners = append(runners, runner)
 		workers.Add(1)
 		go func() {
 			defer workers.Done()
-			if err := run(); err != nil {
+			if err := run(&runner.attempts); err != nil {
 				select {
 				case errorsCh <- fmt.Errorf("%s: %w", name, err):
 				default:
@@ -169,16 +257,16 @@ func Search(ctx context.Context, cfg SearchConfig, progressFn ProgressFunc) (*Se
 	if effectiveBackend == BackendCPU || effectiveBackend == BackendHybrid {
 		for workerID := 0; workerID < cfg.Workers; workerID++ {
 			id := workerID
-			startRunner(fmt.Sprintf("CPU worker %d", id), func() error {
-				return searchWorker(searchCtx, cfg, &completed, &reserved, &bestRun, candidates)
+			startRunner(fmt.Sprintf("CPU worker %d", id), func(completed *atomic.Uint64) error {
+				return searchWorker(searchCtx, cfg, completed, &reserved, &bestRun, &satisfied, &collectFloor, candidates)
 			})
 		}
 	}
 	if effectiveBackend == BackendOpenCL || effectiveBackend == BackendHybrid {
 		for _, device := range openCLDevices {
 			device := device
-			startRunner(fmt.Sprintf("OpenCL device %d (%s)", device.Info.Index, device.Info.Name), func() error {
-				return searchOpenCLWorker(searchCtx, cfg, device, &completed, &reserved, &bestRun, candidates)
+			startRunner(fmt.Sprintf("OpenCL device %d (%s)", device.Info.Index, device.Info.Name), func(completed *atomic.Uint64) error {
+				return searchOpenCLWorker(searchCtx, cfg, device, completed, &reserved, &bestRun, candidates)
 			})
 		}
 	}
@@ -193,14 +281,17 @@ func Search(ctx context.Context, cfg SearchConfig, progressFn ProgressFunc) (*Se
 	}
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	searchMetrics := newSearchMetrics(cfg.Metrics, cfg, runners, &bestRun, &satisfied, startedAt)
 
 	var best *Candidate
+	var hits []Candidate
+	var collected []Candidate
 	var firstErr error
 	emitProgress := func(final bool) {
 		if progressFn == nil {
 			return
 		}
-		runAttempts := completed.Load()
+		runAttempts := totalAttempts(runners)
 		elapsed := time.Since(startedAt)
 		rate := 0.0
 		if elapsed > 0 {
@@ -211,13 +302,14 @@ func Search(ctx context.Context, cfg SearchConfig, progressFn ProgressFunc) (*Se
 			keyID = best.KeyIDHex()
 		}
 		progressFn(Progress{
-			Attempts:    cfg.InitialAttempts + runAttempts,
-			RunAttempts: runAttempts,
-			BestRun:     int(bestRun.Load()),
-			BestKeyID:   keyID,
-			Elapsed:     elapsed,
-			Rate:        rate,
-			Final:       final,
+			Attempts:         cfg.InitialAttempts + runAttempts,
+			RunAttempts:      runAttempts,
+			BestRun:          int(bestRun.Load()),
+			BestKeyID:        keyID,
+			Elapsed:          elapsed,
+			Rate:             rate,
+			Final:            final,
+			TargetsSatisfied: satisfiedCount(&satisfied),
 		})
 	}
 
@@ -226,7 +318,7 @@ func Search(ctx context.Context, cfg SearchConfig, progressFn ProgressFunc) (*Se
 		case candidate, ok := <-candidates:
 			if !ok {
 				emitProgress(true)
-				runAttempts := completed.Load()
+				runAttempts := totalAttempts(runners)
 				elapsed := time.Since(startedAt)
 				rate := 0.0
 				if elapsed > 0 {
@@ -240,8 +332,15 @@ func Search(ctx context.Context, cfg SearchConfig, progressFn ProgressFunc) (*Se
 					Elapsed:       elapsed,
 					Rate:          rate,
 					TargetReached: best != nil && best.Match.RunLength >= cfg.MinRun,
+					Hits:          hits,
+					Collected:     collected,
 				}
-				if best != nil && best.Match.RunLength != result.BestRun {
+				if len(cfg.Targets) > 0 {
+					result.TargetReached = len(hits) == len(cfg.Targets)
+				}
+				// A collecting search retains runs shorter than a resumed best,
+				// so only other searches keep the two aligned.
+				if cfg.Collect == 0 && best != nil && best.Match.RunLength != result.BestRun {
 					return result, fmt.Errorf("best candidate run %d does not match promoted run %d", best.Match.RunLength, result.BestRun)
 				}
 				if firstErr != nil {
@@ -252,6 +351,25 @@ func Search(ctx context.Context, cfg SearchConfig, progressFn ProgressFunc) (*Se
 				}
 				return result, nil
 			}
+			if len(cfg.Targets) > 0 {
+				hits = append(hits, candidate)
+				if len(hits) == len(cfg.Targets) {
+					cancel()
+				}
+				continue
+			}
+			if cfg.Collect > 0 {
+				collected = collectCandidate(collected, candidate, cfg.Collect)
+				best = &collected[0]
+				if len(collected) >= cfg.Collect {
+					floor := collected[cfg.Collect-1].Match.RunLength
+					collectFloor.Store(int32(floor))
+					if floor >= longestRun {
+						cancel()
+					}
+				}
+				continue
+			}
 			if best == nil || candidate.Match.RunLength > best.Match.RunLength {
 				copyCandidate := candidate
 				best = &copyCandidate
@@ -264,6 +382,7 @@ func Search(ctx context.Context, cfg SearchConfig, progressFn ProgressFunc) (*Se
 				firstErr = err
 			}
 		case <-ticker.C:
+			searchMetrics.observe(time.Now())
 			emitProgress(false)
 		}
 	}
@@ -275,14 +394,17 @@ func searchWorker(
 	completed *atomic.Uint64,
 	reserved *atomic.Uint64,
 	bestRun *atomic.Int32,
+	satisfied *atomic.Uint64,
+	collectFloor *atomic.Int32,
 	output chan<- Candidate,
 ) error {
+keys:
 	for {
 		if err := ctx.Err(); err != nil {
 			return nil
 		}
 
-		privateKey, template, err := generateCandidateKey()
+		privateKey, template, err := generateCandidateKeyFor(cfg.KeyKind)
 		if err != nil {
 			return err
 		}
@@ -317,7 +439,54 @@ func searchWorker(
 					completed.Add(processed)
 					return err
 				}
-				match := EvaluateKeyIDForDigits(keyID, cfg.Scope, cfg.AllowedDigits)
+				if len(cfg.Targets) > 0 {
+					target, match := claimTarget(cfg.Targets, satisfied, keyID)
+					if target < 0 {
+						processed++
+						continue
+					}
+					output <- Candidate{
+						Fingerprint: fingerprint,
+						KeyID:       keyID,
+						Timestamp:   timestamp,
+						Match:       match,
+						Target:      target,
+						privateKey:  privateKey,
+					}
+					completed.Add(processed + 1)
+					releaseAttempts(reserved, cfg.MaxAttempts, claimed-processed-1)
+					if satisfiedCount(satisfied) == len(cfg.Targets) {
+						return nil
+					}
+					// Different timestamps of one key share its secret, so each
+					// key satisfies one target at most.
+					continue keys
+				}
+				var match Match
+				if cfg.Pattern != nil {
+					match = cfg.Pattern.Evaluate(keyID)
+				} else {
+					match = EvaluateKeyIDForDigits(keyID, cfg.Scope, cfg.AllowedDigits)
+				}
+				if cfg.Collect > 0 {
+					if match.RunLength < cfg.MinRun || int32(match.RunLength) < collectFloor.Load() {
+						processed++
+						continue
+					}
+					promoteBest(bestRun, match.RunLength)
+					output <- Candidate{
+						Fingerprint: fingerprint,
+						KeyID:       keyID,
+						Timestamp:   timestamp,
+						Match:       match,
+						privateKey:  privateKey,
+					}
+					completed.Add(processed + 1)
+					releaseAttempts(reserved, cfg.MaxAttempts, claimed-processed-1)
+					// Collected keys may be handed to different people, so each
+					// key contributes one candidate at most.
+					continue keys
+				}
 				if promoteBest(bestRun, match.RunLength) {
 					candidate := Candidate{
 						Fingerprint: fingerprint,
@@ -343,6 +512,37 @@ func searchWorker(
 	}
 }
 
+// collectCandidate inserts candidate into collected, which is ordered by run
+// length with ties in the order found, and keeps the limit best distinct key
+// IDs together with every later one tied with the last of them.
+func collectCandidate(collected []Candidate, candidate Candidate, limit int) []Candidate {
+	for _, existing := range collected {
+		if existing.KeyID == candidate.KeyID {
+			return collected
+		}
+	}
+	if len(collected) >= limit && candidate.Match.RunLength < collected[limit-1].Match.RunLength {
+		return collected
+	}
+	position := len(collected)
+	for i, existing := range collected {
+		if candidate.Match.RunLength > existing.Match.RunLength {
+			position = i
+			break
+		}
+	}
+	collected = slices.Insert(collected, position, candidate)
+	if len(collected) > limit {
+		floor := collected[limit-1].Match.RunLength
+		end := limit
+		for end < len(collected) && collected[end].Match.RunLength == floor {
+			end++
+		}
+		collected = collected[:end]
+	}
+	return collected
+}
+
 func claimAttempts(reserved *atomic.Uint64, maximum, requested uint64) uint64 {
 	if maximum == 0 {
 		return requested
@@ -359,6 +559,14 @@ func claimAttempts(reserved *atomic.Uint64, maximum, requested uint64) uint64 {
 	}
 }
 
+// releaseAttempts returns claimed attempts a worker will not make to the
+// budget.
+func releaseAttempts(reserved *atomic.Uint64, maximum, unused uint64) {
+	if maximum != 0 && unused != 0 {
+		reserved.Add(-unused)
+	}
+}
+
 func promoteBest(best *atomic.Int32, candidate int) bool {
 	for {
 		current := best.Load()
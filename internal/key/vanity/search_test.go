@@ -1,10 +1,15 @@
 package vanity
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/iyuangang/gpgenie/internal/metrics"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -28,6 +33,29 @@ func TestSearchStopsWhenTargetReached(t *testing.T) {
 	assert.GreaterOrEqual(t, result.RunAttempts, uint64(1))
 }
 
+func TestSearchMinesEncryptionCandidates(t *testing.T) {
+	now := uint32(time.Now().Unix())
+	cfg := SearchConfig{
+		Workers:        1,
+		MinRun:         1,
+		Scope:          ScopeSuffix,
+		KeyKind:        KeyKindEncryptionSubkey,
+		TimestampStart: now - 10,
+		TimestampEnd:   now,
+		MaxAttempts:    100,
+	}
+	result, err := Search(context.Background(), cfg, nil)
+
+	require.NoError(t, err)
+	require.NotNil(t, result.Candidate)
+	assert.True(t, result.TargetReached)
+	assert.Equal(t, packet.PubKeyAlgoECDH, result.Candidate.privateKey.PubKeyAlgo)
+
+	cfg.Backend = BackendOpenCL
+	_, err = Search(context.Background(), cfg, nil)
+	assert.ErrorContains(t, err, "encryption subkey")
+}
+
 func TestSearchHonorsAttemptBudget(t *testing.T) {
 	now := uint32(time.Now().Unix())
 	result, err := Search(context.Background(), SearchConfig{
@@ -47,6 +75,33 @@ func TestSearchHonorsAttemptBudget(t *testing.T) {
 	}
 }
 
+func TestSearchPublishesMetrics(t *testing.T) {
+	now := uint32(time.Now().Unix())
+	registry := metrics.NewRegistry()
+	result, err := Search(context.Background(), SearchConfig{
+		Workers:          2,
+		MinRun:           16,
+		Scope:            ScopeSuffix,
+		TimestampStart:   now - 100,
+		TimestampEnd:     now,
+		MaxAttempts:      1000,
+		InitialAttempts:  500,
+		ProgressInterval: time.Millisecond,
+		Metrics:          registry,
+	}, nil)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	_, err = registry.WriteTo(&out)
+	require.NoError(t, err)
+	text := out.String()
+	assert.Contains(t, text, "gpgenie_vanity_attempts_total 1500\n")
+	assert.Contains(t, text, fmt.Sprintf("gpgenie_vanity_best_run %d\n", result.BestRun))
+	assert.Contains(t, text, "gpgenie_vanity_target_run 16\n")
+	assert.Contains(t, text, `gpgenie_vanity_runner_attempts_total{runner="CPU worker 0"}`)
+	assert.Contains(t, text, `gpgenie_vanity_runner_attempts_per_second{runner="CPU worker 1"}`)
+}
+
 func TestSearchRetainsEveryPromotedCandidateDuringConcurrentCancellation(t *testing.T) {
 	now := uint32(time.Now().Unix())
 	for i := 0; i < 10; i++ {
@@ -118,3 +173,100 @@ func BenchmarkSearchTenMillionCandidates(b *testing.B) {
 		}
 	}
 }
+
+func TestCollectCandidateKeepsBestDistinct(t *testing.T) {
+	candidate := func(keyID uint64, run int) Candidate {
+		return Candidate{KeyID: keyID, Match: Match{RunLength: run}}
+	}
+	var collected []Candidate
+	for _, c := range []Candidate{
+		candidate(1, 3), candidate(2, 5), candidate(3, 3), candidate(2, 5), candidate(4, 4), candidate(5, 3),
+	} {
+		collected = collectCandidate(collected, c, 3)
+	}
+
+	keyIDs := func() []uint64 {
+		ids := make([]uint64, len(collected))
+		for i, c := range collected {
+			ids[i] = c.KeyID
+		}
+		return ids
+	}
+	// The duplicate key ID is ignored and the later ties with the third run
+	// are kept after the earlier one.
+	assert.Equal(t, []uint64{2, 4, 1, 3, 5}, keyIDs())
+
+	// A longer run raises the third run to 4 and drops the ties at 3.
+	collected = collectCandidate(collected, candidate(6, 6), 3)
+	assert.Equal(t, []uint64{6, 2, 4}, keyIDs())
+	collected = collectCandidate(collected, candidate(7, 3), 3)
+	collected = collectCandidate(collected, candidate(8, 4), 3)
+	assert.Equal(t, []uint64{6, 2, 4, 8}, keyIDs())
+}
+
+func TestSearchCollectEndsWhenNothingBetterCanBeFound(t *testing.T) {
+	// Every match of a pattern has its full length, so once two are
+	// collected the search has nothing left to improve and stops on its
+	// own despite the unlimited budget.
+	pattern, err := ParsePattern("...[0-7]")
+	require.NoError(t, err)
+	now := uint32(time.Now().Unix())
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	result, err := Search(ctx, SearchConfig{
+		Workers:        2,
+		Scope:          ScopeSuffix,
+		Pattern:        pattern,
+		Collect:        2,
+		TimestampStart: now - 100,
+		TimestampEnd:   now,
+	}, nil)
+
+	require.NoError(t, err)
+	require.NoError(t, ctx.Err(), "the search stops by itself")
+	assert.True(t, result.TargetReached)
+	assert.GreaterOrEqual(t, len(result.Collected), 2)
+	for _, candidate := range result.Collected {
+		assert.Equal(t, 1, candidate.Match.RunLength)
+	}
+}
+
+func TestSearchCollectsPastTarget(t *testing.T) {
+	now := uint32(time.Now().Unix())
+	result, err := Search(context.Background(), SearchConfig{
+		Workers:        2,
+		MinRun:         1,
+		Scope:          ScopeSuffix,
+		Collect:        4,
+		TimestampStart: now - 100,
+		TimestampEnd:   now,
+		MaxAttempts:    50000,
+	}, nil)
+
+	require.NoError(t, err)
+	assert.True(t, result.TargetReached)
+	require.GreaterOrEqual(t, len(result.Collected), 4)
+	assert.Equal(t, result.Collected[0], *result.Candidate)
+	keys := make(map[any]bool)
+	for i, candidate := range result.Collected {
+		assert.False(t, keys[candidate.privateKey], "each key is collected once")
+		keys[candidate.privateKey] = true
+		if i > 0 {
+			assert.LessOrEqual(t, candidate.Match.RunLength, result.Collected[i-1].Match.RunLength)
+		}
+		if i >= 4 {
+			assert.Equal(t, result.Collected[3].Match.RunLength, candidate.Match.RunLength, "only ties with the fourth run are kept past it")
+		}
+	}
+	assert.Greater(t, result.RunAttempts, uint64(4), "the search continues past the first match")
+
+	_, err = Search(context.Background(), SearchConfig{
+		Workers:        1,
+		MinRun:         1,
+		Scope:          ScopeSuffix,
+		Collect:        -1,
+		TimestampStart: now,
+		TimestampEnd:   now,
+	}, nil)
+	assert.Error(t, err)
+}
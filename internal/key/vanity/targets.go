@@ -0,0 +1,180 @@
+package vanity
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"os"
+	"regexp"
+	"sync/atomic"
+)
+
+// MaxTargets bounds a multi-target search so the satisfied targets fit in one
+// atomic bit mask.
+const MaxTargets = 64
+
+var targetNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Target is one entry of a multi-target search: either repeated-run criteria
+// or a pattern, and the identity its keyring is built for.
+type Target struct {
+	Name          string
+	MinRun        int
+	Scope         Scope
+	AllowedDigits DigitSet
+	Pattern       *Pattern
+	Identity      Identity
+}
+
+// targetSpec is the targets file form of a Target.
+type targetSpec struct {
+	Name     string   `json:"name"`
+	Pattern  string   `json:"pattern,omitempty"`
+	MinRun   int      `json:"min_run,omitempty"`
+	Scope    Scope    `json:"scope,omitempty"`
+	Digits   string   `json:"digits,omitempty"`
+	Identity Identity `json:"identity"`
+}
+
+// LoadTargets reads a targets file: a JSON object whose "targets" array lists
+// each target's name, either a pattern or min_run with optional scope and
+// digits, and an optional identity. Identity fields left empty are filled in
+// from defaults.
+func LoadTargets(path string, defaults Identity) ([]Target, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read vanity targets: %w", err)
+	}
+	var file struct {
+		Targets []targetSpec `json:"targets"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse vanity targets: %w", err)
+	}
+	if len(file.Targets) == 0 {
+		return nil, fmt.Errorf("vanity targets file %s lists no targets", path)
+	}
+	if len(file.Targets) > MaxTargets {
+		return nil, fmt.Errorf("vanity targets file lists %d targets; at most %d are supported", len(file.Targets), MaxTargets)
+	}
+
+	targets := make([]Target, 0, len(file.Targets))
+	seen := make(map[string]bool, len(file.Targets))
+	for _, spec := range file.Targets {
+		target, err := spec.target(defaults)
+		if err != nil {
+			return nil, err
+		}
+		if seen[target.Name] {
+			return nil, fmt.Errorf("vanity target %q is listed more than once", target.Name)
+		}
+		seen[target.Name] = true
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func (s targetSpec) target(defaults Identity) (Target, error) {
+	if !targetNamePattern.MatchString(s.Name) {
+		return Target{}, fmt.Errorf("vanity target name %q must be letters, digits, '.', '_', or '-'", s.Name)
+	}
+	target := Target{Name: s.Name, Identity: s.Identity}
+	if target.Identity.Name == "" {
+		target.Identity.Name = defaults.Name
+	}
+	if target.Identity.Comment == "" {
+		target.Identity.Comment = defaults.Comment
+	}
+	if target.Identity.Email == "" {
+		target.Identity.Email = defaults.Email
+	}
+	if target.Identity.Name == "" || target.Identity.Email == "" {
+		return Target{}, fmt.Errorf("vanity target %q needs an identity name and email", s.Name)
+	}
+
+	if s.Pattern != "" {
+		if s.MinRun != 0 || s.Scope != "" || s.Digits != "" {
+			return Target{}, fmt.Errorf("vanity target %q cannot combine a pattern with min_run, scope, or digits", s.Name)
+		}
+		pattern, err := ParsePattern(s.Pattern)
+		if err != nil {
+			return Target{}, fmt.Errorf("vanity target %q: %w", s.Name, err)
+		}
+		target.Pattern = pattern
+		target.MinRun = pattern.Length()
+		target.Scope = ScopeSuffix
+		target.AllowedDigits = AllDigits
+		return target, nil
+	}
+
+	target.MinRun = s.MinRun
+	target.Scope = s.Scope
+	if target.Scope == "" {
+		target.Scope = ScopeSuffix
+	}
+	target.AllowedDigits = AllDigits
+	if s.Digits != "" {
+		digits, err := ParseDigits(s.Digits)
+		if err != nil {
+			return Target{}, fmt.Errorf("vanity target %q: %w", s.Name, err)
+		}
+		target.AllowedDigits = digits
+	}
+	if err := target.validate(); err != nil {
+		return Target{}, fmt.Errorf("vanity target %q: %w", s.Name, err)
+	}
+	return target, nil
+}
+
+func (t Target) validate() error {
+	if t.MinRun < 1 || t.MinRun > 16 {
+		return fmt.Errorf("min run must be between 1 and 16")
+	}
+	return t.Scope.Validate()
+}
+
+// Criteria describes what the target matches, for checkpoints and output.
+func (t Target) Criteria() string {
+	if t.Pattern != nil {
+		return "pattern=" + t.Pattern.String()
+	}
+	return fmt.Sprintf("scope=%s digits=%s min_run=%d", t.Scope, t.AllowedDigits.String(), t.MinRun)
+}
+
+// Evaluate returns the match of keyID against the target. The target is
+// satisfied when the run length reaches MinRun.
+func (t Target) Evaluate(keyID uint64) Match {
+	if t.Pattern != nil {
+		return t.Pattern.Evaluate(keyID)
+	}
+	return EvaluateKeyIDForDigits(keyID, t.Scope, t.AllowedDigits)
+}
+
+// claimTarget returns the index of the first unsatisfied target keyID
+// satisfies and marks it satisfied, or -1. One key ID is claimed by one
+// target at most, so no two targets share a key.
+func claimTarget(targets []Target, satisfied *atomic.Uint64, keyID uint64) (int, Match) {
+	for {
+		current := satisfied.Load()
+		index, match := -1, Match{}
+		for i := range targets {
+			if current&(1<<i) != 0 {
+				continue
+			}
+			if m := targets[i].Evaluate(keyID); m.RunLength >= targets[i].MinRun {
+				index, match = i, m
+				break
+			}
+		}
+		if index < 0 {
+			return -1, Match{}
+		}
+		if satisfied.CompareAndSwap(current, current|1<<index) {
+			return index, match
+		}
+	}
+}
+
+func satisfiedCount(satisfied *atomic.Uint64) int {
+	return bits.OnesCount64(satisfied.Load())
+}
@@ -0,0 +1,85 @@
+package vanity
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTargets(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "targets.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadTargets(t *testing.T) {
+	path := writeTargets(t, `{"targets": [
+		{"name": "coffee", "pattern": "...c0ffee", "identity": {"name": "Alice", "email": "alice@example.com"}},
+		{"name": "ops", "min_run": 9, "digits": "180"},
+		{"name": "any-run", "min_run": 10, "scope": "any"}
+	]}`)
+	targets, err := LoadTargets(path, Identity{Name: "Team", Comment: "vanity", Email: "team@example.com"})
+	require.NoError(t, err)
+	require.Len(t, targets, 3)
+
+	assert.Equal(t, "pattern=...C0FFEE", targets[0].Criteria())
+	assert.Equal(t, 6, targets[0].MinRun)
+	assert.Equal(t, Identity{Name: "Alice", Comment: "vanity", Email: "alice@example.com"}, targets[0].Identity)
+
+	assert.Equal(t, "scope=suffix digits=018 min_run=9", targets[1].Criteria())
+	assert.Equal(t, Identity{Name: "Team", Comment: "vanity", Email: "team@example.com"}, targets[1].Identity)
+	assert.Equal(t, ScopeAny, targets[2].Scope)
+	assert.Equal(t, AllDigits, targets[2].AllowedDigits)
+
+	for _, content := range []string{
+		`{"targets": []}`,
+		`{"targets": [{"name": "bad/name", "min_run": 4}]}`,
+		`{"targets": [{"name": "a", "min_run": 4}, {"name": "a", "min_run": 5}]}`,
+		`{"targets": [{"name": "a", "min_run": 17}]}`,
+		`{"targets": [{"name": "a", "pattern": "...1", "min_run": 4}]}`,
+		`{"targets": [{"name": "a", "min_run": 4, "scope": "prefix"}]}`,
+	} {
+		_, err := LoadTargets(writeTargets(t, content), Identity{Name: "Team", Email: "team@example.com"})
+		assert.Error(t, err, content)
+	}
+	_, err = LoadTargets(writeTargets(t, `{"targets": [{"name": "a", "min_run": 4}]}`), Identity{})
+	assert.Error(t, err, "identity is required")
+}
+
+func TestSearchSatisfiesEveryTarget(t *testing.T) {
+	low, err := ParsePattern("...[0-7]")
+	require.NoError(t, err)
+	targets := []Target{
+		{Name: "low", MinRun: 1, Scope: ScopeSuffix, AllowedDigits: AllDigits, Pattern: low},
+		{Name: "high", MinRun: 1, Scope: ScopeSuffix, AllowedDigits: 0xff00},
+		{Name: "any", MinRun: 1, Scope: ScopeAny, AllowedDigits: AllDigits},
+	}
+	now := uint32(time.Now().Unix())
+	result, err := Search(context.Background(), SearchConfig{
+		Workers:        2,
+		Targets:        targets,
+		TimestampStart: now - 100,
+		TimestampEnd:   now,
+		MaxAttempts:    100000,
+	}, nil)
+
+	require.NoError(t, err)
+	assert.True(t, result.TargetReached)
+	require.Len(t, result.Hits, len(targets))
+	seen := make(map[int]bool)
+	keys := make(map[any]bool)
+	for _, hit := range result.Hits {
+		assert.False(t, seen[hit.Target], "each target is satisfied once")
+		seen[hit.Target] = true
+		assert.False(t, keys[hit.privateKey], "no two targets share a key")
+		keys[hit.privateKey] = true
+		target := targets[hit.Target]
+		assert.GreaterOrEqual(t, target.Evaluate(hit.KeyID).RunLength, target.MinRun)
+	}
+}
@@ -0,0 +1,342 @@
+// Package metrics is a small registry of counters, gauges, and histograms
+// exposed in the Prometheus text exposition format.
+//
+// A nil *Registry is valid: it hands out nil metrics, and every method of a
+// nil metric is a no-op, so instrumented code does not need to check whether
+// metrics are enabled.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// Label is one name="value" pair attached to a series.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Registry holds metric families keyed by name. Requesting an existing series
+// returns the registered metric, so callers may look metrics up repeatedly.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+type family struct {
+	name   string
+	help   string
+	kind   string
+	series map[string]*series
+}
+
+type series struct {
+	labels    string
+	counter   *Counter
+	gauge     *Gauge
+	histogram *Histogram
+	fn        func() float64
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Counter returns the counter for name and labels, registering it if needed.
+func (r *Registry) Counter(name, help string, labels ...Label) *Counter {
+	if r == nil {
+		return nil
+	}
+	return r.series(name, help, typeCounter, labels, func(s *series) {
+		if s.counter == nil {
+			s.counter = &Counter{}
+		}
+	}).counter
+}
+
+// CounterFunc registers a counter whose value is read from fn at scrape time.
+// Registering the same series again replaces fn.
+func (r *Registry) CounterFunc(name, help string, fn func() float64, labels ...Label) {
+	if r == nil {
+		return
+	}
+	r.series(name, help, typeCounter, labels, func(s *series) { s.fn = fn })
+}
+
+// Gauge returns the gauge for name and labels, registering it if needed.
+func (r *Registry) Gauge(name, help string, labels ...Label) *Gauge {
+	if r == nil {
+		return nil
+	}
+	return r.series(name, help, typeGauge, labels, func(s *series) {
+		if s.gauge == nil {
+			s.gauge = &Gauge{}
+		}
+	}).gauge
+}
+
+// GaugeFunc registers a gauge whose value is read from fn at scrape time.
+// Registering the same series again replaces fn.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64, labels ...Label) {
+	if r == nil {
+		return
+	}
+	r.series(name, help, typeGauge, labels, func(s *series) { s.fn = fn })
+}
+
+// Histogram returns the histogram for name and labels, registering it with
+// the given upper bounds if needed. Buckets must be sorted in increasing order.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...Label) *Histogram {
+	if r == nil {
+		return nil
+	}
+	return r.series(name, help, typeHistogram, labels, func(s *series) {
+		if s.histogram == nil {
+			s.histogram = &Histogram{
+				bounds: append([]float64(nil), buckets...),
+				counts: make([]atomic.Uint64, len(buckets)),
+			}
+		}
+	}).histogram
+}
+
+// series looks up or creates a series and lets init populate it while the
+// registry is locked.
+func (r *Registry) series(name, help, kind string, labels []Label, init func(*series)) *series {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{name: name, help: help, kind: kind, series: make(map[string]*series)}
+		r.families[name] = f
+	}
+	if f.kind != kind {
+		panic(fmt.Sprintf("metrics: %s registered as %s and %s", name, f.kind, kind))
+	}
+	key := formatLabels(labels)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: key}
+		f.series[key] = s
+	}
+	init(s)
+	return s
+}
+
+// WriteTo writes every metric in the Prometheus text format, sorted by name
+// and labels.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	counter := &countingWriter{w: w}
+	out := bufio.NewWriter(counter)
+	if r != nil {
+		r.mu.Lock()
+		names := make([]string, 0, len(r.families))
+		for name := range r.families {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			r.families[name].write(out)
+		}
+		r.mu.Unlock()
+	}
+	err := out.Flush()
+	return counter.n, err
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = r.WriteTo(w)
+	})
+}
+
+func (f *family) write(out *bufio.Writer) {
+	fmt.Fprintf(out, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(out, "# TYPE %s %s\n", f.name, f.kind)
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		switch {
+		case s.fn != nil:
+			writeSample(out, f.name, s.labels, s.fn())
+		case s.counter != nil:
+			writeSample(out, f.name, s.labels, float64(s.counter.Value()))
+		case s.gauge != nil:
+			writeSample(out, f.name, s.labels, s.gauge.Value())
+		case s.histogram != nil:
+			s.histogram.write(out, f.name, s.labels)
+		}
+	}
+}
+
+func writeSample(out *bufio.Writer, name, labels string, value float64) {
+	fmt.Fprintf(out, "%s%s %s\n", name, labels, formatValue(value))
+}
+
+// Counter is a monotonically increasing integer.
+type Counter struct {
+	value atomic.Uint64
+}
+
+// Add increases the counter by delta.
+func (c *Counter) Add(delta uint64) {
+	if c != nil {
+		c.value.Add(delta)
+	}
+}
+
+// Inc increases the counter by one.
+func (c *Counter) Inc() { c.Add(1) }
+
+// Value returns the current count.
+func (c *Counter) Value() uint64 {
+	if c == nil {
+		return 0
+	}
+	return c.value.Load()
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+// Set stores value.
+func (g *Gauge) Set(value float64) {
+	if g != nil {
+		g.bits.Store(math.Float64bits(value))
+	}
+}
+
+// Value returns the current value.
+func (g *Gauge) Value() float64 {
+	if g == nil {
+		return 0
+	}
+	return math.Float64frombits(g.bits.Load())
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	bounds []float64
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	mu     sync.Mutex
+	sum    float64
+}
+
+// Observe records one value.
+func (h *Histogram) Observe(value float64) {
+	if h == nil {
+		return
+	}
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.counts[i].Add(1)
+			break
+		}
+	}
+	h.count.Add(1)
+	h.mu.Lock()
+	h.sum += value
+	h.mu.Unlock()
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	if h == nil {
+		return 0
+	}
+	return h.count.Load()
+}
+
+func (h *Histogram) write(out *bufio.Writer, name, labels string) {
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i].Load()
+		writeSample(out, name+"_bucket", withLabel(labels, "le", formatValue(bound)), float64(cumulative))
+	}
+	count := h.count.Load()
+	writeSample(out, name+"_bucket", withLabel(labels, "le", "+Inf"), float64(count))
+	h.mu.Lock()
+	sum := h.sum
+	h.mu.Unlock()
+	writeSample(out, name+"_sum", labels, sum)
+	writeSample(out, name+"_count", labels, float64(count))
+}
+
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	sorted := append([]Label(nil), labels...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	parts := make([]string, len(sorted))
+	for i, label := range sorted {
+		parts[i] = label.Name + `="` + escapeLabelValue(label.Value) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// withLabel appends one label to an already formatted label set.
+func withLabel(labels, name, value string) string {
+	label := name + `="` + escapeLabelValue(value) + `"`
+	if labels == "" {
+		return "{" + label + "}"
+	}
+	return labels[:len(labels)-1] + "," + label + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabelValue(value string) string { return labelValueEscaper.Replace(value) }
+
+func escapeHelp(help string) string { return helpEscaper.Replace(help) }
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryWritesPrometheusText(t *testing.T) {
+	registry := NewRegistry()
+	registry.Counter("jobs_total", "Jobs done.").Add(3)
+	registry.Counter("jobs_total", "Jobs done.").Inc()
+	registry.Gauge("runner_rate", "Per-runner rate.", Label{"runner", `cpu "0"`}).Set(1.5)
+	registry.GaugeFunc("queue_items", "Queued items.", func() float64 { return 7 })
+	latency := registry.Histogram("insert_seconds", "Insert latency.", []float64{0.1, 1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(2)
+
+	var out bytes.Buffer
+	_, err := registry.WriteTo(&out)
+	require.NoError(t, err)
+
+	assert.Equal(t, `# HELP insert_seconds Insert latency.
+# TYPE insert_seconds histogram
+insert_seconds_bucket{le="0.1"} 1
+insert_seconds_bucket{le="1"} 2
+insert_seconds_bucket{le="+Inf"} 3
+insert_seconds_sum 2.55
+insert_seconds_count 3
+# HELP jobs_total Jobs done.
+# TYPE jobs_total counter
+jobs_total 4
+# HELP queue_items Queued items.
+# TYPE queue_items gauge
+queue_items 7
+# HELP runner_rate Per-runner rate.
+# TYPE runner_rate gauge
+runner_rate{runner="cpu \"0\""} 1.5
+`, out.String())
+}
+
+func TestNilRegistryIsNoOp(t *testing.T) {
+	var registry *Registry
+	registry.Counter("c", "").Inc()
+	registry.Gauge("g", "").Set(1)
+	registry.Histogram("h", "", []float64{1}).Observe(1)
+	registry.GaugeFunc("f", "", func() float64 { return 1 })
+
+	var out bytes.Buffer
+	_, err := registry.WriteTo(&out)
+	require.NoError(t, err)
+	assert.Empty(t, out.String())
+}
+
+func TestServeExposesMetrics(t *testing.T) {
+	registry := NewRegistry()
+	registry.Counter("served_total", "Served.").Inc()
+	server, err := Serve("127.0.0.1:0", registry)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, server.Close()) }()
+
+	response, err := http.Get("http://" + server.Addr() + "/metrics")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Contains(t, string(body), "served_total 1\n")
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iyuangang/gpgenie/models"
+)
+
+// armorSink writes every key as a pair of armored files named after its
+// fingerprint: <fingerprint>-public.asc and <fingerprint>-private.asc.pgp,
+// the private key being encrypted to the configured recipient. It keeps no
+// index, so queries return ErrSinkWriteOnly.
+type armorSink struct {
+	dir string
+}
+
+// NewArmorSink creates dir if needed and returns a sink that writes into it.
+func NewArmorSink(dir string) (FileSink, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create armor sink directory: %w", err)
+	}
+	return &armorSink{dir: dir}, nil
+}
+
+func (s *armorSink) paths(fingerprint string) (public, private string) {
+	base := filepath.Join(s.dir, strings.ToLower(fingerprint))
+	return base + "-public.asc", base + "-private.asc.pgp"
+}
+
+func (s *armorSink) write(key *models.KeyInfo) error {
+	public, private := s.paths(key.Fingerprint)
+	if err := os.WriteFile(public, []byte(key.PublicKey), 0o644); err != nil {
+		return fmt.Errorf("write public key: %w", err)
+	}
+	if err := os.WriteFile(private, []byte(key.PrivateKey), 0o600); err != nil {
+		return fmt.Errorf("write encrypted private key: %w", err)
+	}
+	return nil
+}
+
+func (s *armorSink) exists(fingerprint string) (bool, error) {
+	public, _ := s.paths(fingerprint)
+	_, err := os.Stat(public)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// BatchCreate treats an existing public key file as a stored fingerprint.
+func (s *armorSink) BatchCreate(keys []*models.KeyInfo, onConflict ConflictPolicy) (BatchResult, error) {
+	var result BatchResult
+	switch onConflict {
+	case "", ConflictSkip, ConflictUpdate, ConflictFail:
+	default:
+		return result, fmt.Errorf("unknown conflict policy %q", onConflict)
+	}
+	unique := uniqueByFingerprint(keys, onConflict == ConflictUpdate)
+	if onConflict == ConflictFail && len(unique) < len(keys) {
+		return result, fmt.Errorf("duplicate fingerprint in batch")
+	}
+	result.Skipped = int64(len(keys) - len(unique))
+	for _, key := range unique {
+		exists, err := s.exists(key.Fingerprint)
+		if err != nil {
+			return result, err
+		}
+		switch {
+		case !exists:
+			result.Inserted++
+		case onConflict == ConflictFail:
+			return result, fmt.Errorf("fingerprint %s is already stored", key.Fingerprint)
+		case onConflict == ConflictUpdate:
+			result.Updated++
+		default:
+			result.Skipped++
+			continue
+		}
+		if err := s.write(key); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func (s *armorSink) Upsert(key *models.KeyInfo) error {
+	if key == nil {
+		return errors.New("key is nil")
+	}
+	return s.write(key)
+}
+
+// DeleteByFingerprints removes the key files of the given fingerprints.
+func (s *armorSink) DeleteByFingerprints(fingerprints []string) (int64, error) {
+	var deleted int64
+	for _, fingerprint := range fingerprints {
+		public, private := s.paths(fingerprint)
+		err := os.Remove(public)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+		if err := os.Remove(private); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (s *armorSink) GetTopKeys(int, KeyFilter) ([]models.KeyInfo, error) {
+	return nil, ErrSinkWriteOnly
+}
+
+func (s *armorSink) GetLowLetterCountKeys(int, KeyFilter) ([]models.KeyInfo, error) {
+	return nil, ErrSinkWriteOnly
+}
+
+func (s *armorSink) GetRarestKeys(int, KeyFilter) ([]models.KeyInfo, error) {
+	return nil, ErrSinkWriteOnly
+}
+
+func (s *armorSink) GetByFingerprint(string) (*models.KeyInfo, error) {
+	return nil, ErrSinkWriteOnly
+}
+
+func (s *armorSink) GetAnalysisStats(KeyFilter) (*AnalysisStats, error) {
+	return nil, ErrSinkWriteOnly
+}
+
+func (s *armorSink) Rescore(KeyFilter, int, func(*models.KeyInfo) error) (int64, error) {
+	return 0, ErrSinkWriteOnly
+}
+
+// NextRunID starts at one: the directory records no run IDs.
+func (s *armorSink) NextRunID() uint { return 1 }
+
+func (s *armorSink) Close() error { return nil }
@@ -0,0 +1,374 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iyuangang/gpgenie/models"
+
+	"gorm.io/gorm"
+)
+
+// maxJSONLRecordSize bounds one line of a JSONL sink. RSA 4096 keys with an
+// encrypted private key stay well below it.
+const maxJSONLRecordSize = 16 << 20
+
+// jsonlRepository keeps keys in an append-only file with one KeyInfo record
+// per line. A later record for the same fingerprint replaces an earlier one,
+// and a record with DeletedAt set removes it, so updates and evictions never
+// rewrite the file. The live keys are held in memory and queried there.
+type jsonlRepository struct {
+	mu        sync.Mutex
+	path      string
+	file      *os.File
+	keys      []*models.KeyInfo // live keys in first-insert order; nil once deleted
+	index     map[string]int
+	lastID    uint
+	lastRunID uint
+}
+
+// OpenJSONLRepository loads an existing JSONL sink, or prepares a new one that
+// is created on the first write.
+func OpenJSONLRepository(path string) (FileSink, error) {
+	r := &jsonlRepository{path: path, index: make(map[string]int)}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open jsonl sink: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxJSONLRecordSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var key models.KeyInfo
+		if err := json.Unmarshal(scanner.Bytes(), &key); err != nil {
+			return nil, fmt.Errorf("read jsonl sink %s line %d: %w", path, line, err)
+		}
+		r.apply(&key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read jsonl sink %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// apply folds one record into the in-memory state.
+func (r *jsonlRepository) apply(key *models.KeyInfo) {
+	r.lastID = max(r.lastID, key.ID)
+	r.lastRunID = max(r.lastRunID, key.RunID)
+	i, ok := r.index[key.Fingerprint]
+	switch {
+	case key.DeletedAt.Valid:
+		if ok {
+			r.keys[i] = nil
+			delete(r.index, key.Fingerprint)
+		}
+	case ok:
+		r.keys[i] = key
+	default:
+		r.index[key.Fingerprint] = len(r.keys)
+		r.keys = append(r.keys, key)
+	}
+}
+
+// appendRecords writes records in one call and then applies them.
+func (r *jsonlRepository) appendRecords(records []*models.KeyInfo) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if r.file == nil {
+		file, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("open jsonl sink: %w", err)
+		}
+		r.file = file
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("encode key %s: %w", record.Fingerprint, err)
+		}
+	}
+	if _, err := r.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write jsonl sink: %w", err)
+	}
+	for _, record := range records {
+		r.apply(record)
+	}
+	return nil
+}
+
+// stamp prepares a record for writing the way the database would: IDs are
+// assigned on first insert and the algorithm column defaults to ed25519.
+func (r *jsonlRepository) stamp(key *models.KeyInfo, now time.Time) *models.KeyInfo {
+	record := *key
+	if i, ok := r.index[key.Fingerprint]; ok {
+		record.ID = r.keys[i].ID
+		record.CreatedAt = r.keys[i].CreatedAt
+	} else {
+		r.lastID++
+		record.ID = r.lastID
+		record.CreatedAt = now
+	}
+	record.UpdatedAt = now
+	record.DeletedAt = gorm.DeletedAt{}
+	if record.Algorithm == "" {
+		record.Algorithm = "ed25519"
+	}
+	key.ID, key.CreatedAt, key.UpdatedAt = record.ID, record.CreatedAt, record.UpdatedAt
+	return &record
+}
+
+func (r *jsonlRepository) BatchCreate(keys []*models.KeyInfo, onConflict ConflictPolicy) (BatchResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var result BatchResult
+	switch onConflict {
+	case "", ConflictSkip, ConflictUpdate, ConflictFail:
+	default:
+		return result, fmt.Errorf("unknown conflict policy %q", onConflict)
+	}
+	unique := uniqueByFingerprint(keys, onConflict == ConflictUpdate)
+	if onConflict == ConflictFail && len(unique) < len(keys) {
+		return result, fmt.Errorf("duplicate fingerprint in batch")
+	}
+	result.Skipped = int64(len(keys) - len(unique))
+
+	now := time.Now()
+	records := make([]*models.KeyInfo, 0, len(unique))
+	for _, key := range unique {
+		_, exists := r.index[key.Fingerprint]
+		switch {
+		case !exists:
+			result.Inserted++
+		case onConflict == ConflictFail:
+			return BatchResult{}, fmt.Errorf("fingerprint %s is already stored", key.Fingerprint)
+		case onConflict == ConflictUpdate:
+			result.Updated++
+		default:
+			result.Skipped++
+			continue
+		}
+		records = append(records, r.stamp(key, now))
+	}
+	if err := r.appendRecords(records); err != nil {
+		return BatchResult{}, err
+	}
+	return result, nil
+}
+
+func (r *jsonlRepository) Upsert(key *models.KeyInfo) error {
+	if key == nil {
+		return errors.New("key is nil")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.appendRecords([]*models.KeyInfo{r.stamp(key, time.Now())})
+}
+
+// DeleteByFingerprints appends a deletion record for every stored key.
+func (r *jsonlRepository) DeleteByFingerprints(fingerprints []string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var tombstones []*models.KeyInfo
+	for _, fingerprint := range fingerprints {
+		i, ok := r.index[fingerprint]
+		if !ok {
+			continue
+		}
+		tombstones = append(tombstones, &models.KeyInfo{
+			Model:       gorm.Model{ID: r.keys[i].ID, DeletedAt: gorm.DeletedAt{Time: now, Valid: true}},
+			Fingerprint: fingerprint,
+		})
+	}
+	if err := r.appendRecords(tombstones); err != nil {
+		return 0, err
+	}
+	return int64(len(tombstones)), nil
+}
+
+// matching returns copies of the live keys accepted by filter.
+func (r *jsonlRepository) matching(filter KeyFilter) []models.KeyInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]models.KeyInfo, 0, len(r.index))
+	for _, key := range r.keys {
+		if key != nil && filter.matches(key) {
+			keys = append(keys, *key)
+		}
+	}
+	return keys
+}
+
+func (r *jsonlRepository) GetTopKeys(limit int, filter KeyFilter) ([]models.KeyInfo, error) {
+	keys := r.matching(filter)
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i].Score != keys[j].Score {
+			return keys[i].Score > keys[j].Score
+		}
+		return keys[i].UniqueLettersCount < keys[j].UniqueLettersCount
+	})
+	return keys[:min(limit, len(keys))], nil
+}
+
+func (r *jsonlRepository) GetLowLetterCountKeys(limit int, filter KeyFilter) ([]models.KeyInfo, error) {
+	keys := r.matching(filter)
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i].UniqueLettersCount != keys[j].UniqueLettersCount {
+			return keys[i].UniqueLettersCount < keys[j].UniqueLettersCount
+		}
+		return keys[i].Score > keys[j].Score
+	})
+	return keys[:min(limit, len(keys))], nil
+}
+
+func (r *jsonlRepository) GetRarestKeys(limit int, filter KeyFilter) ([]models.KeyInfo, error) {
+	keys := r.matching(filter)
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i].Rarity != keys[j].Rarity {
+			return keys[i].Rarity > keys[j].Rarity
+		}
+		if keys[i].Score != keys[j].Score {
+			return keys[i].Score > keys[j].Score
+		}
+		return keys[i].UniqueLettersCount < keys[j].UniqueLettersCount
+	})
+	return keys[:min(limit, len(keys))], nil
+}
+
+func (r *jsonlRepository) GetByFingerprint(fingerprint string) (*models.KeyInfo, error) {
+	query, full := fingerprintQuery(fingerprint)
+	for _, key := range r.matching(KeyFilter{}) {
+		stored := strings.ToLower(key.Fingerprint)
+		if full && stored == query || !full && (strings.HasSuffix(stored, query) ||
+			key.KeyVersion == 6 && strings.HasPrefix(stored, query)) {
+			return &key, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *jsonlRepository) GetAnalysisStats(filter KeyFilter) (*AnalysisStats, error) {
+	keys := r.matching(filter)
+	stats := &AnalysisStats{}
+	if len(keys) == 0 {
+		return stats, nil
+	}
+
+	n := float64(len(keys))
+	var sumXY, sumX2, sumY2 float64
+	byAlgorithm := make(map[string]*AlgorithmStats)
+	stats.Score.Min, stats.Score.Max = math.Inf(1), math.Inf(-1)
+	stats.UniqueLetters.Min, stats.UniqueLetters.Max = math.Inf(1), math.Inf(-1)
+	for i := range keys {
+		key := &keys[i]
+		score, unique := float64(key.Score), float64(key.UniqueLettersCount)
+		stats.Score.Total += score
+		stats.Score.Min = math.Min(stats.Score.Min, score)
+		stats.Score.Max = math.Max(stats.Score.Max, score)
+		stats.UniqueLetters.Total += unique
+		stats.UniqueLetters.Min = math.Min(stats.UniqueLetters.Min, unique)
+		stats.UniqueLetters.Max = math.Max(stats.UniqueLetters.Max, unique)
+		stats.Components.AverageRepeat += float64(key.RepeatLetterScore) / n
+		stats.Components.AverageIncreasing += float64(key.IncreasingLetterScore) / n
+		stats.Components.AverageDecreasing += float64(key.DecreasingLetterScore) / n
+		stats.Components.AverageMagic += float64(key.MagicLetterScore) / n
+		stats.Components.AveragePalindrome += float64(key.PalindromeScore) / n
+		stats.Components.AverageRepeatingBlock += float64(key.RepeatingBlockScore) / n
+		stats.Components.AverageAlternating += float64(key.AlternatingScore) / n
+		stats.Rarity.Average += key.Rarity / n
+		stats.Rarity.Max = math.Max(stats.Rarity.Max, key.Rarity)
+		sumXY += score * unique
+		sumX2 += score * score
+		sumY2 += unique * unique
+
+		algorithm, ok := byAlgorithm[key.Algorithm]
+		if !ok {
+			algorithm = &AlgorithmStats{Algorithm: key.Algorithm, MaxScore: score}
+			byAlgorithm[key.Algorithm] = algorithm
+		}
+		algorithm.Count++
+		algorithm.AverageScore += score
+		algorithm.MaxScore = math.Max(algorithm.MaxScore, score)
+	}
+	stats.Score.Count = int64(len(keys))
+	stats.Score.Average = stats.Score.Total / n
+	stats.UniqueLetters.Count = int64(len(keys))
+	stats.UniqueLetters.Average = stats.UniqueLetters.Total / n
+
+	numerator := n*sumXY - stats.Score.Total*stats.UniqueLetters.Total
+	denominatorSquared := (n*sumX2 - stats.Score.Total*stats.Score.Total) *
+		(n*sumY2 - stats.UniqueLetters.Total*stats.UniqueLetters.Total)
+	if denominatorSquared > 0 {
+		stats.Correlation = numerator / math.Sqrt(denominatorSquared)
+	}
+
+	for _, algorithm := range byAlgorithm {
+		algorithm.AverageScore /= float64(algorithm.Count)
+		stats.Algorithms = append(stats.Algorithms, *algorithm)
+	}
+	sort.Slice(stats.Algorithms, func(i, j int) bool {
+		a, b := stats.Algorithms[i], stats.Algorithms[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Algorithm < b.Algorithm
+	})
+	return stats, nil
+}
+
+// Rescore lets rescore update matching keys and appends the results in
+// batches of batchSize records.
+func (r *jsonlRepository) Rescore(filter KeyFilter, batchSize int, rescore func(*models.KeyInfo) error) (int64, error) {
+	keys := r.matching(filter)
+	var updated int64
+	for start := 0; start < len(keys); start += batchSize {
+		batch := make([]*models.KeyInfo, 0, batchSize)
+		for i := start; i < min(start+batchSize, len(keys)); i++ {
+			if err := rescore(&keys[i]); err != nil {
+				return updated, err
+			}
+			batch = append(batch, &keys[i])
+		}
+		if _, err := r.BatchCreate(batch, ConflictUpdate); err != nil {
+			return updated, err
+		}
+		updated += int64(len(batch))
+	}
+	return updated, nil
+}
+
+func (r *jsonlRepository) NextRunID() uint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastRunID + 1
+}
+
+func (r *jsonlRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
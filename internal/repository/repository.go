@@ -2,6 +2,7 @@ package repository
 
 import (
 	"errors"
+	"fmt"
 	"math"
 	"strings"
 
@@ -13,12 +14,105 @@ import (
 
 // KeyRepository 定义了与 KeyInfo 相关的数据库操作
 type KeyRepository interface {
-	BatchCreate(keys []*models.KeyInfo) error
+	BatchCreate(keys []*models.KeyInfo, onConflict ConflictPolicy) (BatchResult, error)
 	Upsert(key *models.KeyInfo) error
-	GetTopKeys(limit int) ([]models.KeyInfo, error)
-	GetLowLetterCountKeys(limit int) ([]models.KeyInfo, error)
-	GetByFingerprint(lastSixteen string) (*models.KeyInfo, error)
-	GetAnalysisStats() (*AnalysisStats, error)
+	DeleteByFingerprints(fingerprints []string) (int64, error)
+	GetTopKeys(limit int, filter KeyFilter) ([]models.KeyInfo, error)
+	GetLowLetterCountKeys(limit int, filter KeyFilter) ([]models.KeyInfo, error)
+	GetRarestKeys(limit int, filter KeyFilter) ([]models.KeyInfo, error)
+	GetByFingerprint(fingerprint string) (*models.KeyInfo, error)
+	GetAnalysisStats(filter KeyFilter) (*AnalysisStats, error)
+	Rescore(filter KeyFilter, batchSize int, rescore func(*models.KeyInfo) error) (int64, error)
+}
+
+// KeyFilter narrows listing and analysis queries. The zero value matches
+// every key. Algorithm matches a stored algorithm label such as "rsa4096" or,
+// as a prefix, a family such as "rsa" or "ecdsa". RankedOnly leaves out
+// vanity keys and pattern hits, which are kept regardless of their score.
+// ScoreWindow matches the canonical name of the scoring window, such as
+// "long" or "0:8", so scores from different windows are not compared.
+type KeyFilter struct {
+	RunID       uint
+	Algorithm   string
+	RankedOnly  bool
+	ScoreWindow string
+}
+
+// defaultScoreWindow is the window of keys stored before score_window was
+// recorded.
+const defaultScoreWindow = "long"
+
+func (f KeyFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.RunID != 0 {
+		db = db.Where("run_id = ?", f.RunID)
+	}
+	if f.Algorithm != "" {
+		algorithm := strings.ToLower(f.Algorithm)
+		db = db.Where("algorithm = ? OR algorithm LIKE ?", algorithm, algorithm+"%")
+	}
+	if f.RankedOnly {
+		db = db.Where("is_vanity = ? AND (matched_pattern = '' OR matched_pattern IS NULL)", false)
+	}
+	if f.ScoreWindow != "" {
+		if f.ScoreWindow == defaultScoreWindow {
+			db = db.Where("score_window = ? OR score_window = '' OR score_window IS NULL", f.ScoreWindow)
+		} else {
+			db = db.Where("score_window = ?", f.ScoreWindow)
+		}
+	}
+	return db
+}
+
+// ConflictPolicy decides what BatchCreate does with a key whose fingerprint
+// is already stored or repeated within the batch.
+type ConflictPolicy string
+
+const (
+	// ConflictSkip keeps the stored key and drops the new one. It is the
+	// policy used for an empty value.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictUpdate replaces the stored key with the new one.
+	ConflictUpdate ConflictPolicy = "update"
+	// ConflictFail rejects the whole batch.
+	ConflictFail ConflictPolicy = "fail"
+)
+
+// BatchResult counts the outcome of one BatchCreate call. Inserted and
+// Updated keys are written; Skipped keys are not.
+type BatchResult struct {
+	Inserted int64
+	Updated  int64
+	Skipped  int64
+}
+
+// Written returns the number of keys stored by the batch.
+func (r BatchResult) Written() int64 { return r.Inserted + r.Updated }
+
+// Add accumulates another batch result.
+func (r *BatchResult) Add(other BatchResult) {
+	r.Inserted += other.Inserted
+	r.Updated += other.Updated
+	r.Skipped += other.Skipped
+}
+
+// matches is the in-memory counterpart of apply, used by file sinks.
+func (f KeyFilter) matches(key *models.KeyInfo) bool {
+	if f.RunID != 0 && key.RunID != f.RunID {
+		return false
+	}
+	if f.Algorithm != "" && !strings.HasPrefix(key.Algorithm, strings.ToLower(f.Algorithm)) {
+		return false
+	}
+	if f.ScoreWindow != "" {
+		window := key.ScoreWindow
+		if window == "" {
+			window = defaultScoreWindow
+		}
+		if window != f.ScoreWindow {
+			return false
+		}
+	}
+	return !f.RankedOnly || (!key.IsVanity && key.MatchedPattern == "")
 }
 
 // ScoreStats 用于存储分数统计数据
@@ -45,15 +139,37 @@ type ScoreComponentsStats struct {
 	AverageIncreasing float64 `gorm:"column:average_increasing"`
 	AverageDecreasing float64 `gorm:"column:average_decreasing"`
 	AverageMagic      float64 `gorm:"column:average_magic"`
+	// Symmetry components average over every key, so keys scored before
+	// they existed count as zero.
+	AveragePalindrome     float64 `gorm:"column:average_palindrome"`
+	AverageRepeatingBlock float64 `gorm:"column:average_repeating_block"`
+	AverageAlternating    float64 `gorm:"column:average_alternating"`
+}
+
+// AlgorithmStats summarizes the keys of one algorithm.
+type AlgorithmStats struct {
+	Algorithm    string  `gorm:"column:algorithm"`
+	Count        int64   `gorm:"column:count"`
+	AverageScore float64 `gorm:"column:average_score"`
+	MaxScore     float64 `gorm:"column:max_score"`
+}
+
+// RarityStats summarizes the stored rarity of the analyzed keys.
+type RarityStats struct {
+	Average float64 `gorm:"column:average"`
+	Max     float64 `gorm:"column:max"`
 }
 
 // AnalysisStats contains all aggregates required by the analyze command. The
-// repository populates it with one database scan.
+// repository populates it with one database scan plus a per-algorithm
+// breakdown.
 type AnalysisStats struct {
 	Score         ScoreStats
 	UniqueLetters UniqueLettersStats
 	Components    ScoreComponentsStats
+	Rarity        RarityStats
 	Correlation   float64
+	Algorithms    []AlgorithmStats
 }
 
 // keyRepository 是 KeyRepository 的具体实现
@@ -66,54 +182,201 @@ func NewKeyRepository(db *gorm.DB) KeyRepository {
 	return &keyRepository{db: db}
 }
 
+// upsertColumns are overwritten when Upsert meets an existing fingerprint.
+var upsertColumns = []string{
+	"fingerprint_suffix", "primary_fingerprint", "public_key", "private_key",
+	"repeat_letter_score", "increasing_letter_score", "decreasing_letter_score",
+	"magic_letter_score", "palindrome_score", "repeating_block_score", "alternating_score",
+	"score", "unique_letters_count", "rarity", "score_strategy", "score_window", "algorithm", "is_vanity",
+	"vanity_run_length", "vanity_run_start", "vanity_digit", "vanity_scope",
+	"vanity_target_digits", "updated_at",
+}
+
+// batchUpdateColumns are overwritten by BatchCreate with ConflictUpdate. The
+// key also moves to the new run and is restored if it was soft-deleted.
+var batchUpdateColumns = append(append([]string(nil), upsertColumns...), "matched_pattern", "run_id", "deleted_at")
+
 func (r *keyRepository) Upsert(key *models.KeyInfo) error {
 	if key == nil {
 		return errors.New("key is nil")
 	}
 	return r.db.Clauses(clause.OnConflict{
-		Columns: []clause.Column{{Name: "fingerprint"}},
-		DoUpdates: clause.AssignmentColumns([]string{
-			"fingerprint_suffix", "primary_fingerprint", "public_key", "private_key",
-			"repeat_letter_score", "increasing_letter_score", "decreasing_letter_score",
-			"magic_letter_score", "score", "unique_letters_count", "is_vanity",
-			"vanity_run_length", "vanity_run_start", "vanity_digit", "vanity_scope",
-			"vanity_target_digits", "updated_at",
-		}),
+		Columns:   []clause.Column{{Name: "fingerprint"}},
+		DoUpdates: clause.AssignmentColumns(upsertColumns),
 	}).Create(key).Error
 }
 
-func (r *keyRepository) BatchCreate(keys []*models.KeyInfo) error {
+// BatchCreate inserts keys in one transaction and resolves duplicate
+// fingerprints according to onConflict. Duplicates within the batch count as
+// conflicts too: skip keeps the first, update the last. The ON CONFLICT
+// clauses used here are understood by both SQLite and PostgreSQL.
+func (r *keyRepository) BatchCreate(keys []*models.KeyInfo, onConflict ConflictPolicy) (BatchResult, error) {
+	var result BatchResult
 	if len(keys) == 0 {
+		return result, nil
+	}
+	switch onConflict {
+	case ConflictFail:
+		if err := r.db.Create(keys).Error; err != nil {
+			return result, err
+		}
+		result.Inserted = int64(len(keys))
+		return result, nil
+	case "", ConflictSkip, ConflictUpdate:
+	default:
+		return result, fmt.Errorf("unknown conflict policy %q", onConflict)
+	}
+
+	unique := uniqueByFingerprint(keys, onConflict == ConflictUpdate)
+	result.Skipped = int64(len(keys) - len(unique))
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		fingerprints := make([]string, len(unique))
+		for i, key := range unique {
+			fingerprints[i] = key.Fingerprint
+		}
+		var existing int64
+		if err := tx.Unscoped().Model(&models.KeyInfo{}).
+			Where("fingerprint IN ?", fingerprints).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+
+		if onConflict == ConflictUpdate {
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "fingerprint"}},
+				DoUpdates: clause.AssignmentColumns(batchUpdateColumns),
+			}).Create(unique).Error; err != nil {
+				return err
+			}
+			result.Updated = existing
+			result.Inserted = int64(len(unique)) - existing
+			return nil
+		}
+
+		created := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "fingerprint"}},
+			DoNothing: true,
+		}).Create(unique)
+		if created.Error != nil {
+			return created.Error
+		}
+		result.Inserted = created.RowsAffected
+		result.Skipped += int64(len(unique)) - created.RowsAffected
 		return nil
+	})
+	if err != nil {
+		return BatchResult{}, err
 	}
-	return r.db.Create(keys).Error
+	return result, nil
+}
+
+// DeleteByFingerprints permanently removes the keys with the given full
+// fingerprints and returns how many rows were deleted.
+func (r *keyRepository) DeleteByFingerprints(fingerprints []string) (int64, error) {
+	if len(fingerprints) == 0 {
+		return 0, nil
+	}
+	result := r.db.Unscoped().Where("fingerprint IN ?", fingerprints).Delete(&models.KeyInfo{})
+	return result.RowsAffected, result.Error
+}
+
+// uniqueByFingerprint drops repeated fingerprints, keeping the first or, with
+// keepLast, the last occurrence in its original position.
+func uniqueByFingerprint(keys []*models.KeyInfo, keepLast bool) []*models.KeyInfo {
+	index := make(map[string]int, len(keys))
+	unique := make([]*models.KeyInfo, 0, len(keys))
+	for _, key := range keys {
+		i, seen := index[key.Fingerprint]
+		switch {
+		case !seen:
+			index[key.Fingerprint] = len(unique)
+			unique = append(unique, key)
+		case keepLast:
+			unique[i] = key
+		}
+	}
+	return unique
+}
+
+// scoreColumns are the columns derived from a fingerprint by a scoring strategy.
+var scoreColumns = []string{
+	"repeat_letter_score", "increasing_letter_score", "decreasing_letter_score",
+	"magic_letter_score", "palindrome_score", "repeating_block_score",
+	"alternating_score", "score", "unique_letters_count", "rarity",
+	"score_strategy", "score_window",
 }
 
-func (r *keyRepository) GetTopKeys(limit int) ([]models.KeyInfo, error) {
+// Rescore loads matching keys in batches, lets rescore update their score
+// fields, and writes back only the score columns. Each batch is committed in
+// its own transaction.
+func (r *keyRepository) Rescore(filter KeyFilter, batchSize int, rescore func(*models.KeyInfo) error) (int64, error) {
+	var (
+		rows    []models.KeyInfo
+		updated int64
+	)
+	result := filter.apply(r.db.Model(&models.KeyInfo{})).
+		Select("id", "fingerprint", "fingerprint_suffix").
+		FindInBatches(&rows, batchSize, func(_ *gorm.DB, _ int) error {
+			return r.db.Transaction(func(tx *gorm.DB) error {
+				for i := range rows {
+					if err := rescore(&rows[i]); err != nil {
+						return err
+					}
+					if err := tx.Model(&rows[i]).Select(scoreColumns).Updates(&rows[i]).Error; err != nil {
+						return err
+					}
+					updated++
+				}
+				return nil
+			})
+		})
+	return updated, result.Error
+}
+
+func (r *keyRepository) GetTopKeys(limit int, filter KeyFilter) ([]models.KeyInfo, error) {
 	var keys []models.KeyInfo
-	err := r.db.Select("fingerprint", "score", "unique_letters_count").
+	err := filter.apply(r.db).Select(listColumns).
 		Order("score DESC, unique_letters_count ASC").Limit(limit).Find(&keys).Error
 	return keys, err
 }
 
-func (r *keyRepository) GetLowLetterCountKeys(limit int) ([]models.KeyInfo, error) {
+func (r *keyRepository) GetLowLetterCountKeys(limit int, filter KeyFilter) ([]models.KeyInfo, error) {
 	var keys []models.KeyInfo
-	err := r.db.Select("fingerprint", "score", "unique_letters_count").
+	err := filter.apply(r.db).Select(listColumns).
 		Order("unique_letters_count ASC, score DESC").Limit(limit).Find(&keys).Error
 	return keys, err
 }
 
-func (r *keyRepository) GetByFingerprint(lastSixteen string) (*models.KeyInfo, error) {
+// GetRarestKeys lists keys by rarity, which unlike the score compares keys
+// scored with different strategies or windows.
+func (r *keyRepository) GetRarestKeys(limit int, filter KeyFilter) ([]models.KeyInfo, error) {
+	var keys []models.KeyInfo
+	err := filter.apply(r.db).Select(listColumns).
+		Order("rarity DESC, score DESC, unique_letters_count ASC").Limit(limit).Find(&keys).Error
+	return keys, err
+}
+
+// listColumns are the columns key listings display.
+var listColumns = []string{"fingerprint", "score", "unique_letters_count", "rarity", "matched_pattern", "algorithm", "score_window"}
+
+// GetByFingerprint finds a key by its full v4 (40-digit) or v6 (64-digit)
+// fingerprint, by the last 16 digits of either, or by the leading 16 digits
+// of a v6 fingerprint, which are its key ID.
+func (r *keyRepository) GetByFingerprint(fingerprint string) (*models.KeyInfo, error) {
 	var keyInfo models.KeyInfo
-	suffix := strings.ToLower(lastSixteen)
-	if len(suffix) > 16 {
-		suffix = suffix[len(suffix)-16:]
+	query, full := fingerprintQuery(fingerprint)
+	if full {
+		if err := r.db.Where("fingerprint = ?", query).First(&keyInfo).Error; err != nil {
+			return nil, err
+		}
+		return &keyInfo, nil
 	}
-	err := r.db.Where("fingerprint_suffix = ?", suffix).First(&keyInfo).Error
+	err := r.db.Where("fingerprint_suffix = ?", query).
+		Or("key_version = ? AND fingerprint LIKE ?", 6, query+"%").First(&keyInfo).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		// Compatibility fallback for databases created before fingerprint_suffix
 		// was introduced. Connect backfills these rows during normal startup.
-		err = r.db.Where("fingerprint LIKE ?", "%"+suffix).First(&keyInfo).Error
+		err = r.db.Where("fingerprint LIKE ?", "%"+query).First(&keyInfo).Error
 	}
 	if err != nil {
 		return nil, err
@@ -121,28 +384,49 @@ func (r *keyRepository) GetByFingerprint(lastSixteen string) (*models.KeyInfo, e
 	return &keyInfo, nil
 }
 
-func (r *keyRepository) GetAnalysisStats() (*AnalysisStats, error) {
+// fingerprintQuery lower-cases a fingerprint argument. A full v4 or v6
+// fingerprint is returned whole; anything else is reduced to its last 16
+// digits, which is what the fingerprint_suffix column holds. A 16-digit
+// argument is kept as is, so it can also match the key ID of a v6 key.
+func fingerprintQuery(fingerprint string) (query string, full bool) {
+	query = strings.ToLower(fingerprint)
+	switch len(query) {
+	case 40, 64:
+		return query, true
+	}
+	if len(query) > 16 {
+		query = query[len(query)-16:]
+	}
+	return query, false
+}
+
+func (r *keyRepository) GetAnalysisStats(filter KeyFilter) (*AnalysisStats, error) {
 	type aggregateRow struct {
-		Count             int64   `gorm:"column:count"`
-		ScoreAverage      float64 `gorm:"column:score_average"`
-		ScoreMin          float64 `gorm:"column:score_min"`
-		ScoreMax          float64 `gorm:"column:score_max"`
-		ScoreTotal        float64 `gorm:"column:score_total"`
-		UniqueAverage     float64 `gorm:"column:unique_average"`
-		UniqueMin         float64 `gorm:"column:unique_min"`
-		UniqueMax         float64 `gorm:"column:unique_max"`
-		UniqueTotal       float64 `gorm:"column:unique_total"`
-		AverageRepeat     float64 `gorm:"column:average_repeat"`
-		AverageIncreasing float64 `gorm:"column:average_increasing"`
-		AverageDecreasing float64 `gorm:"column:average_decreasing"`
-		AverageMagic      float64 `gorm:"column:average_magic"`
-		SumXY             float64 `gorm:"column:sum_xy"`
-		SumX2             float64 `gorm:"column:sum_x2"`
-		SumY2             float64 `gorm:"column:sum_y2"`
+		Count                 int64   `gorm:"column:count"`
+		ScoreAverage          float64 `gorm:"column:score_average"`
+		ScoreMin              float64 `gorm:"column:score_min"`
+		ScoreMax              float64 `gorm:"column:score_max"`
+		ScoreTotal            float64 `gorm:"column:score_total"`
+		UniqueAverage         float64 `gorm:"column:unique_average"`
+		UniqueMin             float64 `gorm:"column:unique_min"`
+		UniqueMax             float64 `gorm:"column:unique_max"`
+		UniqueTotal           float64 `gorm:"column:unique_total"`
+		AverageRepeat         float64 `gorm:"column:average_repeat"`
+		AverageIncreasing     float64 `gorm:"column:average_increasing"`
+		AverageDecreasing     float64 `gorm:"column:average_decreasing"`
+		AverageMagic          float64 `gorm:"column:average_magic"`
+		AveragePalindrome     float64 `gorm:"column:average_palindrome"`
+		AverageRepeatingBlock float64 `gorm:"column:average_repeating_block"`
+		AverageAlternating    float64 `gorm:"column:average_alternating"`
+		RarityAverage         float64 `gorm:"column:rarity_average"`
+		RarityMax             float64 `gorm:"column:rarity_max"`
+		SumXY                 float64 `gorm:"column:sum_xy"`
+		SumX2                 float64 `gorm:"column:sum_x2"`
+		SumY2                 float64 `gorm:"column:sum_y2"`
 	}
 
 	var row aggregateRow
-	err := r.db.Model(&models.KeyInfo{}).Select(`
+	err := filter.apply(r.db.Model(&models.KeyInfo{})).Select(`
 		COUNT(*) AS count,
 		COALESCE(AVG(score), 0) AS score_average,
 		COALESCE(MIN(score), 0) AS score_min,
@@ -156,6 +440,11 @@ func (r *keyRepository) GetAnalysisStats() (*AnalysisStats, error) {
 		COALESCE(AVG(increasing_letter_score), 0) AS average_increasing,
 		COALESCE(AVG(decreasing_letter_score), 0) AS average_decreasing,
 		COALESCE(AVG(magic_letter_score), 0) AS average_magic,
+		COALESCE(AVG(COALESCE(palindrome_score, 0)), 0) AS average_palindrome,
+		COALESCE(AVG(COALESCE(repeating_block_score, 0)), 0) AS average_repeating_block,
+		COALESCE(AVG(COALESCE(alternating_score, 0)), 0) AS average_alternating,
+		COALESCE(AVG(COALESCE(rarity, 0)), 0) AS rarity_average,
+		COALESCE(MAX(rarity), 0) AS rarity_max,
 		COALESCE(SUM(1.0 * score * unique_letters_count), 0) AS sum_xy,
 		COALESCE(SUM(1.0 * score * score), 0) AS sum_x2,
 		COALESCE(SUM(1.0 * unique_letters_count * unique_letters_count), 0) AS sum_y2
@@ -164,6 +453,17 @@ func (r *keyRepository) GetAnalysisStats() (*AnalysisStats, error) {
 		return nil, err
 	}
 
+	var algorithms []AlgorithmStats
+	err = filter.apply(r.db.Model(&models.KeyInfo{})).Select(`
+		algorithm,
+		COUNT(*) AS count,
+		COALESCE(AVG(score), 0) AS average_score,
+		COALESCE(MAX(score), 0) AS max_score
+	`).Group("algorithm").Order("count DESC, algorithm").Scan(&algorithms).Error
+	if err != nil {
+		return nil, err
+	}
+
 	correlation := 0.0
 	if row.Count > 0 {
 		n := float64(row.Count)
@@ -191,11 +491,16 @@ func (r *keyRepository) GetAnalysisStats() (*AnalysisStats, error) {
 			Count:   row.Count,
 		},
 		Components: ScoreComponentsStats{
-			AverageRepeat:     row.AverageRepeat,
-			AverageIncreasing: row.AverageIncreasing,
-			AverageDecreasing: row.AverageDecreasing,
-			AverageMagic:      row.AverageMagic,
+			AverageRepeat:         row.AverageRepeat,
+			AverageIncreasing:     row.AverageIncreasing,
+			AverageDecreasing:     row.AverageDecreasing,
+			AverageMagic:          row.AverageMagic,
+			AveragePalindrome:     row.AveragePalindrome,
+			AverageRepeatingBlock: row.AverageRepeatingBlock,
+			AverageAlternating:    row.AverageAlternating,
 		},
+		Rarity:      RarityStats{Average: row.RarityAverage, Max: row.RarityMax},
 		Correlation: correlation,
+		Algorithms:  algorithms,
 	}, nil
 }
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"context"
+	"strings"
 	"testing"
 
 	"github.com/iyuangang/gpgenie/models"
@@ -14,7 +16,7 @@ import (
 func setupTestDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	assert.NoError(t, err)
-	err = db.AutoMigrate(&models.KeyInfo{})
+	err = db.AutoMigrate(&models.KeyInfo{}, &models.GenerationRun{})
 	assert.NoError(t, err)
 	return db
 }
@@ -59,14 +61,15 @@ func TestBatchCreateAndGetTopKeys(t *testing.T) {
 
 	keys := []*models.KeyInfo{
 		{Fingerprint: "00000000fingerprint1", FingerprintSuffix: "0000fingerprint1", Score: 100, UniqueLettersCount: 10},
-		{Fingerprint: "00000000fingerprint2", FingerprintSuffix: "0000fingerprint2", Score: 200, UniqueLettersCount: 8},
+		{Fingerprint: "00000000fingerprint2", FingerprintSuffix: "0000fingerprint2", Score: 200, UniqueLettersCount: 8, PalindromeScore: 90, AlternatingScore: 30},
 		{Fingerprint: "00000000fingerprint3", FingerprintSuffix: "0000fingerprint3", Score: 150, UniqueLettersCount: 12},
 	}
 
-	err := repo.BatchCreate(keys)
+	result, err := repo.BatchCreate(keys, ConflictFail)
 	assert.NoError(t, err)
+	assert.Equal(t, BatchResult{Inserted: 3}, result)
 
-	topKeys, err := repo.GetTopKeys(2)
+	topKeys, err := repo.GetTopKeys(2, KeyFilter{})
 	assert.NoError(t, err)
 	assert.Len(t, topKeys, 2)
 	assert.Equal(t, "00000000fingerprint2", topKeys[0].Fingerprint)
@@ -76,8 +79,298 @@ func TestBatchCreateAndGetTopKeys(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 200, found.Score)
 
-	stats, err := repo.GetAnalysisStats()
+	stats, err := repo.GetAnalysisStats(KeyFilter{})
 	assert.NoError(t, err)
 	assert.Equal(t, int64(3), stats.Score.Count)
 	assert.InDelta(t, 150.0, stats.Score.Average, 0.001)
+	assert.InDelta(t, 30.0, stats.Components.AveragePalindrome, 0.001)
+	assert.InDelta(t, 10.0, stats.Components.AverageAlternating, 0.001)
+	assert.Zero(t, stats.Components.AverageRepeatingBlock)
+}
+
+func TestGetRarestKeysRanksByRarity(t *testing.T) {
+	repo := NewKeyRepository(setupTestDB(t))
+	keys := []*models.KeyInfo{
+		{Fingerprint: "00000000fingerprint1", Score: 300, Rarity: 12, ScoreWindow: "long"},
+		{Fingerprint: "00000000fingerprint2", Score: 200, Rarity: 21.5, ScoreWindow: "short"},
+		{Fingerprint: "00000000fingerprint3", Score: 400, Rarity: 12, ScoreWindow: "long"},
+	}
+	_, err := repo.BatchCreate(keys, ConflictFail)
+	require.NoError(t, err)
+
+	rarest, err := repo.GetRarestKeys(3, KeyFilter{})
+	require.NoError(t, err)
+	require.Len(t, rarest, 3)
+	assert.Equal(t, "00000000fingerprint2", rarest[0].Fingerprint, "rarity compares keys across windows")
+	assert.Equal(t, 21.5, rarest[0].Rarity)
+	assert.Equal(t, "00000000fingerprint3", rarest[1].Fingerprint, "ties rank by score")
+
+	stats, err := repo.GetAnalysisStats(KeyFilter{})
+	require.NoError(t, err)
+	assert.InDelta(t, 15.1667, stats.Rarity.Average, 0.001)
+	assert.Equal(t, 21.5, stats.Rarity.Max)
+}
+
+func TestGetByFingerprintMatchesFullFingerprints(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewKeyRepository(db)
+
+	v4 := "0123456789abcdef0123456789abcdef01234567"
+	v6 := "cb186c4f0609a697e4d52dfa6c722b0c1f1e27c18a56708f6525ec27bad9acc9"
+	// A second v6 key shares the trailing 16 digits of the first.
+	twin := "00000000000000000000000000000000000000000000000f6525ec27bad9acc9"
+	_, err := repo.BatchCreate([]*models.KeyInfo{
+		{Fingerprint: v4, FingerprintSuffix: v4[24:], KeyVersion: 4},
+		{Fingerprint: twin, FingerprintSuffix: twin[48:], KeyVersion: 6, Score: 1},
+		{Fingerprint: v6, FingerprintSuffix: v6[48:], KeyVersion: 6, Score: 2},
+	}, ConflictFail)
+	require.NoError(t, err)
+
+	found, err := repo.GetByFingerprint(strings.ToUpper(v6))
+	require.NoError(t, err)
+	assert.Equal(t, v6, found.Fingerprint)
+	assert.Equal(t, 6, found.KeyVersion)
+
+	found, err = repo.GetByFingerprint(v4)
+	require.NoError(t, err)
+	assert.Equal(t, 4, found.KeyVersion)
+
+	found, err = repo.GetByFingerprint(v6[40:])
+	require.NoError(t, err)
+	assert.Equal(t, v6[48:], found.FingerprintSuffix)
+
+	// The key ID of a v6 key is the leading 16 digits.
+	found, err = repo.GetByFingerprint(strings.ToUpper(v6[:16]))
+	require.NoError(t, err)
+	assert.Equal(t, v6, found.Fingerprint)
+
+	_, err = repo.GetByFingerprint(v4[:16])
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound, "v4 key IDs are the trailing digits")
+
+	_, err = repo.GetByFingerprint(strings.Repeat("0", 64))
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestBatchCreateResolvesConflicts(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewKeyRepository(db)
+
+	stored := &models.KeyInfo{Fingerprint: "00000000fingerprint1", PublicKey: "stored", Score: 10, RunID: 1}
+	result, err := repo.BatchCreate([]*models.KeyInfo{stored}, ConflictSkip)
+	require.NoError(t, err)
+	assert.Equal(t, BatchResult{Inserted: 1}, result)
+
+	batch := func() []*models.KeyInfo {
+		return []*models.KeyInfo{
+			{Fingerprint: "00000000fingerprint1", PublicKey: "new", Score: 20, RunID: 2},
+			{Fingerprint: "00000000fingerprint2", PublicKey: "first", Score: 30, RunID: 2},
+			{Fingerprint: "00000000fingerprint2", PublicKey: "second", Score: 40, RunID: 2},
+		}
+	}
+	publicKey := func(fingerprint string) string {
+		var key models.KeyInfo
+		require.NoError(t, db.Where("fingerprint = ?", fingerprint).First(&key).Error)
+		return key.PublicKey
+	}
+
+	_, err = repo.BatchCreate(batch(), ConflictFail)
+	require.Error(t, err)
+	var count int64
+	require.NoError(t, db.Model(&models.KeyInfo{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count, "a failed batch writes nothing")
+
+	result, err = repo.BatchCreate(batch(), ConflictSkip)
+	require.NoError(t, err)
+	assert.Equal(t, BatchResult{Inserted: 1, Skipped: 2}, result)
+	assert.Equal(t, "stored", publicKey("00000000fingerprint1"))
+	assert.Equal(t, "first", publicKey("00000000fingerprint2"))
+
+	result, err = repo.BatchCreate(batch(), ConflictUpdate)
+	require.NoError(t, err)
+	assert.Equal(t, BatchResult{Updated: 2, Skipped: 1}, result)
+	assert.Equal(t, "new", publicKey("00000000fingerprint1"))
+	assert.Equal(t, "second", publicKey("00000000fingerprint2"))
+	require.NoError(t, db.Model(&models.KeyInfo{}).Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+
+	_, err = repo.BatchCreate(batch(), ConflictPolicy("merge"))
+	assert.ErrorContains(t, err, "unknown conflict policy")
+}
+
+func TestRankedOnlyFilterAndDeleteByFingerprints(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewKeyRepository(db)
+
+	keys := []*models.KeyInfo{
+		{Fingerprint: "00000000fingerprint1", Score: 300, IsVanity: true},
+		{Fingerprint: "00000000fingerprint2", Score: 200, MatchedPattern: "...C0FFEE"},
+		{Fingerprint: "00000000fingerprint3", Score: 100},
+		{Fingerprint: "00000000fingerprint4", Score: 50},
+	}
+	_, err := repo.BatchCreate(keys, ConflictFail)
+	require.NoError(t, err)
+
+	ranked, err := repo.GetTopKeys(10, KeyFilter{RankedOnly: true})
+	require.NoError(t, err)
+	require.Len(t, ranked, 2)
+	assert.Equal(t, "00000000fingerprint3", ranked[0].Fingerprint)
+
+	deleted, err := repo.DeleteByFingerprints([]string{"00000000fingerprint3", "missing"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	var count int64
+	require.NoError(t, db.Unscoped().Model(&models.KeyInfo{}).Count(&count).Error)
+	assert.Equal(t, int64(3), count, "evicted keys are removed, not soft-deleted")
+}
+
+func TestKeyFilterSplitsByAlgorithm(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewKeyRepository(db)
+
+	keys := []*models.KeyInfo{
+		{Fingerprint: "00000000fingerprint1", FingerprintSuffix: "0000fingerprint1", Score: 300, Algorithm: "ed25519"},
+		{Fingerprint: "00000000fingerprint2", FingerprintSuffix: "0000fingerprint2", Score: 100, Algorithm: "rsa3072"},
+		{Fingerprint: "00000000fingerprint3", FingerprintSuffix: "0000fingerprint3", Score: 200, Algorithm: "rsa4096"},
+	}
+	_, err := repo.BatchCreate(keys, ConflictFail)
+	require.NoError(t, err)
+
+	rsa, err := repo.GetTopKeys(10, KeyFilter{Algorithm: "RSA"})
+	require.NoError(t, err)
+	require.Len(t, rsa, 2)
+	assert.Equal(t, "rsa4096", rsa[0].Algorithm)
+
+	exact, err := repo.GetTopKeys(10, KeyFilter{Algorithm: "rsa3072"})
+	require.NoError(t, err)
+	require.Len(t, exact, 1)
+	assert.Equal(t, "00000000fingerprint2", exact[0].Fingerprint)
+
+	stats, err := repo.GetAnalysisStats(KeyFilter{})
+	require.NoError(t, err)
+	require.Len(t, stats.Algorithms, 3)
+	assert.Equal(t, "ed25519", stats.Algorithms[0].Algorithm)
+	assert.Equal(t, int64(1), stats.Algorithms[0].Count)
+	assert.InDelta(t, 300.0, stats.Algorithms[0].MaxScore, 0.001)
+}
+
+func TestKeyFilterSeparatesScoreWindows(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewKeyRepository(db)
+
+	keys := []*models.KeyInfo{
+		// Rows stored before score_window existed were scored over the long window.
+		{Fingerprint: "00000000fingerprint1", Score: 300},
+		{Fingerprint: "00000000fingerprint2", Score: 200, ScoreWindow: "long"},
+		{Fingerprint: "00000000fingerprint3", Score: 900, ScoreWindow: "full"},
+	}
+	_, err := repo.BatchCreate(keys, ConflictFail)
+	require.NoError(t, err)
+
+	long, err := repo.GetTopKeys(10, KeyFilter{ScoreWindow: "long"})
+	require.NoError(t, err)
+	require.Len(t, long, 2)
+	assert.Equal(t, "long", long[0].ScoreWindow)
+
+	full, err := repo.GetTopKeys(10, KeyFilter{ScoreWindow: "full"})
+	require.NoError(t, err)
+	require.Len(t, full, 1)
+	assert.Equal(t, 900, full[0].Score)
+
+	stats, err := repo.GetAnalysisStats(KeyFilter{ScoreWindow: "long"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Score.Count)
+
+	assert.True(t, KeyFilter{ScoreWindow: "long"}.matches(&models.KeyInfo{}))
+	assert.False(t, KeyFilter{ScoreWindow: "short"}.matches(&models.KeyInfo{ScoreWindow: "long"}))
+}
+
+func TestKeyFilterRestrictsQueriesToRun(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewKeyRepository(db)
+
+	keys := []*models.KeyInfo{
+		{Fingerprint: "00000000fingerprint1", FingerprintSuffix: "0000fingerprint1", Score: 300, UniqueLettersCount: 4, RunID: 1},
+		{Fingerprint: "00000000fingerprint2", FingerprintSuffix: "0000fingerprint2", Score: 100, UniqueLettersCount: 9, RunID: 2},
+		{Fingerprint: "00000000fingerprint3", FingerprintSuffix: "0000fingerprint3", Score: 200, UniqueLettersCount: 6, RunID: 2},
+	}
+	_, err := repo.BatchCreate(keys, ConflictFail)
+	require.NoError(t, err)
+
+	topKeys, err := repo.GetTopKeys(10, KeyFilter{RunID: 2})
+	require.NoError(t, err)
+	require.Len(t, topKeys, 2)
+	assert.Equal(t, "00000000fingerprint3", topKeys[0].Fingerprint)
+
+	minimal, err := repo.GetLowLetterCountKeys(10, KeyFilter{RunID: 1})
+	require.NoError(t, err)
+	require.Len(t, minimal, 1)
+	assert.Equal(t, "00000000fingerprint1", minimal[0].Fingerprint)
+
+	stats, err := repo.GetAnalysisStats(KeyFilter{RunID: 2})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Score.Count)
+	assert.InDelta(t, 150.0, stats.Score.Average, 0.001)
+}
+
+func TestRunRepositoryLifecycle(t *testing.T) {
+	db := setupTestDB(t)
+	runs := NewRunRepository(db)
+
+	run := &models.GenerationRun{Status: models.RunStatusRunning, TargetKeys: 100}
+	require.NoError(t, runs.CreateRun(run))
+	require.NotZero(t, run.ID)
+
+	require.NoError(t, runs.UpdateRunProgress(run.ID, 40, 4, 3))
+	require.NoError(t, runs.FinishRun(run.ID, models.RunStatusCanceled, context.Canceled))
+
+	got, err := runs.GetRun(run.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.RunStatusCanceled, got.Status)
+	assert.Equal(t, uint64(40), got.Generated)
+	assert.Equal(t, 60, got.Remaining())
+	assert.Equal(t, context.Canceled.Error(), got.LastError)
+	require.NotNil(t, got.FinishedAt)
+
+	require.NoError(t, runs.ReopenRun(run.ID))
+	got, err = runs.GetRun(run.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.RunStatusRunning, got.Status)
+	assert.Nil(t, got.FinishedAt)
+	assert.Empty(t, got.LastError)
+
+	listed, err := runs.ListRuns(10)
+	require.NoError(t, err)
+	assert.Len(t, listed, 1)
+}
+
+func TestRescoreUpdatesOnlyScoreColumns(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewKeyRepository(db)
+	keys := []*models.KeyInfo{
+		{Fingerprint: "00000000fingerprint1", FingerprintSuffix: "0000fingerprint1", PublicKey: "public", Score: 1, RunID: 1},
+		{Fingerprint: "00000000fingerprint2", FingerprintSuffix: "0000fingerprint2", Score: 2, RunID: 1},
+		{Fingerprint: "00000000fingerprint3", FingerprintSuffix: "0000fingerprint3", Score: 3, RunID: 2},
+	}
+	_, err := repo.BatchCreate(keys, ConflictFail)
+	require.NoError(t, err)
+
+	updated, err := repo.Rescore(KeyFilter{RunID: 1}, 1, func(key *models.KeyInfo) error {
+		key.Score = 100
+		key.RepeatLetterScore = 100
+		key.ScoreStrategy = "test"
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), updated)
+
+	got, err := repo.GetByFingerprint("0000fingerprint1")
+	require.NoError(t, err)
+	assert.Equal(t, 100, got.Score)
+	assert.Equal(t, 100, got.RepeatLetterScore)
+	assert.Equal(t, "test", got.ScoreStrategy)
+	assert.Equal(t, "public", got.PublicKey)
+
+	untouched, err := repo.GetByFingerprint("0000fingerprint3")
+	require.NoError(t, err)
+	assert.Equal(t, 3, untouched.Score)
 }
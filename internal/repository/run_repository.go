@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/iyuangang/gpgenie/models"
+
+	"gorm.io/gorm"
+)
+
+// RunRepository persists the generate run ledger.
+type RunRepository interface {
+	CreateRun(run *models.GenerationRun) error
+	GetRun(id uint) (*models.GenerationRun, error)
+	ListRuns(limit int) ([]models.GenerationRun, error)
+	ReopenRun(id uint) error
+	UpdateRunProgress(id uint, generated, accepted, saved uint64) error
+	FinishRun(id uint, status string, runErr error) error
+}
+
+type runRepository struct {
+	db *gorm.DB
+}
+
+// NewRunRepository creates a RunRepository backed by the key database.
+func NewRunRepository(db *gorm.DB) RunRepository {
+	return &runRepository{db: db}
+}
+
+func (r *runRepository) CreateRun(run *models.GenerationRun) error {
+	if run == nil {
+		return errors.New("run is nil")
+	}
+	return r.db.Create(run).Error
+}
+
+func (r *runRepository) GetRun(id uint) (*models.GenerationRun, error) {
+	var run models.GenerationRun
+	if err := r.db.First(&run, id).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (r *runRepository) ListRuns(limit int) ([]models.GenerationRun, error) {
+	var runs []models.GenerationRun
+	err := r.db.Order("id DESC").Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+// ReopenRun marks an unfinished run as running again for --resume.
+func (r *runRepository) ReopenRun(id uint) error {
+	return r.db.Model(&models.GenerationRun{}).Where("id = ?", id).Updates(map[string]any{
+		"status":      models.RunStatusRunning,
+		"finished_at": nil,
+		"last_error":  "",
+	}).Error
+}
+
+func (r *runRepository) UpdateRunProgress(id uint, generated, accepted, saved uint64) error {
+	return r.db.Model(&models.GenerationRun{}).Where("id = ?", id).Updates(map[string]any{
+		"generated": generated,
+		"accepted":  accepted,
+		"saved":     saved,
+	}).Error
+}
+
+func (r *runRepository) FinishRun(id uint, status string, runErr error) error {
+	lastError := ""
+	if runErr != nil {
+		lastError = runErr.Error()
+	}
+	finishedAt := time.Now().UTC()
+	return r.db.Model(&models.GenerationRun{}).Where("id = ?", id).Updates(map[string]any{
+		"status":      status,
+		"finished_at": &finishedAt,
+		"last_error":  lastError,
+	}).Error
+}
+
+// memoryRunRepository keeps the run ledger in memory for file sinks, which
+// have no table to record runs in. Runs cannot be resumed across processes.
+type memoryRunRepository struct {
+	mu     sync.Mutex
+	nextID uint
+	runs   map[uint]*models.GenerationRun
+}
+
+// NewMemoryRunRepository creates an in-memory RunRepository whose run IDs
+// start at firstID.
+func NewMemoryRunRepository(firstID uint) RunRepository {
+	return &memoryRunRepository{nextID: max(firstID, 1), runs: make(map[uint]*models.GenerationRun)}
+}
+
+func (r *memoryRunRepository) CreateRun(run *models.GenerationRun) error {
+	if run == nil {
+		return errors.New("run is nil")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run.ID = r.nextID
+	r.nextID++
+	stored := *run
+	r.runs[run.ID] = &stored
+	return nil
+}
+
+func (r *memoryRunRepository) GetRun(id uint) (*models.GenerationRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run, ok := r.runs[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *run
+	return &copied, nil
+}
+
+func (r *memoryRunRepository) ListRuns(limit int) ([]models.GenerationRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runs := make([]models.GenerationRun, 0, len(r.runs))
+	for _, run := range r.runs {
+		runs = append(runs, *run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].ID > runs[j].ID })
+	return runs[:min(limit, len(runs))], nil
+}
+
+func (r *memoryRunRepository) ReopenRun(id uint) error {
+	return r.update(id, func(run *models.GenerationRun) {
+		run.Status = models.RunStatusRunning
+		run.FinishedAt = nil
+		run.LastError = ""
+	})
+}
+
+func (r *memoryRunRepository) UpdateRunProgress(id uint, generated, accepted, saved uint64) error {
+	return r.update(id, func(run *models.GenerationRun) {
+		run.Generated, run.Accepted, run.Saved = generated, accepted, saved
+	})
+}
+
+func (r *memoryRunRepository) FinishRun(id uint, status string, runErr error) error {
+	finishedAt := time.Now().UTC()
+	return r.update(id, func(run *models.GenerationRun) {
+		run.Status = status
+		run.FinishedAt = &finishedAt
+		run.LastError = ""
+		if runErr != nil {
+			run.LastError = runErr.Error()
+		}
+	})
+}
+
+func (r *memoryRunRepository) update(id uint, apply func(*models.GenerationRun)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run, ok := r.runs[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	apply(run)
+	return nil
+}
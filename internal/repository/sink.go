@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sink kinds accepted by ParseSink.
+const (
+	SinkDatabase = "db"
+	SinkJSONL    = "jsonl"
+	SinkArmor    = "armor"
+)
+
+// ErrSinkWriteOnly is returned by queries against a sink that only stores
+// keys, such as the armor directory.
+var ErrSinkWriteOnly = errors.New("sink cannot be queried")
+
+// SinkSpec selects where keys are stored: the configured database, an
+// append-only JSONL file, or a directory of armored key pairs.
+type SinkSpec struct {
+	Kind     string
+	Location string
+}
+
+// ParseSink parses "db", "jsonl:<file>", or "armor:<directory>". An empty
+// spec selects the database.
+func ParseSink(spec string) (SinkSpec, error) {
+	kind, location, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	kind = strings.ToLower(kind)
+	switch kind {
+	case "", SinkDatabase:
+		if location != "" {
+			return SinkSpec{}, fmt.Errorf("sink %q takes no location", SinkDatabase)
+		}
+		return SinkSpec{Kind: SinkDatabase}, nil
+	case SinkJSONL, SinkArmor:
+		if location == "" {
+			return SinkSpec{}, fmt.Errorf("sink %q needs a location, e.g. %s:<path>", kind, kind)
+		}
+		return SinkSpec{Kind: kind, Location: location}, nil
+	default:
+		return SinkSpec{}, fmt.Errorf("unknown sink %q; use db, jsonl:<file>, or armor:<directory>", spec)
+	}
+}
+
+// IsDatabase reports whether the spec selects the database.
+func (s SinkSpec) IsDatabase() bool { return s.Kind == SinkDatabase }
+
+// FileSink is a KeyRepository stored outside the database. Close flushes and
+// releases the underlying files.
+type FileSink interface {
+	KeyRepository
+	Close() error
+	// NextRunID is the first run ID that is not yet used by stored keys.
+	NextRunID() uint
+}
+
+// OpenFileSink opens the JSONL or armor sink described by spec.
+func OpenFileSink(spec SinkSpec) (FileSink, error) {
+	switch spec.Kind {
+	case SinkJSONL:
+		return OpenJSONLRepository(spec.Location)
+	case SinkArmor:
+		return NewArmorSink(spec.Location)
+	default:
+		return nil, fmt.Errorf("sink %q is not a file sink", spec.Kind)
+	}
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/iyuangang/gpgenie/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSink(t *testing.T) {
+	for spec, want := range map[string]SinkSpec{
+		"":                 {Kind: SinkDatabase},
+		"db":               {Kind: SinkDatabase},
+		"jsonl:keys.jsonl": {Kind: SinkJSONL, Location: "keys.jsonl"},
+		"ARMOR:/tmp/keys":  {Kind: SinkArmor, Location: "/tmp/keys"},
+	} {
+		got, err := ParseSink(spec)
+		require.NoError(t, err, spec)
+		assert.Equal(t, want, got, spec)
+	}
+	for _, spec := range []string{"jsonl", "armor:", "db:x", "s3:bucket"} {
+		_, err := ParseSink(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestJSONLRepositoryReplaysAppendedRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.jsonl")
+	sink, err := OpenJSONLRepository(path)
+	require.NoError(t, err)
+
+	result, err := sink.BatchCreate([]*models.KeyInfo{
+		{Fingerprint: "00000000fingerprint1", FingerprintSuffix: "0000fingerprint1", Score: 100, UniqueLettersCount: 10, RunID: 3},
+		{Fingerprint: "00000000fingerprint2", FingerprintSuffix: "0000fingerprint2", Score: 200, UniqueLettersCount: 8, RunID: 3},
+		{Fingerprint: "00000000fingerprint3", FingerprintSuffix: "0000fingerprint3", Score: 150, UniqueLettersCount: 12, RunID: 4, Algorithm: "rsa3072"},
+	}, ConflictSkip)
+	require.NoError(t, err)
+	assert.Equal(t, BatchResult{Inserted: 3}, result)
+
+	result, err = sink.BatchCreate([]*models.KeyInfo{
+		{Fingerprint: "00000000fingerprint1", Score: 300, RunID: 4},
+	}, ConflictSkip)
+	require.NoError(t, err)
+	assert.Equal(t, BatchResult{Skipped: 1}, result)
+	result, err = sink.BatchCreate([]*models.KeyInfo{
+		{Fingerprint: "00000000fingerprint1", FingerprintSuffix: "0000fingerprint1", Score: 300, UniqueLettersCount: 10, RunID: 4},
+	}, ConflictUpdate)
+	require.NoError(t, err)
+	assert.Equal(t, BatchResult{Updated: 1}, result)
+	_, err = sink.BatchCreate([]*models.KeyInfo{{Fingerprint: "00000000fingerprint2"}}, ConflictFail)
+	assert.Error(t, err)
+
+	deleted, err := sink.DeleteByFingerprints([]string{"00000000fingerprint2", "missing"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	require.NoError(t, sink.Close())
+
+	reopened, err := OpenJSONLRepository(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, reopened.Close()) })
+	assert.Equal(t, uint(5), reopened.NextRunID())
+
+	top, err := reopened.GetTopKeys(10, KeyFilter{})
+	require.NoError(t, err)
+	require.Len(t, top, 2)
+	assert.Equal(t, "00000000fingerprint1", top[0].Fingerprint)
+	assert.Equal(t, 300, top[0].Score)
+	assert.Equal(t, "ed25519", top[0].Algorithm)
+	assert.Equal(t, uint(1), top[0].ID, "an update keeps the key's ID")
+
+	rsa, err := reopened.GetTopKeys(10, KeyFilter{Algorithm: "rsa"})
+	require.NoError(t, err)
+	require.Len(t, rsa, 1)
+	assert.Equal(t, "00000000fingerprint3", rsa[0].Fingerprint)
+
+	found, err := reopened.GetByFingerprint("0000FINGERPRINT3")
+	require.NoError(t, err)
+	assert.Equal(t, 150, found.Score)
+
+	stats, err := reopened.GetAnalysisStats(KeyFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Score.Count)
+	assert.InDelta(t, 225.0, stats.Score.Average, 0.001)
+	assert.Equal(t, 150.0, stats.Score.Min)
+	require.Len(t, stats.Algorithms, 2)
+	assert.Equal(t, "ed25519", stats.Algorithms[0].Algorithm)
+}
+
+func TestArmorSinkWritesKeyPairs(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keys")
+	sink, err := NewArmorSink(dir)
+	require.NoError(t, err)
+
+	key := &models.KeyInfo{Fingerprint: "ABCDEF0123", PublicKey: "public", PrivateKey: "private"}
+	result, err := sink.BatchCreate([]*models.KeyInfo{key, key}, ConflictSkip)
+	require.NoError(t, err)
+	assert.Equal(t, BatchResult{Inserted: 1, Skipped: 1}, result)
+	assert.FileExists(t, filepath.Join(dir, "abcdef0123-public.asc"))
+	assert.FileExists(t, filepath.Join(dir, "abcdef0123-private.asc.pgp"))
+
+	_, err = sink.GetTopKeys(1, KeyFilter{})
+	assert.ErrorIs(t, err, ErrSinkWriteOnly)
+
+	deleted, err := sink.DeleteByFingerprints([]string{key.Fingerprint})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	assert.NoFileExists(t, filepath.Join(dir, "abcdef0123-public.asc"))
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Generation run states recorded in the run ledger.
+const (
+	RunStatusRunning   = "running"
+	RunStatusCompleted = "completed"
+	RunStatusFailed    = "failed"
+	RunStatusCanceled  = "canceled"
+	// RunStatusStopped marks a run that ended at its time limit before
+	// reaching the target. Like a canceled run it can be resumed.
+	RunStatusStopped = "stopped"
+)
+
+// GenerationRun records one generate invocation. Counters are cumulative
+// across resumed invocations so a run always describes its whole target.
+type GenerationRun struct {
+	gorm.Model
+	Status         string `gorm:"size:16;index"`
+	Profile        string `gorm:"size:64"`
+	ConfigSnapshot string `gorm:"type:text"`
+	TargetKeys     int
+	Generated      uint64
+	Accepted       uint64
+	Saved          uint64
+	StartedAt      time.Time
+	FinishedAt     *time.Time
+	LastError      string `gorm:"type:text"`
+}
+
+// Remaining returns the number of candidates still needed to reach the target.
+func (r *GenerationRun) Remaining() int {
+	if r.Generated >= uint64(r.TargetKeys) {
+		return 0
+	}
+	return r.TargetKeys - int(r.Generated)
+}
@@ -13,12 +13,22 @@ type KeyInfo struct {
 	IncreasingLetterScore int
 	DecreasingLetterScore int
 	MagicLetterScore      int
-	Score                 int  `gorm:"index:idx_score_unique,priority:1,sort:desc;index:idx_unique_score,priority:2,sort:desc"`
-	UniqueLettersCount    int  `gorm:"index:idx_score_unique,priority:2,sort:asc;index:idx_unique_score,priority:1,sort:asc"`
-	IsVanity              bool `gorm:"index"`
-	VanityRunLength       int  `gorm:"index"`
+	PalindromeScore       int
+	RepeatingBlockScore   int
+	AlternatingScore      int
+	Score                 int     `gorm:"index:idx_score_unique,priority:1,sort:desc;index:idx_unique_score,priority:2,sort:desc"`
+	UniqueLettersCount    int     `gorm:"index:idx_score_unique,priority:2,sort:asc;index:idx_unique_score,priority:1,sort:asc"`
+	Rarity                float64 `gorm:"index;default:0"`
+	ScoreStrategy         string  `gorm:"size:32"`
+	ScoreWindow           string  `gorm:"size:16;index;default:long"`
+	Algorithm             string  `gorm:"size:32;index;default:ed25519"`
+	KeyVersion            int     `gorm:"default:4"`
+	MatchedPattern        string  `gorm:"type:text;index"`
+	IsVanity              bool    `gorm:"index"`
+	VanityRunLength       int     `gorm:"index"`
 	VanityRunStart        int
 	VanityDigit           string `gorm:"size:1"`
 	VanityScope           string `gorm:"size:8"`
 	VanityTargetDigits    string `gorm:"size:16"`
+	RunID                 uint   `gorm:"index"`
 }
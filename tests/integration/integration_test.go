@@ -9,6 +9,9 @@ import (
 	"testing"
 
 	"github.com/iyuangang/gpgenie/internal/app"
+	"github.com/iyuangang/gpgenie/internal/key/service"
+	"github.com/iyuangang/gpgenie/internal/repository"
+	"github.com/iyuangang/gpgenie/models"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/ProtonMail/go-crypto/openpgp/armor"
@@ -22,20 +25,102 @@ func TestIntegration(t *testing.T) {
 	}
 
 	tempDir := t.TempDir()
+	configPath := writeTestConfig(t, tempDir, map[string]any{
+		"type":              "sqlite",
+		"dbname":            filepath.Join(tempDir, "gpgenie.db"),
+		"max_open_conns":    1,
+		"max_idle_conns":    1,
+		"conn_max_lifetime": 300,
+		"log_level":         "warn",
+	})
+
+	application, err := app.NewApp(configPath)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, application.Close()) })
+
+	summary, err := application.KeyService.GenerateKeys(context.Background(), service.GenerateOptions{})
+	require.NoError(t, err)
+
+	keys, err := application.Repository.GetTopKeys(10, repository.KeyFilter{})
+	require.NoError(t, err)
+	assert.Len(t, keys, 5)
+
+	runKeys, err := application.Repository.GetTopKeys(10, repository.KeyFilter{RunID: summary.RunID})
+	require.NoError(t, err)
+	assert.Len(t, runKeys, 5)
+
+	run, err := application.Runs.GetRun(summary.RunID)
+	require.NoError(t, err)
+	assert.Equal(t, models.RunStatusCompleted, run.Status)
+	assert.Equal(t, uint64(5), run.Saved)
+
+	require.NoError(t, application.KeyService.ShowTopKeys(5, repository.KeyFilter{}))
+	require.NoError(t, application.KeyService.ShowRuns(5))
+	require.NoError(t, application.KeyService.AnalyzeData(repository.KeyFilter{RunID: summary.RunID}, 5))
+}
+
+func TestIntegrationFileSinks(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	tempDir := t.TempDir()
+	// The database is unreachable: file sinks must not connect to it.
+	configPath := writeTestConfig(t, tempDir, map[string]any{
+		"type": "postgres", "host": "gpgenie.invalid", "port": 5432, "dbname": "gpgenie",
+	})
+	sinkPath := filepath.Join(tempDir, "keys.jsonl")
+
+	application, err := app.NewAppWithSink(configPath, "jsonl:"+sinkPath)
+	require.NoError(t, err)
+	first, err := application.KeyService.GenerateKeys(context.Background(), service.GenerateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, application.Close())
+
+	application, err = app.NewAppWithSink(configPath, "jsonl:"+sinkPath)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, application.Close()) })
+	second, err := application.KeyService.GenerateKeys(context.Background(), service.GenerateOptions{})
+	require.NoError(t, err)
+	assert.Greater(t, second.RunID, first.RunID, "run IDs continue from the keys in the file")
+
+	keys, err := application.Repository.GetTopKeys(20, repository.KeyFilter{})
+	require.NoError(t, err)
+	assert.Len(t, keys, 10)
+	runKeys, err := application.Repository.GetTopKeys(20, repository.KeyFilter{RunID: first.RunID})
+	require.NoError(t, err)
+	assert.Len(t, runKeys, 5)
+
+	exportDir := filepath.Join(tempDir, "exported")
+	require.NoError(t, application.KeyService.ExportKeyByFingerprint(keys[0].Fingerprint[24:], exportDir, true))
+	assert.FileExists(t, filepath.Join(exportDir, keys[0].Fingerprint+"_pub.key"))
+	require.NoError(t, application.KeyService.AnalyzeData(repository.KeyFilter{}, 5))
+
+	armorDir := filepath.Join(tempDir, "armored")
+	armored, err := app.NewAppWithSink(configPath, "armor:"+armorDir)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, armored.Close()) })
+	_, err = armored.KeyService.GenerateKeys(context.Background(), service.GenerateOptions{})
+	require.NoError(t, err)
+	publicKeys, err := filepath.Glob(filepath.Join(armorDir, "*-public.asc"))
+	require.NoError(t, err)
+	assert.Len(t, publicKeys, 5)
+	privateKeys, err := filepath.Glob(filepath.Join(armorDir, "*-private.asc.pgp"))
+	require.NoError(t, err)
+	assert.Len(t, privateKeys, 5)
+}
+
+// writeTestConfig writes a config that generates five keys into the given
+// database and returns its path.
+func writeTestConfig(t *testing.T, tempDir string, database map[string]any) string {
+	t.Helper()
 	publicKeyPath := filepath.Join(tempDir, "encryptor_public_key.asc")
 	writeTestPublicKey(t, publicKeyPath)
 
 	configPath := filepath.Join(tempDir, "config.json")
 	configData, err := json.Marshal(map[string]any{
 		"environment": "test",
-		"database": map[string]any{
-			"type":              "sqlite",
-			"dbname":            filepath.Join(tempDir, "gpgenie.db"),
-			"max_open_conns":    1,
-			"max_idle_conns":    1,
-			"conn_max_lifetime": 300,
-			"log_level":         "warn",
-		},
+		"database":    database,
 		"key_generation": map[string]any{
 			"num_generator_workers": 2,
 			"num_scorer_workers":    2,
@@ -55,20 +140,7 @@ func TestIntegration(t *testing.T) {
 	})
 	require.NoError(t, err)
 	require.NoError(t, os.WriteFile(configPath, configData, 0o600))
-
-	application, err := app.NewApp(configPath)
-	require.NoError(t, err)
-	t.Cleanup(func() { require.NoError(t, application.Close()) })
-
-	err = application.KeyService.GenerateKeys(context.Background())
-	require.NoError(t, err)
-
-	keys, err := application.Repository.GetTopKeys(10)
-	require.NoError(t, err)
-	assert.Len(t, keys, 5)
-
-	require.NoError(t, application.KeyService.ShowTopKeys(5))
-	require.NoError(t, application.KeyService.AnalyzeData())
+	return configPath
 }
 
 func writeTestPublicKey(t *testing.T, path string) {